@@ -2,7 +2,9 @@
 
 BINARY_FOLDER=$1
 
-for shader in $(ls src/shaders)
+cp src/shaders/shaders.json $BINARY_FOLDER/
+
+for shader in $(ls src/shaders | grep -v "\.json$")
 do
     glslangValidator -s -V src/shaders/$shader -o $BINARY_FOLDER/$shader.spv -e main --source-entrypoint main
 done
\ No newline at end of file
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -20,6 +21,7 @@ import (
 	"unsafe"
 
 	"github.com/devblok/koru/src/core"
+	"github.com/devblok/koru/src/gfx"
 	glm "github.com/go-gl/mathgl/mgl32"
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -31,7 +33,7 @@ func init() {
 // Essential globals
 var (
 	vkInstance core.Instance
-	vkRenderer core.Renderer
+	renderer   core.Renderer
 	sdlWindow  *sdl.Window
 	sdlSurface unsafe.Pointer
 
@@ -44,6 +46,8 @@ var (
 	memProfile   = flag.String("memprof", "", "Profile memory usage into a file")
 	traceProfile = flag.String("trace", "", "Trace output for profiling")
 	debug        = flag.Bool("vkdbg", false, "Load Vulkan validation layers")
+	hotReload    = flag.Bool("hotreload", false, "Reload assets and shaders when they change")
+	headless     = flag.Bool("headless", false, "Run without a window or a GPU, drawing nothing")
 )
 
 var configuration = core.Configuration{
@@ -59,6 +63,7 @@ var configuration = core.Configuration{
 			"VK_KHR_swapchain",
 		},
 		ShaderDirectory: "./shaders",
+		AssetPaths:      []string{"."},
 	},
 }
 
@@ -77,40 +82,16 @@ func newWindow() *sdl.Window {
 	return window
 }
 
-func main() {
-	flag.Parse()
-
-	if *cpuProfile != "" {
-		f, err := os.Create(*cpuProfile)
-		if err != nil {
-			panic(err)
-		}
-		if err := pprof.StartCPUProfile(f); err != nil {
-			panic(err)
-		}
-		defer pprof.StopCPUProfile()
-	}
-
-	if *traceProfile != "" {
-		f, err := os.Create(*traceProfile)
-		if err != nil {
-			panic(err)
-		}
-		if err := trace.Start(f); err != nil {
-			panic(err)
-		}
-		defer trace.Stop()
-	}
-
+// setupVulkan creates the window and a Vulkan renderer for it,
+// the returned function tears down what the renderer was made with
+func setupVulkan() func() {
 	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_EVENTS); err != nil {
 		panic(err)
 	}
-	defer sdl.Quit()
 
 	if err := sdl.VulkanLoadLibrary(""); err != nil {
 		panic(err)
 	}
-	defer sdl.VulkanUnloadLibrary()
 
 	{
 		cfg := core.InstanceConfiguration{
@@ -124,7 +105,6 @@ func main() {
 		} else {
 			vkInstance = vi
 		}
-		defer vkInstance.Destroy()
 	}
 
 	sdlWindow = newWindow()
@@ -136,23 +116,67 @@ func main() {
 	}
 
 	var rendererErr error
-	vkRenderer, rendererErr = core.NewVulkanRenderer(vkInstance, configuration.Renderer)
+	renderer, rendererErr = core.NewVulkanRenderer(vkInstance, configuration.Renderer)
 	if rendererErr != nil {
 		panic(rendererErr)
 	}
 
 	deviceUsed := vkInstance.AvailableDevices()[0]
-	if suitable, reason := vkRenderer.DeviceIsSuitable(deviceUsed); !suitable {
+	if suitable, reason := renderer.DeviceIsSuitable(deviceUsed); !suitable {
 		panic(reason)
 	}
 
-	if err := vkRenderer.Initialise(); err != nil {
+	return func() {
+		vkInstance.Destroy()
+		sdl.VulkanUnloadLibrary()
+		sdl.Quit()
+	}
+}
+
+func main() {
+	flag.Parse()
+	configuration.Renderer.HotReload = *hotReload
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			panic(err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			panic(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	if *traceProfile != "" {
+		f, err := os.Create(*traceProfile)
+		if err != nil {
+			panic(err)
+		}
+		if err := trace.Start(f); err != nil {
+			panic(err)
+		}
+		defer trace.Stop()
+	}
+
+	if *headless {
+		loader, err := gfx.OpenSearchPath(configuration.Renderer.AssetPaths...)
+		if err != nil {
+			panic(err)
+		}
+		defer loader.Close()
+		renderer = core.NewNullRenderer(loader)
+	} else {
+		defer setupVulkan()()
+	}
+
+	if err := renderer.Initialise(); err != nil {
 		panic(err)
 	}
-	defer vkRenderer.Destroy()
+	defer renderer.Destroy()
 
-	srh := vkRenderer.ResourceHandle()
-	crh := vkRenderer.ResourceHandle()
+	srh := renderer.ResourceHandle()
+	crh := renderer.ResourceHandle()
 
 	timeService := core.NewTime(configuration.Time)
 
@@ -189,14 +213,14 @@ func main() {
 				log.Println("Event loop exited")
 				break DrawLoop
 			case <-timeService.FpsTicker().C:
-				if _, ok := <-vkRenderer.ResourceUpdate(srh, core.ResourceInstance{
+				if _, ok := <-renderer.ResourceUpdate(srh, core.ResourceInstance{
 					ResourceID: "assets/suzanne.dae",
 					Position:   glm.Translate3D(0, 0, 0),
 					Rotation:   glm.HomogRotate3D(constant, glm.Vec3{0, 0, 1}),
 				}); !ok {
 					fmt.Printf("Error: not updated resource\n")
 				}
-				if _, ok := <-vkRenderer.ResourceUpdate(crh, core.ResourceInstance{
+				if _, ok := <-renderer.ResourceUpdate(crh, core.ResourceInstance{
 					ResourceID: "assets/cube.dae",
 					Position:   glm.Translate3D(0, 0, 0),
 					Rotation:   glm.HomogRotate3D(constant, glm.Vec3{0, 0, 1}),
@@ -204,10 +228,10 @@ func main() {
 					fmt.Printf("Error: not updated resource\n")
 				}
 				constant += 0.005
-				if err := vkRenderer.Draw(); err != nil {
+				if err := renderer.Draw(); err != nil {
 					log.Println("Draw error: " + err.Error())
 				}
-				if err := vkRenderer.Present(); err != nil {
+				if err := renderer.Present(); err != nil {
 					log.Println("Present error: " + err.Error())
 				}
 				atomic.AddInt64(&frameCounter, 1)
@@ -217,8 +241,15 @@ func main() {
 	}(ctx, &programSync)
 
 	/* Event loop */
+	if *headless {
+		// without a window, only an interrupt ends it
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		cancel()
+	}
 EventLoop:
-	for {
+	for !*headless {
 		select {
 		case <-ctx.Done():
 			break EventLoop
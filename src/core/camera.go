@@ -0,0 +1,254 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/devblok/koru/src/gfx/visibility"
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// ProjectionType is the way a camera projects the scene
+type ProjectionType int
+
+// Projections a Camera can use
+const (
+	PerspectiveProjection ProjectionType = iota
+	OrthographicProjection
+)
+
+// DefaultCameraName is the name of the camera renderers start with
+const DefaultCameraName = "main"
+
+// DefaultCamera is the camera renderers start with,
+// it looks at the origin from above with Z up
+var DefaultCamera = NewPerspectiveCamera(45, 0.1, 10).LookAt(
+	glm.Vec3{2, 2, 2},
+	glm.Vec3{0, 0, 0},
+	glm.Vec3{0, 0, 1},
+)
+
+// Viewport is the part of the surface a camera draws into,
+// in fractions of the surface size from the top left corner
+type Viewport struct {
+	X, Y          float32
+	Width, Height float32
+}
+
+// FullViewport covers the whole surface
+var FullViewport = Viewport{X: 0, Y: 0, Width: 1, Height: 1}
+
+// Rect returns the pixels of the viewport on a surface of the size
+func (vp Viewport) Rect(width, height uint32) image.Rectangle {
+	round := func(f float32, size uint32) int {
+		return int(math.Floor(float64(f)*float64(size) + 0.5))
+	}
+	return image.Rect(
+		round(vp.X, width), round(vp.Y, height),
+		round(vp.X+vp.Width, width), round(vp.Y+vp.Height, height),
+	)
+}
+
+// Camera is a point of view the scene is drawn from. It is a plain
+// value, change it and set it to the renderer with SetCamera.
+type Camera struct {
+	Projection ProjectionType
+
+	// FieldOfView is the vertical angle the perspective
+	// projection sees, in degrees
+	FieldOfView float32
+
+	// Height is the height of the box the orthographic
+	// projection sees, in world units
+	Height float32
+
+	// Near and Far are the distances of the clip planes,
+	// nothing closer or further away is drawn
+	Near, Far float32
+
+	// Transform places the camera in the world. Cameras
+	// look along -Z of their transform, with Y up
+	Transform glm.Mat4
+
+	Viewport Viewport
+}
+
+// NewPerspectiveCamera creates a camera at the origin with perspective
+// projection, fov is in degrees, it draws to the whole surface
+func NewPerspectiveCamera(fov, near, far float32) Camera {
+	return Camera{
+		Projection:  PerspectiveProjection,
+		FieldOfView: fov,
+		Near:        near,
+		Far:         far,
+		Transform:   glm.Ident4(),
+		Viewport:    FullViewport,
+	}
+}
+
+// NewOrthographicCamera creates a camera at the origin with orthographic
+// projection seeing height world units, it draws to the whole surface
+func NewOrthographicCamera(height, near, far float32) Camera {
+	return Camera{
+		Projection: OrthographicProjection,
+		Height:     height,
+		Near:       near,
+		Far:        far,
+		Transform:  glm.Ident4(),
+		Viewport:   FullViewport,
+	}
+}
+
+// LookAt returns the camera moved to eye, looking at center with up
+func (c Camera) LookAt(eye, center, up glm.Vec3) Camera {
+	c.Transform = glm.LookAtV(eye, center, up).Inv()
+	return c
+}
+
+// Validate checks that the camera can be drawn with
+func (c Camera) Validate() error {
+	switch c.Projection {
+	case PerspectiveProjection:
+		if c.FieldOfView <= 0 || c.FieldOfView >= 180 {
+			return fmt.Errorf("field of view %g is not between 0 and 180 degrees", c.FieldOfView)
+		}
+		if c.Near <= 0 {
+			return errors.New("perspective near plane must be further than 0")
+		}
+	case OrthographicProjection:
+		if c.Height <= 0 {
+			return errors.New("orthographic height must be more than 0")
+		}
+	default:
+		return fmt.Errorf("unknown projection %d", c.Projection)
+	}
+	if c.Far <= c.Near {
+		return errors.New("far plane must be further than the near one")
+	}
+
+	vp := c.Viewport
+	if vp.Width <= 0 || vp.Height <= 0 || vp.X < 0 || vp.Y < 0 || vp.X+vp.Width > 1 || vp.Y+vp.Height > 1 {
+		return fmt.Errorf("viewport %+v is not within the surface", vp)
+	}
+	return nil
+}
+
+// View returns the view matrix, the inverse of the transform
+func (c Camera) View() glm.Mat4 {
+	return c.Transform.Inv()
+}
+
+// vulkanClip converts OpenGL clip space into Vulkan's,
+// where Y points down and depth goes from 0 to w
+var vulkanClip = glm.Mat4{
+	1, 0, 0, 0,
+	0, -1, 0, 0,
+	0, 0, 0.5, 0,
+	0, 0, 0.5, 1,
+}
+
+// ProjectionMatrix returns the projection into Vulkan clip
+// space for a viewport with the aspect ratio of width by height
+func (c Camera) ProjectionMatrix(aspect float32) glm.Mat4 {
+	var projection glm.Mat4
+	switch c.Projection {
+	case OrthographicProjection:
+		halfHeight := c.Height / 2
+		halfWidth := halfHeight * aspect
+		projection = glm.Ortho(-halfWidth, halfWidth, -halfHeight, halfHeight, c.Near, c.Far)
+	default:
+		projection = glm.Perspective(glm.DegToRad(c.FieldOfView), aspect, c.Near, c.Far)
+	}
+	return vulkanClip.Mul4(projection)
+}
+
+// Uniform returns the view and projection the scene is
+// drawn with, on a surface of width by height pixels
+func (c Camera) Uniform(width, height uint32) model.Uniform {
+	rect := c.Viewport.Rect(width, height)
+	aspect := float32(1)
+	if rect.Dy() > 0 {
+		aspect = float32(rect.Dx()) / float32(rect.Dy())
+	}
+	return model.Uniform{
+		View:       c.View(),
+		Projection: c.ProjectionMatrix(aspect),
+	}
+}
+
+// cull returns the items the camera sees on a surface of width
+// by height pixels, in the order they should be drawn
+func (c Camera) cull(width, height uint32, items []visibility.Item) []visibility.Item {
+	ubo := c.Uniform(width, height)
+	view := visibility.NewView(ubo.View, ubo.Projection)
+	// a unit at a distance of one spans the y scale of the
+	// projection in clip space, which is half the viewport
+	view.LODScale = float32(math.Abs(float64(ubo.Projection.At(1, 1)))) * float32(c.Viewport.Rect(width, height).Dy()) / 2
+	return view.Cull(items)
+}
+
+// namedCamera is a camera set to a renderer
+type namedCamera struct {
+	name string
+	Camera
+}
+
+// cameraSet keeps the cameras of a renderer, safe to use concurrently
+type cameraSet struct {
+	lock    sync.RWMutex
+	cameras map[string]Camera
+}
+
+// newCameraSet creates a set with the default camera
+func newCameraSet() *cameraSet {
+	return &cameraSet{
+		cameras: map[string]Camera{DefaultCameraName: DefaultCamera},
+	}
+}
+
+// set adds or replaces the camera, if it is valid and at most
+// limit cameras are set afterwards. No limit if it's 0
+func (s *cameraSet) set(name string, camera Camera, limit int) error {
+	if err := camera.Validate(); err != nil {
+		return fmt.Errorf("camera %s: %s", name, err.Error())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.cameras[name]; !ok && limit > 0 && len(s.cameras) >= limit {
+		return fmt.Errorf("camera %s: no more than %d cameras can be set", name, limit)
+	}
+	s.cameras[name] = camera
+	return nil
+}
+
+func (s *cameraSet) remove(name string) {
+	s.lock.Lock()
+	delete(s.cameras, name)
+	s.lock.Unlock()
+}
+
+// sorted returns the cameras ordered by name, the order they're drawn in
+func (s *cameraSet) sorted() []namedCamera {
+	s.lock.RLock()
+	cameras := make([]namedCamera, 0, len(s.cameras))
+	for name, camera := range s.cameras {
+		cameras = append(cameras, namedCamera{name: name, Camera: camera})
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(cameras, func(i, j int) bool {
+		return cameras[i].name < cameras[j].name
+	})
+	return cameras
+}
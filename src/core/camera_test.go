@@ -0,0 +1,141 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// project returns the normalized device coordinates of the point
+func project(camera core.Camera, width, height uint32, point glm.Vec3) glm.Vec3 {
+	ubo := camera.Uniform(width, height)
+	clip := ubo.Projection.Mul4(ubo.View).Mul4x1(point.Vec4(1))
+	return clip.Vec3().Mul(1 / clip[3])
+}
+
+func TestCameraPerspective(t *testing.T) {
+	camera := core.NewPerspectiveCamera(90, 1, 10).LookAt(
+		glm.Vec3{0, 0, 5},
+		glm.Vec3{0, 0, 0},
+		glm.Vec3{0, 1, 0},
+	)
+
+	for _, c := range []struct {
+		point, ndc glm.Vec3
+	}{
+		{glm.Vec3{0, 0, 4}, glm.Vec3{0, 0, 0}},
+		{glm.Vec3{0, 0, -5}, glm.Vec3{0, 0, 1}},
+		// with 90 degrees, the top is as far up as it's away, Y points down
+		{glm.Vec3{0, 2, 3}, glm.Vec3{0, -1, 5.0 / 9}},
+		// four times as wide as high
+		{glm.Vec3{2, 0, 4}, glm.Vec3{0.5, 0, 0}},
+	} {
+		if ndc := project(camera, 200, 50, c.point); !ndc.ApproxEqualThreshold(c.ndc, 1e-5) {
+			t.Errorf("%v: expected %v, got %v", c.point, c.ndc, ndc)
+		}
+	}
+}
+
+func TestCameraOrthographic(t *testing.T) {
+	camera := core.NewOrthographicCamera(4, 0, 10)
+	camera.Transform = glm.Translate3D(1, 0, 0)
+
+	ndc := project(camera, 100, 100, glm.Vec3{3, -2, -10})
+	if !ndc.ApproxEqualThreshold(glm.Vec3{1, 1, 1}, 1e-5) {
+		t.Fatalf("expected the bottom right far corner, got %v", ndc)
+	}
+	ndc = project(camera, 100, 100, glm.Vec3{1, 0, 0})
+	if !ndc.ApproxEqualThreshold(glm.Vec3{0, 0, 0}, 1e-5) {
+		t.Fatalf("expected the near center, got %v", ndc)
+	}
+}
+
+func TestCameraValidate(t *testing.T) {
+	valid := core.NewPerspectiveCamera(60, 0.1, 100)
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, modify := range map[string]func(c *core.Camera){
+		"fov":        func(c *core.Camera) { c.FieldOfView = 180 },
+		"near":       func(c *core.Camera) { c.Near = 0 },
+		"far":        func(c *core.Camera) { c.Far = c.Near },
+		"height":     func(c *core.Camera) { c.Projection, c.Height = core.OrthographicProjection, 0 },
+		"projection": func(c *core.Camera) { c.Projection = 5 },
+		"viewport":   func(c *core.Camera) { c.Viewport = core.Viewport{X: 0.5, Y: 0, Width: 0.6, Height: 1} },
+	} {
+		camera := valid
+		modify(&camera)
+		if err := camera.Validate(); err == nil {
+			t.Errorf("bad %s was not caught", name)
+		}
+	}
+
+	renderer := core.NewNullRenderer(nil)
+	if err := renderer.SetCamera("bad", core.Camera{}); err == nil {
+		t.Fatal("renderer took a bad camera")
+	}
+}
+
+func TestViewportRect(t *testing.T) {
+	right := core.Viewport{X: 0.5, Y: 0, Width: 0.5, Height: 1}
+	if rect := right.Rect(101, 50); rect != image.Rect(51, 0, 101, 50) {
+		t.Fatalf("bad viewport, got %v", rect)
+	}
+}
+
+func TestNullRendererCameras(t *testing.T) {
+	renderer := core.NewNullRenderer(nil)
+	renderer.Initialise()
+	defer renderer.Destroy()
+
+	renderer.SetCamera("editor", core.NewOrthographicCamera(10, 0, 100))
+	renderer.Draw()
+	if cameras := renderer.LastFrame().Cameras; len(cameras) != 2 || cameras[0] != "editor" || cameras[1] != core.DefaultCameraName {
+		t.Fatalf("cameras are not drawn in order of names: %v", cameras)
+	}
+
+	renderer.RemoveCamera(core.DefaultCameraName)
+	renderer.Draw()
+	if cameras := renderer.LastFrame().Cameras; len(cameras) != 1 || cameras[0] != "editor" {
+		t.Fatalf("camera was not removed: %v", cameras)
+	}
+}
+
+func TestSoftwareRendererSplitScreen(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 64, 32)
+	defer cleanup()
+
+	// the left camera looks at the red quad, the right one at the blue one
+	left := core.NewPerspectiveCamera(60, 0.1, 10).LookAt(glm.Vec3{0, 0, 2}, glm.Vec3{0, 0, 0}, glm.Vec3{0, 1, 0})
+	left.Viewport = core.Viewport{X: 0, Y: 0, Width: 0.5, Height: 1}
+	right := core.NewPerspectiveCamera(60, 0.1, 10).LookAt(glm.Vec3{5, 0, 2}, glm.Vec3{5, 0, 0}, glm.Vec3{0, 1, 0})
+	right.Viewport = core.Viewport{X: 0.5, Y: 0, Width: 0.5, Height: 1}
+
+	renderer.RemoveCamera(core.DefaultCameraName)
+	if err := renderer.SetCamera("left", left); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.SetCamera("right", right); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := drawFrame(t, renderer, map[core.ResourceHandle]core.ResourceInstance{
+		renderer.ResourceHandle(): placed("red.obj", 0, 0, 0),
+		renderer.ResourceHandle(): placed("blue.obj", 5, 0, 0),
+	})
+	if c := frame.RGBAAt(16, 16); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Fatalf("expected red on the left, got %v", c)
+	}
+	if c := frame.RGBAAt(48, 16); c != (color.RGBA{0, 0, 255, 255}) {
+		t.Fatalf("expected blue on the right, got %v", c)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxPushConstantsSize is the most push constants a dispatch can
+// hand to a compute program, the least every device supports
+const MaxPushConstantsSize = 128
+
+// StorageBuffer is memory of a renderer that compute programs read
+// and write, made with Renderer.CreateStorageBuffer. It must not be
+// read, written or destroyed while a dispatch that uses it runs.
+type StorageBuffer interface {
+	Destroyable
+
+	// Size is the size of the buffer in bytes
+	Size() int
+
+	// Write copies the data into the buffer from the offset on
+	Write(offset int, data []byte) error
+
+	// Read copies from the buffer at the offset into data
+	Read(offset int, data []byte) error
+}
+
+// ComputeDispatch is work for a compute program, like simulating
+// particles or culling instances on the GPU
+type ComputeDispatch struct {
+	// Program names a compute program of the shader manifest
+	Program string
+
+	// Buffers are bound to the storage buffers of set 0 of the
+	// program, in the order of their bindings and array elements
+	Buffers []StorageBuffer
+
+	// PushConstants are the bytes of the push constant range of
+	// the program, as many as the range takes
+	PushConstants []byte
+
+	// Groups are the numbers of work groups in x, y and z
+	Groups [3]uint32
+}
+
+// Validate checks that the dispatch can be submitted
+func (d ComputeDispatch) Validate() error {
+	if d.Program == "" {
+		return errors.New("no compute program")
+	}
+	for axis, groups := range d.Groups {
+		if groups == 0 {
+			return fmt.Errorf("no work groups in %c", "xyz"[axis])
+		}
+	}
+	for idx, buffer := range d.Buffers {
+		if buffer == nil {
+			return fmt.Errorf("buffer %d is nil", idx)
+		}
+	}
+	if len(d.PushConstants)%4 != 0 {
+		return fmt.Errorf("%d bytes of push constants are not a multiple of 4", len(d.PushConstants))
+	}
+	if len(d.PushConstants) > MaxPushConstantsSize {
+		return fmt.Errorf("%d bytes of push constants, no more than %d are supported", len(d.PushConstants), MaxPushConstantsSize)
+	}
+	return nil
+}
+
+// checkBufferRange checks that length bytes at the offset are in a buffer of the size
+func checkBufferRange(size, offset, length int) error {
+	if offset < 0 || length < 0 || offset+length > size {
+		return fmt.Errorf("%d bytes at offset %d are out of the %d bytes of the buffer", length, offset, size)
+	}
+	return nil
+}
+
+// hostStorageBuffer is a storage buffer in memory, of the
+// renderers that don't have a GPU
+type hostStorageBuffer struct {
+	lock sync.RWMutex
+	data []byte
+}
+
+func newHostStorageBuffer(size int) (*hostStorageBuffer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("bad storage buffer size %d", size)
+	}
+	return &hostStorageBuffer{data: make([]byte, size)}, nil
+}
+
+// Size implements interface
+func (b *hostStorageBuffer) Size() int {
+	return len(b.data)
+}
+
+// Write implements interface
+func (b *hostStorageBuffer) Write(offset int, data []byte) error {
+	if err := checkBufferRange(len(b.data), offset, len(data)); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	copy(b.data[offset:], data)
+	b.lock.Unlock()
+	return nil
+}
+
+// Read implements interface
+func (b *hostStorageBuffer) Read(offset int, data []byte) error {
+	if err := checkBufferRange(len(b.data), offset, len(data)); err != nil {
+		return err
+	}
+	b.lock.RLock()
+	copy(data, b.data[offset:])
+	b.lock.RUnlock()
+	return nil
+}
+
+// Destroy implements interface
+func (b *hostStorageBuffer) Destroy() {}
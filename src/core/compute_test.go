@@ -0,0 +1,137 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	vk "github.com/devblok/vulkan"
+)
+
+func TestComputeDispatchValidate(t *testing.T) {
+	valid := core.ComputeDispatch{Program: "particles", Groups: [3]uint32{64, 1, 1}}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, work := range map[string]core.ComputeDispatch{
+		"no program":          {Groups: [3]uint32{1, 1, 1}},
+		"no groups":           {Program: "particles"},
+		"no groups in z":      {Program: "particles", Groups: [3]uint32{1, 1, 0}},
+		"nil buffer":          {Program: "particles", Groups: [3]uint32{1, 1, 1}, Buffers: []core.StorageBuffer{nil}},
+		"odd push constants":  {Program: "particles", Groups: [3]uint32{1, 1, 1}, PushConstants: make([]byte, 6)},
+		"many push constants": {Program: "particles", Groups: [3]uint32{1, 1, 1}, PushConstants: make([]byte, core.MaxPushConstantsSize+4)},
+	} {
+		if err := work.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNullRendererDispatch(t *testing.T) {
+	renderer := core.NewNullRenderer(nil)
+	work := core.ComputeDispatch{Program: "particles", Groups: [3]uint32{16, 1, 1}}
+	if _, err := renderer.Dispatch(work); err == nil {
+		t.Fatal("expected a dispatch before Initialise to fail")
+	}
+	renderer.Initialise()
+	defer renderer.Destroy()
+
+	if _, err := renderer.CreateStorageBuffer(0); err == nil {
+		t.Fatal("expected an empty storage buffer to fail")
+	}
+	buffer, err := renderer.CreateStorageBuffer(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Destroy()
+
+	if err := buffer.Write(4, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	read := make([]byte, 8)
+	if err := buffer.Read(0, read); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, []byte{0, 0, 0, 0, 1, 2, 3, 4}) {
+		t.Fatalf("unexpected contents %v", read)
+	}
+	if err := buffer.Write(14, []byte{1, 2, 3}); err == nil {
+		t.Fatal("expected a write past the end to fail")
+	}
+	if err := buffer.Read(-1, read); err == nil {
+		t.Fatal("expected a read before the start to fail")
+	}
+
+	work.Buffers = []core.StorageBuffer{buffer}
+	done, err := renderer.Dispatch(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if _, err := renderer.Dispatch(core.ComputeDispatch{Program: "particles"}); err == nil {
+		t.Fatal("expected an invalid dispatch to fail")
+	}
+
+	dispatches := renderer.Dispatches()
+	if len(dispatches) != 1 || dispatches[0].Program != "particles" || len(dispatches[0].Buffers) != 1 {
+		t.Fatalf("unexpected dispatches %+v", dispatches)
+	}
+}
+
+func TestSoftwareRendererDispatch(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 16, 16)
+	defer cleanup()
+
+	buffer, err := renderer.CreateStorageBuffer(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Size() != 64 {
+		t.Fatalf("expected 64 bytes, got %d", buffer.Size())
+	}
+	if _, err := renderer.Dispatch(core.ComputeDispatch{
+		Program: "particles",
+		Buffers: []core.StorageBuffer{buffer},
+		Groups:  [3]uint32{1, 1, 1},
+	}); err == nil {
+		t.Fatal("expected the software renderer to fail running compute programs")
+	}
+}
+
+func TestSelectComputeQueue(t *testing.T) {
+	graphics := vk.QueueFlags(vk.QueueGraphicsBit | vk.QueueComputeBit | vk.QueueTransferBit)
+	compute := vk.QueueFlags(vk.QueueComputeBit | vk.QueueTransferBit)
+	transfer := vk.QueueFlags(vk.QueueTransferBit)
+
+	for name, c := range map[string]struct {
+		families      []vk.QueueFamilyProperties
+		graphics      uint32
+		family, index uint32
+	}{
+		"compute family": {
+			families: []vk.QueueFamilyProperties{{QueueFlags: graphics, QueueCount: 16}, {QueueFlags: transfer, QueueCount: 1}, {QueueFlags: compute, QueueCount: 8}},
+			family:   2,
+		},
+		"second graphics queue": {
+			families: []vk.QueueFamilyProperties{{QueueFlags: transfer, QueueCount: 1}, {QueueFlags: graphics, QueueCount: 2}},
+			graphics: 1,
+			family:   1,
+			index:    1,
+		},
+		"shared graphics queue": {
+			families: []vk.QueueFamilyProperties{{QueueFlags: graphics, QueueCount: 1}, {QueueFlags: transfer, QueueCount: 2}},
+			family:   0,
+		},
+	} {
+		family, index := core.SelectComputeQueue(c.families, c.graphics)
+		if family != c.family || index != c.index {
+			t.Errorf("%s: expected queue %d of family %d, got %d of %d", name, c.index, c.family, index, family)
+		}
+	}
+}
@@ -39,4 +39,17 @@ type RendererConfiguration struct {
 	ScreenHeight uint32
 
 	ShaderDirectory string
+
+	// AssetPaths are directories and kar archives that resource ids
+	// are looked up in, in order. Empty means the working directory
+	AssetPaths []string
+
+	// ResourceBudget is the device memory in bytes that resources may
+	// take, before the ones no instance uses are unloaded. With 0
+	// resources are unloaded as soon as they're unused
+	ResourceBudget int64
+
+	// HotReload watches the asset directories and ShaderDirectory,
+	// reloading the meshes, textures and shaders that change
+	HotReload bool
 }
@@ -8,6 +8,8 @@ package core
 import (
 	"unsafe"
 
+	"github.com/devblok/koru/src/gfx"
+	"github.com/devblok/koru/src/gfx/spirv"
 	vk "github.com/devblok/vulkan"
 	glm "github.com/go-gl/mathgl/mgl32"
 )
@@ -76,6 +78,31 @@ type Renderer interface {
 	// ResourceDelete removes the resource from rendering queue
 	ResourceDelete(ResourceHandle)
 
+	// ResourceStats describes the resources that are loaded
+	ResourceStats() gfx.CacheStats
+
+	// SetCamera adds or replaces the named camera. Every camera draws
+	// the scene into its viewport, in the order of their names.
+	// Renderers start with DefaultCamera named DefaultCameraName
+	SetCamera(name string, camera Camera) error
+
+	// RemoveCamera stops drawing with the named camera
+	RemoveCamera(name string)
+
+	// SetMaterial adds or replaces the named material. Instances
+	// naming a material that is not set are not updated. Renderers
+	// start with DefaultMaterial named DefaultMaterialName
+	SetMaterial(name string, material Material) error
+
+	// CreateStorageBuffer creates a buffer of the size in bytes
+	// for compute programs, filled with zeroes
+	CreateStorageBuffer(size int) (StorageBuffer, error)
+
+	// Dispatch submits the compute work, the channel is closed once
+	// it's done. Work runs along with drawing on devices with a queue
+	// for compute besides the one that draws
+	Dispatch(ComputeDispatch) (<-chan struct{}, error)
+
 	// Draw draws the frame
 	Draw() error
 
@@ -94,9 +121,22 @@ type ShaderType int
 const (
 	VertexShaderType ShaderType = iota
 	FragmentShaderType
+	GeometryShaderType
+	TessellationControlShaderType
+	TessellationEvaluationShaderType
+	ComputeShaderType
 	UnknownShaderType
 )
 
+// SpecializationConstant is the value a specialization
+// constant of a shader is set to
+type SpecializationConstant struct {
+	ID uint32
+
+	// Value is the bits of the 32 bit scalar, booleans are 0 or 1
+	Value uint32
+}
+
 // Shader is an abstraction for shader modules.
 // It is safe to destroy after the rendering pipeline is created.
 type Shader interface {
@@ -108,7 +148,17 @@ type Shader interface {
 	// Type returns the type of shader in question
 	Type() ShaderType
 
-	// Name Shader name
+	// Module is what the shader takes, read from its SPIR-V
+	Module() *spirv.Module
+
+	// EntryPoint is the function the shader starts at
+	EntryPoint() string
+
+	// Specialization are the specialization constants that are set,
+	// ordered by id
+	Specialization() []SpecializationConstant
+
+	// Name is the name of the program the shader is a stage of
 	Name() string
 }
 
@@ -124,6 +174,10 @@ type ResourceInstance struct {
 
 	// Rotation matrix for the Resource
 	Rotation glm.Mat4
+
+	// Material names the material the instance is drawn with,
+	// DefaultMaterialName when empty
+	Material string
 }
 
 // ResourceHandle identifies the resource instance in the renderer
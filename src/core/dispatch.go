@@ -0,0 +1,495 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/devblok/koru/src/gfx/spirv"
+	"github.com/devblok/koru/src/gfx/vkr"
+	vk "github.com/devblok/vulkan"
+)
+
+// Limits of the descriptor pool of dispatches, sets are freed once
+// the dispatch is done, so they limit the dispatches that run at once
+const (
+	maxComputeSets    = 64
+	maxComputeBuffers = 8 * maxComputeSets
+)
+
+// computeSet is the only descriptor set of compute programs
+const computeSet = 0
+
+// vulkanStorageBuffer is a storage buffer in host visible memory, so
+// it's read and written without copies. It's shared by the graphics
+// and the compute queue families
+type vulkanStorageBuffer struct {
+	renderer *VulkanRenderer
+	buffer   vk.Buffer
+	memory   vkr.Memory
+	size     int
+}
+
+// CreateStorageBuffer implements interface
+func (v *VulkanRenderer) CreateStorageBuffer(size int) (StorageBuffer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("bad storage buffer size %d", size)
+	}
+	if v.logicalDevice == nil {
+		return nil, errors.New("renderer is not initialised")
+	}
+
+	bci := vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        vk.DeviceSize(size),
+		Usage:       vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit),
+		SharingMode: vk.SharingModeExclusive,
+	}
+	if v.computeQueueIndex != v.graphicsQueueIndex {
+		bci.SharingMode = vk.SharingModeConcurrent
+		bci.QueueFamilyIndexCount = 2
+		bci.PQueueFamilyIndices = []uint32{v.graphicsQueueIndex, v.computeQueueIndex}
+	}
+
+	b := &vulkanStorageBuffer{renderer: v, size: size}
+	if err := vk.Error(vk.CreateBuffer(v.logicalDevice, &bci, nil, &b.buffer)); err != nil {
+		return nil, fmt.Errorf("vk.CreateBuffer(): %s", err.Error())
+	}
+
+	var memoryRequirements vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(v.logicalDevice, b.buffer, &memoryRequirements)
+	memoryRequirements.Deref()
+
+	memory, err := v.allocator.Malloc(
+		memoryRequirements,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit,
+	)
+	if err != nil {
+		vk.DestroyBuffer(v.logicalDevice, b.buffer, nil)
+		return nil, err
+	}
+	b.memory = memory
+	vk.BindBufferMemory(v.logicalDevice, b.buffer, b.memory.Get(), 0)
+
+	if err := b.Write(0, make([]byte, size)); err != nil {
+		b.Destroy()
+		return nil, err
+	}
+	return b, nil
+}
+
+// mapped maps length bytes at the offset for f
+func (b *vulkanStorageBuffer) mapped(offset, length int, f func([]byte)) error {
+	if err := checkBufferRange(b.size, offset, length); err != nil {
+		return err
+	}
+	if length == 0 {
+		return nil
+	}
+
+	device := b.renderer.logicalDevice
+	var mappedMemory unsafe.Pointer
+	if err := vk.Error(vk.MapMemory(
+		device,
+		b.memory.Get(),
+		vk.DeviceSize(b.memory.Offset()+uint(offset)),
+		vk.DeviceSize(length), 0,
+		&mappedMemory,
+	)); err != nil {
+		return fmt.Errorf("vk.MapMemory(): %s", err.Error())
+	}
+	f(*(*[]byte)(unsafe.Pointer(&sliceHeader{
+		Data: uintptr(mappedMemory),
+		Len:  length,
+		Cap:  length,
+	})))
+	vk.UnmapMemory(device, b.memory.Get())
+	return nil
+}
+
+// Size implements interface
+func (b *vulkanStorageBuffer) Size() int {
+	return b.size
+}
+
+// Write implements interface
+func (b *vulkanStorageBuffer) Write(offset int, data []byte) error {
+	return b.mapped(offset, len(data), func(mapped []byte) {
+		copy(mapped, data)
+	})
+}
+
+// Read implements interface
+func (b *vulkanStorageBuffer) Read(offset int, data []byte) error {
+	return b.mapped(offset, len(data), func(mapped []byte) {
+		copy(data, mapped)
+	})
+}
+
+// Destroy implements interface, waits for the device
+// so no work uses the buffer anymore
+func (b *vulkanStorageBuffer) Destroy() {
+	device := b.renderer.logicalDevice
+	b.renderer.waitIdle()
+	vk.DestroyBuffer(device, b.buffer, nil)
+	b.memory.Release()
+}
+
+// computePipeline is the pipeline of a compute program
+// with the layout made from what its shader takes
+type computePipeline struct {
+	reflection     *spirv.Layout
+	setLayout      vk.DescriptorSetLayout
+	pipelineLayout vk.PipelineLayout
+	pipeline       vk.Pipeline
+}
+
+// buffers returns the storage buffers of the program, counting array elements
+func (p *computePipeline) buffers() int {
+	var count int
+	for _, b := range p.reflection.Sets[computeSet] {
+		count += int(b.Count)
+	}
+	return count
+}
+
+// SelectComputeQueue picks the family and the index in it of the queue
+// compute work is submitted to, one of a family that computes but
+// doesn't draw if the device has one, so the work runs along with
+// drawing. Otherwise it's a second queue of the graphics family, or the
+// graphics queue itself if the family has only one
+func SelectComputeQueue(families []vk.QueueFamilyProperties, graphics uint32) (family, index uint32) {
+	for idx, f := range families {
+		f.Deref()
+		if f.QueueFlags&vk.QueueFlags(vk.QueueComputeBit) != 0 && f.QueueFlags&vk.QueueFlags(vk.QueueGraphicsBit) == 0 {
+			return uint32(idx), 0
+		}
+	}
+	if int(graphics) < len(families) {
+		f := families[graphics]
+		f.Deref()
+		if f.QueueCount > 1 {
+			return graphics, 1
+		}
+	}
+	return graphics, 0
+}
+
+// createCompute creates the command pool and the descriptor pool of dispatches
+func (v *VulkanRenderer) createCompute() error {
+	cpci := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		QueueFamilyIndex: v.computeQueueIndex,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit),
+	}
+	if err := vk.Error(vk.CreateCommandPool(v.logicalDevice, &cpci, nil, &v.computeCommandPool)); err != nil {
+		return errors.New("vk.CreateCommandPool(): " + err.Error())
+	}
+
+	poolSizes := []vk.DescriptorPoolSize{{
+		Type:            vk.DescriptorTypeStorageBuffer,
+		DescriptorCount: maxComputeBuffers,
+	}}
+	dpci := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		Flags:         vk.DescriptorPoolCreateFlags(vk.DescriptorPoolCreateFreeDescriptorSetBit),
+		MaxSets:       maxComputeSets,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	if err := vk.Error(vk.CreateDescriptorPool(v.logicalDevice, &dpci, nil, &v.computeDescriptorPool)); err != nil {
+		return errors.New("vk.CreateDescriptorPool(): " + err.Error())
+	}
+	return nil
+}
+
+// computePipeline returns the pipeline of the program, creating it on
+// first use. The compute lock must be held
+func (v *VulkanRenderer) computePipeline(program string) (*computePipeline, error) {
+	if pipeline, ok := v.computePipelines[program]; ok {
+		return pipeline, nil
+	}
+
+	shaders := v.programShaders(program)
+	if len(shaders) != 1 || shaders[0].Type() != ComputeShaderType {
+		return nil, fmt.Errorf("no compute program %s", program)
+	}
+	shader := shaders[0]
+	reflection, err := spirv.NewLayout(spirv.Shader{Module: shader.Module(), EntryPoint: shader.EntryPoint()})
+	if err != nil {
+		return nil, fmt.Errorf("program %s: %s", program, err.Error())
+	}
+	for set, bindings := range reflection.Sets {
+		if set != computeSet {
+			return nil, fmt.Errorf("program %s uses set %d, only set %d is bound", program, set, computeSet)
+		}
+		for _, b := range bindings {
+			if b.Type != spirv.StorageBuffer || b.Count == 0 {
+				return nil, fmt.Errorf("program %s: %s %s is not a storage buffer the renderer binds", program, b.Type, b.Name)
+			}
+		}
+	}
+
+	p := &computePipeline{reflection: reflection}
+	if p.setLayout, err = v.createSetLayout(reflection.Sets[computeSet], false); err != nil {
+		return nil, err
+	}
+
+	plci := vk.PipelineLayoutCreateInfo{
+		SType:          vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount: 1,
+		PSetLayouts:    []vk.DescriptorSetLayout{p.setLayout},
+	}
+	if pc := reflection.PushConstants; pc.Size > 0 {
+		plci.PushConstantRangeCount = 1
+		plci.PPushConstantRanges = []vk.PushConstantRange{{
+			StageFlags: vk.ShaderStageFlags(pc.Stages),
+			Offset:     pc.Offset,
+			Size:       pc.Size,
+		}}
+	}
+	if err := vk.Error(vk.CreatePipelineLayout(v.logicalDevice, &plci, nil, &p.pipelineLayout)); err != nil {
+		vk.DestroyDescriptorSetLayout(v.logicalDevice, p.setLayout, nil)
+		return nil, errors.New("vk.CreatePipelineLayout(): " + err.Error())
+	}
+
+	shaderModule, ok := shader.ShaderModule().(vk.ShaderModule)
+	if !ok {
+		p.destroy(v.logicalDevice)
+		return nil, errors.New("failed to assert shader module to it's original type")
+	}
+	cpci := []vk.ComputePipelineCreateInfo{{
+		SType: vk.StructureTypeComputePipelineCreateInfo,
+		Stage: vk.PipelineShaderStageCreateInfo{
+			SType:               vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:               vk.ShaderStageComputeBit,
+			Module:              shaderModule,
+			PName:               safeString(shader.EntryPoint()),
+			PSpecializationInfo: specializationInfo(shader.Specialization()),
+		},
+		Layout: p.pipelineLayout,
+	}}
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateComputePipelines(v.logicalDevice, v.pipelineCache, 1, cpci, nil, pipelines)); err != nil {
+		p.destroy(v.logicalDevice)
+		return nil, fmt.Errorf("vk.CreateComputePipelines(): %s", err.Error())
+	}
+	p.pipeline = pipelines[0]
+
+	v.computePipelines[program] = p
+	return p, nil
+}
+
+func (p *computePipeline) destroy(device vk.Device) {
+	if p.pipeline != nil {
+		vk.DestroyPipeline(device, p.pipeline, nil)
+	}
+	vk.DestroyPipelineLayout(device, p.pipelineLayout, nil)
+	vk.DestroyDescriptorSetLayout(device, p.setLayout, nil)
+}
+
+// destroyComputePipelines destroys the pipelines of compute programs,
+// they're made again on the next dispatch
+func (v *VulkanRenderer) destroyComputePipelines() {
+	v.computeLock.Lock()
+	defer v.computeLock.Unlock()
+	for program, p := range v.computePipelines {
+		p.destroy(v.logicalDevice)
+		delete(v.computePipelines, program)
+	}
+}
+
+// destroyCompute waits for the dispatches and destroys what they're made with
+func (v *VulkanRenderer) destroyCompute() {
+	v.dispatches.Wait()
+	v.destroyComputePipelines()
+	vk.DestroyDescriptorPool(v.logicalDevice, v.computeDescriptorPool, nil)
+	vk.DestroyCommandPool(v.logicalDevice, v.computeCommandPool, nil)
+}
+
+// Dispatch implements interface, the work is submitted to the compute
+// queue, under queueLock if it's the device queue
+func (v *VulkanRenderer) Dispatch(work ComputeDispatch) (<-chan struct{}, error) {
+	if err := work.Validate(); err != nil {
+		return nil, err
+	}
+	if v.logicalDevice == nil {
+		return nil, errors.New("renderer is not initialised")
+	}
+
+	v.computeLock.Lock()
+	defer v.computeLock.Unlock()
+
+	p, err := v.computePipeline(work.Program)
+	if err != nil {
+		return nil, err
+	}
+	buffers, err := v.dispatchBuffers(p, work)
+	if err != nil {
+		return nil, err
+	}
+	pc := p.reflection.PushConstants
+	if len(work.PushConstants) != int(pc.Size) {
+		return nil, fmt.Errorf("program %s takes %d bytes of push constants, the dispatch has %d", work.Program, pc.Size, len(work.PushConstants))
+	}
+
+	dsai := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     v.computeDescriptorPool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{p.setLayout},
+	}
+	var descriptorSet vk.DescriptorSet
+	if err := vk.Error(vk.AllocateDescriptorSets(v.logicalDevice, &dsai, &descriptorSet)); err != nil {
+		return nil, fmt.Errorf("vk.AllocateDescriptorSets(): %s", err.Error())
+	}
+	var wds []vk.WriteDescriptorSet
+	for _, b := range p.reflection.Sets[computeSet] {
+		infos := make([]vk.DescriptorBufferInfo, b.Count)
+		for idx := range infos {
+			infos[idx] = vk.DescriptorBufferInfo{
+				Buffer: buffers[idx].buffer,
+				Offset: 0,
+				Range:  vk.DeviceSize(buffers[idx].size),
+			}
+		}
+		buffers = buffers[b.Count:]
+		wds = append(wds, vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          descriptorSet,
+			DstBinding:      b.Binding,
+			DstArrayElement: 0,
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: b.Count,
+			PBufferInfo:     infos,
+		})
+	}
+	vk.UpdateDescriptorSets(v.logicalDevice, uint32(len(wds)), wds, 0, nil)
+
+	commandBuffer, err := v.recordDispatch(p, descriptorSet, work)
+	if err != nil {
+		vk.FreeDescriptorSets(v.logicalDevice, v.computeDescriptorPool, 1, &descriptorSet)
+		return nil, err
+	}
+
+	fci := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	var fence vk.Fence
+	if err := vk.Error(vk.CreateFence(v.logicalDevice, &fci, nil, &fence)); err != nil {
+		vk.FreeCommandBuffers(v.logicalDevice, v.computeCommandPool, 1, []vk.CommandBuffer{commandBuffer})
+		vk.FreeDescriptorSets(v.logicalDevice, v.computeDescriptorPool, 1, &descriptorSet)
+		return nil, errors.New("vk.CreateFence(): " + err.Error())
+	}
+
+	si := vk.SubmitInfo{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vk.CommandBuffer{commandBuffer},
+	}
+	if v.computeQueue == v.deviceQueue {
+		v.queueLock.Lock()
+	}
+	err = vk.Error(vk.QueueSubmit(v.computeQueue, 1, []vk.SubmitInfo{si}, fence))
+	if v.computeQueue == v.deviceQueue {
+		v.queueLock.Unlock()
+	}
+	if err != nil {
+		vk.DestroyFence(v.logicalDevice, fence, nil)
+		vk.FreeCommandBuffers(v.logicalDevice, v.computeCommandPool, 1, []vk.CommandBuffer{commandBuffer})
+		vk.FreeDescriptorSets(v.logicalDevice, v.computeDescriptorPool, 1, &descriptorSet)
+		return nil, fmt.Errorf("vk.QueueSubmit(): %s", err.Error())
+	}
+
+	done := make(chan struct{})
+	v.dispatches.Add(1)
+	go func() {
+		defer v.dispatches.Done()
+		vk.WaitForFences(v.logicalDevice, 1, []vk.Fence{fence}, vk.True, math.MaxUint64)
+
+		v.computeLock.Lock()
+		vk.DestroyFence(v.logicalDevice, fence, nil)
+		vk.FreeCommandBuffers(v.logicalDevice, v.computeCommandPool, 1, []vk.CommandBuffer{commandBuffer})
+		vk.FreeDescriptorSets(v.logicalDevice, v.computeDescriptorPool, 1, &descriptorSet)
+		v.computeLock.Unlock()
+		close(done)
+	}()
+	return done, nil
+}
+
+// dispatchBuffers checks that the buffers of the dispatch are the ones
+// of this renderer the program takes, and returns them
+func (v *VulkanRenderer) dispatchBuffers(p *computePipeline, work ComputeDispatch) ([]*vulkanStorageBuffer, error) {
+	if len(work.Buffers) != p.buffers() {
+		return nil, fmt.Errorf("program %s takes %d storage buffers, the dispatch has %d", work.Program, p.buffers(), len(work.Buffers))
+	}
+
+	buffers := make([]*vulkanStorageBuffer, len(work.Buffers))
+	idx := 0
+	for _, b := range p.reflection.Sets[computeSet] {
+		for element := uint32(0); element < b.Count; element++ {
+			buffer, ok := work.Buffers[idx].(*vulkanStorageBuffer)
+			if !ok || buffer.renderer != v {
+				return nil, fmt.Errorf("buffer %d was not made by this renderer", idx)
+			}
+			if buffer.size < int(b.Size) {
+				return nil, fmt.Errorf("buffer %d has %d bytes, %s takes at least %d", idx, buffer.size, b.Name, b.Size)
+			}
+			buffers[idx] = buffer
+			idx++
+		}
+	}
+	return buffers, nil
+}
+
+// recordDispatch records the command buffer of the dispatch, which
+// makes what the program writes visible to the host once it's done
+func (v *VulkanRenderer) recordDispatch(p *computePipeline, descriptorSet vk.DescriptorSet, work ComputeDispatch) (vk.CommandBuffer, error) {
+	cbai := vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		Level:              vk.CommandBufferLevelPrimary,
+		CommandPool:        v.computeCommandPool,
+		CommandBufferCount: 1,
+	}
+	commandBuffers := make([]vk.CommandBuffer, 1)
+	if err := vk.Error(vk.AllocateCommandBuffers(v.logicalDevice, &cbai, commandBuffers)); err != nil {
+		return nil, fmt.Errorf("vk.AllocateCommandBuffers(): %s", err.Error())
+	}
+	cmd := commandBuffers[0]
+
+	cbbi := vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	}
+	if err := vk.Error(vk.BeginCommandBuffer(cmd, &cbbi)); err != nil {
+		vk.FreeCommandBuffers(v.logicalDevice, v.computeCommandPool, 1, commandBuffers)
+		return nil, fmt.Errorf("vk.BeginCommandBuffer(): %s", err.Error())
+	}
+
+	vk.CmdBindPipeline(cmd, vk.PipelineBindPointCompute, p.pipeline)
+	vk.CmdBindDescriptorSets(cmd, vk.PipelineBindPointCompute, p.pipelineLayout, computeSet, 1, []vk.DescriptorSet{descriptorSet}, 0, nil)
+	if pc := p.reflection.PushConstants; pc.Size > 0 {
+		vk.CmdPushConstants(cmd, p.pipelineLayout, vk.ShaderStageFlags(pc.Stages), pc.Offset, pc.Size, unsafe.Pointer(&work.PushConstants[0]))
+	}
+	vk.CmdDispatch(cmd, work.Groups[0], work.Groups[1], work.Groups[2])
+	vk.CmdPipelineBarrier(cmd,
+		vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		vk.PipelineStageFlags(vk.PipelineStageHostBit),
+		0, 1, []vk.MemoryBarrier{{
+			SType:         vk.StructureTypeMemoryBarrier,
+			SrcAccessMask: vk.AccessFlags(vk.AccessShaderWriteBit),
+			DstAccessMask: vk.AccessFlags(vk.AccessHostReadBit),
+		}}, 0, nil, 0, nil)
+
+	if err := vk.Error(vk.EndCommandBuffer(cmd)); err != nil {
+		vk.FreeCommandBuffers(v.logicalDevice, v.computeCommandPool, 1, commandBuffers)
+		return nil, fmt.Errorf("vk.EndCommandBuffer(): %s", err.Error())
+	}
+	return cmd, nil
+}
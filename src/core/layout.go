@@ -0,0 +1,296 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/devblok/koru/src/gfx/spirv"
+	"github.com/devblok/koru/src/model"
+	vk "github.com/devblok/vulkan"
+)
+
+// shaderEntryPoint is the function shader stages start at, if the
+// manifest doesn't name another
+const shaderEntryPoint = "main"
+
+// programLayout is the pipeline layout of a program, made from what its
+// shaders take. Set 0 is the one of resources, the uniform buffer in it
+// is the camera, bound with a dynamic offset, and the sampler the texture
+// of the mesh. Set 1 is the one of materials, the uniform buffer in it
+// holds the params and the samplers the textures, in the order of their
+// bindings.
+type programLayout struct {
+	reflection *spirv.Layout
+
+	materialSetLayout vk.DescriptorSetLayout
+	pipelineLayout    vk.PipelineLayout
+
+	// attributes are the vertex attributes the vertex stage takes
+	attributes []vk.VertexInputAttributeDescription
+}
+
+// materialTextures returns how many textures the program samples
+func (l *programLayout) materialTextures() int {
+	var count int
+	for _, b := range l.reflection.Bindings(materialDescriptorSet, spirv.CombinedImageSampler) {
+		count += int(b.Count)
+	}
+	return count
+}
+
+// reflectProgram merges what the shaders of the program take
+func reflectProgram(program string, shaders []Shader) (*spirv.Layout, error) {
+	if len(shaders) == 0 {
+		return nil, fmt.Errorf("no shaders of program %s", program)
+	}
+	stages := make([]spirv.Shader, len(shaders))
+	for idx, shader := range shaders {
+		stages[idx] = spirv.Shader{Module: shader.Module(), EntryPoint: shader.EntryPoint()}
+	}
+	layout, err := spirv.NewLayout(stages...)
+	if err != nil {
+		return nil, fmt.Errorf("program %s: %s", program, err.Error())
+	}
+	if layout.Stages&spirv.StageCompute != 0 {
+		return nil, fmt.Errorf("program %s is a compute program, it doesn't draw", program)
+	}
+	for set := range layout.Sets {
+		if set != resourceDescriptorSet && set != materialDescriptorSet {
+			return nil, fmt.Errorf("program %s uses set %d, only the resource set %d and the material set %d are bound",
+				program, set, resourceDescriptorSet, materialDescriptorSet)
+		}
+	}
+	return layout, nil
+}
+
+// checkSetBindings checks that the set has at most one uniform buffer
+// and otherwise only samplers, the things the renderer binds
+func checkSetBindings(program string, set uint32, bindings []spirv.Binding) error {
+	var uniforms int
+	for _, b := range bindings {
+		switch b.Type {
+		case spirv.UniformBuffer:
+			uniforms++
+			if b.Count != 1 {
+				return fmt.Errorf("program %s: uniform %s in set %d is an array", program, b.Name, set)
+			}
+		case spirv.CombinedImageSampler:
+			if b.Count == 0 {
+				return fmt.Errorf("program %s: textures %s in set %d have no size", program, b.Name, set)
+			}
+		default:
+			return fmt.Errorf("program %s: %s %s in set %d is not bound by the renderer", program, b.Type, b.Name, set)
+		}
+	}
+	if uniforms > 1 {
+		return fmt.Errorf("program %s: more than one uniform buffer in set %d", program, set)
+	}
+	return nil
+}
+
+// createSetLayout creates a descriptor set layout of the bindings,
+// uniform buffers are made dynamic if dynamic is set
+func (v *VulkanRenderer) createSetLayout(bindings []spirv.Binding, dynamic bool) (vk.DescriptorSetLayout, error) {
+	layoutBindings := make([]vk.DescriptorSetLayoutBinding, len(bindings))
+	for idx, b := range bindings {
+		descriptorType := vk.DescriptorType(b.Type)
+		if dynamic && b.Type == spirv.UniformBuffer {
+			descriptorType = vk.DescriptorTypeUniformBufferDynamic
+		}
+		layoutBindings[idx] = vk.DescriptorSetLayoutBinding{
+			Binding:         b.Binding,
+			DescriptorType:  descriptorType,
+			DescriptorCount: b.Count,
+			StageFlags:      vk.ShaderStageFlags(b.Stages),
+		}
+	}
+	dslci := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(layoutBindings)),
+		PBindings:    layoutBindings,
+	}
+
+	var descriptorSetLayout vk.DescriptorSetLayout
+	if err := vk.Error(vk.CreateDescriptorSetLayout(v.logicalDevice, &dslci, nil, &descriptorSetLayout)); err != nil {
+		return nil, errors.New("vk.CreateDescriptorSetLayout(): " + err.Error())
+	}
+	return descriptorSetLayout, nil
+}
+
+// createPipelineLayout creates the layout of the resource set from the
+// shaders of the default program, layouts of programs are made on first use
+func (v *VulkanRenderer) createPipelineLayout() error {
+	layout, err := reflectProgram(DefaultProgram, v.programShaders(DefaultProgram))
+	if err != nil {
+		return err
+	}
+	bindings := layout.Sets[resourceDescriptorSet]
+	if err := checkSetBindings(DefaultProgram, resourceDescriptorSet, bindings); err != nil {
+		return err
+	}
+	if samplers := layout.Bindings(resourceDescriptorSet, spirv.CombinedImageSampler); len(samplers) > 1 || (len(samplers) == 1 && samplers[0].Count != 1) {
+		return fmt.Errorf("program %s: set %d has room for more than the texture of the mesh", DefaultProgram, resourceDescriptorSet)
+	}
+
+	resourceSetLayout, err := v.createSetLayout(bindings, true)
+	if err != nil {
+		return err
+	}
+	v.resourceSetLayout = resourceSetLayout
+	v.resourceBindings = bindings
+
+	_, err = v.programLayout(DefaultProgram)
+	return err
+}
+
+// programLayout returns the layout of the program, creating it on first use.
+// Bindings of set 0 must be the ones of the default program
+func (v *VulkanRenderer) programLayout(program string) (*programLayout, error) {
+	if layout, ok := v.layouts[program]; ok {
+		return layout, nil
+	}
+
+	reflection, err := reflectProgram(program, v.programShaders(program))
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range reflection.Sets[resourceDescriptorSet] {
+		if !v.hasResourceBinding(b) {
+			return nil, fmt.Errorf("program %s: %s %s at binding %d of set %d is not one of the resource set of program %s",
+				program, b.Type, b.Name, b.Binding, resourceDescriptorSet, DefaultProgram)
+		}
+	}
+	materialBindings := reflection.Sets[materialDescriptorSet]
+	if err := checkSetBindings(program, materialDescriptorSet, materialBindings); err != nil {
+		return nil, err
+	}
+	for _, b := range reflection.Bindings(materialDescriptorSet, spirv.UniformBuffer) {
+		if int(b.Size) > materialParamsSize {
+			return nil, fmt.Errorf("program %s: params %s take %d bytes, no more than %d fit", program, b.Name, b.Size, materialParamsSize)
+		}
+	}
+
+	attributes, err := vertexAttributes(program, reflection.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &programLayout{
+		reflection: reflection,
+		attributes: attributes,
+	}
+	if layout.materialTextures() > MaxMaterialTextures {
+		return nil, fmt.Errorf("program %s samples %d textures, no more than %d are supported", program, layout.materialTextures(), MaxMaterialTextures)
+	}
+
+	if layout.materialSetLayout, err = v.createSetLayout(materialBindings, false); err != nil {
+		return nil, err
+	}
+
+	plci := vk.PipelineLayoutCreateInfo{
+		SType:          vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount: 2,
+		PSetLayouts:    []vk.DescriptorSetLayout{v.resourceSetLayout, layout.materialSetLayout},
+	}
+	if pc := reflection.PushConstants; pc.Size > 0 {
+		plci.PushConstantRangeCount = 1
+		plci.PPushConstantRanges = []vk.PushConstantRange{{
+			StageFlags: vk.ShaderStageFlags(pc.Stages),
+			Offset:     pc.Offset,
+			Size:       pc.Size,
+		}}
+	}
+
+	var pipelineLayout vk.PipelineLayout
+	if err := vk.Error(vk.CreatePipelineLayout(v.logicalDevice, &plci, nil, &pipelineLayout)); err != nil {
+		vk.DestroyDescriptorSetLayout(v.logicalDevice, layout.materialSetLayout, nil)
+		return nil, errors.New("vk.CreatePipelineLayout(): " + err.Error())
+	}
+	layout.pipelineLayout = pipelineLayout
+
+	v.layouts[program] = layout
+	return layout, nil
+}
+
+// hasResourceBinding tells if the binding is one of the resource set,
+// used by no more stages than the set was made for
+func (v *VulkanRenderer) hasResourceBinding(b spirv.Binding) bool {
+	for _, rb := range v.resourceBindings {
+		if rb.Binding == b.Binding {
+			return rb.Type == b.Type && rb.Count == b.Count && b.Stages&^rb.Stages == 0
+		}
+	}
+	return false
+}
+
+// hasBindingOf tells if one of the bindings is of the type
+func hasBindingOf(bindings []spirv.Binding, t spirv.DescriptorType) bool {
+	for _, b := range bindings {
+		if b.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// destroyLayouts destroys the layouts of the programs and of the resource set
+func (v *VulkanRenderer) destroyLayouts() {
+	for program, layout := range v.layouts {
+		vk.DestroyPipelineLayout(v.logicalDevice, layout.pipelineLayout, nil)
+		vk.DestroyDescriptorSetLayout(v.logicalDevice, layout.materialSetLayout, nil)
+		delete(v.layouts, program)
+	}
+	vk.DestroyDescriptorSetLayout(v.logicalDevice, v.resourceSetLayout, nil)
+	v.resourceBindings = nil
+}
+
+// vertexFormat returns the format of a location of the type
+func vertexFormat(t spirv.Type) (vk.Format, bool) {
+	if t.Width != 32 || t.Components < 1 || t.Components > 4 {
+		return 0, false
+	}
+	formats := map[spirv.ScalarKind][4]vk.Format{
+		spirv.Float: {vk.FormatR32Sfloat, vk.FormatR32g32Sfloat, vk.FormatR32g32b32Sfloat, vk.FormatR32g32b32a32Sfloat},
+		spirv.Int:   {vk.FormatR32Sint, vk.FormatR32g32Sint, vk.FormatR32g32b32Sint, vk.FormatR32g32b32a32Sint},
+		spirv.Uint:  {vk.FormatR32Uint, vk.FormatR32g32Uint, vk.FormatR32g32b32Uint, vk.FormatR32g32b32a32Uint},
+	}
+	kind, ok := formats[t.Kind]
+	if !ok {
+		return 0, false
+	}
+	return kind[t.Components-1], true
+}
+
+// vertexAttributes returns the attributes of the vertex and the instance
+// the inputs of the vertex stage are at, and checks their formats match
+func vertexAttributes(program string, inputs []spirv.Variable) ([]vk.VertexInputAttributeDescription, error) {
+	available := make(map[uint32]vk.VertexInputAttributeDescription)
+	for _, attribute := range model.VertexAttributeDescriptions() {
+		available[attribute.Location] = attribute
+	}
+
+	var attributes []vk.VertexInputAttributeDescription
+	for _, input := range inputs {
+		format, ok := vertexFormat(input.Type)
+		if !ok {
+			return nil, fmt.Errorf("program %s: input %s has a type no vertex attribute has", program, input.Name)
+		}
+		for location := input.Location; location < input.Location+input.Locations(); location++ {
+			attribute, ok := available[location]
+			if !ok {
+				return nil, fmt.Errorf("program %s: no vertex attribute at location %d of input %s", program, location, input.Name)
+			}
+			if attribute.Format != format {
+				return nil, fmt.Errorf("program %s: input %s at location %d is format %d, the vertex attribute is %d",
+					program, input.Name, location, format, attribute.Format)
+			}
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes, nil
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devblok/koru/src/gfx/spirv"
+)
+
+// ShaderManifestFile is the name of the manifest in the shader directory
+const ShaderManifestFile = "shaders.json"
+
+// shaderStageNames are the names of the stages in a manifest
+var shaderStageNames = map[string]ShaderType{
+	"vert": VertexShaderType,
+	"frag": FragmentShaderType,
+	"geom": GeometryShaderType,
+	"tesc": TessellationControlShaderType,
+	"tese": TessellationEvaluationShaderType,
+	"comp": ComputeShaderType,
+}
+
+// stage returns the SPIR-V stage of the shader type, 0 if it's unknown
+func (t ShaderType) stage() spirv.Stage {
+	switch t {
+	case VertexShaderType:
+		return spirv.StageVertex
+	case FragmentShaderType:
+		return spirv.StageFragment
+	case GeometryShaderType:
+		return spirv.StageGeometry
+	case TessellationControlShaderType:
+		return spirv.StageTessellationControl
+	case TessellationEvaluationShaderType:
+		return spirv.StageTessellationEvaluation
+	case ComputeShaderType:
+		return spirv.StageCompute
+	}
+	return 0
+}
+
+// ShaderManifest describes the shader programs and the materials drawn
+// with them. It's read from ShaderManifestFile in the shader directory:
+//
+//	{
+//		"programs": {
+//			"main": {
+//				"vert": {"file": "main.vert.spv"},
+//				"frag": {"file": "main.frag.spv", "specialization": {"fog": true}}
+//			}
+//		},
+//		"materials": {
+//			"water": {"program": "main", "textures": ["water.png"], "state": {"blend": "alpha"}}
+//		}
+//	}
+type ShaderManifest struct {
+	Programs ProgramsManifest `json:"programs"`
+
+	// Materials are set to the renderer when it's initialised
+	Materials map[string]Material `json:"materials"`
+}
+
+// ProgramsManifest is the programs of a manifest by their name
+type ProgramsManifest map[string]ProgramManifest
+
+// ProgramManifest is the stages of a program by their name. Programs
+// that draw have vert and frag stages, and may have geom, and tesc with
+// tese. Compute programs have only a comp stage
+type ProgramManifest map[string]*StageManifest
+
+// StageManifest is a stage of a program
+type StageManifest struct {
+	// File is the compiled SPIR-V, relative to the shader directory
+	File string `json:"file"`
+
+	// EntryPoint is the function the stage starts at, main if empty
+	EntryPoint string `json:"entryPoint,omitempty"`
+
+	// Specialization sets specialization constants,
+	// by their id or name, to numbers or booleans
+	Specialization map[string]interface{} `json:"specialization,omitempty"`
+
+	// Type, Code, Module and Constants are filled when the manifest is loaded
+	Type      ShaderType               `json:"-"`
+	Code      []byte                   `json:"-"`
+	Module    *spirv.Module            `json:"-"`
+	Constants []SpecializationConstant `json:"-"`
+}
+
+// LoadShaderManifest reads the manifest in the directory and the
+// stages of its programs, and checks that they fit together
+func LoadShaderManifest(dir string) (*ShaderManifest, error) {
+	path := filepath.Join(dir, ShaderManifestFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ShaderManifest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if err := manifest.load(dir); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return &manifest, nil
+}
+
+// load reads and checks the stages and the materials
+func (m *ShaderManifest) load(dir string) error {
+	for _, name := range m.Programs.names() {
+		if err := m.Programs[name].load(dir); err != nil {
+			return fmt.Errorf("program %s: %s", name, err.Error())
+		}
+	}
+	if program, ok := m.Programs[DefaultProgram]; !ok {
+		return fmt.Errorf("no %s program, the default material draws with it", DefaultProgram)
+	} else if program.IsCompute() {
+		return fmt.Errorf("program %s is a compute program, the default material draws with it", DefaultProgram)
+	}
+
+	names := make([]string, 0, len(m.Materials))
+	for name := range m.Materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		material := m.Materials[name]
+		if err := material.Validate(); err != nil {
+			return fmt.Errorf("material %s: %s", name, err.Error())
+		}
+		program, ok := m.Programs[material.Program]
+		if !ok {
+			return fmt.Errorf("material %s: no program %s", name, material.Program)
+		}
+		if program.IsCompute() {
+			return fmt.Errorf("material %s: program %s is a compute program", name, material.Program)
+		}
+	}
+	return nil
+}
+
+// names returns the names of the programs in order
+func (p ProgramsManifest) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsCompute tells if the program has a compute stage
+func (p ProgramManifest) IsCompute() bool {
+	_, ok := p["comp"]
+	return ok
+}
+
+// Stages returns the stages of the program ordered by type,
+// types are known once the manifest is loaded
+func (p ProgramManifest) Stages() []*StageManifest {
+	stages := make([]*StageManifest, 0, len(p))
+	for _, stage := range p {
+		stages = append(stages, stage)
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].Type < stages[j].Type
+	})
+	return stages
+}
+
+// load checks that the program has stages that fit together and reads them
+func (p ProgramManifest) load(dir string) error {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		if _, ok := shaderStageNames[name]; !ok {
+			return fmt.Errorf("unknown stage %s, expected one of %s", name, stageNames())
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	has := func(name string) bool {
+		_, ok := p[name]
+		return ok
+	}
+	switch {
+	case len(p) == 0:
+		return errors.New("no stages")
+	case p.IsCompute() && len(p) > 1:
+		return errors.New("a compute program has no other stages than comp")
+	case !p.IsCompute() && (!has("vert") || !has("frag")):
+		return errors.New("a program that draws needs vert and frag stages")
+	case has("tesc") != has("tese"):
+		return errors.New("tessellation needs both tesc and tese stages")
+	}
+
+	for _, name := range names {
+		stage := p[name]
+		if stage == nil {
+			return fmt.Errorf("stage %s: no file", name)
+		}
+		stage.Type = shaderStageNames[name]
+		if err := stage.load(dir); err != nil {
+			return fmt.Errorf("stage %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// load reads the SPIR-V of the stage and sets its specialization constants
+func (s *StageManifest) load(dir string) error {
+	if s.File == "" {
+		return errors.New("no file")
+	}
+	if filepath.IsAbs(s.File) {
+		return fmt.Errorf("file %s is not relative to the shader directory", s.File)
+	}
+	if s.EntryPoint == "" {
+		s.EntryPoint = shaderEntryPoint
+	}
+
+	code, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(s.File)))
+	if err != nil {
+		return err
+	}
+	module, err := spirv.Parse(code)
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.File, err.Error())
+	}
+	entryPoint, ok := module.EntryPoint(s.EntryPoint)
+	if !ok {
+		return fmt.Errorf("%s has no entry point %s", s.File, s.EntryPoint)
+	}
+	if entryPoint.Stage != s.Type.stage() {
+		return fmt.Errorf("entry point %s of %s is a %s stage", s.EntryPoint, s.File, entryPoint.Stage)
+	}
+	constants, err := specialize(module, s.Specialization)
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.File, err.Error())
+	}
+
+	s.Code, s.Module, s.Constants = code, module, constants
+	return nil
+}
+
+// specialize returns the values of the specialization constants, the
+// keys are ids or names of constants the module has
+func specialize(module *spirv.Module, values map[string]interface{}) ([]SpecializationConstant, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := make(map[uint32]string)
+	var constants []SpecializationConstant
+	for _, key := range keys {
+		constant, ok := specConstant(module, key)
+		if !ok {
+			return nil, fmt.Errorf("no specialization constant %s", key)
+		}
+		if other, ok := set[constant.ID]; ok {
+			return nil, fmt.Errorf("specialization constant %d is set as %s and %s", constant.ID, other, key)
+		}
+		set[constant.ID] = key
+
+		value, err := specializationValue(constant.Type, values[key])
+		if err != nil {
+			return nil, fmt.Errorf("specialization constant %s: %s", key, err.Error())
+		}
+		constants = append(constants, SpecializationConstant{ID: constant.ID, Value: value})
+	}
+	sort.Slice(constants, func(i, j int) bool {
+		return constants[i].ID < constants[j].ID
+	})
+	return constants, nil
+}
+
+// specConstant finds the constant by its id or name
+func specConstant(module *spirv.Module, key string) (spirv.SpecConstant, bool) {
+	if id, err := strconv.ParseUint(key, 10, 32); err == nil {
+		return module.SpecConstant(uint32(id))
+	}
+	for _, constant := range module.SpecConstants {
+		if constant.Name == key {
+			return constant, true
+		}
+	}
+	return spirv.SpecConstant{}, false
+}
+
+// specializationValue returns the bits of the value for a
+// constant of the type, as decoded from JSON
+func specializationValue(t spirv.Type, value interface{}) (uint32, error) {
+	if t.Kind == spirv.Bool {
+		b, ok := value.(bool)
+		if !ok {
+			return 0, fmt.Errorf("%v is not a boolean", value)
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	if t.Width != 32 {
+		return 0, fmt.Errorf("%d bit constants are not supported", t.Width)
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+	switch t.Kind {
+	case spirv.Float:
+		return math.Float32bits(float32(number)), nil
+	case spirv.Int:
+		if number != math.Trunc(number) || number < math.MinInt32 || number > math.MaxInt32 {
+			return 0, fmt.Errorf("%v is not a 32 bit integer", number)
+		}
+		return uint32(int32(number)), nil
+	case spirv.Uint:
+		if number != math.Trunc(number) || number < 0 || number > math.MaxUint32 {
+			return 0, fmt.Errorf("%v is not a 32 bit unsigned integer", number)
+		}
+		return uint32(number), nil
+	}
+	return 0, errors.New("unsupported type")
+}
+
+// stageNames returns the names of the stages, for errors
+func stageNames() string {
+	names := make([]string, 0, len(shaderStageNames))
+	for name := range shaderStageNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
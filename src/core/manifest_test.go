@@ -0,0 +1,179 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	"github.com/devblok/koru/src/gfx/spirv"
+)
+
+// spirvModule is a module with the entry point main of the execution
+// model, a float specialization constant scale with id 0 and a boolean
+// one fog with id 1
+func spirvModule(model uint32) []byte {
+	str := func(s string) []uint32 {
+		b := append([]byte(s), 0)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		words := make([]uint32, len(b)/4)
+		for idx := range words {
+			words[idx] = binary.LittleEndian.Uint32(b[idx*4:])
+		}
+		return words
+	}
+
+	words := []uint32{spirv.Magic, 0x00010000, 0, 6, 0}
+	op := func(opcode uint32, operands ...uint32) {
+		words = append(words, uint32(len(operands)+1)<<16|opcode)
+		words = append(words, operands...)
+	}
+	op(22, 1, 32)                                  // OpTypeFloat %1 32
+	op(50, 1, 2, math.Float32bits(1))              // OpSpecConstant %1 %2 1.0
+	op(5, append([]uint32{2}, str("scale")...)...) // OpName %2 "scale"
+	op(71, 2, 1, 0)                                // OpDecorate %2 SpecId 0
+	op(20, 3)                                      // OpTypeBool %3
+	op(48, 3, 4)                                   // OpSpecConstantTrue %3 %4
+	op(5, append([]uint32{4}, str("fog")...)...)   // OpName %4 "fog"
+	op(71, 4, 1, 1)                                // OpDecorate %4 SpecId 1
+	op(15, append([]uint32{model, 5}, str("main")...)...)
+
+	code := make([]byte, len(words)*4)
+	for idx, w := range words {
+		binary.LittleEndian.PutUint32(code[idx*4:], w)
+	}
+	return code
+}
+
+// shaderDirectory writes the manifest and compiled shaders of every
+// stage of a program and a compute program
+func shaderDirectory(t *testing.T, manifest string) (string, func()) {
+	dir, err := ioutil.TempDir("", "shaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		core.ShaderManifestFile: []byte(manifest),
+		"main.vert.spv":         spirvModule(0),
+		"main.tesc.spv":         spirvModule(1),
+		"main.tese.spv":         spirvModule(2),
+		"main.geom.spv":         spirvModule(3),
+		"main.frag.spv":         spirvModule(4),
+		"particles.comp.spv":    spirvModule(5),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadShaderManifest(t *testing.T) {
+	dir, cleanup := shaderDirectory(t, `{
+		"programs": {
+			"main": {
+				"vert": {"file": "main.vert.spv"},
+				"frag": {"file": "main.frag.spv", "entryPoint": "main", "specialization": {"0": 2.5, "fog": false}}
+			},
+			"terrain": {
+				"vert": {"file": "main.vert.spv"},
+				"tesc": {"file": "main.tesc.spv"},
+				"tese": {"file": "main.tese.spv"},
+				"geom": {"file": "main.geom.spv"},
+				"frag": {"file": "main.frag.spv"}
+			},
+			"particles": {
+				"comp": {"file": "particles.comp.spv"}
+			}
+		},
+		"materials": {
+			"water": {"program": "terrain", "textures": ["water.png"], "state": {"blend": "alpha", "cull": "none"}}
+		}
+	}`)
+	defer cleanup()
+
+	manifest, err := core.LoadShaderManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frag := manifest.Programs["main"]["frag"]
+	if frag.Type != core.FragmentShaderType || frag.Module == nil || len(frag.Code) == 0 {
+		t.Fatalf("fragment stage was not loaded: %+v", frag)
+	}
+	expected := []core.SpecializationConstant{
+		{ID: 0, Value: math.Float32bits(2.5)},
+		{ID: 1, Value: 0},
+	}
+	if len(frag.Constants) != len(expected) || frag.Constants[0] != expected[0] || frag.Constants[1] != expected[1] {
+		t.Errorf("expected constants %+v, got %+v", expected, frag.Constants)
+	}
+	if vert := manifest.Programs["main"]["vert"]; vert.EntryPoint != "main" || len(vert.Constants) != 0 {
+		t.Errorf("unexpected vertex stage %+v", vert)
+	}
+
+	var types []core.ShaderType
+	for _, stage := range manifest.Programs["terrain"].Stages() {
+		types = append(types, stage.Type)
+	}
+	if len(types) != 5 || types[0] != core.VertexShaderType || types[4] != core.TessellationEvaluationShaderType {
+		t.Errorf("stages are not ordered by type: %v", types)
+	}
+	if !manifest.Programs["particles"].IsCompute() || manifest.Programs["main"].IsCompute() {
+		t.Error("compute programs are not told apart")
+	}
+
+	water := manifest.Materials["water"]
+	if water.Program != "terrain" || water.State.Blend != core.BlendAlpha || water.State.Cull != core.CullNone || len(water.Textures) != 1 {
+		t.Errorf("unexpected material %+v", water)
+	}
+}
+
+func TestLoadShaderManifestErrors(t *testing.T) {
+	main := `"main": {"vert": {"file": "main.vert.spv"}, "frag": {"file": "main.frag.spv"}}`
+	for name, c := range map[string]struct {
+		manifest string
+		err      string
+	}{
+		"not json":            {`{"programs": `, "unexpected EOF"},
+		"unknown field":       {`{"programs": {` + main + `}, "shaders": {}}`, "unknown field"},
+		"no main program":     {`{"programs": {}}`, "no main program"},
+		"compute main":        {`{"programs": {"main": {"comp": {"file": "particles.comp.spv"}}}}`, "main is a compute program"},
+		"unknown stage":       {`{"programs": {` + main + `, "x": {"tess": {"file": "main.tesc.spv"}}}}`, "unknown stage tess"},
+		"no fragment stage":   {`{"programs": {"main": {"vert": {"file": "main.vert.spv"}}}}`, "needs vert and frag"},
+		"compute and drawing": {`{"programs": {"main": {"vert": {"file": "main.vert.spv"}, "frag": {"file": "main.frag.spv"}, "comp": {"file": "particles.comp.spv"}}}}`, "no other stages"},
+		"compute with others": {`{"programs": {` + main + `, "x": {"comp": {"file": "particles.comp.spv"}, "vert": {"file": "main.vert.spv"}}}}`, "no other stages"},
+		"half tessellation":   {`{"programs": {"main": {"vert": {"file": "main.vert.spv"}, "frag": {"file": "main.frag.spv"}, "tesc": {"file": "main.tesc.spv"}}}}`, "both tesc and tese"},
+		"missing file":        {`{"programs": {"main": {"vert": {"file": "missing.spv"}, "frag": {"file": "main.frag.spv"}}}}`, "missing.spv"},
+		"wrong stage":         {`{"programs": {"main": {"vert": {"file": "main.frag.spv"}, "frag": {"file": "main.frag.spv"}}}}`, "is a fragment stage"},
+		"no entry point":      {`{"programs": {"main": {"vert": {"file": "main.vert.spv", "entryPoint": "other"}, "frag": {"file": "main.frag.spv"}}}}`, "no entry point other"},
+		"unknown constant":    {`{"programs": {"main": {"vert": {"file": "main.vert.spv", "specialization": {"7": 1}}, "frag": {"file": "main.frag.spv"}}}}`, "no specialization constant 7"},
+		"constant set twice":  {`{"programs": {"main": {"vert": {"file": "main.vert.spv", "specialization": {"0": 1, "scale": 2}}, "frag": {"file": "main.frag.spv"}}}}`, "set as"},
+		"not a boolean":       {`{"programs": {"main": {"vert": {"file": "main.vert.spv", "specialization": {"fog": 1}}, "frag": {"file": "main.frag.spv"}}}}`, "not a boolean"},
+		"not a number":        {`{"programs": {"main": {"vert": {"file": "main.vert.spv", "specialization": {"scale": "big"}}, "frag": {"file": "main.frag.spv"}}}}`, "not a number"},
+		"unknown program":     {`{"programs": {` + main + `}, "materials": {"water": {"program": "water"}}}`, "no program water"},
+		"compute material":    {`{"programs": {` + main + `, "p": {"comp": {"file": "particles.comp.spv"}}}, "materials": {"water": {"program": "p"}}}`, "compute program"},
+		"unknown blend":       {`{"programs": {` + main + `}, "materials": {"water": {"program": "main", "state": {"blend": "multiply"}}}}`, "unknown blend mode"},
+	} {
+		dir, cleanup := shaderDirectory(t, c.manifest)
+		_, err := core.LoadShaderManifest(dir)
+		cleanup()
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected an error about %q, got %s", name, c.err, err)
+		}
+	}
+}
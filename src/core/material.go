@@ -0,0 +1,247 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/devblok/koru/src/gfx/visibility"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// BlendMode is how drawn colors are combined with the ones drawn before
+type BlendMode int
+
+// Blend modes of a RenderState
+const (
+	// BlendOpaque replaces the colors drawn before
+	BlendOpaque BlendMode = iota
+
+	// BlendAlpha mixes with the colors drawn before by alpha
+	BlendAlpha
+
+	// BlendAdditive adds to the colors drawn before, weighted by alpha
+	BlendAdditive
+)
+
+// CullMode is which faces of triangles are not drawn
+type CullMode int
+
+// Cull modes of a RenderState
+const (
+	CullBack CullMode = iota
+	CullFront
+	CullNone
+)
+
+// DepthMode is how the depth buffer is used
+type DepthMode int
+
+// Depth modes of a RenderState
+const (
+	// DepthReadWrite draws what's closer than what's drawn before and
+	// keeps its depth
+	DepthReadWrite DepthMode = iota
+
+	// DepthRead draws what's closer, but leaves the depth as it was
+	DepthRead
+
+	// DepthDisabled draws everything over what's drawn before
+	DepthDisabled
+)
+
+// RenderState is the fixed function state a material is drawn with,
+// the zero value draws opaque, culls back faces and tests depth
+type RenderState struct {
+	Blend BlendMode `json:"blend"`
+	Cull  CullMode  `json:"cull"`
+	Depth DepthMode `json:"depth"`
+}
+
+// Names of the modes, as they're written in a shader manifest
+var (
+	blendModeNames = []string{"opaque", "alpha", "additive"}
+	cullModeNames  = []string{"back", "front", "none"}
+	depthModeNames = []string{"readwrite", "read", "disabled"}
+)
+
+// modeText returns the name of the mode
+func modeText(names []string, mode int) ([]byte, error) {
+	if mode < 0 || mode >= len(names) {
+		return nil, fmt.Errorf("unknown mode %d", mode)
+	}
+	return []byte(names[mode]), nil
+}
+
+// parseMode returns the mode with the name
+func parseMode(names []string, kind string, text []byte) (int, error) {
+	for mode, name := range names {
+		if name == string(text) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s mode %q, expected one of %s", kind, text, strings.Join(names, ", "))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m BlendMode) MarshalText() ([]byte, error) {
+	return modeText(blendModeNames, int(m))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *BlendMode) UnmarshalText(text []byte) error {
+	mode, err := parseMode(blendModeNames, "blend", text)
+	*m = BlendMode(mode)
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m CullMode) MarshalText() ([]byte, error) {
+	return modeText(cullModeNames, int(m))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *CullMode) UnmarshalText(text []byte) error {
+	mode, err := parseMode(cullModeNames, "cull", text)
+	*m = CullMode(mode)
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m DepthMode) MarshalText() ([]byte, error) {
+	return modeText(depthModeNames, int(m))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *DepthMode) UnmarshalText(text []byte) error {
+	mode, err := parseMode(depthModeNames, "depth", text)
+	*m = DepthMode(mode)
+	return err
+}
+
+// Limits of a Material
+const (
+	MaxMaterialParams   = 16
+	MaxMaterialTextures = 4
+)
+
+// DefaultMaterialName is the material of instances that don't name one
+const DefaultMaterialName = "default"
+
+// DefaultProgram is the shader program of the default material
+const DefaultProgram = "main"
+
+// DefaultMaterial is the material renderers start with, it draws
+// with the main shaders and the texture of the mesh
+var DefaultMaterial = Material{Program: DefaultProgram}
+
+// Material describes how instances are drawn. Materials are
+// set to the renderer with SetMaterial, instances refer to them by name.
+type Material struct {
+	// Program names the shaders the material is drawn with
+	Program string `json:"program"`
+
+	// Params are handed to the shaders in the uniform buffer
+	// of set 1, one vec4 after another
+	Params []glm.Vec4 `json:"params,omitempty"`
+
+	// Textures are ids of textures bound to the samplers of set 1, in
+	// the order of their bindings. There must be as many as the shaders
+	// sample. The texture of the mesh is the sampler of set 0
+	Textures []string `json:"textures,omitempty"`
+
+	State RenderState `json:"state"`
+}
+
+// Validate checks that the material can be drawn with
+func (m Material) Validate() error {
+	if m.Program == "" {
+		return errors.New("no shader program")
+	}
+	if len(m.Params) > MaxMaterialParams {
+		return fmt.Errorf("%d params, no more than %d are supported", len(m.Params), MaxMaterialParams)
+	}
+	if len(m.Textures) > MaxMaterialTextures {
+		return fmt.Errorf("%d textures, no more than %d are supported", len(m.Textures), MaxMaterialTextures)
+	}
+	if m.State.Blend < BlendOpaque || m.State.Blend > BlendAdditive {
+		return fmt.Errorf("unknown blend mode %d", m.State.Blend)
+	}
+	if m.State.Cull < CullBack || m.State.Cull > CullNone {
+		return fmt.Errorf("unknown cull mode %d", m.State.Cull)
+	}
+	if m.State.Depth < DepthReadWrite || m.State.Depth > DepthDisabled {
+		return fmt.Errorf("unknown depth mode %d", m.State.Depth)
+	}
+	return nil
+}
+
+// blendedKey is set in the pipeline keys of materials that blend,
+// they're drawn over the opaque ones, back to front
+const blendedKey = visibility.Blended
+
+// PipelineKey is a hash of what the pipeline of the material is made
+// of, materials with the same key share the pipeline. Params and
+// textures are not part of it, they're bound separately. Keys of
+// blending materials are larger than the keys of opaque ones
+func (m Material) PipelineKey() uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(m.Program))
+	hash.Write([]byte{0})
+	binary.Write(hash, binary.LittleEndian, []int32{
+		int32(m.State.Blend),
+		int32(m.State.Cull),
+		int32(m.State.Depth),
+	})
+	if m.State.Blend != BlendOpaque {
+		return hash.Sum64() | blendedKey
+	}
+	return hash.Sum64() &^ blendedKey
+}
+
+// materialName returns the material an instance is drawn with
+func materialName(instance ResourceInstance) string {
+	if instance.Material == "" {
+		return DefaultMaterialName
+	}
+	return instance.Material
+}
+
+// materialSet keeps the materials of a renderer, safe to use concurrently
+type materialSet struct {
+	lock      sync.RWMutex
+	materials map[string]Material
+}
+
+// newMaterialSet creates a set with the default material
+func newMaterialSet() *materialSet {
+	return &materialSet{
+		materials: map[string]Material{DefaultMaterialName: DefaultMaterial},
+	}
+}
+
+func (s *materialSet) set(name string, material Material) error {
+	if err := material.Validate(); err != nil {
+		return fmt.Errorf("material %s: %s", name, err.Error())
+	}
+
+	s.lock.Lock()
+	s.materials[name] = material
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *materialSet) get(name string) (Material, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	material, ok := s.materials[name]
+	return material, ok
+}
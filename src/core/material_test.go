@@ -0,0 +1,172 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestMaterialValidate(t *testing.T) {
+	if err := core.DefaultMaterial.Validate(); err != nil {
+		t.Fatalf("default material: %s", err)
+	}
+
+	for name, material := range map[string]core.Material{
+		"no program":     {},
+		"many params":    {Program: "main", Params: make([]glm.Vec4, core.MaxMaterialParams+1)},
+		"many textures":  {Program: "main", Textures: make([]string, core.MaxMaterialTextures+1)},
+		"unknown blend":  {Program: "main", State: core.RenderState{Blend: 7}},
+		"unknown cull":   {Program: "main", State: core.RenderState{Cull: -1}},
+		"unknown depths": {Program: "main", State: core.RenderState{Depth: 3}},
+	} {
+		if err := material.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMaterialPipelineKey(t *testing.T) {
+	base := core.Material{Program: "main"}
+	same := core.Material{
+		Program:  "main",
+		Params:   []glm.Vec4{{1, 2, 3, 4}},
+		Textures: []string{"checker.png"},
+	}
+	if base.PipelineKey() != same.PipelineKey() {
+		t.Fatal("params and textures changed the pipeline key")
+	}
+
+	keys := map[uint64]string{base.PipelineKey(): "base"}
+	for name, material := range map[string]core.Material{
+		"program": {Program: "toon"},
+		"blend":   {Program: "main", State: core.RenderState{Blend: core.BlendAlpha}},
+		"cull":    {Program: "main", State: core.RenderState{Cull: core.CullNone}},
+		"depth":   {Program: "main", State: core.RenderState{Depth: core.DepthRead}},
+	} {
+		key := material.PipelineKey()
+		if other, ok := keys[key]; ok {
+			t.Errorf("%s has the key of %s", name, other)
+		}
+		keys[key] = name
+	}
+
+	additive := core.Material{Program: "a", State: core.RenderState{Blend: core.BlendAdditive}}
+	for _, program := range []string{"a", "main", "toon", "zzz"} {
+		if opaque := (core.Material{Program: program}); opaque.PipelineKey() >= additive.PipelineKey() {
+			t.Fatalf("opaque %s is not drawn before blended materials", program)
+		}
+	}
+}
+
+func TestNullRendererMaterials(t *testing.T) {
+	renderer := core.NewNullRenderer(nil)
+	renderer.Initialise()
+	defer renderer.Destroy()
+
+	if err := renderer.SetMaterial("bad", core.Material{}); err == nil {
+		t.Fatal("expected an invalid material to fail")
+	}
+
+	instance := core.ResourceInstance{ResourceID: "cube.dae", Material: "glass"}
+	if _, ok := <-renderer.ResourceUpdate(renderer.ResourceHandle(), instance); ok {
+		t.Fatal("instance of a material that's not set was updated")
+	}
+
+	if err := renderer.SetMaterial("glass", core.Material{Program: "main", State: core.RenderState{Blend: core.BlendAlpha}}); err != nil {
+		t.Fatal(err)
+	}
+	handle := renderer.ResourceHandle()
+	if _, ok := <-renderer.ResourceUpdate(handle, instance); !ok {
+		t.Fatal("instance was not updated")
+	}
+	<-renderer.ResourceUpdate(renderer.ResourceHandle(), core.ResourceInstance{ResourceID: "cube.dae"})
+
+	renderer.Draw()
+	draws := renderer.LastFrame().Draws
+	if len(draws) != 2 || draws[0].Material != "glass" || draws[1].Material != core.DefaultMaterialName {
+		t.Fatalf("unexpected materials drawn: %+v", draws)
+	}
+}
+
+func TestSoftwareRendererMaterials(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 64, 48)
+	defer cleanup()
+
+	for name, material := range map[string]core.Material{
+		"twosided": {Program: "main", State: core.RenderState{Cull: core.CullNone}},
+		"glass": {
+			Program:  "main",
+			Textures: []string{"glass.png"},
+			State:    core.RenderState{Blend: core.BlendAlpha, Depth: core.DepthRead},
+		},
+		"overlay": {Program: "main", State: core.RenderState{Blend: core.BlendAdditive, Depth: core.DepthDisabled}},
+	} {
+		if err := renderer.SetMaterial(name, material); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := renderer.SetMaterial("missing", core.Material{Program: "main", Textures: []string{"missing.png"}}); err == nil {
+		t.Fatal("expected a material with a missing texture to fail")
+	}
+
+	near := func(c, expected color.RGBA) bool {
+		diff := func(a, b uint8) bool {
+			return int(a)-int(b) > 2 || int(b)-int(a) > 2
+		}
+		return !diff(c.R, expected.R) && !diff(c.G, expected.G) && !diff(c.B, expected.B)
+	}
+	for name, c := range map[string]struct {
+		instances []core.ResourceInstance
+		expected  color.RGBA
+	}{
+		"back face drawn without culling": {
+			instances: []core.ResourceInstance{func() core.ResourceInstance {
+				instance := placed("back.obj", 0, 0, 0)
+				instance.Material = "twosided"
+				return instance
+			}()},
+			expected: color.RGBA{255, 255, 255, 255},
+		},
+		"blue through half transparent red": {
+			instances: []core.ResourceInstance{
+				placed("blue.obj", 0, 0, 0),
+				func() core.ResourceInstance {
+					instance := placed("red.obj", 0.3, 0.3, 0.3)
+					instance.Material = "glass"
+					return instance
+				}(),
+			},
+			expected: color.RGBA{128, 0, 127, 255},
+		},
+		"added over what's in front": {
+			instances: []core.ResourceInstance{
+				placed("blue.obj", 0.3, 0.3, 0.3),
+				func() core.ResourceInstance {
+					instance := placed("red.obj", 0, 0, 0)
+					instance.Material = "overlay"
+					return instance
+				}(),
+			},
+			expected: color.RGBA{255, 0, 255, 255},
+		},
+	} {
+		instances := make(map[core.ResourceHandle]core.ResourceInstance)
+		for _, instance := range c.instances {
+			instances[renderer.ResourceHandle()] = instance
+		}
+		frame := drawFrame(t, renderer, instances)
+		if got := frame.RGBAAt(32, 24); !near(got, c.expected) {
+			t.Errorf("%s: expected %v in the center, got %v", name, c.expected, got)
+		}
+		for handle := range instances {
+			renderer.ResourceDelete(handle)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/devblok/koru/src/gfx"
+	vk "github.com/devblok/vulkan"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// NullDraw is a draw a NullRenderer would have made
+type NullDraw struct {
+	Handle     ResourceHandle
+	ResourceID string
+	Material   string
+
+	// Model is the model matrix of the instance
+	Model glm.Mat4
+}
+
+// NullFrame is what a NullRenderer would have drawn in a frame
+type NullFrame struct {
+	// Number counts the frames drawn, starting with 1
+	Number uint64
+
+	// Draws are ordered by the handle
+	Draws []NullDraw
+
+	// Cameras are the names of the cameras the frame is drawn with, in order
+	Cameras []string
+
+	// Presented is set once the frame is presented
+	Presented bool
+}
+
+// NewNullRenderer creates a renderer that draws nothing. Resources
+// are loaded with the loader, so ids are checked like a renderer
+// on a GPU would. Without a loader every id is accepted.
+func NewNullRenderer(loader gfx.Loader) *NullRenderer {
+	n := &NullRenderer{
+		instances: make(map[ResourceHandle]ResourceInstance),
+		resources: make(map[ResourceHandle]*gfx.Handle),
+		cameras:   newCameraSet(),
+		materials: newMaterialSet(),
+	}
+	if loader != nil {
+		n.cache = gfx.NewCache(loader, 0)
+	}
+	return n
+}
+
+// NullRenderer implements Renderer without a GPU, a window or a
+// surface. Draw records what would be drawn, which can be looked at
+// with LastFrame. Use it for tests and servers.
+type NullRenderer struct {
+	Renderer
+
+	cache       *gfx.Cache
+	initialised bool
+	counter     uint32
+
+	instanceLock sync.RWMutex
+	instances    map[ResourceHandle]ResourceInstance
+	resources    map[ResourceHandle]*gfx.Handle
+
+	cameras   *cameraSet
+	materials *materialSet
+
+	frameLock  sync.Mutex
+	frame      NullFrame
+	dispatches []ComputeDispatch
+}
+
+// Initialise implements interface
+func (n *NullRenderer) Initialise() error {
+	n.initialised = true
+	return nil
+}
+
+// ResourceHandle implements interface
+func (n *NullRenderer) ResourceHandle() ResourceHandle {
+	return ResourceHandle(atomic.AddUint32(&n.counter, 1) - 1)
+}
+
+// ResourceUpdate implements interface, the channel is closed without
+// a value if the resource could not be loaded or the material is not set
+func (n *NullRenderer) ResourceUpdate(handle ResourceHandle, instance ResourceInstance) <-chan struct{} {
+	sig := make(chan struct{}, 1)
+	if _, ok := n.materials.get(materialName(instance)); !ok {
+		close(sig)
+		return sig
+	}
+
+	n.instanceLock.RLock()
+	current, ok := n.resources[handle]
+	n.instanceLock.RUnlock()
+
+	var previous *gfx.Handle
+	if n.cache != nil && (!ok || current.ID() != instance.ResourceID) {
+		res, err := n.cache.Acquire(instance.ResourceID)
+		if err != nil {
+			close(sig)
+			return sig
+		}
+		<-res.Resource().Ready()
+		if failed, ok := res.Resource().(interface{ Err() error }); ok && failed.Err() != nil {
+			res.Release()
+			close(sig)
+			return sig
+		}
+		previous, current = current, res
+	}
+
+	n.instanceLock.Lock()
+	n.instances[handle] = instance
+	if current != nil {
+		n.resources[handle] = current
+	}
+	n.instanceLock.Unlock()
+
+	if previous != nil {
+		previous.Release()
+	}
+	sig <- struct{}{}
+	return sig
+}
+
+// ResourceDelete implements interface
+func (n *NullRenderer) ResourceDelete(handle ResourceHandle) {
+	n.instanceLock.Lock()
+	res, ok := n.resources[handle]
+	delete(n.instances, handle)
+	delete(n.resources, handle)
+	n.instanceLock.Unlock()
+
+	if ok {
+		res.Release()
+	}
+}
+
+// ResourceStats implements interface
+func (n *NullRenderer) ResourceStats() gfx.CacheStats {
+	if n.cache == nil {
+		return gfx.CacheStats{}
+	}
+	return n.cache.Stats()
+}
+
+// SetCamera implements interface
+func (n *NullRenderer) SetCamera(name string, camera Camera) error {
+	return n.cameras.set(name, camera, 0)
+}
+
+// RemoveCamera implements interface
+func (n *NullRenderer) RemoveCamera(name string) {
+	n.cameras.remove(name)
+}
+
+// SetMaterial implements interface
+func (n *NullRenderer) SetMaterial(name string, material Material) error {
+	return n.materials.set(name, material)
+}
+
+// CreateStorageBuffer implements interface, the buffer is in memory
+func (n *NullRenderer) CreateStorageBuffer(size int) (StorageBuffer, error) {
+	return newHostStorageBuffer(size)
+}
+
+// Dispatch implements interface, records the dispatch. No work is done,
+// the buffers are left as they are
+func (n *NullRenderer) Dispatch(work ComputeDispatch) (<-chan struct{}, error) {
+	if !n.initialised {
+		return nil, errors.New("renderer is not initialised")
+	}
+	if err := work.Validate(); err != nil {
+		return nil, err
+	}
+
+	n.frameLock.Lock()
+	n.dispatches = append(n.dispatches, work)
+	n.frameLock.Unlock()
+
+	done := make(chan struct{})
+	close(done)
+	return done, nil
+}
+
+// Dispatches returns the dispatches submitted so far, in order
+func (n *NullRenderer) Dispatches() []ComputeDispatch {
+	n.frameLock.Lock()
+	defer n.frameLock.Unlock()
+	return append([]ComputeDispatch(nil), n.dispatches...)
+}
+
+// Draw implements interface, records the draws of the instances
+func (n *NullRenderer) Draw() error {
+	if !n.initialised {
+		return errors.New("renderer is not initialised")
+	}
+
+	n.instanceLock.RLock()
+	draws := make([]NullDraw, 0, len(n.instances))
+	for handle, instance := range n.instances {
+		draws = append(draws, NullDraw{
+			Handle:     handle,
+			ResourceID: instance.ResourceID,
+			Material:   materialName(instance),
+			Model:      instance.Position.Mul4(instance.Rotation),
+		})
+	}
+	n.instanceLock.RUnlock()
+	sort.Slice(draws, func(i, j int) bool {
+		return draws[i].Handle < draws[j].Handle
+	})
+
+	var cameras []string
+	for _, camera := range n.cameras.sorted() {
+		cameras = append(cameras, camera.name)
+	}
+
+	n.frameLock.Lock()
+	n.frame = NullFrame{
+		Number:  n.frame.Number + 1,
+		Draws:   draws,
+		Cameras: cameras,
+	}
+	n.frameLock.Unlock()
+	return nil
+}
+
+// Present implements interface
+func (n *NullRenderer) Present() error {
+	n.frameLock.Lock()
+	defer n.frameLock.Unlock()
+	if n.frame.Number == 0 {
+		return errors.New("nothing was drawn to present")
+	}
+	n.frame.Presented = true
+	return nil
+}
+
+// LastFrame returns the frame drawn last
+func (n *NullRenderer) LastFrame() NullFrame {
+	n.frameLock.Lock()
+	defer n.frameLock.Unlock()
+	return n.frame
+}
+
+// DeviceIsSuitable implements interface, any device will do
+func (n *NullRenderer) DeviceIsSuitable(vk.PhysicalDevice) (bool, string) {
+	return true, ""
+}
+
+// Destroy implements interface, releases all resources
+func (n *NullRenderer) Destroy() {
+	n.instanceLock.Lock()
+	for handle, res := range n.resources {
+		res.Release()
+		delete(n.resources, handle)
+	}
+	n.instances = make(map[ResourceHandle]ResourceInstance)
+	n.instanceLock.Unlock()
+
+	if n.cache != nil {
+		n.cache.Purge()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	"github.com/devblok/koru/src/gfx"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestNullRenderer(t *testing.T) {
+	var renderer core.Renderer = core.NewNullRenderer(nil)
+	if err := renderer.Draw(); err == nil {
+		t.Fatal("expected drawing before Initialise to fail")
+	}
+	if err := renderer.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Destroy()
+
+	first, second := renderer.ResourceHandle(), renderer.ResourceHandle()
+	if first == second {
+		t.Fatal("handles are not unique")
+	}
+	if err := renderer.Present(); err == nil {
+		t.Fatal("expected presenting before drawing to fail")
+	}
+
+	for handle, x := range map[core.ResourceHandle]float32{second: 1, first: 2} {
+		if _, ok := <-renderer.ResourceUpdate(handle, core.ResourceInstance{
+			ResourceID: "anything",
+			Position:   glm.Translate3D(x, 0, 0),
+			Rotation:   glm.HomogRotate3DZ(glm.DegToRad(90)),
+		}); !ok {
+			t.Fatalf("update of %d failed", handle)
+		}
+	}
+	if err := renderer.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.Present(); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := renderer.(*core.NullRenderer).LastFrame()
+	if frame.Number != 1 || !frame.Presented || len(frame.Draws) != 2 {
+		t.Fatalf("bad frame: %+v", frame)
+	}
+	if frame.Draws[0].Handle != first || frame.Draws[1].Handle != second {
+		t.Fatal("draws are not ordered by handle")
+	}
+	moved := frame.Draws[0].Model.Mul4x1(glm.Vec4{1, 0, 0, 1})
+	if !moved.ApproxEqualThreshold(glm.Vec4{2, 1, 0, 1}, 1e-5) {
+		t.Fatalf("model matrix is not position by rotation, got: %v", moved)
+	}
+
+	renderer.ResourceDelete(first)
+	renderer.Draw()
+	frame = renderer.(*core.NullRenderer).LastFrame()
+	if frame.Number != 2 || frame.Presented || len(frame.Draws) != 1 || frame.Draws[0].Handle != second {
+		t.Fatalf("deleted instance still drawn: %+v", frame)
+	}
+}
+
+func TestNullRendererResources(t *testing.T) {
+	renderer := core.NewNullRenderer(gfx.NewSearchLoader(gfx.Dir("../../assets")))
+	renderer.Initialise()
+	defer renderer.Destroy()
+
+	first, second := renderer.ResourceHandle(), renderer.ResourceHandle()
+	for _, handle := range []core.ResourceHandle{first, second} {
+		if _, ok := <-renderer.ResourceUpdate(handle, core.ResourceInstance{ResourceID: "cube.dae"}); !ok {
+			t.Fatal("cube was not loaded")
+		}
+	}
+	if _, ok := <-renderer.ResourceUpdate(renderer.ResourceHandle(), core.ResourceInstance{ResourceID: "missing.dae"}); ok {
+		t.Fatal("missing resource was signalled as updated")
+	}
+
+	stats := renderer.ResourceStats()
+	if stats.Resources != 1 || stats.Loads != 2 || stats.Hits != 1 {
+		t.Fatalf("cube was not shared: %+v", stats)
+	}
+
+	renderer.ResourceDelete(first)
+	renderer.ResourceDelete(second)
+	if stats := renderer.ResourceStats(); stats.Resources != 0 {
+		t.Fatalf("cube was not released: %+v", stats)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/devblok/koru/src/gfx/spirv"
+	"github.com/devblok/koru/src/gfx/vkr"
+	vk "github.com/devblok/vulkan"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Descriptor sets of the pipeline layout
+const (
+	resourceDescriptorSet = 0
+	materialDescriptorSet = 1
+)
+
+// materialParamsSize is the size of the uniform buffer of material params
+const materialParamsSize = MaxMaterialParams * int(unsafe.Sizeof(glm.Vec4{}))
+
+// vulkanMaterial is a material with its params and textures uploaded
+type vulkanMaterial struct {
+	Material
+
+	renderer *VulkanRenderer
+	layout   *programLayout
+
+	paramsBuffer  vk.Buffer
+	paramsMemory  vkr.Memory
+	textures      []*deviceTexture
+	descriptorSet vk.DescriptorSet
+}
+
+func (m *vulkanMaterial) destroy() {
+	v := m.renderer
+	if m.descriptorSet != vk.NullDescriptorSet {
+		vk.FreeDescriptorSets(v.logicalDevice, v.descriptorPool, 1, &m.descriptorSet)
+	}
+	for _, tex := range m.textures {
+		tex.destroy(v.logicalDevice)
+	}
+	vk.DestroyBuffer(v.logicalDevice, m.paramsBuffer, nil)
+	m.paramsMemory.Release()
+}
+
+// SetMaterial implements interface, the textures of the material
+// are uploaded before it returns. The renderer must be initialised
+func (v *VulkanRenderer) SetMaterial(name string, material Material) error {
+	if err := material.Validate(); err != nil {
+		return fmt.Errorf("material %s: %s", name, err.Error())
+	}
+	if v.logicalDevice == nil {
+		return errors.New("renderer is not initialised")
+	}
+	layout, err := v.programLayout(material.Program)
+	if err != nil {
+		return fmt.Errorf("material %s: %s", name, err.Error())
+	}
+	if textures := layout.materialTextures(); len(material.Textures) < textures {
+		return fmt.Errorf("material %s: program %s samples %d textures, the material has %d",
+			name, material.Program, textures, len(material.Textures))
+	}
+
+	mat, err := v.createMaterial(material, layout)
+	if err != nil {
+		return fmt.Errorf("material %s: %s", name, err.Error())
+	}
+
+	v.materialLock.Lock()
+	previous := v.materials[name]
+	v.materials[name] = mat
+	v.materialLock.Unlock()
+
+	if previous != nil {
+		v.waitIdle()
+		previous.destroy()
+	}
+	return nil
+}
+
+func (v *VulkanRenderer) createMaterial(material Material, layout *programLayout) (*vulkanMaterial, error) {
+	mat := &vulkanMaterial{
+		Material: material,
+		renderer: v,
+		layout:   layout,
+	}
+
+	if err := v.createBuffer(&mat.paramsBuffer, materialParamsSize, vk.BufferUsageUniformBufferBit, vk.SharingModeExclusive); err != nil {
+		return nil, err
+	}
+
+	var memoryRequirements vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(v.logicalDevice, mat.paramsBuffer, &memoryRequirements)
+	memoryRequirements.Deref()
+
+	memory, err := v.allocator.Malloc(
+		memoryRequirements,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	mat.paramsMemory = memory
+	vk.BindBufferMemory(v.logicalDevice, mat.paramsBuffer, mat.paramsMemory.Get(), 0)
+
+	var mappedMemory unsafe.Pointer
+	vk.MapMemory(
+		v.logicalDevice,
+		mat.paramsMemory.Get(),
+		vk.DeviceSize(mat.paramsMemory.Offset()),
+		vk.DeviceSize(materialParamsSize), 0,
+		&mappedMemory,
+	)
+	params := *(*[]glm.Vec4)(unsafe.Pointer(&sliceHeader{
+		Data: uintptr(mappedMemory),
+		Cap:  MaxMaterialParams,
+		Len:  MaxMaterialParams,
+	}))
+	for idx := range params {
+		params[idx] = glm.Vec4{}
+	}
+	copy(params, material.Params)
+	vk.UnmapMemory(v.logicalDevice, mat.paramsMemory.Get())
+
+	for _, id := range material.Textures {
+		tex, err := loadTexture(v.loader, id)
+		if err != nil {
+			return nil, err
+		}
+
+		deviceTex := &deviceTexture{}
+		if err := v.createTextureImage(deviceTex, tex); err != nil {
+			return nil, err
+		}
+		if err := v.createTextureImageView(deviceTex); err != nil {
+			return nil, err
+		}
+		mat.textures = append(mat.textures, deviceTex)
+	}
+
+	if err := v.createMaterialDescriptorSet(mat); err != nil {
+		return nil, err
+	}
+	return mat, nil
+}
+
+// createMaterialDescriptorSet allocates set 1 of the material from the
+// descriptor pool, with the params at the uniform buffer of the set and
+// the textures at its samplers, in order
+func (v *VulkanRenderer) createMaterialDescriptorSet(mat *vulkanMaterial) error {
+	dsai := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     v.descriptorPool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{mat.layout.materialSetLayout},
+	}
+
+	var descriptorSet vk.DescriptorSet
+	if err := vk.Error(vk.AllocateDescriptorSets(v.logicalDevice, &dsai, &descriptorSet)); err != nil {
+		return fmt.Errorf("vk.AllocateDescriptorSets(): %s", err.Error())
+	}
+
+	var wds []vk.WriteDescriptorSet
+	textures := mat.textures
+	for _, b := range mat.layout.reflection.Sets[materialDescriptorSet] {
+		switch b.Type {
+		case spirv.UniformBuffer:
+			wds = append(wds, vk.WriteDescriptorSet{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          descriptorSet,
+				DstBinding:      b.Binding,
+				DstArrayElement: 0,
+				DescriptorType:  vk.DescriptorTypeUniformBuffer,
+				DescriptorCount: 1,
+				PBufferInfo: []vk.DescriptorBufferInfo{{
+					Buffer: mat.paramsBuffer,
+					Offset: 0,
+					Range:  vk.DeviceSize(materialParamsSize),
+				}},
+			})
+		case spirv.CombinedImageSampler:
+			images := make([]vk.DescriptorImageInfo, b.Count)
+			for idx := range images {
+				images[idx] = vk.DescriptorImageInfo{
+					ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+					ImageView:   textures[idx].textureImageView,
+					Sampler:     v.textureSampler,
+				}
+			}
+			textures = textures[b.Count:]
+			wds = append(wds, vk.WriteDescriptorSet{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          descriptorSet,
+				DstBinding:      b.Binding,
+				DstArrayElement: 0,
+				DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+				DescriptorCount: b.Count,
+				PImageInfo:      images,
+			})
+		}
+	}
+	vk.UpdateDescriptorSets(v.logicalDevice, uint32(len(wds)), wds, 0, nil)
+
+	mat.descriptorSet = descriptorSet
+	return nil
+}
+
+// programShaders returns the loaded shaders of the program
+func (v *VulkanRenderer) programShaders(program string) []Shader {
+	var shaders []Shader
+	for _, shader := range v.shaders {
+		if shader.Name() == program {
+			shaders = append(shaders, shader)
+		}
+	}
+	return shaders
+}
+
+// specializationInfo returns the specialization info of the constants,
+// nil if there are none. Every constant is a 32 bit scalar
+func specializationInfo(constants []SpecializationConstant) []vk.SpecializationInfo {
+	if len(constants) == 0 {
+		return nil
+	}
+	entries := make([]vk.SpecializationMapEntry, len(constants))
+	data := make([]uint32, len(constants))
+	for idx, c := range constants {
+		entries[idx] = vk.SpecializationMapEntry{
+			ConstantID: c.ID,
+			Offset:     uint32(idx * 4),
+			Size:       4,
+		}
+		data[idx] = c.Value
+	}
+	return []vk.SpecializationInfo{{
+		MapEntryCount: uint32(len(entries)),
+		PMapEntries:   entries,
+		DataSize:      uint(len(data) * 4),
+		PData:         unsafe.Pointer(&data[0]),
+	}}
+}
+
+// materialPipeline returns the pipeline the material is drawn with,
+// creating it if no material with the same key was drawn before
+func (v *VulkanRenderer) materialPipeline(material Material) (vk.Pipeline, error) {
+	key := material.PipelineKey()
+	if pipeline, ok := v.pipelines[key]; ok {
+		return pipeline, nil
+	}
+
+	layout, err := v.programLayout(material.Program)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := v.createPipeline(layout, v.programShaders(material.Program), material.State)
+	if err != nil {
+		return nil, fmt.Errorf("program %s: %s", material.Program, err.Error())
+	}
+	v.pipelines[key] = pipeline
+	return pipeline, nil
+}
+
+// destroyPipelines destroys the pipelines of materials,
+// they are created again when they're drawn with next
+func (v *VulkanRenderer) destroyPipelines() {
+	for key, pipeline := range v.pipelines {
+		vk.DestroyPipeline(v.logicalDevice, pipeline, nil)
+		delete(v.pipelines, key)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/devblok/koru/src/texture"
+)
+
+// PixelFormat is a layout of texels that images are packed into
+type PixelFormat int
+
+const (
+	// PixelFormatRGBA8 is 4 bytes per texel, premultiplied like image.RGBA
+	PixelFormatRGBA8 PixelFormat = iota
+
+	// PixelFormatR8 is a byte per texel, the red channel,
+	// which is the gray level of grayscale images
+	PixelFormatR8
+
+	// PixelFormatRG8 is 2 bytes per texel, the red and green channels
+	PixelFormatRG8
+
+	// PixelFormatRGBA16F is 4 half floats per texel, premultiplied.
+	// Values of float images are kept beyond 1
+	PixelFormatRGBA16F
+)
+
+// TexelSize returns the bytes of a single texel
+func (f PixelFormat) TexelSize() int {
+	switch f {
+	case PixelFormatR8:
+		return 1
+	case PixelFormatRG8:
+		return 2
+	case PixelFormatRGBA16F:
+		return 8
+	default:
+		return 4
+	}
+}
+
+// GetPixels transforms a given image into RGBA8 pixels,
+// see PackPixels for the row pitch
+func GetPixels(img image.Image, rowPitch int) ([]uint8, error) {
+	return PackPixels(img, PixelFormatRGBA8, rowPitch)
+}
+
+// PackPixels transforms a given image into rows of texels of the format,
+// each row starting rowPitch bytes after the one before. A row pitch
+// smaller than a row of texels, like 0, packs the rows tightly.
+// Images already in the layout of the format are copied row by row
+func PackPixels(img image.Image, format PixelFormat, rowPitch int) ([]uint8, error) {
+	if format < PixelFormatRGBA8 || format > PixelFormatRGBA16F {
+		return nil, fmt.Errorf("unknown pixel format %d", format)
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowSize := width * format.TexelSize()
+	if rowPitch < rowSize {
+		rowPitch = rowSize
+	}
+	pixels := make([]uint8, rowPitch*height)
+	if width == 0 || height == 0 {
+		return pixels, nil
+	}
+
+	copyRows := func(src []uint8, stride int) {
+		for y := 0; y < height; y++ {
+			copy(pixels[y*rowPitch:y*rowPitch+rowSize], src[y*stride:])
+		}
+	}
+	switch format {
+	case PixelFormatRGBA8:
+		if src, ok := img.(*image.RGBA); ok {
+			copyRows(src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y):], src.Stride)
+			return pixels, nil
+		}
+		// draw straight into the rows, the canvas shares their memory
+		canvas := &image.RGBA{
+			Pix:    pixels,
+			Stride: rowPitch,
+			Rect:   image.Rect(0, 0, width, height),
+		}
+		draw.Draw(canvas, canvas.Rect, img, bounds.Min, draw.Src)
+		return pixels, nil
+	case PixelFormatR8:
+		if src, ok := img.(*image.Gray); ok {
+			copyRows(src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y):], src.Stride)
+			return pixels, nil
+		}
+	case PixelFormatRGBA16F:
+		if src, ok := img.(*texture.FloatImage); ok {
+			for y := 0; y < height; y++ {
+				row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+				dst := pixels[y*rowPitch:]
+				for idx := 0; idx < width*4; idx++ {
+					binary.LittleEndian.PutUint16(dst[idx*2:], texture.FloatToHalf(row[idx]))
+				}
+			}
+			return pixels, nil
+		}
+	}
+
+	// everything else goes texel by texel
+	texel := texelReader(img)
+	quantize := func(v float32) uint8 {
+		return uint8(math.Max(0, math.Min(1, float64(v)))*255 + 0.5)
+	}
+	for y := 0; y < height; y++ {
+		dst := pixels[y*rowPitch:]
+		for x := 0; x < width; x++ {
+			v := texel(bounds.Min.X+x, bounds.Min.Y+y)
+			switch format {
+			case PixelFormatR8:
+				dst[x] = quantize(v[0])
+			case PixelFormatRG8:
+				dst[x*2], dst[x*2+1] = quantize(v[0]), quantize(v[1])
+			case PixelFormatRGBA16F:
+				for c := 0; c < 4; c++ {
+					binary.LittleEndian.PutUint16(dst[x*8+c*2:], texture.FloatToHalf(v[c]))
+				}
+			}
+		}
+	}
+	return pixels, nil
+}
+
+// texelReader returns a function reading premultiplied texels of img,
+// in full precision for the types that have more than 8 bits
+func texelReader(img image.Image) func(x, y int) [4]float32 {
+	switch src := img.(type) {
+	case *texture.FloatImage:
+		return src.FloatAt
+	case *image.Gray:
+		return func(x, y int) [4]float32 {
+			v := float32(src.GrayAt(x, y).Y) / 0xff
+			return [4]float32{v, v, v, 1}
+		}
+	case *image.Gray16:
+		return func(x, y int) [4]float32 {
+			v := float32(src.Gray16At(x, y).Y) / 0xffff
+			return [4]float32{v, v, v, 1}
+		}
+	default:
+		return func(x, y int) [4]float32 {
+			r, g, b, a := img.At(x, y).RGBA()
+			return [4]float32{
+				float32(r) / 0xffff,
+				float32(g) / 0xffff,
+				float32(b) / 0xffff,
+				float32(a) / 0xffff,
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	"github.com/devblok/koru/src/texture"
+)
+
+// checkRows verifies the texels of every row and that the padding between them is untouched
+func checkRows(t *testing.T, pixels []uint8, rowPitch, height int, rows [][]uint8) {
+	if len(pixels) != rowPitch*height {
+		t.Fatalf("expected %d bytes, got %d", rowPitch*height, len(pixels))
+	}
+	for y, row := range rows {
+		if !bytes.Equal(pixels[y*rowPitch:y*rowPitch+len(row)], row) {
+			t.Fatalf("row %d is %v, expected %v", y, pixels[y*rowPitch:y*rowPitch+len(row)], row)
+		}
+		for _, padding := range pixels[y*rowPitch+len(row) : (y+1)*rowPitch] {
+			if padding != 0 {
+				t.Fatalf("row %d wrote into its padding", y)
+			}
+		}
+	}
+}
+
+func TestGetPixelsRowPitch(t *testing.T) {
+	// wider than tall, so the pitch is compared to the width
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for idx := range img.Pix {
+		img.Pix[idx] = uint8(idx)
+	}
+	img.Pix[3], img.Pix[7] = 255, 255
+	expected := func(pitch int) {
+		pixels, err := core.GetPixels(img, pitch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := [][]uint8{make([]uint8, 12), make([]uint8, 12)}
+		for idx := range img.Pix {
+			c := img.NRGBAAt(idx/4%3, idx/12)
+			rgba := color.RGBAModel.Convert(c).(color.RGBA)
+			rows[idx/12][idx%12] = []uint8{rgba.R, rgba.G, rgba.B, rgba.A}[idx%4]
+		}
+		effective := pitch
+		if effective < 12 {
+			effective = 12
+		}
+		checkRows(t, pixels, effective, 2, rows)
+	}
+	for _, pitch := range []int{0, 4, 12, 16, 64} {
+		expected(pitch)
+	}
+
+	// images already in the layout are copied, sub images included
+	rgba := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for idx := range rgba.Pix {
+		rgba.Pix[idx] = uint8(idx)
+	}
+	sub := rgba.SubImage(image.Rect(1, 1, 3, 3))
+	pixels, _ := core.GetPixels(sub, 10)
+	checkRows(t, pixels, 10, 2, [][]uint8{rgba.Pix[20:28], rgba.Pix[36:44]})
+}
+
+func TestPackPixelsGray(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(gray.Pix, []uint8{10, 20, 30, 40, 50, 60})
+	pixels, err := core.PackPixels(gray, core.PixelFormatR8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, pixels, 4, 2, [][]uint8{{10, 20, 30}, {40, 50, 60}})
+
+	gray16 := image.NewGray16(image.Rect(0, 0, 2, 1))
+	gray16.SetGray16(0, 0, color.Gray16{Y: 0xffff})
+	gray16.SetGray16(1, 0, color.Gray16{Y: 0x8000})
+	pixels, _ = core.PackPixels(gray16, core.PixelFormatRG8, 0)
+	checkRows(t, pixels, 4, 1, [][]uint8{{255, 255, 128, 128}})
+
+	pixels, _ = core.PackPixels(gray16, core.PixelFormatRGBA8, 0)
+	checkRows(t, pixels, 8, 1, [][]uint8{{255, 255, 255, 255, 128, 128, 128, 255}})
+}
+
+func TestPackPixelsHalfFloat(t *testing.T) {
+	half := func(values ...float32) []uint8 {
+		out := make([]uint8, len(values)*2)
+		for idx, v := range values {
+			binary.LittleEndian.PutUint16(out[idx*2:], texture.FloatToHalf(v))
+		}
+		return out
+	}
+
+	hdr := texture.NewFloatImage(image.Rect(0, 0, 2, 1))
+	hdr.SetFloat(0, 0, [4]float32{4, 0.5, 0, 1})
+	hdr.SetFloat(1, 0, [4]float32{0.25, 100, 2, 1})
+	pixels, err := core.PackPixels(hdr, core.PixelFormatRGBA16F, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, pixels, 20, 1, [][]uint8{half(4, 0.5, 0, 1, 0.25, 100, 2, 1)})
+
+	// 8-bit targets clamp
+	pixels, _ = core.PackPixels(hdr, core.PixelFormatRG8, 0)
+	checkRows(t, pixels, 4, 1, [][]uint8{{255, 128, 64, 255}})
+
+	wide := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	wide.SetRGBA64(0, 0, color.RGBA64{R: 0xffff, G: 0x4000, B: 0, A: 0xffff})
+	pixels, _ = core.PackPixels(wide, core.PixelFormatRGBA16F, 0)
+	checkRows(t, pixels, 8, 1, [][]uint8{half(1, float32(0x4000)/0xffff, 0, 1)})
+
+	if _, err := core.PackPixels(wide, core.PixelFormat(42), 0); err == nil {
+		t.Fatal("expected an error on an unknown format")
+	}
+}
+
+func BenchmarkPackPixelsR8(b *testing.B) {
+	needTestImage(b)
+	for idx := 0; idx < b.N; idx++ {
+		core.PackPixels(testImage, core.PixelFormatR8, 0)
+	}
+}
+
+func BenchmarkPackPixelsRGBA16F(b *testing.B) {
+	needTestImage(b)
+	for idx := 0; idx < b.N; idx++ {
+		core.PackPixels(testImage, core.PixelFormatRGBA16F, 0)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"image"
+	"math"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// rasterTarget is a color and a depth buffer triangles are drawn into,
+// following the rules of the Vulkan pipeline: clip space depth goes from
+// 0 to w, Y points down, counter clockwise triangles in the framebuffer
+// face front, depth passes when less. Culling, depth and blending
+// follow the RenderState triangles are drawn with.
+type rasterTarget struct {
+	color *image.RGBA
+	depth []float32
+
+	// viewport is where clip space is mapped to, nothing is drawn outside
+	viewport image.Rectangle
+}
+
+func newRasterTarget(width, height int) *rasterTarget {
+	bounds := image.Rect(0, 0, width, height)
+	return &rasterTarget{
+		color:    image.NewRGBA(bounds),
+		depth:    make([]float32, width*height),
+		viewport: bounds,
+	}
+}
+
+// clear fills the color buffer with the color, depth with the far plane
+func (t *rasterTarget) clear(c [4]uint8) {
+	for idx := 0; idx < len(t.color.Pix); idx += 4 {
+		copy(t.color.Pix[idx:idx+4], c[:])
+	}
+	for idx := range t.depth {
+		t.depth[idx] = 1
+	}
+}
+
+// setViewport draws into the part of the target from now on, with its
+// depth cleared, so it's drawn over whatever was drawn there before
+func (t *rasterTarget) setViewport(viewport image.Rectangle) {
+	t.viewport = viewport.Intersect(t.color.Rect)
+	width := t.color.Rect.Dx()
+	for y := t.viewport.Min.Y; y < t.viewport.Max.Y; y++ {
+		for x := t.viewport.Min.X; x < t.viewport.Max.X; x++ {
+			t.depth[y*width+x] = 1
+		}
+	}
+}
+
+// rasterVertex is a vertex in clip space, with
+// the values main.vert passes to main.frag
+type rasterVertex struct {
+	pos   glm.Vec4
+	color glm.Vec4
+	tex   glm.Vec2
+}
+
+func lerpVertex(a, b rasterVertex, t float32) rasterVertex {
+	return rasterVertex{
+		pos:   a.pos.Add(b.pos.Sub(a.pos).Mul(t)),
+		color: a.color.Add(b.color.Sub(a.color).Mul(t)),
+		tex:   a.tex.Add(b.tex.Sub(a.tex).Mul(t)),
+	}
+}
+
+// clipPlanes return the signed distance to the planes clip space depth
+// is kept within, vertices of visible triangles are not negative
+var clipPlanes = []func(p glm.Vec4) float32{
+	func(p glm.Vec4) float32 { return p[2] },
+	func(p glm.Vec4) float32 { return p[3] - p[2] },
+}
+
+// clipPolygon cuts off the parts of the polygon in front of
+// the near plane and behind the far plane
+func clipPolygon(poly []rasterVertex) []rasterVertex {
+	for _, plane := range clipPlanes {
+		if len(poly) == 0 {
+			return nil
+		}
+		var clipped []rasterVertex
+		for idx := range poly {
+			a, b := poly[idx], poly[(idx+1)%len(poly)]
+			da, db := plane(a.pos), plane(b.pos)
+			if da >= 0 {
+				clipped = append(clipped, a)
+			}
+			if (da >= 0) != (db >= 0) {
+				clipped = append(clipped, lerpVertex(a, b, da/(da-db)))
+			}
+		}
+		poly = clipped
+	}
+	return poly
+}
+
+// drawTriangles transforms a list of triangles with mvp like main.vert,
+// and colors the fragments like main.frag, sampling the texture
+func (t *rasterTarget) drawTriangles(vertices []model.Vertex, mvp glm.Mat4, tex *image.NRGBA, state RenderState) {
+	for first := 0; first+2 < len(vertices); first += 3 {
+		poly := make([]rasterVertex, 3, 6)
+		for idx := range poly {
+			v := vertices[first+idx]
+			poly[idx] = rasterVertex{
+				pos:   mvp.Mul4x1(v.Pos.Vec4(1)),
+				color: v.Color,
+				tex:   v.Tex,
+			}
+		}
+		poly = clipPolygon(poly)
+		for idx := 1; idx+1 < len(poly); idx++ {
+			t.rasterise(poly[0], poly[idx], poly[idx+1], tex, state)
+		}
+	}
+}
+
+// screenVertex is a vertex after the perspective divide and the viewport
+type screenVertex struct {
+	x, y, z float64
+
+	// invW is 1/w, attributes are divided by w, so they're
+	// interpolated in screen space and corrected per fragment
+	invW  float64
+	color glm.Vec4
+	tex   glm.Vec2
+}
+
+func (t *rasterTarget) toScreen(v rasterVertex) screenVertex {
+	vp := t.viewport
+	invW := 1 / float64(v.pos[3])
+	w := float32(invW)
+	return screenVertex{
+		x:     float64(vp.Min.X) + (float64(v.pos[0])*invW+1)*float64(vp.Dx())/2,
+		y:     float64(vp.Min.Y) + (float64(v.pos[1])*invW+1)*float64(vp.Dy())/2,
+		z:     float64(v.pos[2]) * invW,
+		invW:  invW,
+		color: v.color.Mul(w),
+		tex:   v.tex.Mul(w),
+	}
+}
+
+// edge is twice the signed area of the triangle a, b and the point
+func edge(a, b screenVertex, x, y float64) float64 {
+	return (b.x-a.x)*(y-a.y) - (b.y-a.y)*(x-a.x)
+}
+
+// isTopLeft tells if the edge from a to b owns the pixels right on it,
+// so pixels on an edge shared by two triangles are drawn once. Front
+// faces go counter clockwise on screen, so their left edges go down
+// and their top edges go left
+func isTopLeft(a, b screenVertex) bool {
+	return (a.y == b.y && b.x < a.x) || b.y > a.y
+}
+
+func (t *rasterTarget) rasterise(v0, v1, v2 rasterVertex, tex *image.NRGBA, state RenderState) {
+	a, b, c := t.toScreen(v0), t.toScreen(v1), t.toScreen(v2)
+
+	// the area Vulkan decides the facing with is the negated one, with Y
+	// pointing down, counter clockwise triangles have a negative area here
+	area := edge(a, b, c.x, c.y)
+	if area == 0 {
+		return
+	}
+	if front := area < 0; (front && state.Cull == CullFront) || (!front && state.Cull == CullBack) {
+		return
+	}
+	if area > 0 {
+		// back faces that are drawn are turned around, so the
+		// edges and the top left rule work the same for them
+		b, c = c, b
+		area = -area
+	}
+
+	vp := t.viewport
+	minX := int(math.Max(math.Floor(math.Min(a.x, math.Min(b.x, c.x))), float64(vp.Min.X)))
+	maxX := int(math.Min(math.Ceil(math.Max(a.x, math.Max(b.x, c.x))), float64(vp.Max.X-1)))
+	minY := int(math.Max(math.Floor(math.Min(a.y, math.Min(b.y, c.y))), float64(vp.Min.Y)))
+	maxY := int(math.Min(math.Ceil(math.Max(a.y, math.Max(b.y, c.y))), float64(vp.Max.Y-1)))
+
+	owns := func(e float64, topLeft bool) bool {
+		return e < 0 || (e == 0 && topLeft)
+	}
+	tlBC, tlCA, tlAB := isTopLeft(b, c), isTopLeft(c, a), isTopLeft(a, b)
+
+	for y := minY; y <= maxY; y++ {
+		py := float64(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float64(x) + 0.5
+			e0, e1, e2 := edge(b, c, px, py), edge(c, a, px, py), edge(a, b, px, py)
+			if !owns(e0, tlBC) || !owns(e1, tlCA) || !owns(e2, tlAB) {
+				continue
+			}
+
+			// barycentric weights of a, b and c
+			w0, w1, w2 := e0/area, e1/area, e2/area
+			z := float32(w0*a.z + w1*b.z + w2*c.z)
+			idx := y*t.color.Rect.Dx() + x
+			if state.Depth != DepthDisabled && z >= t.depth[idx] {
+				continue
+			}
+
+			invW := w0*a.invW + w1*b.invW + w2*c.invW
+			f0, f1, f2 := float32(w0/invW), float32(w1/invW), float32(w2/invW)
+			color := a.color.Mul(f0).Add(b.color.Mul(f1)).Add(c.color.Mul(f2))
+			uv := a.tex.Mul(f0).Add(b.tex.Mul(f1)).Add(c.tex.Mul(f2))
+
+			out := sampleBilinear(tex, uv)
+			for ch := 0; ch < 4; ch++ {
+				out[ch] *= color[ch]
+			}
+
+			if state.Depth == DepthReadWrite {
+				t.depth[idx] = z
+			}
+			pix := t.color.Pix[y*t.color.Stride+x*4:]
+			out = blend(state.Blend, out, pix)
+			for ch := 0; ch < 4; ch++ {
+				pix[ch] = uint8(glm.Clamp(out[ch], 0, 1)*255 + 0.5)
+			}
+		}
+	}
+}
+
+// blend combines the color with the pixel drawn before,
+// like the blend attachment of the Vulkan pipeline would
+func blend(mode BlendMode, src glm.Vec4, pix []uint8) glm.Vec4 {
+	if mode == BlendOpaque {
+		return src
+	}
+	dst := glm.Vec4{float32(pix[0]) / 255, float32(pix[1]) / 255, float32(pix[2]) / 255, float32(pix[3]) / 255}
+	alpha := src[3]
+	var out glm.Vec4
+	for ch := 0; ch < 3; ch++ {
+		switch mode {
+		case BlendAlpha:
+			out[ch] = src[ch]*alpha + dst[ch]*(1-alpha)
+		case BlendAdditive:
+			out[ch] = src[ch]*alpha + dst[ch]
+		}
+	}
+	switch mode {
+	case BlendAlpha:
+		out[3] = alpha + dst[3]*(1-alpha)
+	case BlendAdditive:
+		out[3] = dst[3]
+	}
+	return out
+}
+
+// sampleBilinear samples the texture like the sampler of the Vulkan
+// renderer, linear filtering and repeating coordinates. Only the first
+// mip level is used
+func sampleBilinear(tex *image.NRGBA, uv glm.Vec2) glm.Vec4 {
+	width, height := tex.Rect.Dx(), tex.Rect.Dy()
+	if width == 0 || height == 0 {
+		return glm.Vec4{0, 0, 0, 0}
+	}
+
+	x := float64(uv[0])*float64(width) - 0.5
+	y := float64(uv[1])*float64(height) - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := float32(x-x0), float32(y-y0)
+
+	wrap := func(v, size int) int {
+		v %= size
+		if v < 0 {
+			v += size
+		}
+		return v
+	}
+	texel := func(tx, ty int) glm.Vec4 {
+		p := tex.Pix[tex.PixOffset(tex.Rect.Min.X+wrap(tx, width), tex.Rect.Min.Y+wrap(ty, height)):]
+		return glm.Vec4{float32(p[0]) / 255, float32(p[1]) / 255, float32(p[2]) / 255, float32(p[3]) / 255}
+	}
+	ix, iy := int(x0), int(y0)
+	top := texel(ix, iy).Mul(1 - fx).Add(texel(ix+1, iy).Mul(fx))
+	bottom := texel(ix, iy+1).Mul(1 - fx).Add(texel(ix+1, iy+1).Mul(fx))
+	return top.Mul(1 - fy).Add(bottom.Mul(fy))
+}
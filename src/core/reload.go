@@ -0,0 +1,178 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/devblok/koru/src/utility/watch"
+)
+
+// reloadInterval is how often the watched directories are looked at
+const reloadInterval = 500 * time.Millisecond
+
+// shaderSuffix is the extension of compiled shaders
+const shaderSuffix = ".spv"
+
+// assetDirectories returns the directories of the asset search path,
+// archives don't change while running
+func assetDirectories(paths []string) []string {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var dirs []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			dirs = append(dirs, p)
+		}
+	}
+	return dirs
+}
+
+// relativeTo returns the slash separated path of file under dir,
+// false if the file is not under it
+func relativeTo(dir, file string) (string, bool) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// watchFiles starts watching the asset directories and the shader
+// directory, changes are queued until the next Draw
+func (v *VulkanRenderer) watchFiles() error {
+	assetDirs := assetDirectories(v.configuration.AssetPaths)
+	watcher, err := watch.NewWatcher(append(assetDirs, v.configuration.ShaderDirectory)...)
+	if err != nil {
+		return err
+	}
+
+	v.reloadFiles = make(map[string]struct{})
+	v.watchDone = make(chan struct{})
+	errs := make(chan error)
+	events := watcher.Run(reloadInterval, v.watchDone, errs)
+	go func() {
+		for {
+			select {
+			case err := <-errs:
+				log.Println("Watching files failed: " + err.Error())
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if e.Op == watch.Removed {
+					continue
+				}
+				v.queueReload(assetDirs, e.Path)
+			}
+		}
+	}()
+	return nil
+}
+
+// queueReload finds what the changed file is part of
+func (v *VulkanRenderer) queueReload(assetDirs []string, file string) {
+	v.reloadLock.Lock()
+	defer v.reloadLock.Unlock()
+
+	if _, ok := relativeTo(v.configuration.ShaderDirectory, file); ok && (strings.HasSuffix(file, shaderSuffix) || filepath.Base(file) == ShaderManifestFile) {
+		v.reloadShaders = true
+		return
+	}
+	for _, dir := range assetDirs {
+		if id, ok := relativeTo(dir, file); ok {
+			v.reloadFiles[id] = struct{}{}
+		}
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		v.reloadFiles[filepath.ToSlash(abs)] = struct{}{}
+	}
+}
+
+// applyReloads reloads what changed since the last call. Failed reloads
+// keep the previous version and only log the error, an error is
+// returned when the renderer could not be brought back
+func (v *VulkanRenderer) applyReloads() error {
+	v.reloadLock.Lock()
+	shaders, files := v.reloadShaders, v.reloadFiles
+	v.reloadShaders = false
+	if len(files) > 0 {
+		v.reloadFiles = make(map[string]struct{})
+	}
+	v.reloadLock.Unlock()
+
+	if shaders {
+		if err := v.reloadShaderModules(); err != nil {
+			return err
+		}
+	}
+	for _, id := range v.dependentResources(files) {
+		if err := v.cache.Reload(id); err != nil {
+			log.Printf("Reloading %s failed, keeping the old one: %s", id, err.Error())
+		}
+	}
+	return nil
+}
+
+// dependentResources returns the ids of the loaded resource sets
+// that are made of any of the files
+func (v *VulkanRenderer) dependentResources(files map[string]struct{}) []string {
+	if len(files) == 0 {
+		return nil
+	}
+
+	v.resourceLock.RLock()
+	defer v.resourceLock.RUnlock()
+
+	var ids []string
+	for id, rs := range v.resources {
+		dependent := false
+		for _, file := range append([]string{id}, rs.files...) {
+			if _, ok := files[path.Clean(file)]; ok {
+				dependent = true
+				break
+			}
+		}
+		if dependent {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// reloadShaderModules loads the shader manifest and its shaders again
+// and rebuilds the pipeline with them. If that fails, the pipeline is
+// rebuilt with the old ones. Materials of the manifest are set again
+func (v *VulkanRenderer) reloadShaderModules() error {
+	previous, previousManifest := v.shaders, v.manifest
+	if err := v.loadShaders(); err != nil {
+		log.Println("Reloading shaders failed, keeping the old ones: " + err.Error())
+		return nil
+	}
+
+	if err := v.recreatePipeline(); err != nil {
+		log.Println("Rebuilding the pipeline failed, keeping the old shaders: " + err.Error())
+		for _, shader := range v.shaders {
+			shader.Destroy()
+		}
+		v.shaders, v.manifest = previous, previousManifest
+		return v.recreatePipeline()
+	}
+
+	for _, shader := range previous {
+		shader.Destroy()
+	}
+	if err := v.setManifestMaterials(); err != nil {
+		log.Println("Setting the materials of the shader manifest failed: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/devblok/koru/src/gfx"
+	"github.com/devblok/koru/src/gfx/visibility"
+	"github.com/devblok/koru/src/model"
+	vk "github.com/devblok/vulkan"
+)
+
+// softwareClearColor is the clear color of the Vulkan renderer in 8 bits
+var softwareClearColor = [4]uint8{1, 1, 1, 1}
+
+// NewSoftwareRenderer creates a renderer that draws on the CPU into
+// images of ScreenWidth by ScreenHeight. Meshes are loaded with the loader.
+func NewSoftwareRenderer(loader gfx.Loader, cfg RendererConfiguration) *SoftwareRenderer {
+	return &SoftwareRenderer{
+		configuration: cfg,
+		cache:         gfx.NewCache(softwareMeshLoader{loader: loader}, cfg.ResourceBudget),
+		instances:     make(map[ResourceHandle]ResourceInstance),
+		resources:     make(map[ResourceHandle]*gfx.Handle),
+		cameras:       newCameraSet(),
+		loader:        loader,
+		materials:     map[string]softwareMaterial{DefaultMaterialName: {Material: DefaultMaterial}},
+	}
+}
+
+// SoftwareRenderer implements Renderer without a GPU. It draws
+// like the Vulkan renderer with its shaders would, with a depth
+// buffer and perspective correct texturing, though only with the
+// first mip level of textures. Materials are drawn with their render
+// state and their first texture in place of the mesh's, programs and
+// params are not used. Draw draws into a back buffer, Present makes
+// it the frame returned by Frame.
+type SoftwareRenderer struct {
+	Renderer
+
+	configuration RendererConfiguration
+	cache         *gfx.Cache
+	counter       uint32
+
+	instanceLock sync.RWMutex
+	instances    map[ResourceHandle]ResourceInstance
+	resources    map[ResourceHandle]*gfx.Handle
+
+	cameras *cameraSet
+
+	loader       gfx.Loader
+	materialLock sync.RWMutex
+	materials    map[string]softwareMaterial
+
+	frameLock sync.Mutex
+	back      *rasterTarget
+	drawn     bool
+	front     *image.RGBA
+}
+
+// Initialise implements interface
+func (s *SoftwareRenderer) Initialise() error {
+	width, height := s.configuration.ScreenWidth, s.configuration.ScreenHeight
+	if width == 0 || height == 0 {
+		return fmt.Errorf("bad screen size %dx%d", width, height)
+	}
+
+	s.frameLock.Lock()
+	s.back = newRasterTarget(int(width), int(height))
+	s.front = image.NewRGBA(s.back.color.Rect)
+	s.frameLock.Unlock()
+	return nil
+}
+
+// ResourceHandle implements interface
+func (s *SoftwareRenderer) ResourceHandle() ResourceHandle {
+	return ResourceHandle(atomic.AddUint32(&s.counter, 1) - 1)
+}
+
+// ResourceUpdate implements interface, the channel is closed without
+// a value if the resource could not be loaded or the material is not set
+func (s *SoftwareRenderer) ResourceUpdate(handle ResourceHandle, instance ResourceInstance) <-chan struct{} {
+	sig := make(chan struct{}, 1)
+
+	s.materialLock.RLock()
+	_, ok := s.materials[materialName(instance)]
+	s.materialLock.RUnlock()
+	if !ok {
+		close(sig)
+		return sig
+	}
+
+	s.instanceLock.RLock()
+	current, ok := s.resources[handle]
+	s.instanceLock.RUnlock()
+
+	var previous *gfx.Handle
+	if !ok || current.ID() != instance.ResourceID {
+		res, err := s.cache.Acquire(instance.ResourceID)
+		if err != nil {
+			close(sig)
+			return sig
+		}
+		previous, current = current, res
+	}
+
+	s.instanceLock.Lock()
+	s.instances[handle] = instance
+	s.resources[handle] = current
+	s.instanceLock.Unlock()
+
+	if previous != nil {
+		previous.Release()
+	}
+	sig <- struct{}{}
+	return sig
+}
+
+// ResourceDelete implements interface
+func (s *SoftwareRenderer) ResourceDelete(handle ResourceHandle) {
+	s.instanceLock.Lock()
+	res, ok := s.resources[handle]
+	delete(s.instances, handle)
+	delete(s.resources, handle)
+	s.instanceLock.Unlock()
+
+	if ok {
+		res.Release()
+	}
+}
+
+// ResourceStats implements interface
+func (s *SoftwareRenderer) ResourceStats() gfx.CacheStats {
+	return s.cache.Stats()
+}
+
+// SetCamera implements interface
+func (s *SoftwareRenderer) SetCamera(name string, camera Camera) error {
+	return s.cameras.set(name, camera, 0)
+}
+
+// RemoveCamera implements interface
+func (s *SoftwareRenderer) RemoveCamera(name string) {
+	s.cameras.remove(name)
+}
+
+// SetMaterial implements interface, the first texture
+// of the material is loaded before it returns
+func (s *SoftwareRenderer) SetMaterial(name string, material Material) error {
+	if err := material.Validate(); err != nil {
+		return fmt.Errorf("material %s: %s", name, err.Error())
+	}
+
+	mat := softwareMaterial{Material: material}
+	if len(material.Textures) > 0 {
+		tex, err := loadTexture(s.loader, material.Textures[0])
+		if err != nil {
+			return fmt.Errorf("material %s: %s", name, err.Error())
+		}
+		if mat.texture, err = tex.Image(0); err != nil {
+			return fmt.Errorf("material %s: %s", name, err.Error())
+		}
+	}
+
+	s.materialLock.Lock()
+	s.materials[name] = mat
+	s.materialLock.Unlock()
+	return nil
+}
+
+// CreateStorageBuffer implements interface, the buffer is in memory
+func (s *SoftwareRenderer) CreateStorageBuffer(size int) (StorageBuffer, error) {
+	return newHostStorageBuffer(size)
+}
+
+// Dispatch implements interface, compute programs are not run
+// by the software renderer, so it always fails
+func (s *SoftwareRenderer) Dispatch(work ComputeDispatch) (<-chan struct{}, error) {
+	if err := work.Validate(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("program %s: the software renderer doesn't run compute programs", work.Program)
+}
+
+// Draw implements interface, draws the instances every camera sees
+func (s *SoftwareRenderer) Draw() error {
+	s.frameLock.Lock()
+	defer s.frameLock.Unlock()
+	if s.back == nil {
+		return errors.New("renderer is not initialised")
+	}
+
+	s.materialLock.RLock()
+	materials := make(map[string]softwareMaterial, len(s.materials))
+	for name, mat := range s.materials {
+		materials[name] = mat
+	}
+	s.materialLock.RUnlock()
+
+	meshes := make(map[string]*softwareMesh)
+	s.instanceLock.RLock()
+	items := make([]visibility.Item, 0, len(s.instances))
+	for handle, instance := range s.instances {
+		mesh := s.resources[handle].Resource().(*softwareMesh)
+		meshes[mesh.id] = mesh
+		name := materialName(instance)
+		items = append(items, visibility.Item{
+			ID:       uint32(handle),
+			Pipeline: materials[name].PipelineKey(),
+			Material: name,
+			Resource: mesh.id,
+			Model:    instance.Position.Mul4(instance.Rotation),
+			Bounds:   mesh.bounds,
+		})
+	}
+	s.instanceLock.RUnlock()
+
+	width, height := uint32(s.back.color.Rect.Dx()), uint32(s.back.color.Rect.Dy())
+	s.back.clear(softwareClearColor)
+	for _, camera := range s.cameras.sorted() {
+		ubo := camera.Uniform(width, height)
+		viewProjection := ubo.Projection.Mul4(ubo.View)
+
+		s.back.setViewport(camera.Viewport.Rect(width, height))
+		for _, item := range camera.cull(width, height, items) {
+			mesh, mat := meshes[item.Resource], materials[item.Material]
+			tex := mesh.texture
+			if mat.texture != nil {
+				tex = mat.texture
+			}
+			s.back.drawTriangles(mesh.vertices, viewProjection.Mul4(item.Model), tex, mat.State)
+		}
+	}
+	s.drawn = true
+	return nil
+}
+
+// Present implements interface, the drawn frame becomes the one returned by Frame
+func (s *SoftwareRenderer) Present() error {
+	s.frameLock.Lock()
+	defer s.frameLock.Unlock()
+	if !s.drawn {
+		return errors.New("nothing was drawn to present")
+	}
+	copy(s.front.Pix, s.back.color.Pix)
+	return nil
+}
+
+// Frame returns a copy of the frame presented last
+func (s *SoftwareRenderer) Frame() *image.RGBA {
+	s.frameLock.Lock()
+	defer s.frameLock.Unlock()
+	if s.front == nil {
+		return nil
+	}
+	frame := image.NewRGBA(s.front.Rect)
+	copy(frame.Pix, s.front.Pix)
+	return frame
+}
+
+// DeviceIsSuitable implements interface, any device will do
+func (s *SoftwareRenderer) DeviceIsSuitable(vk.PhysicalDevice) (bool, string) {
+	return true, ""
+}
+
+// Destroy implements interface, releases all resources
+func (s *SoftwareRenderer) Destroy() {
+	s.instanceLock.Lock()
+	for handle, res := range s.resources {
+		res.Release()
+		delete(s.resources, handle)
+	}
+	s.instances = make(map[ResourceHandle]ResourceInstance)
+	s.instanceLock.Unlock()
+
+	s.cache.Purge()
+}
+
+// softwareMaterial is a material with its first texture ready to be sampled
+type softwareMaterial struct {
+	Material
+	texture *image.NRGBA
+}
+
+// softwareMesh is a mesh ready to be rasterised
+type softwareMesh struct {
+	id       string
+	vertices []model.Vertex
+	bounds   model.Bounds
+	texture  *image.NRGBA
+}
+
+// ID implements gfx.Resource
+func (m *softwareMesh) ID() string {
+	return m.id
+}
+
+// Ready implements gfx.Resource, the mesh is loaded when it's created
+func (m *softwareMesh) Ready() <-chan struct{} {
+	return closedChannel
+}
+
+// Sub implements gfx.Resource
+func (m *softwareMesh) Sub() []gfx.Resource {
+	return nil
+}
+
+// Size implements gfx.Sizer
+func (m *softwareMesh) Size() int64 {
+	return int64(len(m.vertices))*int64(unsafe.Sizeof(model.Vertex{})) + int64(len(m.texture.Pix))
+}
+
+// Release implements gfx.Resource, memory is left to the garbage collector
+func (m *softwareMesh) Release() {}
+
+// softwareMeshLoader loads meshes for the cache of the software renderer
+type softwareMeshLoader struct {
+	loader gfx.Loader
+}
+
+// Load implements gfx.Loader
+func (l softwareMeshLoader) Load(id string) (gfx.Resource, error) {
+	res, err := l.loader.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Release()
+
+	mesh, ok := res.(*gfx.Mesh)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a mesh", id)
+	}
+	<-mesh.Ready()
+	if err := mesh.Err(); err != nil {
+		return nil, err
+	}
+
+	tex, err := meshTexture(mesh)
+	if err != nil {
+		return nil, err
+	}
+	img, err := tex.Image(0)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := mesh.Object()
+	return &softwareMesh{
+		id:       id,
+		vertices: obj.Vertices(),
+		bounds:   obj.Bounds(),
+		texture:  img,
+	}, nil
+}
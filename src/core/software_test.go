@@ -0,0 +1,254 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package core_test
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devblok/koru/src/core"
+	"github.com/devblok/koru/src/gfx"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata")
+
+// Quads facing up, Y in OBJ files, colored with the vertex colors extension
+var softwareFiles = map[string]string{
+	"red.obj": `
+v -0.5 0 0.5 1 0 0
+v 0.5 0 0.5 1 0 0
+v 0.5 0 -0.5 1 0 0
+v -0.5 0 -0.5 1 0 0
+f 1 2 3 4
+`,
+	"blue.obj": `
+v -0.5 0 0.5 0 0 1
+v 0.5 0 0.5 0 0 1
+v 0.5 0 -0.5 0 0 1
+v -0.5 0 -0.5 0 0 1
+f 1 2 3 4
+`,
+	"back.obj": `
+v -0.5 0 0.5
+v 0.5 0 0.5
+v 0.5 0 -0.5
+v -0.5 0 -0.5
+f 4 3 2 1
+`,
+	"floor.obj": `
+mtllib floor.mtl
+v -2 0 2
+v 2 0 2
+v 2 0 -2
+v -2 0 -2
+vt 0 0
+vt 4 0
+vt 4 4
+vt 0 4
+usemtl Checker
+f 1/1 2/2 3/3 4/4
+`,
+	"floor.mtl": `
+newmtl Checker
+Kd 1 1 1
+map_Kd checker.png
+`,
+}
+
+// checkerPNG is a 2 by 2 checker board of 4 pixel squares
+func checkerPNG(t *testing.T) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if (x/4+y/4)%2 == 0 {
+				img.Set(x, y, color.NRGBA{230, 230, 230, 255})
+			} else {
+				img.Set(x, y, color.NRGBA{40, 90, 160, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// glassPNG is a single white pixel, half transparent
+func glassPNG(t *testing.T) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.NRGBA{255, 255, 255, 128})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func newSoftwareRenderer(t *testing.T, width, height uint32) (*core.SoftwareRenderer, func()) {
+	dir, err := ioutil.TempDir("", "software")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"checker.png": checkerPNG(t),
+		"glass.png":   glassPNG(t),
+	}
+	for name, data := range softwareFiles {
+		files[name] = data
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renderer := core.NewSoftwareRenderer(
+		gfx.NewSearchLoader(gfx.Dir(dir), gfx.Dir("../../assets")),
+		core.RendererConfiguration{ScreenWidth: width, ScreenHeight: height},
+	)
+	if err := renderer.Initialise(); err != nil {
+		t.Fatal(err)
+	}
+	return renderer, func() {
+		renderer.Destroy()
+		os.RemoveAll(dir)
+	}
+}
+
+func drawFrame(t *testing.T, renderer *core.SoftwareRenderer, instances map[core.ResourceHandle]core.ResourceInstance) *image.RGBA {
+	for handle, instance := range instances {
+		if _, ok := <-renderer.ResourceUpdate(handle, instance); !ok {
+			t.Fatalf("%s was not loaded", instance.ResourceID)
+		}
+	}
+	if err := renderer.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.Present(); err != nil {
+		t.Fatal(err)
+	}
+	return renderer.Frame()
+}
+
+func placed(id string, x, y, z float32) core.ResourceInstance {
+	return core.ResourceInstance{
+		ResourceID: id,
+		Position:   glm.Translate3D(x, y, z),
+		Rotation:   glm.Ident4(),
+	}
+}
+
+func TestSoftwareRendererDepth(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 64, 48)
+	defer cleanup()
+
+	// the blue quad is moved towards the camera, it's in
+	// front of the red one whichever is drawn first
+	for _, order := range [][]string{{"red.obj", "blue.obj"}, {"blue.obj", "red.obj"}} {
+		instances := make(map[core.ResourceHandle]core.ResourceInstance)
+		for _, id := range order {
+			if id == "blue.obj" {
+				instances[renderer.ResourceHandle()] = placed(id, 0.3, 0.3, 0.3)
+			} else {
+				instances[renderer.ResourceHandle()] = placed(id, 0, 0, 0)
+			}
+		}
+		frame := drawFrame(t, renderer, instances)
+		if c := frame.RGBAAt(32, 24); c != (color.RGBA{0, 0, 255, 255}) {
+			t.Fatalf("drawing %v, expected blue in the center, got: %v", order, c)
+		}
+		for handle := range instances {
+			renderer.ResourceDelete(handle)
+		}
+	}
+}
+
+func TestSoftwareRendererCulling(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 64, 48)
+	defer cleanup()
+
+	if err := renderer.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	renderer.Present()
+	clear := renderer.Frame().RGBAAt(32, 24)
+
+	frame := drawFrame(t, renderer, map[core.ResourceHandle]core.ResourceInstance{
+		renderer.ResourceHandle(): placed("back.obj", 0, 0, 0),
+	})
+	if c := frame.RGBAAt(32, 24); c != clear {
+		t.Fatalf("back face was drawn: %v", c)
+	}
+}
+
+func TestSoftwareRendererGolden(t *testing.T) {
+	renderer, cleanup := newSoftwareRenderer(t, 96, 72)
+	defer cleanup()
+
+	frame := drawFrame(t, renderer, map[core.ResourceHandle]core.ResourceInstance{
+		renderer.ResourceHandle(): placed("floor.obj", 0, 0, -0.5),
+		renderer.ResourceHandle(): {
+			ResourceID: "cube.dae",
+			Position:   glm.Translate3D(-0.3, 0.2, 0).Mul4(glm.Scale3D(0.4, 0.4, 0.4)),
+			Rotation:   glm.HomogRotate3DZ(glm.DegToRad(30)),
+		},
+		renderer.ResourceHandle(): placed("blue.obj", 0.6, -0.6, 0.2),
+	})
+
+	golden := filepath.Join("testdata", "software_scene.png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, frame); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	expected, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected.Bounds() != frame.Bounds() {
+		t.Fatalf("expected a %v frame, got: %v", expected.Bounds(), frame.Bounds())
+	}
+
+	// channels may be off by a little, from float rounding
+	const tolerance = 2
+	differ := 0
+	for y := 0; y < frame.Rect.Dy(); y++ {
+		for x := 0; x < frame.Rect.Dx(); x++ {
+			want := color.RGBAModel.Convert(expected.At(x, y)).(color.RGBA)
+			got := frame.RGBAAt(x, y)
+			for ch, pair := range [][2]uint8{{want.R, got.R}, {want.G, got.G}, {want.B, got.B}, {want.A, got.A}} {
+				if d := int(pair[0]) - int(pair[1]); d > tolerance || d < -tolerance {
+					if differ == 0 {
+						t.Errorf("pixel %d,%d channel %d: expected %d, got %d", x, y, ch, pair[0], pair[1])
+					}
+					differ++
+				}
+			}
+		}
+	}
+	if differ > 0 {
+		t.Fatalf("%d channels differ from %s", differ, golden)
+	}
+}
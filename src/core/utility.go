@@ -8,56 +8,14 @@ package core
 import (
 	"fmt"
 	"image"
-	"image/draw"
-	"os"
-	"path/filepath"
-	"strings"
+	"image/color"
 	"unsafe"
-)
-
-const shaderSuffix = ".spv"
-
-// loadShaderFilesFromDirectory get the list of files that are compiled shaders
-// it is important that the file name does not contain more than two dots,
-// the first is always the name of the shader, second is type, and the third one
-// ensured that the shader is compiled (only compiled shaders have an .spv extension).
-// All shader files will be loaded.
-func loadShaderFilesFromDirectory(dir string) ([]string, []ShaderType, error) {
-	var (
-		shaders     []string
-		shaderTypes []ShaderType
-	)
-	if err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if strings.HasSuffix(f.Name(), shaderSuffix) {
-			shader := strings.TrimSuffix(f.Name(), shaderSuffix)
-			nodes := strings.Split(shader, ".")
-
-			if len(nodes) != 2 {
-				return nil
-			}
 
-			suffix := nodes[len(nodes)-1]
-			switch suffix {
-			case "frag":
-				shaderTypes = append(shaderTypes, FragmentShaderType)
-				shaders = append(shaders, path)
-			case "vert":
-				shaderTypes = append(shaderTypes, VertexShaderType)
-				shaders = append(shaders, path)
-			default:
-				return nil
-			}
-		}
-		return nil
-	}); err != nil {
-		return nil, nil, err
-	}
-	return shaders, shaderTypes, nil
-}
+	"github.com/devblok/koru/src/gfx"
+	"github.com/devblok/koru/src/model"
+	"github.com/devblok/koru/src/texture"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
 
 type sliceHeader struct {
 	Data uintptr
@@ -84,15 +42,53 @@ func safeStrings(sgs []string) []string {
 	return safe
 }
 
-// GetPixels transforms a given image into right arrangement of pixels
-// by drawing the decoded image onto a controlled RGBA canvas
-func GetPixels(img image.Image, rowPitch int) ([]uint8, error) {
-	newImg := image.NewRGBA(img.Bounds())
-	if rowPitch <= 4*img.Bounds().Dy() {
-		// apply the proposed row pitch only if supported,
-		// as we're using only optimal textures.
-		newImg.Stride = rowPitch
+// meshTexture waits for the first color texture of the mesh. If no material
+// references a texture, a single pixel texture of the diffuse color is made.
+func meshTexture(mesh *gfx.Mesh) (*texture.Texture, error) {
+	obj := mesh.Object()
+	if img := obj.Texture(); img != nil {
+		return texture.FromImage(img, texture.DefaultConfiguration)
+	}
+	if textures := mesh.Textures(); len(textures) > 0 {
+		<-textures[0].Ready()
+		if err := textures[0].Err(); err != nil {
+			return nil, err
+		}
+		return textures[0].Texture(), nil
+	}
+
+	diffuse := model.DefaultObjectMaterial.Diffuse
+	if mats := obj.Materials(); len(mats) > 0 {
+		diffuse = mats[0].Diffuse
+	}
+	channel := func(c float32) uint8 {
+		return uint8(glm.Clamp(c, 0, 1)*255 + 0.5)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.RGBA{
+		R: channel(diffuse[0]),
+		G: channel(diffuse[1]),
+		B: channel(diffuse[2]),
+		A: channel(diffuse[3]),
+	})
+	return texture.FromImage(img, texture.DefaultConfiguration)
+}
+
+// loadTexture loads the texture with the id and waits for it to be decoded
+func loadTexture(loader gfx.Loader, id string) (*texture.Texture, error) {
+	res, err := loader.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Release()
+
+	tex, ok := res.(*gfx.Texture)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a texture", id)
+	}
+	<-tex.Ready()
+	if err := tex.Err(); err != nil {
+		return nil, err
 	}
-	draw.Draw(newImg, newImg.Bounds(), img, image.ZP, draw.Src)
-	return newImg.Pix, nil
+	return tex.Texture(), nil
 }
@@ -24,30 +24,41 @@ func init() {
 	StaticResources = packr.NewBox("../../assets")
 	img, err := png.Decode(bytes.NewReader(StaticResources.Bytes("Bricks_COLOR.png")))
 	if err != nil {
-		panic(err)
+		return
 	}
 	testImage = img
 }
 
+// needTestImage skips benchmarks when the image is not in the assets
+func needTestImage(b *testing.B) {
+	if testImage == nil {
+		b.Skip("Bricks_COLOR.png is not in the assets")
+	}
+}
+
 func BenchmarkGetPixelsNoRowPitch(b *testing.B) {
+	needTestImage(b)
 	for idx := 0; idx < b.N; idx++ {
 		core.GetPixels(testImage, 0)
 	}
 }
 
 func BenchmarkGetPixelsSmallRowPitch(b *testing.B) {
+	needTestImage(b)
 	for idx := 0; idx < b.N; idx++ {
 		core.GetPixels(testImage, 4)
 	}
 }
 
 func BenchmarkGetPixelsMediumRowPitch(b *testing.B) {
+	needTestImage(b)
 	for idx := 0; idx < b.N; idx++ {
 		core.GetPixels(testImage, 200)
 	}
 }
 
 func BenchmarkGetPixelsBigRowPitch(b *testing.B) {
+	needTestImage(b)
 	for idx := 0; idx < b.N; idx++ {
 		core.GetPixels(testImage, 1000)
 	}
@@ -8,20 +8,19 @@ package core
 import (
 	"errors"
 	"fmt"
-	"image"
-	"image/png"
-	"io/ioutil"
 	"math"
-	"os"
-	"strings"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/devblok/koru/src/gfx"
+	"github.com/devblok/koru/src/gfx/spirv"
+	"github.com/devblok/koru/src/gfx/visibility"
 	"github.com/devblok/koru/src/gfx/vkr"
 	"github.com/devblok/koru/src/model"
+	"github.com/devblok/koru/src/texture"
 	vk "github.com/devblok/vulkan"
-	glm "github.com/go-gl/mathgl/mgl32"
 )
 
 // DefaultVulkanApplicationInfo application info describes a Vulkan application
@@ -193,15 +192,28 @@ func (v VulkanInstance) Destroy() {
 
 // NewVulkanRenderer creates a not yet initialised Vulkan API renderer
 func NewVulkanRenderer(instance Instance, cfg RendererConfiguration) (Renderer, error) {
-	return &VulkanRenderer{
+	loader, err := gfx.OpenSearchPath(cfg.AssetPaths...)
+	if err != nil {
+		return nil, err
+	}
+	v := &VulkanRenderer{
 		configuration:        cfg,
+		loader:               loader,
 		currentSurfaceHeight: cfg.ScreenHeight,
 		currentSurfaceWidth:  cfg.ScreenWidth,
 		surface:              instance.Surface(),
 		physicalDevice:       instance.AvailableDevices()[0],
-		resourcePositions:    make(map[string]int),
+		resources:            make(map[string]*resourceSet),
 		instances:            make(map[ResourceHandle]ResourceInstance),
-	}, nil
+		instanceResources:    make(map[ResourceHandle]*gfx.Handle),
+		cameras:              newCameraSet(),
+		pipelines:            make(map[uint64]vk.Pipeline),
+		layouts:              make(map[string]*programLayout),
+		materials:            make(map[string]*vulkanMaterial),
+		computePipelines:     make(map[string]*computePipeline),
+	}
+	v.cache = gfx.NewCache(resourceSetLoader{renderer: v}, cfg.ResourceBudget)
+	return v, nil
 }
 
 // VulkanRenderer is a Vulkan API renderer
@@ -210,9 +222,11 @@ type VulkanRenderer struct {
 	Renderer
 
 	configuration RendererConfiguration
+	loader        *gfx.SearchLoader
 
 	surface              vk.Surface
 	shaders              []Shader
+	manifest             *ShaderManifest
 	currentSurfaceHeight uint32
 	currentSurfaceWidth  uint32
 
@@ -226,19 +240,27 @@ type VulkanRenderer struct {
 	physicalDevice vk.PhysicalDevice
 	deviceQueue    vk.Queue
 
+	// queueLock is held by submits and presents to the device queue,
+	// which dispatches share if the compute queue is the same one
+	queueLock sync.Mutex
+
 	imageFormat     vk.Format
 	imageColorspace vk.ColorSpace
 
-	viewport vk.Viewport
-	scissor  vk.Rect2D
+	pipelineCache vk.PipelineCache
 
-	pipelineLayout vk.PipelineLayout
-	pipeline       vk.Pipeline
-	pipelineCache  vk.PipelineCache
+	// resourceSetLayout is the layout of set 0, made from the bindings
+	// the default program has in it, layouts are the ones of programs
+	resourceSetLayout vk.DescriptorSetLayout
+	resourceBindings  []spirv.Binding
+	layouts           map[string]*programLayout
 
-	descriptorPool       vk.DescriptorPool
-	descriptorSetLayouts []vk.DescriptorSetLayout
-	renderPass           vk.RenderPass
+	// pipelines are made for the program and render state of
+	// materials on first use, keyed by Material.PipelineKey
+	pipelines map[uint64]vk.Pipeline
+
+	descriptorPool vk.DescriptorPool
+	renderPass     vk.RenderPass
 
 	depthImage       vk.Image
 	depthImageView   vk.ImageView
@@ -256,21 +278,53 @@ type VulkanRenderer struct {
 	currentQueueIndex  uint32
 	graphicsQueueIndex uint32
 
-	// TODO: Resource reaping, now the slice only grows,
-	// on long runs resources may pop in and out, with dead cells
-	// taking up memory essentially. The slice should not be recreated
-	// as it would cause possibly lengthy re-allocation of underlying heap.
-	resourceLock      sync.RWMutex
-	resources         []resourceSet
-	resourcePositions map[string]int
-
-	instanceLock sync.RWMutex
-	instances    map[ResourceHandle]ResourceInstance
+	// compute work is submitted to the compute queue, of a family
+	// that doesn't draw if the device has one. Pipelines of compute
+	// programs are made on first use
+	computeQueueIndex     uint32
+	computeQueueNumber    uint32
+	computeQueue          vk.Queue
+	computeCommandPool    vk.CommandPool
+	computeDescriptorPool vk.DescriptorPool
+	computeLock           sync.Mutex
+	computePipelines      map[string]*computePipeline
+	dispatches            sync.WaitGroup
+
+	// resources are loaded through the cache, which
+	// unloads them once no instance uses them
+	cache        *gfx.Cache
+	resourceLock sync.RWMutex
+	resources    map[string]*resourceSet
+
+	instanceLock      sync.RWMutex
+	instances         map[ResourceHandle]ResourceInstance
+	instanceResources map[ResourceHandle]*gfx.Handle
+
+	cameras *cameraSet
+
+	materialLock sync.RWMutex
+	materials    map[string]*vulkanMaterial
+
+	// instanceBuffers hold the model matrices of the instances drawn to
+	// a swapchain image, with room for instanceCapacity of them
+	instanceBuffers  []vk.Buffer
+	instanceMemory   []vkr.Memory
+	instanceCapacity []int
+
+	// changes found by the watcher of hot reloading,
+	// applied at the start of Draw
+	watchDone     chan struct{}
+	reloadLock    sync.Mutex
+	reloadShaders bool
+	reloadFiles   map[string]struct{}
 
 	instanceCounter uint32
 
 	textureSampler vk.Sampler
 
+	// textureCompressionBC is set when the device samples BC formats
+	textureCompressionBC bool
+
 	// ! new, testing
 	allocator *vkr.MemoryAllocator
 }
@@ -337,15 +391,35 @@ func (v *VulkanRenderer) Initialise() error {
 		if !graphicsFound {
 			return errors.New("vulkan error: could not find a suitable queue family for the target Vulkan mode")
 		}
+
+		/* Compute queue family, separate from graphics if there's one */
+		v.computeQueueIndex, v.computeQueueNumber = SelectComputeQueue(queueFamilies, v.graphicsQueueIndex)
 	}
 
+	var features vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(v.physicalDevice, &features)
+	features.Deref()
+	v.textureCompressionBC = features.TextureCompressionBC.B()
+
 	/* Logical Device setup */
 	queueInfos := []vk.DeviceQueueCreateInfo{{
 		SType:            vk.StructureTypeDeviceQueueCreateInfo,
-		QueueFamilyIndex: 0,
+		QueueFamilyIndex: v.graphicsQueueIndex,
 		QueueCount:       1,
-		PQueuePriorities: []float32{1, 0},
+		PQueuePriorities: []float32{1},
 	}}
+	if v.computeQueueIndex == v.graphicsQueueIndex && v.computeQueueNumber > 0 {
+		queueInfos[0].QueueCount = 2
+		queueInfos[0].PQueuePriorities = []float32{1, 1}
+	}
+	if v.computeQueueIndex != v.graphicsQueueIndex {
+		queueInfos = append(queueInfos, vk.DeviceQueueCreateInfo{
+			SType:            vk.StructureTypeDeviceQueueCreateInfo,
+			QueueFamilyIndex: v.computeQueueIndex,
+			QueueCount:       1,
+			PQueuePriorities: []float32{1},
+		})
+	}
 
 	var vkDevice vk.Device
 	dci := vk.DeviceCreateInfo{
@@ -355,7 +429,8 @@ func (v *VulkanRenderer) Initialise() error {
 		EnabledExtensionCount:   uint32(len(requiredExtensions)),
 		PpEnabledExtensionNames: safeStrings(requiredExtensions),
 		PEnabledFeatures: []vk.PhysicalDeviceFeatures{{
-			SamplerAnisotropy: vk.True,
+			SamplerAnisotropy:    vk.True,
+			TextureCompressionBC: features.TextureCompressionBC,
 		}},
 	}
 	if err := vk.Error(vk.CreateDevice(v.physicalDevice, &dci, nil, &vkDevice)); err != nil {
@@ -365,7 +440,11 @@ func (v *VulkanRenderer) Initialise() error {
 	var deviceQueue vk.Queue
 	vk.GetDeviceQueue(vkDevice, v.graphicsQueueIndex, 0, &deviceQueue)
 
+	var computeQueue vk.Queue
+	vk.GetDeviceQueue(vkDevice, v.computeQueueIndex, v.computeQueueNumber, &computeQueue)
+
 	v.deviceQueue = deviceQueue
+	v.computeQueue = computeQueue
 	v.logicalDevice = vkDevice
 
 	/* Memory Allocator */
@@ -411,19 +490,11 @@ func (v *VulkanRenderer) Initialise() error {
 		return err
 	}
 
-	/* Viewport and scissors creation */
-	v.createViewport()
-
 	/* Depth image */
 	if err := v.prepareDepthImage(); err != nil {
 		return err
 	}
 
-	/* Pipeline Layout */
-	if err := v.createPipelineLayout(); err != nil {
-		return err
-	}
-
 	/* Render pass */
 	if err := v.createRenderPass(); err != nil {
 		return err
@@ -434,13 +505,18 @@ func (v *VulkanRenderer) Initialise() error {
 		return err
 	}
 
+	/* Pipeline Layout, from the shaders */
+	if err := v.createPipelineLayout(); err != nil {
+		return err
+	}
+
 	/* Pipeline cache */
 	if err := v.createPipelineCache(); err != nil {
 		return err
 	}
 
-	/* Pipeline */
-	if err := v.createPipeline(); err != nil {
+	/* Pipeline of the default material, others are made on first use */
+	if _, err := v.materialPipeline(DefaultMaterial); err != nil {
 		return err
 	}
 
@@ -456,6 +532,10 @@ func (v *VulkanRenderer) Initialise() error {
 		return err
 	}
 
+	if err := v.createCompute(); err != nil {
+		return err
+	}
+
 	if err := v.createTextureSampler(); err != nil {
 		return err
 	}
@@ -472,67 +552,106 @@ func (v *VulkanRenderer) Initialise() error {
 		return err
 	}
 
+	if err := v.SetMaterial(DefaultMaterialName, DefaultMaterial); err != nil {
+		return err
+	}
+
+	if err := v.setManifestMaterials(); err != nil {
+		return err
+	}
+
 	// if err := v.loadResourceSet("assets/suzanne.dae"); err != nil {
 	// 	return err
 	// }
 
+	if v.configuration.HotReload {
+		if err := v.watchFiles(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (v *VulkanRenderer) loadResourceSet(key string) error {
-	data, err := ioutil.ReadFile(key)
+func (v *VulkanRenderer) loadResourceSet(key string) (*resourceSet, error) {
+	res, err := v.loader.Load(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer res.Release()
 
-	textureFile, err := os.Open("assets/Bricks_COLOR.png")
-	if err != nil {
-		return fmt.Errorf("texture file open failed: %s", err.Error())
+	mesh, ok := res.(*gfx.Mesh)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a mesh", key)
 	}
-
-	img, err := png.Decode(textureFile)
-	if err != nil {
-		return fmt.Errorf("jpeg decode failed: %s", err.Error())
+	<-mesh.Ready()
+	if err := mesh.Err(); err != nil {
+		return nil, err
 	}
-	textureFile.Close()
+	obj := mesh.Object()
 
-	obj, err := model.ImportColladaObject(data, img)
+	tex, err := meshTexture(mesh)
 	if err != nil {
-		return fmt.Errorf("collada import failed: %s", err.Error())
+		return nil, err
 	}
 
-	rs := resourceSet{
+	rs := &resourceSet{
 		id:          key,
+		files:       mesh.Files(),
+		renderer:    v,
 		device:      v.logicalDevice,
 		numVertices: uint32(len(obj.Vertices())),
+		bounds:      obj.Bounds(),
 	}
 
-	if err := v.createVertexBuffers(&rs, obj.Vertices()); err != nil {
+	if err := v.createResourceSet(rs, obj, tex); err != nil {
+		// whatever was created before the failure is destroyed
+		rs.Release()
+		return nil, err
+	}
+
+	v.resourceLock.Lock()
+	v.resources[key] = rs
+	v.resourceLock.Unlock()
+
+	return rs, nil
+}
+
+// createResourceSet creates the buffers, texture and descriptor sets of a set.
+// Each is kept in the set as soon as it's created, so a set that failed
+// halfway can still be released
+func (v *VulkanRenderer) createResourceSet(rs *resourceSet, obj model.Object, tex *texture.Texture) error {
+	if err := v.createVertexBuffers(rs, obj.Vertices()); err != nil {
 		return err
 	}
 
-	if err := v.createUniformBuffers(&rs); err != nil {
+	if err := v.createIndexBuffer(rs, obj.LODs()); err != nil {
 		return err
 	}
 
-	if err := v.createTextureImage(&rs, obj.Texture()); err != nil {
+	if err := v.createUniformBuffers(rs); err != nil {
 		return err
 	}
 
-	if err := v.createTextureImageView(&rs); err != nil {
+	if err := v.createTextureImage(&rs.deviceTexture, tex); err != nil {
 		return err
 	}
 
-	if err := v.createDescriptorSets(&rs); err != nil {
+	if err := v.createTextureImageView(&rs.deviceTexture); err != nil {
 		return err
 	}
 
-	v.resourceLock.Lock()
-	v.resources = append(v.resources, rs)
-	v.resourcePositions[key] = len(v.resources) - 1
-	v.resourceLock.Unlock()
+	return v.createDescriptorSets(rs)
+}
 
-	return nil
+// resourceSetLoader loads resource sets for the cache of the renderer
+type resourceSetLoader struct {
+	renderer *VulkanRenderer
+}
+
+// Load implements gfx.Loader
+func (l resourceSetLoader) Load(id string) (gfx.Resource, error) {
+	return l.renderer.loadResourceSet(id)
 }
 
 func (v *VulkanRenderer) createTextureSampler() error {
@@ -552,7 +671,7 @@ func (v *VulkanRenderer) createTextureSampler() error {
 		MipmapMode:              vk.SamplerMipmapModeLinear,
 		MipLodBias:              0,
 		MinLod:                  0,
-		MaxLod:                  0,
+		MaxLod:                  vk.LodClampNone,
 	}
 
 	var textureSampler vk.Sampler
@@ -577,9 +696,58 @@ func (v *VulkanRenderer) createBuffer(buffer *vk.Buffer, size int, usage vk.Buff
 	return nil
 }
 
-func (v *VulkanRenderer) createTextureImage(set *resourceSet, texture image.Image) error {
-	bounds := texture.Bounds()
-	bufSize := bounds.Max.X * bounds.Max.Y * 4
+// textureFormat returns the Vulkan format the texture is sampled as.
+// sRGB textures are decoded on sampling only if the swapchain encodes
+// them back, otherwise the colors pass through as they are stored
+func (v *VulkanRenderer) textureFormat(tex *texture.Texture) vk.Format {
+	srgb := tex.SRGB && isSRGBFormat(v.imageFormat)
+	switch tex.Format {
+	case texture.FormatBC1:
+		if srgb {
+			return vk.FormatBc1RgbaSrgbBlock
+		}
+		return vk.FormatBc1RgbaUnormBlock
+	case texture.FormatBC3:
+		if srgb {
+			return vk.FormatBc3SrgbBlock
+		}
+		return vk.FormatBc3UnormBlock
+	case texture.FormatBC5:
+		return vk.FormatBc5UnormBlock
+	case texture.FormatBC7:
+		if srgb {
+			return vk.FormatBc7SrgbBlock
+		}
+		return vk.FormatBc7UnormBlock
+	default:
+		if srgb {
+			return vk.FormatR8g8b8a8Srgb
+		}
+		return vk.FormatR8g8b8a8Unorm
+	}
+}
+
+func isSRGBFormat(format vk.Format) bool {
+	switch format {
+	case vk.FormatB8g8r8a8Srgb, vk.FormatR8g8b8a8Srgb, vk.FormatA8b8g8r8SrgbPack32:
+		return true
+	default:
+		return false
+	}
+}
+
+// createTextureImage uploads every level of the texture through a staging
+// buffer, compressed textures are decompressed if the device can't sample them
+func (v *VulkanRenderer) createTextureImage(set *deviceTexture, tex *texture.Texture) error {
+	if tex.Format.Compressed() && !v.textureCompressionBC {
+		rgba, err := tex.Decompress()
+		if err != nil {
+			return err
+		}
+		tex = rgba
+	}
+	bufSize := tex.Size()
+	format := v.textureFormat(tex)
 
 	var textureBuffer vk.Buffer
 	if err := v.createBuffer(&textureBuffer, bufSize, vk.BufferUsageTransferSrcBit, vk.SharingModeExclusive); err != nil {
@@ -602,18 +770,37 @@ func (v *VulkanRenderer) createTextureImage(set *resourceSet, texture image.Imag
 
 	vk.BindBufferMemory(v.logicalDevice, set.textureBuffer, set.textureMemory.Get(), 0)
 
+	var mappedMemory unsafe.Pointer
+	vk.MapMemory(
+		v.logicalDevice,
+		set.textureMemory.Get(),
+		vk.DeviceSize(set.textureMemory.Offset()),
+		vk.DeviceSize(bufSize), 0,
+		&mappedMemory,
+	)
+	castMappedMemory := *(*[]uint8)(unsafe.Pointer(&sliceHeader{
+		Data: uintptr(mappedMemory),
+		Cap:  bufSize,
+		Len:  bufSize,
+	}))
+	var offset int
+	for _, level := range tex.Levels {
+		offset += copy(castMappedMemory[offset:], level)
+	}
+	vk.UnmapMemory(v.logicalDevice, set.textureMemory.Get())
+
 	ici := vk.ImageCreateInfo{
 		SType:     vk.StructureTypeImageCreateInfo,
 		ImageType: vk.ImageType2d,
 		Extent: vk.Extent3D{
-			Width:  uint32(bounds.Max.X),
-			Height: uint32(bounds.Max.Y),
+			Width:  uint32(tex.Width),
+			Height: uint32(tex.Height),
 			Depth:  1,
 		},
-		MipLevels:     1,
+		MipLevels:     uint32(len(tex.Levels)),
 		ArrayLayers:   1,
-		Format:        vk.FormatR8g8b8a8Unorm,
-		Tiling:        vk.ImageTilingLinear,
+		Format:        format,
+		Tiling:        vk.ImageTilingOptimal,
 		InitialLayout: vk.ImageLayoutUndefined,
 		Usage:         vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
 		SharingMode:   vk.SharingModeExclusive,
@@ -625,33 +812,8 @@ func (v *VulkanRenderer) createTextureImage(set *resourceSet, texture image.Imag
 		return fmt.Errorf("vk.CreateImage(): %s", err.Error())
 	}
 	set.textureImage = textureImage
-
-	var layout vk.SubresourceLayout
-	vk.GetImageSubresourceLayout(v.logicalDevice, set.textureImage, &vk.ImageSubresource{
-		AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
-	}, &layout)
-	layout.Deref()
-
-	pixels, err := GetPixels(texture, int(layout.RowPitch))
-	if err != nil {
-		return err
-	}
-
-	var mappedMemory unsafe.Pointer
-	vk.MapMemory(
-		v.logicalDevice,
-		set.textureMemory.Get(),
-		vk.DeviceSize(set.textureMemory.Offset()),
-		vk.DeviceSize(set.textureImageMemory.Len()), 0,
-		&mappedMemory,
-	)
-	castMappedMemory := *(*[]uint8)(unsafe.Pointer(&sliceHeader{
-		Data: uintptr(mappedMemory),
-		Cap:  bufSize,
-		Len:  bufSize,
-	}))
-	copy(castMappedMemory, pixels[:])
-	vk.UnmapMemory(v.logicalDevice, set.textureMemory.Get())
+	set.textureFormat = format
+	set.textureLevels = uint32(len(tex.Levels))
 
 	var memRequirements vk.MemoryRequirements
 	vk.GetImageMemoryRequirements(v.logicalDevice, set.textureImage, &memRequirements)
@@ -665,31 +827,31 @@ func (v *VulkanRenderer) createTextureImage(set *resourceSet, texture image.Imag
 
 	vk.BindImageMemory(v.logicalDevice, set.textureImage, set.textureImageMemory.Get(), 0)
 
-	if err := v.transitionLayout(set.textureImage, vk.FormatR8g8b8a8Unorm, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal); err != nil {
+	if err := v.transitionLayout(set.textureImage, format, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal, set.textureLevels); err != nil {
 		return err
 	}
 
-	if err := v.copyBufferToImage(set.textureBuffer, set.textureImage, uint32(bounds.Max.X), uint32(bounds.Max.Y)); err != nil {
+	if err := v.copyBufferToImage(set.textureBuffer, set.textureImage, tex); err != nil {
 		return err
 	}
 
-	if err := v.transitionLayout(set.textureImage, vk.FormatR8g8b8a8Unorm, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal); err != nil {
+	if err := v.transitionLayout(set.textureImage, format, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal, set.textureLevels); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (v *VulkanRenderer) createTextureImageView(set *resourceSet) error {
+func (v *VulkanRenderer) createTextureImageView(set *deviceTexture) error {
 	ivci := vk.ImageViewCreateInfo{
 		SType:    vk.StructureTypeImageViewCreateInfo,
 		Image:    set.textureImage,
 		ViewType: vk.ImageViewType2d,
-		Format:   vk.FormatR8g8b8a8Unorm,
+		Format:   set.textureFormat,
 		SubresourceRange: vk.ImageSubresourceRange{
 			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
 			BaseMipLevel:   0,
-			LevelCount:     1,
+			LevelCount:     set.textureLevels,
 			BaseArrayLayer: 0,
 			LayerCount:     1,
 		},
@@ -731,6 +893,16 @@ func (v *VulkanRenderer) beginSingleTimeCommands() (vk.CommandBuffer, error) {
 	return commandBuffer, nil
 }
 
+// waitIdle waits for the device to finish its work. The queues
+// are locked meanwhile, the compute one before the device one
+func (v *VulkanRenderer) waitIdle() {
+	v.computeLock.Lock()
+	v.queueLock.Lock()
+	vk.DeviceWaitIdle(v.logicalDevice)
+	v.queueLock.Unlock()
+	v.computeLock.Unlock()
+}
+
 func (v *VulkanRenderer) endSingleTimeCommands(commandBuffer vk.CommandBuffer) error {
 	if err := vk.Error(vk.EndCommandBuffer(commandBuffer)); err != nil {
 		return fmt.Errorf("vk.EndCommandBuffer(): %s", err.Error())
@@ -742,17 +914,19 @@ func (v *VulkanRenderer) endSingleTimeCommands(commandBuffer vk.CommandBuffer) e
 		PCommandBuffers:    []vk.CommandBuffer{commandBuffer},
 	}
 
+	v.queueLock.Lock()
 	if err := vk.Error(vk.QueueSubmit(v.deviceQueue, 1, []vk.SubmitInfo{si}, nil)); err != nil {
+		v.queueLock.Unlock()
 		return fmt.Errorf("vk.QueueSubmit(): %s", err.Error())
 	}
-
 	vk.QueueWaitIdle(v.deviceQueue)
+	v.queueLock.Unlock()
 
 	vk.FreeCommandBuffers(v.logicalDevice, v.commandPool, 1, []vk.CommandBuffer{commandBuffer})
 	return nil
 }
 
-func (v *VulkanRenderer) transitionLayout(img vk.Image, format vk.Format, old vk.ImageLayout, new vk.ImageLayout) error {
+func (v *VulkanRenderer) transitionLayout(img vk.Image, format vk.Format, old vk.ImageLayout, new vk.ImageLayout, levels uint32) error {
 	cmd, err := v.beginSingleTimeCommands()
 	if err != nil {
 		return err
@@ -767,7 +941,7 @@ func (v *VulkanRenderer) transitionLayout(img vk.Image, format vk.Format, old vk
 		Image:               img,
 		SubresourceRange: vk.ImageSubresourceRange{
 			BaseMipLevel:   0,
-			LevelCount:     1,
+			LevelCount:     levels,
 			BaseArrayLayer: 0,
 			LayerCount:     1,
 			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
@@ -814,27 +988,38 @@ func (v *VulkanRenderer) copyBuffer(src, dst vk.Buffer, size vk.DeviceSize) erro
 	return nil
 }
 
-func (v *VulkanRenderer) copyBufferToImage(buf vk.Buffer, img vk.Image, width, height uint32) error {
+// copyBufferToImage copies every level of the texture, laid out
+// one after another in the buffer, to the mip levels of the image
+func (v *VulkanRenderer) copyBufferToImage(buf vk.Buffer, img vk.Image, tex *texture.Texture) error {
 	cmd, err := v.beginSingleTimeCommands()
 	if err != nil {
 		return err
 	}
 
-	bic := vk.BufferImageCopy{
-		ImageOffset: vk.Offset3D{},
-		ImageExtent: vk.Extent3D{
-			Height: height,
-			Width:  width,
-			Depth:  1,
-		},
-		ImageSubresource: vk.ImageSubresourceLayers{
-			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
-			MipLevel:       0,
-			BaseArrayLayer: 0,
-			LayerCount:     1,
-		},
+	var (
+		regions []vk.BufferImageCopy
+		offset  int
+	)
+	for level, data := range tex.Levels {
+		width, height := tex.LevelSize(level)
+		regions = append(regions, vk.BufferImageCopy{
+			BufferOffset: vk.DeviceSize(offset),
+			ImageOffset:  vk.Offset3D{},
+			ImageExtent: vk.Extent3D{
+				Height: uint32(height),
+				Width:  uint32(width),
+				Depth:  1,
+			},
+			ImageSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				MipLevel:       uint32(level),
+				BaseArrayLayer: 0,
+				LayerCount:     1,
+			},
+		})
+		offset += len(data)
 	}
-	vk.CmdCopyBufferToImage(cmd, buf, img, vk.ImageLayoutTransferDstOptimal, 1, []vk.BufferImageCopy{bic})
+	vk.CmdCopyBufferToImage(cmd, buf, img, vk.ImageLayoutTransferDstOptimal, uint32(len(regions)), regions)
 
 	if err := v.endSingleTimeCommands(cmd); err != nil {
 		return err
@@ -843,17 +1028,16 @@ func (v *VulkanRenderer) copyBufferToImage(buf vk.Buffer, img vk.Image, width, h
 }
 
 func (v *VulkanRenderer) createUniformBuffers(set *resourceSet) error {
-	bufferSize := int(unsafe.Sizeof(model.Uniform{}))
-	uniformBuffers := make([]vk.Buffer, len(v.swapchainImages))
+	bufferSize := uniformStride * maxCameras
+	set.uniformBuffers = make([]vk.Buffer, len(v.swapchainImages))
 
-	var uniformBuffersMemory []vkr.Memory
 	for idx := 0; idx < len(v.swapchainImages); idx++ {
-		if err := v.createBuffer(&uniformBuffers[idx], bufferSize, vk.BufferUsageUniformBufferBit, vk.SharingModeExclusive); err != nil {
+		if err := v.createBuffer(&set.uniformBuffers[idx], bufferSize, vk.BufferUsageUniformBufferBit, vk.SharingModeExclusive); err != nil {
 			return err
 		}
 
 		var memoryRequirements vk.MemoryRequirements
-		vk.GetBufferMemoryRequirements(v.logicalDevice, uniformBuffers[idx], &memoryRequirements)
+		vk.GetBufferMemoryRequirements(v.logicalDevice, set.uniformBuffers[idx], &memoryRequirements)
 		memoryRequirements.Deref()
 
 		memory, err := v.allocator.Malloc(
@@ -864,12 +1048,9 @@ func (v *VulkanRenderer) createUniformBuffers(set *resourceSet) error {
 			return err
 		}
 
-		vk.BindBufferMemory(v.logicalDevice, uniformBuffers[idx], memory.Get(), 0)
-		uniformBuffersMemory = append(uniformBuffersMemory, memory)
+		set.uniformBuffersMemory = append(set.uniformBuffersMemory, memory)
+		vk.BindBufferMemory(v.logicalDevice, set.uniformBuffers[idx], memory.Get(), 0)
 	}
-
-	set.uniformBuffers = uniformBuffers
-	set.uniformBuffersMemory = uniformBuffersMemory
 	return nil
 }
 
@@ -914,6 +1095,63 @@ func (v *VulkanRenderer) createVertexBuffers(set *resourceSet, vertices []model.
 	return nil
 }
 
+// createIndexBuffer uploads the indices of the levels of detail one
+// after the other, sets without levels are drawn without indices
+func (v *VulkanRenderer) createIndexBuffer(set *resourceSet, lods []model.LOD) error {
+	var indices []uint32
+	for _, lod := range lods {
+		set.lods = append(set.lods, lodRange{
+			first: uint32(len(indices)),
+			count: uint32(len(lod.Indices)),
+		})
+		set.lodErrors = append(set.lodErrors, lod.Error)
+		indices = append(indices, lod.Indices...)
+	}
+	if len(indices) == 0 {
+		set.lods, set.lodErrors = nil, nil
+		return nil
+	}
+
+	if err := v.createBuffer(&set.indexBuffer, 4*len(indices), vk.BufferUsageIndexBufferBit, vk.SharingModeExclusive); err != nil {
+		return err
+	}
+
+	memoryRequirements := vk.MemoryRequirements{}
+	vk.GetBufferMemoryRequirements(v.logicalDevice, set.indexBuffer, &memoryRequirements)
+	memoryRequirements.Deref()
+
+	memory, err := v.allocator.Malloc(
+		memoryRequirements,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit,
+	)
+	if err != nil {
+		return err
+	}
+	set.indexMemory = memory
+
+	if err := vk.Error(vk.BindBufferMemory(v.logicalDevice, set.indexBuffer, set.indexMemory.Get(), 0)); err != nil {
+		return fmt.Errorf("vk.BindBufferMemory(): %s", err.Error())
+	}
+
+	var indexMappedMemory unsafe.Pointer
+	vk.MapMemory(
+		v.logicalDevice,
+		set.indexMemory.Get(),
+		vk.DeviceSize(set.indexMemory.Offset()),
+		vk.DeviceSize(set.indexMemory.Len()), 0,
+		&indexMappedMemory,
+	)
+	indexCastMemory := *(*[]uint32)(unsafe.Pointer(&sliceHeader{
+		Data: uintptr(indexMappedMemory),
+		Cap:  len(indices),
+		Len:  len(indices),
+	}))
+	copy(indexCastMemory, indices)
+	vk.UnmapMemory(v.logicalDevice, set.indexMemory.Get())
+
+	return nil
+}
+
 func (v *VulkanRenderer) destroyBeforeRecreatePipeline() {
 	vk.FreeCommandBuffers(v.logicalDevice, v.commandPool, uint32(len(v.commandBuffers)), v.commandBuffers)
 
@@ -923,9 +1161,6 @@ func (v *VulkanRenderer) destroyBeforeRecreatePipeline() {
 	v.framebuffers = []vk.Framebuffer{}
 
 	vk.DestroyDescriptorPool(v.logicalDevice, v.descriptorPool, nil)
-	for _, descriptorLayout := range v.descriptorSetLayouts {
-		vk.DestroyDescriptorSetLayout(v.logicalDevice, descriptorLayout, nil)
-	}
 
 	// Swapchain resources
 	for _, iv := range v.swapchainImageViews {
@@ -945,20 +1180,19 @@ func (v *VulkanRenderer) destroyBeforeRecreatePipeline() {
 
 	vk.DestroyRenderPass(v.logicalDevice, v.renderPass, nil)
 
-	vk.DestroyPipeline(v.logicalDevice, v.pipeline, nil)
-	vk.DestroyPipelineLayout(v.logicalDevice, v.pipelineLayout, nil)
+	v.destroyPipelines()
+	v.destroyComputePipelines()
+	v.destroyLayouts()
 }
 
 func (v *VulkanRenderer) recreatePipeline() error {
-	vk.DeviceWaitIdle(v.logicalDevice)
+	v.waitIdle()
 	v.destroyBeforeRecreatePipeline()
 
 	if err := v.createSwapchain(v.swapchain); err != nil {
 		return err
 	}
 
-	v.createViewport()
-
 	if err := v.prepareDepthImage(); err != nil {
 		return err
 	}
@@ -971,7 +1205,7 @@ func (v *VulkanRenderer) recreatePipeline() error {
 		return err
 	}
 
-	if err := v.createPipeline(); err != nil {
+	if _, err := v.materialPipeline(DefaultMaterial); err != nil {
 		return err
 	}
 
@@ -992,13 +1226,27 @@ func (v *VulkanRenderer) recreatePipeline() error {
 	}
 
 	v.resourceLock.Lock()
-	for k := range v.resources {
-		if err := v.createDescriptorSets(&v.resources[k]); err != nil {
+	for _, rs := range v.resources {
+		if err := v.createDescriptorSets(rs); err != nil {
+			v.resourceLock.Unlock()
 			return err
 		}
 	}
 	v.resourceLock.Unlock()
 
+	v.materialLock.Lock()
+	defer v.materialLock.Unlock()
+	for _, mat := range v.materials {
+		layout, err := v.programLayout(mat.Program)
+		if err != nil {
+			return err
+		}
+		mat.layout = layout
+		if err := v.createMaterialDescriptorSet(mat); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1015,7 +1263,7 @@ func (v *VulkanRenderer) createPipelineCache() error {
 	return nil
 }
 
-func (v *VulkanRenderer) buildCommandBuffers(imageIdx uint32) error {
+func (v *VulkanRenderer) buildCommandBuffers(imageIdx uint32, cameras []namedCamera) error {
 	if err := vk.Error(vk.ResetCommandBuffer(v.commandBuffers[imageIdx], vk.CommandBufferResetFlags(vk.CommandBufferResetReleaseResourcesBit))); err != nil {
 		return fmt.Errorf("vk.ResetCommandBuffer(): %s", err.Error())
 	}
@@ -1051,30 +1299,86 @@ func (v *VulkanRenderer) buildCommandBuffers(imageIdx uint32) error {
 		PClearValues:    clearValues,
 	}
 	vk.CmdBeginRenderPass(v.commandBuffers[imageIdx], &rpbi, vk.SubpassContentsInline)
-	vk.CmdBindPipeline(v.commandBuffers[imageIdx], vk.PipelineBindPointGraphics, v.pipeline)
-	vk.CmdSetViewport(v.commandBuffers[imageIdx], 0, 1, []vk.Viewport{v.viewport})
-	vk.CmdSetScissor(v.commandBuffers[imageIdx], 0, 1, []vk.Rect2D{v.scissor})
 
-	// TODO: Instancing with PushConstants
+	// materials stay locked while recording, so their
+	// descriptor sets aren't freed before the frame is submitted
+	v.materialLock.RLock()
+	defer v.materialLock.RUnlock()
 	v.resourceLock.RLock()
-	for _, rs := range v.resources {
-		if rs.Destroyed() {
+	v.instanceLock.RLock()
+	items := make([]visibility.Item, 0, len(v.instances))
+	for handle, instance := range v.instances {
+		rs, ok := v.resources[instance.ResourceID]
+		if !ok || rs.Destroyed() {
+			continue
+		}
+		name := materialName(instance)
+		mat, ok := v.materials[name]
+		if !ok {
 			continue
 		}
+		items = append(items, visibility.Item{
+			ID:       uint32(handle),
+			Pipeline: mat.PipelineKey(),
+			Material: name,
+			Resource: rs.id,
+			Model:    instance.Position.Mul4(instance.Rotation),
+			Bounds:   rs.bounds,
+			LODs:     rs.lodErrors,
+		})
+	}
+	v.instanceLock.RUnlock()
+
+	// the instances of every camera go into the instance buffer one
+	// after the other, a batch is a range of them drawn at once
+	visible := make([][]visibility.Item, len(cameras))
+	var instances []model.Instance
+	for cameraIdx, camera := range cameras {
+		visible[cameraIdx] = camera.cull(v.currentSurfaceWidth, v.currentSurfaceHeight, items)
+		instances = append(instances, visibility.Instances(visible[cameraIdx])...)
+	}
+	if err := v.updateInstanceBuffer(imageIdx, instances); err != nil {
+		v.resourceLock.RUnlock()
+		return err
+	}
+
+	var firstInstance uint32
+	for cameraIdx, camera := range cameras {
+		v.setCameraViewport(imageIdx, camera.Viewport)
 
-		vk.CmdBindVertexBuffers(v.commandBuffers[imageIdx], 0, 1, []vk.Buffer{rs.vertexBuffer}, []vk.DeviceSize{0})
-		vk.CmdBindDescriptorSets(v.commandBuffers[imageIdx], vk.PipelineBindPointGraphics, v.pipelineLayout, 0, 1, rs.descriptorSets, 0, nil)
-		v.instanceLock.RLock()
-		for _, instance := range v.instances {
-			if instance.ResourceID == rs.id {
-				pc := pushConstant{
-					Model: instance.Position.Mul4(instance.Rotation),
+		// the camera uniform, if the shaders take it, is at its offset
+		var dynamicOffsets []uint32
+		if hasBindingOf(v.resourceBindings, spirv.UniformBuffer) {
+			dynamicOffsets = []uint32{uint32(cameraIdx * uniformStride)}
+		}
+
+		var material *vulkanMaterial
+		for _, batch := range visibility.Batches(visible[cameraIdx]) {
+			if mat := v.materials[batch.Material]; mat != material {
+				if material == nil || mat.PipelineKey() != material.PipelineKey() {
+					pipeline, err := v.materialPipeline(mat.Material)
+					if err != nil {
+						v.resourceLock.RUnlock()
+						return err
+					}
+					vk.CmdBindPipeline(v.commandBuffers[imageIdx], vk.PipelineBindPointGraphics, pipeline)
 				}
-				vk.CmdPushConstants(v.commandBuffers[imageIdx], v.pipelineLayout, vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0, uint32(unsafe.Sizeof(pushConstant{})), unsafe.Pointer(&pc))
-				vk.CmdDraw(v.commandBuffers[imageIdx], rs.numVertices, 1, 0, 0)
+				vk.CmdBindDescriptorSets(v.commandBuffers[imageIdx], vk.PipelineBindPointGraphics, mat.layout.pipelineLayout, materialDescriptorSet, 1, []vk.DescriptorSet{mat.descriptorSet}, 0, nil)
+				material = mat
 			}
+
+			rs := v.resources[batch.Resource]
+			vk.CmdBindVertexBuffers(v.commandBuffers[imageIdx], 0, 2, []vk.Buffer{rs.vertexBuffer, v.instanceBuffers[imageIdx]}, []vk.DeviceSize{0, 0})
+			vk.CmdBindDescriptorSets(v.commandBuffers[imageIdx], vk.PipelineBindPointGraphics, material.layout.pipelineLayout, resourceDescriptorSet, 1, rs.descriptorSets[imageIdx:imageIdx+1], uint32(len(dynamicOffsets)), dynamicOffsets)
+			if len(rs.lods) == 0 {
+				vk.CmdDraw(v.commandBuffers[imageIdx], rs.numVertices, batch.Count, 0, firstInstance+batch.First)
+				continue
+			}
+			lod := rs.lods[batch.LOD]
+			vk.CmdBindIndexBuffer(v.commandBuffers[imageIdx], rs.indexBuffer, 0, vk.IndexTypeUint32)
+			vk.CmdDrawIndexed(v.commandBuffers[imageIdx], lod.count, batch.Count, lod.first, 0, firstInstance+batch.First)
 		}
-		v.instanceLock.RUnlock()
+		firstInstance += uint32(len(visible[cameraIdx]))
 	}
 	v.resourceLock.RUnlock()
 
@@ -1086,16 +1390,124 @@ func (v *VulkanRenderer) buildCommandBuffers(imageIdx uint32) error {
 	return nil
 }
 
-var constant float32
+// updateInstanceBuffer writes the instances into the instance buffer of
+// the swapchain image, growing it if they don't fit. The buffer is not
+// in use, Draw waits for the previous frame before recording
+func (v *VulkanRenderer) updateInstanceBuffer(imageIdx uint32, instances []model.Instance) error {
+	for int(imageIdx) >= len(v.instanceBuffers) {
+		v.instanceBuffers = append(v.instanceBuffers, vk.NullBuffer)
+		v.instanceMemory = append(v.instanceMemory, vkr.Memory{})
+		v.instanceCapacity = append(v.instanceCapacity, 0)
+	}
+
+	if len(instances) > v.instanceCapacity[imageIdx] || v.instanceBuffers[imageIdx] == vk.NullBuffer {
+		capacity := minInstanceCapacity
+		for capacity < len(instances) {
+			capacity *= 2
+		}
+		v.destroyInstanceBuffer(imageIdx)
+
+		var buffer vk.Buffer
+		if err := v.createBuffer(&buffer, capacity*int(unsafe.Sizeof(model.Instance{})), vk.BufferUsageVertexBufferBit, vk.SharingModeExclusive); err != nil {
+			return err
+		}
+
+		var memoryRequirements vk.MemoryRequirements
+		vk.GetBufferMemoryRequirements(v.logicalDevice, buffer, &memoryRequirements)
+		memoryRequirements.Deref()
+
+		memory, err := v.allocator.Malloc(
+			memoryRequirements,
+			vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit,
+		)
+		if err != nil {
+			vk.DestroyBuffer(v.logicalDevice, buffer, nil)
+			return err
+		}
+		if err := vk.Error(vk.BindBufferMemory(v.logicalDevice, buffer, memory.Get(), 0)); err != nil {
+			vk.DestroyBuffer(v.logicalDevice, buffer, nil)
+			memory.Release()
+			return fmt.Errorf("vk.BindBufferMemory(): %s", err.Error())
+		}
+
+		v.instanceBuffers[imageIdx] = buffer
+		v.instanceMemory[imageIdx] = memory
+		v.instanceCapacity[imageIdx] = capacity
+	}
+
+	if len(instances) == 0 {
+		return nil
+	}
+
+	memory := v.instanceMemory[imageIdx]
+	var mappedMemory unsafe.Pointer
+	vk.MapMemory(
+		v.logicalDevice,
+		memory.Get(),
+		vk.DeviceSize(memory.Offset()),
+		vk.DeviceSize(memory.Len()), 0,
+		&mappedMemory,
+	)
+	castMemory := *(*[]model.Instance)(unsafe.Pointer(&sliceHeader{
+		Data: uintptr(mappedMemory),
+		Cap:  len(instances),
+		Len:  len(instances),
+	}))
+	copy(castMemory, instances)
+	vk.UnmapMemory(v.logicalDevice, memory.Get())
+	return nil
+}
 
-func (v *VulkanRenderer) updateUniformBuffers(imageIdx uint32, set *resourceSet) {
-	constant += 0.005
-	ubo := model.Uniform{
-		View:       glm.LookAt(2, 2, 2, 0, 0, 0, 0, 0, 1),
-		Projection: glm.Perspective(45, (float32)(v.currentSurfaceWidth)/(float32)(v.currentSurfaceHeight), 0.1, 10),
+func (v *VulkanRenderer) destroyInstanceBuffer(imageIdx uint32) {
+	if v.instanceBuffers[imageIdx] == vk.NullBuffer {
+		return
 	}
-	ubo.Projection[5] *= -1 // Flip from OpenGl to Vulkan projection
+	vk.DestroyBuffer(v.logicalDevice, v.instanceBuffers[imageIdx], nil)
+	v.instanceMemory[imageIdx].Release()
+	v.instanceBuffers[imageIdx] = vk.NullBuffer
+	v.instanceMemory[imageIdx] = vkr.Memory{}
+	v.instanceCapacity[imageIdx] = 0
+}
 
+// setCameraViewport limits drawing to the viewport of a camera,
+// clearing the depth there so it's drawn over the cameras before
+func (v *VulkanRenderer) setCameraViewport(imageIdx uint32, viewport Viewport) {
+	rect := viewport.Rect(v.currentSurfaceWidth, v.currentSurfaceHeight)
+	scissor := vk.Rect2D{
+		Offset: vk.Offset2D{
+			X: int32(rect.Min.X),
+			Y: int32(rect.Min.Y),
+		},
+		Extent: vk.Extent2D{
+			Width:  uint32(rect.Dx()),
+			Height: uint32(rect.Dy()),
+		},
+	}
+	vk.CmdSetViewport(v.commandBuffers[imageIdx], 0, 1, []vk.Viewport{{
+		X:        float32(rect.Min.X),
+		Y:        float32(rect.Min.Y),
+		Width:    float32(rect.Dx()),
+		Height:   float32(rect.Dy()),
+		MinDepth: 0,
+		MaxDepth: 1,
+	}})
+	vk.CmdSetScissor(v.commandBuffers[imageIdx], 0, 1, []vk.Rect2D{scissor})
+
+	var clearDepth vk.ClearValue
+	clearDepth.SetDepthStencil(1, 0)
+	vk.CmdClearAttachments(v.commandBuffers[imageIdx], 1, []vk.ClearAttachment{{
+		AspectMask: vk.ImageAspectFlags(vk.ImageAspectDepthBit),
+		ClearValue: clearDepth,
+	}}, 1, []vk.ClearRect{{
+		Rect:           scissor,
+		BaseArrayLayer: 0,
+		LayerCount:     1,
+	}})
+}
+
+// updateUniformBuffers writes the uniforms of the cameras
+// uniformStride apart, where the dynamic offsets point
+func (v *VulkanRenderer) updateUniformBuffers(imageIdx uint32, set *resourceSet, uniforms []model.Uniform) {
 	var mappedMemory unsafe.Pointer
 	vk.MapMemory(
 		v.logicalDevice,
@@ -1104,17 +1516,18 @@ func (v *VulkanRenderer) updateUniformBuffers(imageIdx uint32, set *resourceSet)
 		vk.DeviceSize(set.uniformBuffersMemory[imageIdx].Len()), 0,
 		&mappedMemory,
 	)
-	castMemory := *(*[]model.Uniform)(unsafe.Pointer(&sliceHeader{
-		Data: uintptr(mappedMemory),
-		Cap:  1,
-		Len:  1,
-	}))
-	copy(castMemory, []model.Uniform{ubo})
+	for idx, ubo := range uniforms {
+		*(*model.Uniform)(unsafe.Pointer(uintptr(mappedMemory) + uintptr(idx*uniformStride))) = ubo
+	}
 	vk.UnmapMemory(v.logicalDevice, set.uniformBuffersMemory[imageIdx].Get())
 }
 
 // Draw implements interface
 func (v *VulkanRenderer) Draw() error {
+	if err := v.applyReloads(); err != nil {
+		return err
+	}
+
 	vk.WaitForFences(v.logicalDevice, 1, []vk.Fence{v.imageFence}, 0, math.MaxUint32)
 	vk.ResetFences(v.logicalDevice, 1, []vk.Fence{v.imageFence})
 
@@ -1125,14 +1538,20 @@ func (v *VulkanRenderer) Draw() error {
 		return nil
 	}
 
+	cameras := v.cameras.sorted()
+	uniforms := make([]model.Uniform, len(cameras))
+	for idx, camera := range cameras {
+		uniforms[idx] = camera.Uniform(v.currentSurfaceWidth, v.currentSurfaceHeight)
+	}
+
 	v.resourceLock.RLock()
 	for _, rs := range v.resources {
-		v.updateUniformBuffers(v.imageIndex, &rs)
+		v.updateUniformBuffers(v.imageIndex, rs, uniforms)
 	}
 	v.resourceLock.RUnlock()
 
 	/* Fill in command buffers */
-	if err := v.buildCommandBuffers(v.imageIndex); err != nil {
+	if err := v.buildCommandBuffers(v.imageIndex, cameras); err != nil {
 		return err
 	}
 
@@ -1149,6 +1568,8 @@ func (v *VulkanRenderer) Draw() error {
 		PSignalSemaphores:    []vk.Semaphore{v.renderFinishedSemphore},
 	}}
 
+	v.queueLock.Lock()
+	defer v.queueLock.Unlock()
 	if err := vk.Error(vk.QueueSubmit(v.deviceQueue, 1, submit, v.imageFence)); err != nil {
 		return err
 	}
@@ -1167,7 +1588,9 @@ func (v *VulkanRenderer) Present() error {
 		PImageIndices:      []uint32{v.imageIndex},
 	}
 
+	v.queueLock.Lock()
 	presentResult := vk.QueuePresent(v.deviceQueue, &presentInfo)
+	v.queueLock.Unlock()
 	if presentResult == vk.ErrorOutOfDate {
 		if err := v.recreatePipeline(); err != nil {
 			return err
@@ -1182,89 +1605,78 @@ func (v *VulkanRenderer) Present() error {
 	return nil
 }
 
-func (v *VulkanRenderer) createViewport() {
-	viewport := vk.Viewport{
-		X:        0,
-		Y:        0,
-		Width:    float32(v.currentSurfaceWidth),
-		Height:   float32(v.currentSurfaceHeight),
-		MinDepth: 0,
-		MaxDepth: 1,
-	}
-
-	scissor := vk.Rect2D{
-		Offset: vk.Offset2D{
-			X: 0,
-			Y: 0,
-		},
-		Extent: vk.Extent2D{
-			Width:  v.currentSurfaceWidth,
-			Height: v.currentSurfaceHeight,
-		},
-	}
-	v.viewport = viewport
-	v.scissor = scissor
-}
-
+// createDescriptorSets creates set 0 of the resource for every swapchain image,
+// the camera uniform and the mesh texture are bound where the shaders take them
 func (v *VulkanRenderer) createDescriptorSets(set *resourceSet) error {
-	descriptorSets := make([]vk.DescriptorSet, len(v.swapchainImages))
 	dsai := vk.DescriptorSetAllocateInfo{
 		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
 		DescriptorPool:     v.descriptorPool,
 		DescriptorSetCount: 1,
-		PSetLayouts:        v.descriptorSetLayouts,
+		PSetLayouts:        []vk.DescriptorSetLayout{v.resourceSetLayout},
 	}
 
 	for idx := range v.swapchainImages {
-		if err := vk.Error(vk.AllocateDescriptorSets(v.logicalDevice, &dsai, &descriptorSets[idx])); err != nil {
+		var descriptorSet vk.DescriptorSet
+		if err := vk.Error(vk.AllocateDescriptorSets(v.logicalDevice, &dsai, &descriptorSet)); err != nil {
 			return fmt.Errorf("vk.AllocateDescriptorSets(): %s", err.Error())
 		}
-
-		dbi := vk.DescriptorBufferInfo{
-			Buffer: set.uniformBuffers[idx],
-			Offset: 0,
-			Range:  vk.DeviceSize(unsafe.Sizeof(model.Uniform{})),
-		}
-		dii := vk.DescriptorImageInfo{
-			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
-			ImageView:   set.textureImageView,
-			Sampler:     v.textureSampler,
+		set.descriptorSets = append(set.descriptorSets, descriptorSet)
+
+		var wds []vk.WriteDescriptorSet
+		for _, b := range v.resourceBindings {
+			switch b.Type {
+			case spirv.UniformBuffer:
+				wds = append(wds, vk.WriteDescriptorSet{
+					SType:           vk.StructureTypeWriteDescriptorSet,
+					DstSet:          descriptorSet,
+					DstBinding:      b.Binding,
+					DstArrayElement: 0,
+					DescriptorType:  vk.DescriptorTypeUniformBufferDynamic,
+					DescriptorCount: 1,
+					PBufferInfo: []vk.DescriptorBufferInfo{{
+						Buffer: set.uniformBuffers[idx],
+						Offset: 0,
+						Range:  vk.DeviceSize(unsafe.Sizeof(model.Uniform{})),
+					}},
+				})
+			case spirv.CombinedImageSampler:
+				wds = append(wds, vk.WriteDescriptorSet{
+					SType:           vk.StructureTypeWriteDescriptorSet,
+					DstSet:          descriptorSet,
+					DstBinding:      b.Binding,
+					DstArrayElement: 0,
+					DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+					DescriptorCount: 1,
+					PImageInfo: []vk.DescriptorImageInfo{{
+						ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+						ImageView:   set.textureImageView,
+						Sampler:     v.textureSampler,
+					}},
+				})
+			}
 		}
-		wds := []vk.WriteDescriptorSet{{
-			SType:           vk.StructureTypeWriteDescriptorSet,
-			DstSet:          descriptorSets[idx],
-			DstBinding:      0,
-			DstArrayElement: 0,
-			DescriptorType:  vk.DescriptorTypeUniformBuffer,
-			DescriptorCount: 1,
-			PBufferInfo:     []vk.DescriptorBufferInfo{dbi},
-		}, {
-			SType:           vk.StructureTypeWriteDescriptorSet,
-			DstSet:          descriptorSets[idx],
-			DstBinding:      1,
-			DstArrayElement: 0,
-			DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
-			DescriptorCount: 1,
-			PImageInfo:      []vk.DescriptorImageInfo{dii},
-		}}
 		vk.UpdateDescriptorSets(v.logicalDevice, uint32(len(wds)), wds, 0, nil)
 	}
-	set.descriptorSets = descriptorSets
 	return nil
 }
 
 func (v *VulkanRenderer) prepareDescriptorPool() error {
 	poolSizes := []vk.DescriptorPoolSize{
 		{
-			Type:            vk.DescriptorTypeUniformBuffer,
+			Type:            vk.DescriptorTypeUniformBufferDynamic,
 			DescriptorCount: uint32(len(v.swapchainImages)) * 100,
 		},
 		{
 			Type:            vk.DescriptorTypeCombinedImageSampler,
 			DescriptorCount: uint32(len(v.swapchainImages)) * 100,
+		},
+		{
+			Type:            vk.DescriptorTypeUniformBuffer,
+			DescriptorCount: uint32(len(v.swapchainImages)) * 100,
 		}}
 	dpci := vk.DescriptorPoolCreateInfo{
 		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		Flags:         vk.DescriptorPoolCreateFlags(vk.DescriptorPoolCreateFreeDescriptorSetBit),
 		MaxSets:       uint32(len(v.swapchainImages)) * uint32(len(poolSizes)) * 100,
 		PoolSizeCount: uint32(len(poolSizes)),
 		PPoolSizes:    poolSizes,
@@ -1460,36 +1872,82 @@ func (v *VulkanRenderer) getMemoryType(typeBits uint32, properties vk.MemoryProp
 	return 0, errors.New("requested memory type not found")
 }
 
-func (v *VulkanRenderer) createPipeline() error {
-	pipelineShaderStagesInfo := make([]vk.PipelineShaderStageCreateInfo, len(v.shaders))
-	for idx, shader := range v.shaders {
+// createPipeline creates a pipeline of the shaders with their layout, drawing with the render state
+func (v *VulkanRenderer) createPipeline(layout *programLayout, shaders []Shader, state RenderState) (vk.Pipeline, error) {
+	pipelineShaderStagesInfo := make([]vk.PipelineShaderStageCreateInfo, len(shaders))
+	for idx, shader := range shaders {
 
-		var stage vk.ShaderStageFlagBits
-		switch shader.Type() {
-		case VertexShaderType:
-			stage = vk.ShaderStageVertexBit
-		case FragmentShaderType:
-			stage = vk.ShaderStageFragmentBit
-		default:
-			return errors.New("unsupported shader type attempted creation")
+		stage := vk.ShaderStageFlagBits(shader.Type().stage())
+		if stage == 0 || shader.Type() == ComputeShaderType {
+			return nil, errors.New("unsupported shader type attempted creation")
 		}
 
 		var shaderModule vk.ShaderModule
 		if sm, ok := shader.ShaderModule().(vk.ShaderModule); ok {
 			shaderModule = sm
 		} else {
-			return errors.New("failed to assert shader module to it's original type")
+			return nil, errors.New("failed to assert shader module to it's original type")
 		}
 
 		pipelineShaderStagesInfo[idx].SType = vk.StructureTypePipelineShaderStageCreateInfo
 		pipelineShaderStagesInfo[idx].Stage = stage
 		pipelineShaderStagesInfo[idx].Module = shaderModule
-		pipelineShaderStagesInfo[idx].PName = safeString("main")
+		pipelineShaderStagesInfo[idx].PName = safeString(shader.EntryPoint())
+		pipelineShaderStagesInfo[idx].PSpecializationInfo = specializationInfo(shader.Specialization())
+	}
+
+	topology := vk.PrimitiveTopologyTriangleList
+	var tessellationState *vk.PipelineTessellationStateCreateInfo
+	if layout.reflection.Stages&spirv.StageTessellationControl != 0 {
+		topology = vk.PrimitiveTopologyPatchList
+		tessellationState = &vk.PipelineTessellationStateCreateInfo{
+			SType:              vk.StructureTypePipelineTessellationStateCreateInfo,
+			PatchControlPoints: 3,
+		}
 	}
 
-	vertexAttributeDescriptions := model.VertexAttributeDescriptions()
+	vertexAttributeDescriptions := layout.attributes
 	vertexBindingDescriptions := model.VertexBindingDescriptions()
 
+	cullMode := vk.CullModeFlags(vk.CullModeBackBit)
+	switch state.Cull {
+	case CullFront:
+		cullMode = vk.CullModeFlags(vk.CullModeFrontBit)
+	case CullNone:
+		cullMode = vk.CullModeFlags(vk.CullModeNone)
+	}
+
+	depthTest, depthWrite := vk.Bool32(vk.True), vk.Bool32(vk.True)
+	switch state.Depth {
+	case DepthRead:
+		depthWrite = vk.False
+	case DepthDisabled:
+		depthTest, depthWrite = vk.False, vk.False
+	}
+
+	blendAttachment := vk.PipelineColorBlendAttachmentState{
+		ColorWriteMask: 0xF,
+		BlendEnable:    vk.False,
+	}
+	switch state.Blend {
+	case BlendAlpha:
+		blendAttachment.BlendEnable = vk.True
+		blendAttachment.SrcColorBlendFactor = vk.BlendFactorSrcAlpha
+		blendAttachment.DstColorBlendFactor = vk.BlendFactorOneMinusSrcAlpha
+		blendAttachment.ColorBlendOp = vk.BlendOpAdd
+		blendAttachment.SrcAlphaBlendFactor = vk.BlendFactorOne
+		blendAttachment.DstAlphaBlendFactor = vk.BlendFactorOneMinusSrcAlpha
+		blendAttachment.AlphaBlendOp = vk.BlendOpAdd
+	case BlendAdditive:
+		blendAttachment.BlendEnable = vk.True
+		blendAttachment.SrcColorBlendFactor = vk.BlendFactorSrcAlpha
+		blendAttachment.DstColorBlendFactor = vk.BlendFactorOne
+		blendAttachment.ColorBlendOp = vk.BlendOpAdd
+		blendAttachment.SrcAlphaBlendFactor = vk.BlendFactorZero
+		blendAttachment.DstAlphaBlendFactor = vk.BlendFactorOne
+		blendAttachment.AlphaBlendOp = vk.BlendOpAdd
+	}
+
 	gpci := []vk.GraphicsPipelineCreateInfo{{
 		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
 		StageCount: uint32(len(pipelineShaderStagesInfo)),
@@ -1503,8 +1961,9 @@ func (v *VulkanRenderer) createPipeline() error {
 		},
 		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
 			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
-			Topology: vk.PrimitiveTopologyTriangleList,
+			Topology: topology,
 		},
+		PTessellationState: tessellationState,
 		PViewportState: &vk.PipelineViewportStateCreateInfo{
 			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
 			ViewportCount: 1,
@@ -1513,14 +1972,14 @@ func (v *VulkanRenderer) createPipeline() error {
 		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
 			SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
 			PolygonMode: vk.PolygonModeFill,
-			CullMode:    vk.CullModeFlags(vk.CullModeBackBit),
+			CullMode:    cullMode,
 			FrontFace:   vk.FrontFaceCounterClockwise,
 			LineWidth:   1.0,
 		},
 		PDepthStencilState: &vk.PipelineDepthStencilStateCreateInfo{
 			SType:                 vk.StructureTypePipelineDepthStencilStateCreateInfo,
-			DepthTestEnable:       vk.True,
-			DepthWriteEnable:      vk.True,
+			DepthTestEnable:       depthTest,
+			DepthWriteEnable:      depthWrite,
 			DepthCompareOp:        vk.CompareOpLess,
 			DepthBoundsTestEnable: vk.False,
 			Back: vk.StencilOpState{
@@ -1542,10 +2001,7 @@ func (v *VulkanRenderer) createPipeline() error {
 		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
 			SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
 			AttachmentCount: 1,
-			PAttachments: []vk.PipelineColorBlendAttachmentState{{
-				ColorWriteMask: 0xF,
-				BlendEnable:    vk.False,
-			}},
+			PAttachments:    []vk.PipelineColorBlendAttachmentState{blendAttachment},
 		},
 		PDynamicState: &vk.PipelineDynamicStateCreateInfo{
 			SType:             vk.StructureTypePipelineDynamicStateCreateInfo,
@@ -1555,16 +2011,15 @@ func (v *VulkanRenderer) createPipeline() error {
 				vk.DynamicStateViewport,
 			},
 		},
-		Layout:     v.pipelineLayout,
+		Layout:     layout.pipelineLayout,
 		RenderPass: v.renderPass,
 	}}
 
 	pipelines := make([]vk.Pipeline, len(gpci))
 	if err := vk.Error(vk.CreateGraphicsPipelines(v.logicalDevice, v.pipelineCache, uint32(len(gpci)), gpci, nil, pipelines)); err != nil {
-		return errors.New("vk.CreateGraphicsPipelines(): " + err.Error())
+		return nil, errors.New("vk.CreateGraphicsPipelines(): " + err.Error())
 	}
-	v.pipeline = pipelines[0]
-	return nil
+	return pipelines[0], nil
 }
 
 func (v *VulkanRenderer) createSwapchain(oldSwapchain vk.Swapchain) error {
@@ -1637,61 +2092,6 @@ func (v *VulkanRenderer) createSwapchain(oldSwapchain vk.Swapchain) error {
 	return nil
 }
 
-func (v *VulkanRenderer) createPipelineLayout() error {
-	bindings := []vk.DescriptorSetLayoutBinding{
-		{
-			DescriptorCount: 1,
-			DescriptorType:  vk.DescriptorTypeUniformBuffer,
-			StageFlags:      vk.ShaderStageFlags(vk.ShaderStageVertexBit),
-			Binding:         0,
-		},
-		{
-			DescriptorCount: 1,
-			DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
-			StageFlags:      vk.ShaderStageFlags(vk.ShaderStageFragmentBit),
-			Binding:         1,
-		},
-	}
-	dslci := vk.DescriptorSetLayoutCreateInfo{
-		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
-		BindingCount: uint32(len(bindings)),
-		PBindings:    bindings,
-	}
-
-	var descriptorSetLayouts []vk.DescriptorSetLayout
-	for range v.swapchainImages {
-		var descriptorSetLayout vk.DescriptorSetLayout
-		if err := vk.Error(vk.CreateDescriptorSetLayout(v.logicalDevice, &dslci, nil, &descriptorSetLayout)); err != nil {
-			return errors.New("vk.CreateDescriptorSetLayout(): " + err.Error())
-		}
-		descriptorSetLayouts = append(descriptorSetLayouts, descriptorSetLayout)
-	}
-	v.descriptorSetLayouts = descriptorSetLayouts
-
-	pcr := []vk.PushConstantRange{
-		{
-			Offset:     0,
-			Size:       uint32(unsafe.Sizeof(pushConstant{})),
-			StageFlags: vk.ShaderStageFlags(vk.ShaderStageVertexBit),
-		},
-	}
-
-	plci := vk.PipelineLayoutCreateInfo{
-		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
-		SetLayoutCount:         uint32(len(v.descriptorSetLayouts)),
-		PSetLayouts:            v.descriptorSetLayouts,
-		PushConstantRangeCount: uint32(len(pcr)),
-		PPushConstantRanges:    pcr,
-	}
-
-	var pipelineLayout vk.PipelineLayout
-	if err := vk.Error(vk.CreatePipelineLayout(v.logicalDevice, &plci, nil, &pipelineLayout)); err != nil {
-		return errors.New("vk.CreatePipelineLayout(): " + err.Error())
-	}
-	v.pipelineLayout = pipelineLayout
-	return nil
-}
-
 func (v *VulkanRenderer) createRenderPass() error {
 	swapchainAttachments := []vk.AttachmentDescription{
 		{
@@ -1785,7 +2185,7 @@ func (v *VulkanRenderer) createImageViews() error {
 		}
 
 		if err := vk.Error(vk.CreateImageView(v.logicalDevice, &ivci, nil, &imageView)); err != nil {
-			return errors.New("with index " + string(idx) + "vk.CreateImageView(): " + err.Error())
+			return fmt.Errorf("with index %d vk.CreateImageView(): %s", idx, err.Error())
 		}
 
 		v.swapchainImageViews = append(v.swapchainImageViews, imageView)
@@ -1794,20 +2194,41 @@ func (v *VulkanRenderer) createImageViews() error {
 }
 
 func (v *VulkanRenderer) loadShaders() error {
-	var shaders []Shader
-	shaderFiles, shaderTypes, err := loadShaderFilesFromDirectory(v.configuration.ShaderDirectory)
+	manifest, err := LoadShaderManifest(v.configuration.ShaderDirectory)
 	if err != nil {
 		return err
 	}
 
-	for idx, val := range shaderFiles {
-		shader, err := NewVulkanShader(val, shaderTypes[idx], v.logicalDevice)
-		if err != nil {
-			return err
+	var shaders []Shader
+	for _, program := range manifest.Programs.names() {
+		for _, stage := range manifest.Programs[program].Stages() {
+			shader, err := NewVulkanShader(program, stage, v.logicalDevice)
+			if err != nil {
+				for _, created := range shaders {
+					created.Destroy()
+				}
+				return err
+			}
+			shaders = append(shaders, shader)
 		}
-		shaders = append(shaders, shader)
 	}
 	v.shaders = shaders
+	v.manifest = manifest
+	return nil
+}
+
+// setManifestMaterials sets the materials of the shader manifest
+func (v *VulkanRenderer) setManifestMaterials() error {
+	names := make([]string, 0, len(v.manifest.Materials))
+	for name := range v.manifest.Materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := v.SetMaterial(name, v.manifest.Materials[name]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1819,30 +2240,73 @@ func (v *VulkanRenderer) ResourceHandle() ResourceHandle {
 	return ResourceHandle(handle)
 }
 
-// ResourceUpdate implements interface
+// ResourceUpdate implements interface, the channel is closed without
+// a value if the resource could not be loaded or the material is not set
 func (v *VulkanRenderer) ResourceUpdate(handle ResourceHandle, instance ResourceInstance) <-chan struct{} {
 	sig := make(chan struct{}, 1)
-	if _, ok := v.resourcePositions[instance.ResourceID]; !ok {
-		if err := v.loadResourceSet(instance.ResourceID); err != nil {
+
+	v.materialLock.RLock()
+	_, ok := v.materials[materialName(instance)]
+	v.materialLock.RUnlock()
+	if !ok {
+		close(sig)
+		return sig
+	}
+
+	v.instanceLock.RLock()
+	current, ok := v.instanceResources[handle]
+	v.instanceLock.RUnlock()
+
+	var previous *gfx.Handle
+	if !ok || current.ID() != instance.ResourceID {
+		res, err := v.cache.Acquire(instance.ResourceID)
+		if err != nil {
 			defer close(sig)
 			return sig
 		}
+		previous, current = current, res
 	}
 	defer func() { sig <- struct{}{} }()
 
 	v.instanceLock.Lock()
-	defer v.instanceLock.Unlock()
-
 	v.instances[handle] = instance
+	v.instanceResources[handle] = current
+	v.instanceLock.Unlock()
+
+	// releasing may unload the set, which waits for the
+	// draws and so must happen outside of the lock
+	if previous != nil {
+		previous.Release()
+	}
 	return sig
 }
 
 // ResourceDelete implements interface
 func (v *VulkanRenderer) ResourceDelete(handle ResourceHandle) {
-	// TODO: unload empty resource sets
 	v.instanceLock.Lock()
-	defer v.instanceLock.Unlock()
+	res, ok := v.instanceResources[handle]
 	delete(v.instances, handle)
+	delete(v.instanceResources, handle)
+	v.instanceLock.Unlock()
+
+	if ok {
+		res.Release()
+	}
+}
+
+// SetCamera implements interface, at most maxCameras can be set
+func (v *VulkanRenderer) SetCamera(name string, camera Camera) error {
+	return v.cameras.set(name, camera, maxCameras)
+}
+
+// RemoveCamera implements interface
+func (v *VulkanRenderer) RemoveCamera(name string) {
+	v.cameras.remove(name)
+}
+
+// ResourceStats implements interface
+func (v *VulkanRenderer) ResourceStats() gfx.CacheStats {
+	return v.cache.Stats()
 }
 
 // DeviceIsSuitable implements interface
@@ -1853,23 +2317,41 @@ func (v *VulkanRenderer) DeviceIsSuitable(device vk.PhysicalDevice) (bool, strin
 
 // Destroy implements interface
 func (v *VulkanRenderer) Destroy() {
-	vk.DeviceWaitIdle(v.logicalDevice)
+	v.waitIdle()
 
 	for _, shader := range v.shaders {
 		shader.Destroy()
 	}
 
-	v.resourceLock.Lock()
-	for _, rs := range v.resources {
-		rs.Destroy()
+	v.instanceLock.Lock()
+	for handle, res := range v.instanceResources {
+		res.Release()
+		delete(v.instanceResources, handle)
+	}
+	v.instanceLock.Unlock()
+	v.cache.Purge()
+	v.loader.Close()
+	if v.watchDone != nil {
+		close(v.watchDone)
+	}
+
+	for idx := range v.instanceBuffers {
+		v.destroyInstanceBuffer(uint32(idx))
 	}
-	v.resourceLock.Unlock()
+
+	v.materialLock.Lock()
+	for name, mat := range v.materials {
+		mat.destroy()
+		delete(v.materials, name)
+	}
+	v.materialLock.Unlock()
 
 	vk.DestroySemaphore(v.logicalDevice, v.imageAvailableSemaphore, nil)
 	vk.DestroySemaphore(v.logicalDevice, v.renderFinishedSemphore, nil)
 	vk.DestroyFence(v.logicalDevice, v.imageFence, nil)
 
 	vk.DestroyCommandPool(v.logicalDevice, v.commandPool, nil)
+	v.destroyCompute()
 
 	for _, f := range v.framebuffers {
 		vk.DestroyFramebuffer(v.logicalDevice, f, nil)
@@ -1880,14 +2362,11 @@ func (v *VulkanRenderer) Destroy() {
 	}
 
 	vk.DestroyDescriptorPool(v.logicalDevice, v.descriptorPool, nil)
-	for _, descriptorLayout := range v.descriptorSetLayouts {
-		vk.DestroyDescriptorSetLayout(v.logicalDevice, descriptorLayout, nil)
-	}
 
-	vk.DestroyPipeline(v.logicalDevice, v.pipeline, nil)
+	v.destroyPipelines()
+	v.destroyLayouts()
 	vk.DestroyPipelineCache(v.logicalDevice, v.pipelineCache, nil)
 	vk.DestroyRenderPass(v.logicalDevice, v.renderPass, nil)
-	vk.DestroyPipelineLayout(v.logicalDevice, v.pipelineLayout, nil)
 
 	vk.FreeMemory(v.logicalDevice, v.depthImageMemory, nil)
 	vk.DestroyImageView(v.logicalDevice, v.depthImageView, nil)
@@ -1899,34 +2378,29 @@ func (v *VulkanRenderer) Destroy() {
 	vk.DestroyDevice(v.logicalDevice, nil)
 }
 
-// NewVulkanShader creates a Vulkan specific shader wrapper
-func NewVulkanShader(path string, shaderType ShaderType, device vk.Device) (Shader, error) {
-	splitPath := strings.Split(path, "/")
-	filename := splitPath[len(splitPath)-1]
-	shaderName := strings.Split(filename, ".")[0]
-
-	shaderContents, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
+// NewVulkanShader creates a Vulkan specific shader of a stage
+// of the program, from a loaded shader manifest
+func NewVulkanShader(program string, stage *StageManifest, device vk.Device) (Shader, error) {
 	smci := vk.ShaderModuleCreateInfo{
 		SType:    vk.StructureTypeShaderModuleCreateInfo,
-		CodeSize: uint(len(shaderContents)),
-		PCode:    SliceUint32(shaderContents),
+		CodeSize: uint(len(stage.Code)),
+		PCode:    SliceUint32(stage.Code),
 	}
 
 	var shader vk.ShaderModule
 	if err := vk.Error(vk.CreateShaderModule(device, &smci, nil, &shader)); err != nil {
-		return nil, fmt.Errorf("vk.CreateShaderModule(type %d): %s", shaderType, err.Error())
+		return nil, fmt.Errorf("vk.CreateShaderModule(%s): %s", stage.File, err.Error())
 	}
 
 	return &VulkanShader{
 		shader:           shader,
-		shaderType:       shaderType,
-		shaderContents:   shaderContents,
+		shaderType:       stage.Type,
+		shaderContents:   stage.Code,
 		shaderCreateInfo: smci,
-		name:             shaderName,
+		module:           stage.Module,
+		entryPoint:       stage.EntryPoint,
+		specialization:   stage.Constants,
+		name:             program,
 		device:           device,
 	}, nil
 }
@@ -1943,6 +2417,9 @@ type VulkanShader struct {
 	shaderContents   []byte
 	slicedContents   []uint32
 	shaderCreateInfo vk.ShaderModuleCreateInfo
+	module           *spirv.Module
+	entryPoint       string
+	specialization   []SpecializationConstant
 }
 
 // Type implements interface
@@ -1955,6 +2432,21 @@ func (v VulkanShader) ShaderModule() interface{} {
 	return v.shader
 }
 
+// Module implements interface
+func (v VulkanShader) Module() *spirv.Module {
+	return v.module
+}
+
+// EntryPoint implements interface
+func (v VulkanShader) EntryPoint() string {
+	return v.entryPoint
+}
+
+// Specialization implements interface
+func (v VulkanShader) Specialization() []SpecializationConstant {
+	return v.specialization
+}
+
 // Name implements interface
 func (v VulkanShader) Name() string {
 	return v.name
@@ -1969,27 +2461,56 @@ func newResourceSet() (*resourceSet, error) {
 	return nil, nil
 }
 
+// resourceSet is a mesh with its texture uploaded for rendering,
+// it's a gfx.Resource for the cache of the renderer
 type resourceSet struct {
 	Destroyable
 
-	device vk.Device
+	renderer *VulkanRenderer
+	device   vk.Device
 
 	destroyed bool
 	id        string
+	files     []string
 
 	numVertices          uint32
+	bounds               model.Bounds
 	vertexBuffer         vk.Buffer
 	vertexMemory         vkr.Memory
+	indexBuffer          vk.Buffer
+	indexMemory          vkr.Memory
+	lods                 []lodRange
+	lodErrors            []float32
 	uniformBuffers       []vk.Buffer
 	uniformBuffersMemory []vkr.Memory
 
 	descriptorSets []vk.DescriptorSet
 
+	deviceTexture
+}
+
+// deviceTexture is a texture uploaded for sampling
+type deviceTexture struct {
 	textureBuffer      vk.Buffer
 	textureMemory      vkr.Memory
 	textureImage       vk.Image
 	textureImageMemory vkr.Memory
 	textureImageView   vk.ImageView
+	textureFormat      vk.Format
+	textureLevels      uint32
+}
+
+func (t *deviceTexture) destroy(device vk.Device) {
+	t.textureMemory.Release()
+	vk.DestroyBuffer(device, t.textureBuffer, nil)
+	t.textureImageMemory.Release()
+	vk.DestroyImageView(device, t.textureImageView, nil)
+	vk.DestroyImage(device, t.textureImage, nil)
+}
+
+// size is the device memory the texture takes
+func (t *deviceTexture) size() uint {
+	return t.textureMemory.Len() + t.textureImageMemory.Len()
 }
 
 func (rs *resourceSet) Destroy() {
@@ -2005,11 +2526,17 @@ func (rs *resourceSet) Destroy() {
 	vk.DestroyBuffer(rs.device, rs.vertexBuffer, nil)
 	rs.vertexMemory.Release()
 
-	rs.textureMemory.Release()
-	vk.DestroyBuffer(rs.device, rs.textureBuffer, nil)
-	rs.textureImageMemory.Release()
-	vk.DestroyImageView(rs.device, rs.textureImageView, nil)
-	vk.DestroyImage(rs.device, rs.textureImage, nil)
+	// sets without levels of detail have no index buffer to destroy,
+	// a null buffer and unallocated memory are ignored
+	vk.DestroyBuffer(rs.device, rs.indexBuffer, nil)
+	rs.indexMemory.Release()
+
+	rs.deviceTexture.destroy(rs.device)
+}
+
+// lodRange is where the indices of a level of detail are in the index buffer
+type lodRange struct {
+	first, count uint32
 }
 
 // Destroyed checks if the resource is destroyed or not
@@ -2017,6 +2544,64 @@ func (rs *resourceSet) Destroyed() bool {
 	return rs.destroyed
 }
 
-type pushConstant struct {
-	Model glm.Mat4
+// closedChannel is the Ready channel of resources that are always ready
+var closedChannel = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// ID implements gfx.Resource
+func (rs *resourceSet) ID() string {
+	return rs.id
+}
+
+// Ready implements gfx.Resource, sets are ready once loaded
+func (rs *resourceSet) Ready() <-chan struct{} {
+	return closedChannel
+}
+
+// Sub implements gfx.Resource
+func (rs *resourceSet) Sub() []gfx.Resource {
+	return nil
+}
+
+// Size implements gfx.Sizer, it's the device memory taken
+func (rs *resourceSet) Size() int64 {
+	size := rs.vertexMemory.Len() + rs.indexMemory.Len() + rs.deviceTexture.size()
+	for _, mem := range rs.uniformBuffersMemory {
+		size += mem.Len()
+	}
+	return int64(size)
+}
+
+// Release implements gfx.Releasable, it stops the set from being
+// drawn and destroys it once the device is done with it
+func (rs *resourceSet) Release() {
+	v := rs.renderer
+	v.resourceLock.Lock()
+	// a reloaded set takes the place before the old one is released
+	if v.resources[rs.id] == rs {
+		delete(v.resources, rs.id)
+	}
+	v.resourceLock.Unlock()
+
+	v.waitIdle()
+	if len(rs.descriptorSets) > 0 {
+		vk.FreeDescriptorSets(rs.device, v.descriptorPool, uint32(len(rs.descriptorSets)), &rs.descriptorSets[0])
+	}
+	rs.Destroy()
 }
+
+const (
+	// maxCameras is how many cameras the uniform buffers have room for
+	maxCameras = 4
+
+	// minInstanceCapacity is how many instances fit into
+	// an instance buffer at least
+	minInstanceCapacity = 64
+
+	// uniformStride is the distance between the uniforms of cameras,
+	// the largest minUniformBufferOffsetAlignment Vulkan allows
+	uniformStride = 256
+)
@@ -0,0 +1,338 @@
+package gfx
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Sizer is implemented by resources that know how much memory they take,
+// the Cache counts them against its budget once they're ready.
+type Sizer interface {
+
+	// Size returns the bytes occupied by the resource.
+	Size() int64
+}
+
+// sizeOf returns the size of a ready resource, 0 if it doesn't tell
+func sizeOf(res Resource) int64 {
+	sizer, ok := res.(Sizer)
+	if !ok {
+		return 0
+	}
+	select {
+	case <-res.Ready():
+		return sizer.Size()
+	default:
+		return 0
+	}
+}
+
+// CacheStats describes the current state of a Cache
+// and counts what it has done so far.
+type CacheStats struct {
+	// Resources that are loaded, Unused of them have no handles
+	Resources, Unused int
+
+	// Bytes taken by the resources, UnusedBytes by the unused ones
+	Bytes, UnusedBytes int64
+
+	// Hits are acquisitions of resources that were already loaded,
+	// Loads the ones that went to the Loader
+	Hits, Loads uint64
+
+	// Evictions are unused resources released to stay within budget
+	Evictions uint64
+}
+
+// NewCache creates a Cache on top of the loader. Unused resources
+// are kept while all resources take less than budget bytes.
+func NewCache(loader Loader, budget int64) *Cache {
+	return &Cache{
+		loader:  loader,
+		budget:  budget,
+		entries: make(map[string]*cacheEntry),
+		unused:  list.New(),
+	}
+}
+
+// Cache shares resources by ID, loading each once. Users hold Handles,
+// when the last handle of a resource is released, the resource becomes
+// unused. Unused resources are released least recently used first when
+// resources take more than the budget. With a budget of 0, resources
+// are released as soon as the last handle is. It is safe to use concurrently.
+type Cache struct {
+	loader Loader
+
+	mutex   sync.Mutex
+	budget  int64
+	entries map[string]*cacheEntry
+
+	// unused entries, the front was used most recently
+	unused *list.List
+
+	hits, loads, evictions uint64
+}
+
+type cacheEntry struct {
+	id      string
+	current *cacheVersion
+	refs    int
+
+	// loaded is closed when the loader returns, err is set if it failed
+	loaded chan struct{}
+	err    error
+
+	element *list.Element
+}
+
+// cacheVersion is a resource of an entry along with the handles acquired
+// while it was current. Reloading makes a new version, the replaced one
+// is released when the last of its handles is.
+type cacheVersion struct {
+	resource Resource
+	refs     int
+}
+
+// Acquire returns a handle of the resource with the id, loading it
+// if needed. Concurrent acquisitions of a resource load it once.
+func (c *Cache) Acquire(id string) (*Handle, error) {
+	c.mutex.Lock()
+	if e, ok := c.entries[id]; ok {
+		c.ref(e)
+		c.hits++
+		c.mutex.Unlock()
+
+		<-e.loaded
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if e.err != nil {
+			e.refs--
+			return nil, e.err
+		}
+		return c.handle(e), nil
+	}
+
+	e := &cacheEntry{
+		id:     id,
+		refs:   1,
+		loaded: make(chan struct{}),
+	}
+	c.entries[id] = e
+	c.loads++
+	c.mutex.Unlock()
+
+	res, err := c.loader.Load(id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e.err = err
+	if err != nil {
+		// failures are not kept, the next acquisition tries again
+		delete(c.entries, id)
+		close(e.loaded)
+		return nil, err
+	}
+	e.current = &cacheVersion{resource: res}
+	close(e.loaded)
+	return c.handle(e), nil
+}
+
+// handle makes a handle of the current version of a loaded entry,
+// the reference of the entry is taken by the caller
+func (c *Cache) handle(e *cacheEntry) *Handle {
+	e.current.refs++
+	return &Handle{cache: c, entry: e, version: e.current}
+}
+
+// ref takes another reference of the entry, taking it out of the unused
+func (c *Cache) ref(e *cacheEntry) {
+	if e.element != nil {
+		c.unused.Remove(e.element)
+		e.element = nil
+	}
+	e.refs++
+}
+
+// drop lets go of a handle's reference, the last one of a replaced
+// version releases it and the last one of the entry makes it unused
+func (c *Cache) drop(e *cacheEntry, version *cacheVersion) {
+	c.mutex.Lock()
+	var evicted []Resource
+	version.refs--
+	if version != e.current && version.refs == 0 {
+		evicted = append(evicted, version.resource)
+	}
+	e.refs--
+	if e.refs == 0 {
+		e.element = c.unused.PushFront(e)
+		evicted = append(evicted, c.evict()...)
+	}
+	c.mutex.Unlock()
+
+	release(evicted)
+}
+
+// evict takes unused entries out until resources fit into the budget,
+// the resources are released by the caller, outside of the lock
+func (c *Cache) evict() []Resource {
+	var total int64
+	for _, e := range c.entries {
+		if e.current != nil {
+			total += sizeOf(e.current.resource)
+		}
+	}
+
+	var evicted []Resource
+	for total > c.budget || (c.budget <= 0 && c.unused.Len() > 0) {
+		back := c.unused.Back()
+		if back == nil {
+			break
+		}
+		e := c.unused.Remove(back).(*cacheEntry)
+		e.element = nil
+		delete(c.entries, e.id)
+		total -= sizeOf(e.current.resource)
+		evicted = append(evicted, e.current.resource)
+		c.evictions++
+	}
+	return evicted
+}
+
+func release(resources []Resource) {
+	for _, res := range resources {
+		res.Release()
+	}
+}
+
+// Reload loads the resource with the id again, its handles refer to the
+// new resource afterwards. The old one is released once the handles
+// acquired before the reload are, as their users may still hold it.
+// If loading fails, the old one is kept. Resources that aren't loaded
+// are left alone.
+func (c *Cache) Reload(id string) error {
+	c.mutex.Lock()
+	e, ok := c.entries[id]
+	c.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	<-e.loaded
+	if e.err != nil {
+		return nil
+	}
+
+	res, err := c.loader.Load(id)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	if c.entries[id] != e {
+		// evicted while loading
+		c.mutex.Unlock()
+		res.Release()
+		return nil
+	}
+	previous := e.current
+	e.current = &cacheVersion{resource: res}
+	unused := previous.refs == 0
+	c.mutex.Unlock()
+
+	if unused {
+		previous.resource.Release()
+	}
+	return nil
+}
+
+// SetBudget changes the budget, evicting what doesn't fit anymore
+func (c *Cache) SetBudget(budget int64) {
+	c.mutex.Lock()
+	c.budget = budget
+	evicted := c.evict()
+	c.mutex.Unlock()
+
+	release(evicted)
+}
+
+// Trim evicts unused resources that don't fit into the budget. Sizes of
+// resources become known when they get ready, which may be well after
+// their handles are released.
+func (c *Cache) Trim() {
+	c.mutex.Lock()
+	evicted := c.evict()
+	c.mutex.Unlock()
+
+	release(evicted)
+}
+
+// Purge releases all unused resources, regardless of the budget
+func (c *Cache) Purge() {
+	c.mutex.Lock()
+	var purged []Resource
+	for c.unused.Len() > 0 {
+		e := c.unused.Remove(c.unused.Back()).(*cacheEntry)
+		e.element = nil
+		delete(c.entries, e.id)
+		purged = append(purged, e.current.resource)
+	}
+	c.mutex.Unlock()
+
+	release(purged)
+}
+
+// Stats returns the current state of the cache
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := CacheStats{
+		Unused:    c.unused.Len(),
+		Hits:      c.hits,
+		Loads:     c.loads,
+		Evictions: c.evictions,
+	}
+	for _, e := range c.entries {
+		if e.current == nil {
+			continue
+		}
+		size := sizeOf(e.current.resource)
+		stats.Resources++
+		stats.Bytes += size
+		if e.refs == 0 {
+			stats.UnusedBytes += size
+		}
+	}
+	return stats
+}
+
+// Handle is a reference to a resource of a Cache,
+// the resource must not be used after the handle is released.
+type Handle struct {
+	cache    *Cache
+	entry    *cacheEntry
+	version  *cacheVersion
+	released int32
+}
+
+// ID returns the id of the resource
+func (h *Handle) ID() string {
+	return h.entry.id
+}
+
+// Resource returns the referenced resource,
+// which changes when the resource is reloaded
+func (h *Handle) Resource() Resource {
+	h.cache.mutex.Lock()
+	defer h.cache.mutex.Unlock()
+	return h.entry.current.resource
+}
+
+// Release implements Releasable, releasing
+// the handle more than once does nothing.
+func (h *Handle) Release() {
+	if !atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+		return
+	}
+	h.cache.drop(h.entry, h.version)
+}
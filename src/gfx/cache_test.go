@@ -0,0 +1,269 @@
+package gfx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/devblok/koru/src/gfx"
+)
+
+// fakeResource stands in for a GPU resource of a fixed size
+type fakeResource struct {
+	id       string
+	size     int64
+	ready    chan struct{}
+	released int
+}
+
+func (f *fakeResource) ID() string             { return f.id }
+func (f *fakeResource) Ready() <-chan struct{} { return f.ready }
+func (f *fakeResource) Sub() []gfx.Resource    { return nil }
+func (f *fakeResource) Size() int64            { return f.size }
+func (f *fakeResource) Release()               { f.released++ }
+
+// fakeBackend loads fakeResources of the sizes it's given
+type fakeBackend struct {
+	mutex     sync.Mutex
+	sizes     map[string]int64
+	loads     map[string]int
+	resources map[string]*fakeResource
+	block     chan struct{}
+}
+
+func newFakeBackend(sizes map[string]int64) *fakeBackend {
+	return &fakeBackend{
+		sizes:     sizes,
+		loads:     make(map[string]int),
+		resources: make(map[string]*fakeResource),
+	}
+}
+
+func (f *fakeBackend) Load(id string) (gfx.Resource, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	size, ok := f.sizes[id]
+	if !ok {
+		return nil, gfx.ErrNotFound
+	}
+	f.loads[id]++
+	res := &fakeResource{id: id, size: size, ready: make(chan struct{})}
+	close(res.ready)
+	f.resources[id] = res
+	return res, nil
+}
+
+func acquire(t *testing.T, c *gfx.Cache, id string) *gfx.Handle {
+	h, err := c.Acquire(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestCacheSharing(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{"a": 10})
+	cache := gfx.NewCache(backend, 0)
+
+	first := acquire(t, cache, "a")
+	second := acquire(t, cache, "a")
+	if first.Resource() != second.Resource() || backend.loads["a"] != 1 {
+		t.Fatalf("resource loaded %d times", backend.loads["a"])
+	}
+
+	first.Release()
+	first.Release()
+	if backend.resources["a"].released != 0 {
+		t.Fatal("released while a handle is left")
+	}
+	second.Release()
+	if backend.resources["a"].released != 1 {
+		t.Fatal("not released with the last handle")
+	}
+
+	// loads again after it's gone
+	acquire(t, cache, "a").Release()
+	if backend.loads["a"] != 2 {
+		t.Fatalf("expected another load, got: %d", backend.loads["a"])
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Loads != 2 || stats.Evictions != 2 || stats.Resources != 0 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+}
+
+func TestCacheBudget(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{"a": 10, "b": 20, "c": 30, "d": 50})
+	cache := gfx.NewCache(backend, 80)
+
+	a, b, c := acquire(t, cache, "a"), acquire(t, cache, "b"), acquire(t, cache, "c")
+	a.Release()
+	c.Release()
+	b.Release()
+
+	// unused, but all of them fit
+	stats := cache.Stats()
+	if stats.Resources != 3 || stats.Unused != 3 || stats.Bytes != 60 || stats.UnusedBytes != 60 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+
+	// a hit moves c up, so a and b are the least recently used
+	acquire(t, cache, "c").Release()
+	d := acquire(t, cache, "d")
+	cache.Trim()
+	if backend.resources["a"].released != 1 || backend.resources["b"].released != 1 || backend.resources["c"].released != 0 {
+		t.Fatal("evicted in the wrong order")
+	}
+
+	// resources in use are never evicted, even over the budget
+	cache.SetBudget(10)
+	if backend.resources["c"].released != 1 || backend.resources["d"].released != 0 {
+		t.Fatal("budget change evicted wrong")
+	}
+	stats = cache.Stats()
+	if stats.Resources != 1 || stats.Unused != 0 || stats.Bytes != 50 || stats.Evictions != 3 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+
+	cache.SetBudget(100)
+	d.Release()
+	if backend.resources["d"].released != 0 {
+		t.Fatal("evicted while within the budget")
+	}
+	cache.Purge()
+	if backend.resources["d"].released != 1 || cache.Stats().Resources != 0 {
+		t.Fatal("purge kept unused resources")
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{})
+	cache := gfx.NewCache(backend, 0)
+
+	if _, err := cache.Acquire("missing"); err != gfx.ErrNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+
+	// failures are not remembered
+	backend.sizes["missing"] = 1
+	h, err := cache.Acquire("missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Release()
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{"a": 1})
+	backend.block = make(chan struct{})
+	cache := gfx.NewCache(backend, 0)
+
+	var (
+		wg      sync.WaitGroup
+		handles = make([]*gfx.Handle, 8)
+		errs    = make([]error, 8)
+	)
+	for idx := range handles {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			handles[idx], errs[idx] = cache.Acquire("a")
+		}(idx)
+	}
+	close(backend.block)
+	wg.Wait()
+
+	for idx, h := range handles {
+		if errs[idx] != nil {
+			t.Fatal(errs[idx])
+		}
+		if h.Resource() != handles[0].Resource() {
+			t.Fatal("handles refer to different resources")
+		}
+	}
+	if backend.loads["a"] != 1 {
+		t.Fatalf("resource loaded %d times", backend.loads["a"])
+	}
+	for _, h := range handles {
+		h.Release()
+	}
+	if backend.resources["a"].released != 1 {
+		t.Fatal("not released once")
+	}
+
+}
+
+func TestCacheReload(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{"a": 10})
+	cache := gfx.NewCache(backend, 0)
+
+	h := acquire(t, cache, "a")
+	first := h.Resource()
+	if err := cache.Reload("a"); err != nil {
+		t.Fatal(err)
+	}
+	if h.Resource() == first {
+		t.Fatal("handle still refers to the old resource")
+	}
+	if first.(*fakeResource).released != 0 {
+		t.Fatal("old resource was released while its handle is held")
+	}
+
+	// a failed reload keeps what was there
+	second := h.Resource()
+	delete(backend.sizes, "a")
+	if err := cache.Reload("a"); err != gfx.ErrNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+	if h.Resource() != second || second.(*fakeResource).released != 0 {
+		t.Fatal("failed reload replaced the resource")
+	}
+
+	if err := cache.Reload("b"); err != nil {
+		t.Fatalf("resources not loaded are left alone, got: %v", err)
+	}
+	h.Release()
+	if first.(*fakeResource).released != 1 || second.(*fakeResource).released != 1 || backend.loads["a"] != 2 {
+		t.Fatal("reloaded resource was not released")
+	}
+}
+
+func TestCacheReloadHeld(t *testing.T) {
+	backend := newFakeBackend(map[string]int64{"a": 10})
+	cache := gfx.NewCache(backend, 100)
+
+	// before is held across the reload, after comes with the new resource
+	before := acquire(t, cache, "a")
+	first := before.Resource().(*fakeResource)
+	if err := cache.Reload("a"); err != nil {
+		t.Fatal(err)
+	}
+	after := acquire(t, cache, "a")
+	second := after.Resource().(*fakeResource)
+	if first == second || before.Resource() != second {
+		t.Fatal("handles don't refer to the reloaded resource")
+	}
+
+	after.Release()
+	if first.released != 0 || second.released != 0 {
+		t.Fatal("released while a handle from before the reload is held")
+	}
+	before.Release()
+	if first.released != 1 || second.released != 0 {
+		t.Fatalf("expected only the old resource released, got: %d, %d", first.released, second.released)
+	}
+
+	// with no handles left, a reload releases the old resource right away
+	if err := cache.Reload("a"); err != nil {
+		t.Fatal(err)
+	}
+	if second.released != 1 {
+		t.Fatal("unused resource was not released by the reload")
+	}
+	if stats := cache.Stats(); stats.Resources != 1 || stats.Unused != 1 || stats.Bytes != 10 {
+		t.Fatalf("bad stats after the reloads: %+v", stats)
+	}
+}
@@ -0,0 +1,372 @@
+package gfx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // texture decoding
+	_ "image/png"  // texture decoding
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/devblok/koru/src/model"
+	"github.com/devblok/koru/src/model/meshopt"
+	"github.com/devblok/koru/src/texture"
+	"github.com/devblok/koru/src/utility/kar"
+)
+
+// package errors
+var (
+	ErrNotFound       = errors.New("resource not found in the search path")
+	ErrUnknownContent = errors.New("unknown resource content type")
+)
+
+// Source is a place on the search path that resources are read from.
+// Names are slash separated and relative to the root of the source.
+type Source interface {
+
+	// ReadFile returns the contents of the named file,
+	// an error satisfying os.IsNotExist if there is none.
+	ReadFile(name string) ([]byte, error)
+}
+
+// Dir returns a Source reading files under the directory.
+func Dir(dir string) Source {
+	return dirSource(dir)
+}
+
+type dirSource string
+
+func (d dirSource) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// Archive returns a Source reading files from the kar archive.
+func Archive(a *kar.Archive) Source {
+	return archiveSource{archive: a}
+}
+
+type archiveSource struct {
+	archive *kar.Archive
+}
+
+func (a archiveSource) ReadFile(name string) ([]byte, error) {
+	return a.archive.ReadAll(name)
+}
+
+// ContentType is the kind of data a resource holds,
+// it chooses the decoder the resource goes through.
+type ContentType int
+
+// Content types known to the SearchLoader
+const (
+	ContentUnknown ContentType = iota
+	ContentMesh
+	ContentTexture
+)
+
+// String implements fmt.Stringer
+func (c ContentType) String() string {
+	switch c {
+	case ContentMesh:
+		return "mesh"
+	case ContentTexture:
+		return "texture"
+	default:
+		return "unknown"
+	}
+}
+
+var contentExtensions = map[string]ContentType{
+	".dae":  ContentMesh,
+	".obj":  ContentMesh,
+	".gltf": ContentMesh,
+	".glb":  ContentMesh,
+	".png":  ContentTexture,
+	".jpg":  ContentTexture,
+	".jpeg": ContentTexture,
+	".dds":  ContentTexture,
+	".hdr":  ContentTexture,
+	".exr":  ContentTexture,
+}
+
+// DetectContentType finds out what the resource holds by the extension
+// of its id. Unknown extensions fall back to looking at the data.
+func DetectContentType(id string, data []byte) ContentType {
+	if ct, ok := contentExtensions[strings.ToLower(path.Ext(id))]; ok {
+		return ct
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("DDS ")):
+		return ContentTexture
+	case bytes.HasPrefix(data, []byte("glTF")):
+		return ContentMesh
+	case bytes.Contains(data[:minInt(len(data), 512)], []byte("<COLLADA")):
+		return ContentMesh
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return ContentTexture
+	}
+	return ContentUnknown
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// NewSearchLoader creates a loader looking for resources
+// in the sources, the first source having it wins.
+func NewSearchLoader(sources ...Source) *SearchLoader {
+	return &SearchLoader{
+		sources:              sources,
+		TextureConfiguration: texture.DefaultConfiguration,
+		LODConfiguration:     meshopt.DefaultLODConfiguration,
+	}
+}
+
+// OpenSearchPath creates a loader from paths of directories and
+// kar archives. Without any paths the working directory is searched.
+// Archives stay open until Close.
+func OpenSearchPath(paths ...string) (*SearchLoader, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var (
+		sources []Source
+		files   []io.Closer
+	)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		if info.IsDir() {
+			sources = append(sources, Dir(p))
+			continue
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		files = append(files, f)
+		ar, err := kar.Open(f)
+		if err != nil {
+			closeAll(files)
+			return nil, fmt.Errorf("%s: %s", p, err.Error())
+		}
+		sources = append(sources, Archive(ar))
+	}
+	loader := NewSearchLoader(sources...)
+	loader.closers = files
+	return loader, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// SearchLoader implements Loader, resolving resource ids against a
+// search path of Sources. Ids are slash separated paths, absolute
+// ones are read from the file system as they are. Files are read
+// when loading, decoding happens in the background.
+type SearchLoader struct {
+	sources []Source
+	closers []io.Closer
+
+	// ImportConfiguration is used by the mesh importers
+	ImportConfiguration model.ImportConfiguration
+
+	// TextureConfiguration is used to make mip chains of
+	// images, DDS textures are used as they were made
+	TextureConfiguration texture.Configuration
+
+	// LODConfiguration is used to make levels of detail of
+	// meshes, none are made if it has no Levels
+	LODConfiguration meshopt.LODConfiguration
+}
+
+// Close closes the archives opened by OpenSearchPath
+func (l *SearchLoader) Close() error {
+	closeAll(l.closers)
+	l.closers = nil
+	return nil
+}
+
+// ReadFile returns the contents of the first file with the
+// name on the search path, ErrNotFound if none of them have it.
+func (l *SearchLoader) ReadFile(name string) ([]byte, error) {
+	if filepath.IsAbs(name) {
+		data, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return data, err
+	}
+
+	name = path.Clean(filepath.ToSlash(name))
+	for _, s := range l.sources {
+		data, err := s.ReadFile(name)
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Load implements Loader. Returns either a *Mesh or a *Texture,
+// that are ready once decoded.
+func (l *SearchLoader) Load(id string) (Resource, error) {
+	data, err := l.ReadFile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch DetectContentType(id, data) {
+	case ContentMesh:
+		mesh := &Mesh{id: id, ready: make(chan struct{})}
+		go func() {
+			defer close(mesh.ready)
+			mesh.object, mesh.files, mesh.err = l.decodeMesh(id, data)
+			if mesh.err == nil {
+				var textureFiles []string
+				mesh.textures, textureFiles = l.loadMeshTextures(id, mesh.object)
+				mesh.files = append(mesh.files, textureFiles...)
+				meshopt.ApplyLODs(mesh.object, l.LODConfiguration)
+			}
+		}()
+		return mesh, nil
+	case ContentTexture:
+		tex := &Texture{id: id, ready: make(chan struct{})}
+		go func() {
+			defer close(tex.ready)
+			tex.texture, tex.err = l.decodeTexture(id, data)
+		}()
+		return tex, nil
+	default:
+		return nil, fmt.Errorf("%s: %s", id, ErrUnknownContent.Error())
+	}
+}
+
+// decodeMesh chooses the importer by the extension of the id or
+// the data itself, files the mesh references are relative to it.
+// Returns the ids of the files the importer has read
+func (l *SearchLoader) decodeMesh(id string, data []byte) (model.Object, []string, error) {
+	var files []string
+	load := func(name string) ([]byte, error) {
+		fileID := relativeID(id, name)
+		files = append(files, fileID)
+		return l.ReadFile(fileID)
+	}
+
+	ext := strings.ToLower(path.Ext(id))
+	switch {
+	case ext == ".obj":
+		obj, err := model.ImportOBJObjectWithConfiguration(data, load, nil, l.ImportConfiguration)
+		if err != nil {
+			return nil, files, fmt.Errorf("obj import failed: %s", err.Error())
+		}
+		return obj, files, nil
+	case ext == ".gltf" || ext == ".glb" || bytes.HasPrefix(data, []byte("glTF")):
+		obj, err := model.ImportGLTFObjectWithConfiguration(data, load, nil, l.ImportConfiguration)
+		if err != nil {
+			return nil, files, fmt.Errorf("gltf import failed: %s", err.Error())
+		}
+		return obj, files, nil
+	default:
+		obj, err := model.ImportColladaObjectWithConfiguration(data, nil, l.ImportConfiguration)
+		if err != nil {
+			return nil, files, fmt.Errorf("collada import failed: %s", err.Error())
+		}
+		return obj, files, nil
+	}
+}
+
+// loadMeshTextures starts loading the color textures of the materials,
+// a texture used by several materials is loaded once. Returns the ids
+// of texture files too
+func (l *SearchLoader) loadMeshTextures(id string, obj model.Object) ([]*Texture, []string) {
+	var (
+		textures []*Texture
+		files    []string
+		byID     = make(map[string]*Texture)
+	)
+	for idx, mat := range obj.Materials() {
+		var tex *Texture
+		switch {
+		case mat.DiffuseMap.Image != nil:
+			tex = &Texture{id: fmt.Sprintf("%s#%d", id, idx), ready: make(chan struct{})}
+			go func(img image.Image) {
+				defer close(tex.ready)
+				tex.texture, tex.err = texture.FromImage(img, l.TextureConfiguration)
+			}(mat.DiffuseMap.Image)
+		case mat.DiffuseMap.Path != "":
+			texID := relativeID(id, mat.DiffuseMap.Path)
+			if byID[texID] != nil {
+				continue
+			}
+			res, err := l.Load(texID)
+			if err == nil {
+				var ok bool
+				if tex, ok = res.(*Texture); !ok {
+					res.Release()
+					err = fmt.Errorf("%s is a %s", texID, ContentMesh)
+				}
+			}
+			if err != nil {
+				// failed textures are still resources, so the
+				// failure is found where the texture is used
+				tex = &Texture{id: texID, ready: make(chan struct{}), err: err}
+				close(tex.ready)
+			}
+			byID[texID] = tex
+			files = append(files, texID)
+		default:
+			continue
+		}
+		textures = append(textures, tex)
+	}
+	return textures, files
+}
+
+// decodeTexture uses DDS textures as they are,
+// other images get a mip chain made
+func (l *SearchLoader) decodeTexture(id string, data []byte) (*texture.Texture, error) {
+	if bytes.HasPrefix(data, []byte("DDS ")) {
+		tex, err := texture.ReadDDS(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("texture decode failed: %s", err.Error())
+		}
+		return tex, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("texture decode failed: %s", err.Error())
+	}
+	return texture.FromImage(img, l.TextureConfiguration)
+}
+
+// relativeID resolves name relative to the directory of id,
+// absolute names stay as they are
+func relativeID(id, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return path.Join(path.Dir(filepath.ToSlash(id)), filepath.ToSlash(name))
+}
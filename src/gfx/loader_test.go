@@ -0,0 +1,227 @@
+package gfx_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devblok/koru/src/gfx"
+	"github.com/devblok/koru/src/texture"
+	"github.com/devblok/koru/src/utility/kar"
+)
+
+var Quad_obj = `
+mtllib quad.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+usemtl Painted
+f 1/1 2/2 3/3 4/4
+usemtl Plain
+f 1/1 3/3 4/4
+`
+
+var Quad_mtl = `
+newmtl Painted
+Kd 1 1 1
+map_Kd textures/paint.png
+
+newmtl Plain
+Kd 0.5 0.5 0.5
+`
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for idx := 0; idx < len(img.Pix); idx += 4 {
+		copy(img.Pix[idx:], []uint8{200, 50, 20, 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func buildArchive(t *testing.T, files map[string][]byte) *kar.Archive {
+	builder, err := kar.NewBuilder(kar.Header{Author: "test", Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := builder.Add(name, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := builder.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := kar.Open(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ar
+}
+
+func wait(t *testing.T, res gfx.Resource) {
+	select {
+	case <-res.Ready():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s never got ready", res.ID())
+	}
+}
+
+func TestSearchLoaderMesh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "koruLoader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the mesh is in the directory, the texture it uses in the archive
+	writeFiles(t, dir, map[string][]byte{
+		"models/quad.obj": []byte(Quad_obj),
+		"models/quad.mtl": []byte(Quad_mtl),
+	})
+	ar := buildArchive(t, map[string][]byte{
+		"models/textures/paint.png": pngBytes(t, 8, 4),
+	})
+	loader := gfx.NewSearchLoader(gfx.Dir(dir), gfx.Archive(ar))
+
+	res, err := loader.Load("models/quad.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh, ok := res.(*gfx.Mesh)
+	if !ok {
+		t.Fatalf("expected a mesh, got: %T", res)
+	}
+	wait(t, mesh)
+	if mesh.Err() != nil {
+		t.Fatal(mesh.Err())
+	}
+	if len(mesh.Object().Vertices()) != 9 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(mesh.Object().Vertices()))
+	}
+	if lods := mesh.Object().LODs(); len(lods) == 0 || len(lods[0].Indices) != 9 {
+		t.Fatalf("levels of detail were not made: %+v", lods)
+	}
+
+	files := mesh.Files()
+	if len(files) != 2 || files[0] != "models/quad.mtl" || files[1] != "models/textures/paint.png" {
+		t.Fatalf("bad files of the mesh: %v", files)
+	}
+
+	subs := mesh.Sub()
+	if len(subs) != 1 || subs[0].ID() != "models/textures/paint.png" {
+		t.Fatalf("expected the paint texture, got: %v", subs)
+	}
+	wait(t, subs[0])
+	tex := subs[0].(*gfx.Texture)
+	if tex.Err() != nil {
+		t.Fatal(tex.Err())
+	}
+	if tex.Texture().Width != 8 || tex.Texture().Height != 4 || len(tex.Texture().Levels) != 4 {
+		t.Fatalf("bad texture: %dx%d, %d levels", tex.Texture().Width, tex.Texture().Height, len(tex.Texture().Levels))
+	}
+
+	mesh.Release()
+	if mesh.Object() != nil || tex.Texture() != nil {
+		t.Fatal("release kept the decoded data")
+	}
+}
+
+func TestSearchLoaderOrder(t *testing.T) {
+	first := buildArchive(t, map[string][]byte{"tex.png": pngBytes(t, 2, 2)})
+	second := buildArchive(t, map[string][]byte{
+		"tex.png":   pngBytes(t, 4, 4),
+		"other.png": pngBytes(t, 4, 4),
+	})
+	loader := gfx.NewSearchLoader(gfx.Archive(first), gfx.Archive(second))
+
+	for id, width := range map[string]int{"tex.png": 2, "./other.png": 4} {
+		res, err := loader.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait(t, res)
+		if w := res.(*gfx.Texture).Texture().Width; w != width {
+			t.Fatalf("%s came from the wrong source, width %d", id, w)
+		}
+	}
+
+	if _, err := loader.Load("missing.png"); err != gfx.ErrNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+}
+
+func TestSearchLoaderContent(t *testing.T) {
+	tex, err := texture.FromImage(image.NewNRGBA(image.Rect(0, 0, 4, 4)), texture.Configuration{Format: texture.FormatBC1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dds bytes.Buffer
+	if err := texture.WriteDDS(&dds, tex); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := gfx.NewSearchLoader(gfx.Archive(buildArchive(t, map[string][]byte{
+		"noext":      pngBytes(t, 1, 1),
+		"packed":     dds.Bytes(),
+		"broken.png": []byte("not a png"),
+		"notes.txt":  []byte("hello"),
+	})))
+
+	for id, format := range map[string]texture.Format{"noext": texture.FormatRGBA8, "packed": texture.FormatBC1} {
+		res, err := loader.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait(t, res)
+		if got := res.(*gfx.Texture).Texture().Format; got != format {
+			t.Fatalf("%s decoded as %s", id, got)
+		}
+	}
+
+	res, err := loader.Load("broken.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, res)
+	if res.(*gfx.Texture).Err() == nil {
+		t.Fatal("expected a decoding error")
+	}
+
+	if _, err := loader.Load("notes.txt"); err == nil {
+		t.Fatal("expected unknown content to fail")
+	}
+
+	if ct := gfx.DetectContentType("model.DAE", nil); ct != gfx.ContentMesh {
+		t.Fatalf("extension should be case insensitive, got: %s", ct)
+	}
+	if ct := gfx.DetectContentType("scene", []byte(`<?xml version="1.0"?><COLLADA>`)); ct != gfx.ContentMesh {
+		t.Fatalf("collada not detected, got: %s", ct)
+	}
+}
@@ -0,0 +1,134 @@
+package gfx
+
+import (
+	"unsafe"
+
+	"github.com/devblok/koru/src/model"
+	"github.com/devblok/koru/src/texture"
+)
+
+// Mesh is a decoded model, its color textures are subresources.
+// Nothing but ID and Ready should be used before it's ready.
+type Mesh struct {
+	id    string
+	ready chan struct{}
+
+	err      error
+	object   model.Object
+	textures []*Texture
+	files    []string
+}
+
+// ID implements Resource
+func (m *Mesh) ID() string {
+	return m.id
+}
+
+// Ready implements Resource, closed once the model is decoded.
+// Textures may still be decoding, each is ready on its own.
+func (m *Mesh) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Sub implements Resource, returns the color textures
+// in the order of materials that use them.
+func (m *Mesh) Sub() []Resource {
+	subs := make([]Resource, 0, len(m.textures))
+	for _, tex := range m.textures {
+		subs = append(subs, tex)
+	}
+	return subs
+}
+
+// Textures returns the color textures like Sub
+func (m *Mesh) Textures() []*Texture {
+	return m.textures
+}
+
+// Files returns the ids of the other files the mesh was made of,
+// like material libraries, buffers and textures
+func (m *Mesh) Files() []string {
+	return m.files
+}
+
+// Err returns the error decoding failed with
+func (m *Mesh) Err() error {
+	return m.err
+}
+
+// Object returns the decoded model, nil if decoding failed
+func (m *Mesh) Object() model.Object {
+	return m.object
+}
+
+// Size implements Sizer, textures are counted once they're ready
+func (m *Mesh) Size() int64 {
+	var size int64
+	if m.object != nil {
+		size += int64(len(m.object.Vertices())) * int64(unsafe.Sizeof(model.Vertex{}))
+	}
+	for _, tex := range m.textures {
+		size += sizeOf(tex)
+	}
+	return size
+}
+
+// Release implements Releasable, waits for decoding
+// to finish and releases the textures too.
+func (m *Mesh) Release() {
+	<-m.ready
+	for _, tex := range m.textures {
+		tex.Release()
+	}
+	m.object = nil
+	m.textures = nil
+}
+
+// Texture is a decoded image with its mip chain.
+// Nothing but ID and Ready should be used before it's ready.
+type Texture struct {
+	id    string
+	ready chan struct{}
+
+	err     error
+	texture *texture.Texture
+}
+
+// ID implements Resource
+func (t *Texture) ID() string {
+	return t.id
+}
+
+// Ready implements Resource, closed once the texture is decoded
+func (t *Texture) Ready() <-chan struct{} {
+	return t.ready
+}
+
+// Sub implements Resource, textures have no subresources.
+func (*Texture) Sub() []Resource {
+	return nil
+}
+
+// Err returns the error loading or decoding failed with
+func (t *Texture) Err() error {
+	return t.err
+}
+
+// Texture returns the decoded texture, nil if decoding failed
+func (t *Texture) Texture() *texture.Texture {
+	return t.texture
+}
+
+// Size implements Sizer
+func (t *Texture) Size() int64 {
+	if t.texture == nil {
+		return 0
+	}
+	return int64(t.texture.Size())
+}
+
+// Release implements Releasable, waits for decoding to finish
+func (t *Texture) Release() {
+	<-t.ready
+	t.texture = nil
+}
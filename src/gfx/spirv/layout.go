@@ -0,0 +1,111 @@
+package spirv
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Layout is what the stages of a program take together, the
+// pipeline layout and the vertex input of a pipeline are made from it
+type Layout struct {
+	Stages Stage
+
+	// Sets are the bindings of every set, ordered by binding.
+	// Stages of bindings are the stages that use them.
+	Sets map[uint32][]Binding
+
+	// PushConstants is the range over the push constants of all
+	// stages, Size is 0 if none has them
+	PushConstants PushConstantRange
+
+	// Inputs are the vertex attributes of the vertex stage
+	Inputs []Variable
+}
+
+// Shader is a stage of a program, the entry point of the module
+type Shader struct {
+	Module     *Module
+	EntryPoint string
+}
+
+// NewLayout merges what the shaders take. Stages must not appear twice
+// and bindings in more than one stage must be declared the same.
+func NewLayout(shaders ...Shader) (*Layout, error) {
+	layout := &Layout{Sets: make(map[uint32][]Binding)}
+	bindings := make(map[[2]uint32]Binding)
+
+	for _, shader := range shaders {
+		m := shader.Module
+		ep, ok := m.EntryPoint(shader.EntryPoint)
+		if !ok {
+			return nil, fmt.Errorf("no entry point %s", shader.EntryPoint)
+		}
+		if layout.Stages&ep.Stage != 0 {
+			return nil, fmt.Errorf("more than one %s stage", ep.Stage)
+		}
+		layout.Stages |= ep.Stage
+		if ep.Stage == StageVertex {
+			layout.Inputs = ep.Inputs
+		}
+
+		for _, b := range m.Bindings {
+			key := [2]uint32{b.Set, b.Binding}
+			existing, ok := bindings[key]
+			if !ok {
+				b.Stages = ep.Stage
+				bindings[key] = b
+				continue
+			}
+			if existing.Type != b.Type || existing.Count != b.Count {
+				return nil, fmt.Errorf("set %d binding %d is %d %s in the %s stage and %d %s in the %s stage",
+					b.Set, b.Binding, existing.Count, existing.Type, existing.Stages, b.Count, b.Type, ep.Stage)
+			}
+			if b.Size > existing.Size {
+				existing.Size = b.Size
+			}
+			existing.Stages |= ep.Stage
+			bindings[key] = existing
+		}
+
+		for _, pc := range m.PushConstants {
+			pcs := &layout.PushConstants
+			if pcs.Size == 0 {
+				*pcs = PushConstantRange{Name: pc.Name, Offset: pc.Offset, Size: pc.Size}
+			} else {
+				end := pcs.Offset + pcs.Size
+				if pc.Offset+pc.Size > end {
+					end = pc.Offset + pc.Size
+				}
+				if pc.Offset < pcs.Offset {
+					pcs.Offset = pc.Offset
+				}
+				pcs.Size = end - pcs.Offset
+			}
+			pcs.Stages |= ep.Stage
+		}
+	}
+
+	for _, b := range bindings {
+		layout.Sets[b.Set] = append(layout.Sets[b.Set], b)
+	}
+	for _, set := range layout.Sets {
+		sort.Slice(set, func(i, j int) bool {
+			return set[i].Binding < set[j].Binding
+		})
+	}
+	return layout, nil
+}
+
+// Bindings returns the bindings of the set of the type, ordered by binding
+func (l *Layout) Bindings(set uint32, types ...DescriptorType) []Binding {
+	var found []Binding
+	for _, b := range l.Sets[set] {
+		for _, t := range types {
+			if b.Type == t {
+				found = append(found, b)
+				break
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,897 @@
+// Package spirv reads what shaders take from SPIR-V modules: their entry
+// points, descriptor bindings, push constants and vertex inputs, so
+// pipeline layouts can be made to fit them.
+package spirv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Magic is the first word of every SPIR-V module
+const Magic = 0x07230203
+
+// Stage is a set of shader stages, the bits are the same as
+// VkShaderStageFlagBits
+type Stage uint32
+
+// Stages of entry points
+const (
+	StageVertex                 Stage = 0x01
+	StageTessellationControl    Stage = 0x02
+	StageTessellationEvaluation Stage = 0x04
+	StageGeometry               Stage = 0x08
+	StageFragment               Stage = 0x10
+	StageCompute                Stage = 0x20
+)
+
+var stageNames = []struct {
+	stage Stage
+	name  string
+}{
+	{StageVertex, "vertex"},
+	{StageTessellationControl, "tessellation control"},
+	{StageTessellationEvaluation, "tessellation evaluation"},
+	{StageGeometry, "geometry"},
+	{StageFragment, "fragment"},
+	{StageCompute, "compute"},
+}
+
+func (s Stage) String() string {
+	var names []string
+	for _, stage := range stageNames {
+		if s&stage.stage != 0 {
+			names = append(names, stage.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// DescriptorType is the type of a descriptor binding, the
+// values are the same as VkDescriptorType
+type DescriptorType uint32
+
+// Types of descriptors
+const (
+	Sampler DescriptorType = iota
+	CombinedImageSampler
+	SampledImage
+	StorageImage
+	UniformTexelBuffer
+	StorageTexelBuffer
+	UniformBuffer
+	StorageBuffer
+	UniformBufferDynamic
+	StorageBufferDynamic
+	InputAttachment
+)
+
+var descriptorTypeNames = []string{
+	"sampler",
+	"combined image sampler",
+	"sampled image",
+	"storage image",
+	"uniform texel buffer",
+	"storage texel buffer",
+	"uniform buffer",
+	"storage buffer",
+	"dynamic uniform buffer",
+	"dynamic storage buffer",
+	"input attachment",
+}
+
+func (t DescriptorType) String() string {
+	if int(t) < len(descriptorTypeNames) {
+		return descriptorTypeNames[t]
+	}
+	return fmt.Sprintf("descriptor type %d", uint32(t))
+}
+
+// ScalarKind is the kind of the components of a type
+type ScalarKind int
+
+// Kinds of scalars
+const (
+	Float ScalarKind = iota
+	Int
+	Uint
+	Bool
+)
+
+// Type is the type of a vertex input, a scalar, a vector or a matrix
+type Type struct {
+	Kind ScalarKind
+
+	// Width is the size of a component in bits
+	Width uint32
+
+	// Components is the size of a vector, or of
+	// a column of a matrix, 1 for scalars
+	Components uint32
+
+	// Columns of a matrix, 1 for scalars and vectors
+	Columns uint32
+}
+
+// Variable is an input of a shader stage
+type Variable struct {
+	Name     string
+	Location uint32
+	Type     Type
+
+	// Count is the length of an array of the type, 1 if not an array
+	Count uint32
+}
+
+// Locations returns how many locations the variable takes, every
+// column of a matrix and every element of an array takes one
+func (v Variable) Locations() uint32 {
+	return v.Type.Columns * v.Count
+}
+
+// EntryPoint is a function a shader stage starts at
+type EntryPoint struct {
+	Name  string
+	Stage Stage
+
+	// Inputs are the inputs of the stage that are not built in,
+	// ordered by location. Of a vertex stage they're the vertex
+	// attributes.
+	Inputs []Variable
+}
+
+// Binding is a descriptor bound to a set
+type Binding struct {
+	Name    string
+	Set     uint32
+	Binding uint32
+	Type    DescriptorType
+
+	// Count is the number of descriptors in an array, 1 if it's not
+	// an array and 0 for arrays with no size set in the shader
+	Count uint32
+
+	// Size is the size of the block of buffers in bytes, not counting
+	// the elements of an array with no size at its end
+	Size uint32
+
+	// Stages that use the binding, all the stages of the module
+	Stages Stage
+}
+
+// PushConstantRange is where a block of push constants is
+type PushConstantRange struct {
+	Name   string
+	Offset uint32
+	Size   uint32
+
+	// Stages that use the range, all the stages of the module
+	Stages Stage
+}
+
+// SpecConstant is a specialization constant, a scalar
+// set when the pipeline is created
+type SpecConstant struct {
+	Name string
+	ID   uint32
+	Type Type
+}
+
+// Module is what was read from a SPIR-V module
+type Module struct {
+	EntryPoints []EntryPoint
+
+	// Bindings are ordered by set, then binding
+	Bindings      []Binding
+	PushConstants []PushConstantRange
+
+	// SpecConstants are ordered by id
+	SpecConstants []SpecConstant
+}
+
+// Stages returns the stages of the entry points of the module
+func (m *Module) Stages() Stage {
+	var stages Stage
+	for _, ep := range m.EntryPoints {
+		stages |= ep.Stage
+	}
+	return stages
+}
+
+// EntryPoint returns the entry point with the name
+func (m *Module) EntryPoint(name string) (EntryPoint, bool) {
+	for _, ep := range m.EntryPoints {
+		if ep.Name == name {
+			return ep, true
+		}
+	}
+	return EntryPoint{}, false
+}
+
+// SpecConstant returns the specialization constant with the id
+func (m *Module) SpecConstant(id uint32) (SpecConstant, bool) {
+	for _, c := range m.SpecConstants {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return SpecConstant{}, false
+}
+
+// Instructions, decorations and enumerants of the specification used here
+const (
+	opName           = 5
+	opEntryPoint     = 15
+	opTypeBool       = 20
+	opTypeInt        = 21
+	opTypeFloat      = 22
+	opTypeVector     = 23
+	opTypeMatrix     = 24
+	opTypeImage      = 25
+	opTypeSampler    = 26
+	opTypeSampledImg = 27
+	opTypeArray      = 28
+	opTypeRuntimeArr = 29
+	opTypeStruct     = 30
+	opTypePointer    = 32
+	opConstant       = 43
+	opSpecTrue       = 48
+	opSpecFalse      = 49
+	opSpecConstant   = 50
+	opVariable       = 59
+	opDecorate       = 71
+	opMemberDecorate = 72
+
+	decorationSpecID        = 1
+	decorationBlock         = 2
+	decorationBufferBlock   = 3
+	decorationArrayStride   = 6
+	decorationMatrixStride  = 7
+	decorationBuiltIn       = 11
+	decorationLocation      = 30
+	decorationBinding       = 33
+	decorationDescriptorSet = 34
+	decorationOffset        = 35
+
+	storageUniformConstant = 0
+	storageInput           = 1
+	storageUniform         = 2
+	storagePushConstant    = 9
+	storageStorageBuffer   = 12
+
+	dimBuffer      = 5
+	dimSubpassData = 6
+)
+
+var executionModels = map[uint32]Stage{
+	0: StageVertex,
+	1: StageTessellationControl,
+	2: StageTessellationEvaluation,
+	3: StageGeometry,
+	4: StageFragment,
+	5: StageCompute,
+}
+
+// spvType is a type declared in the module
+type spvType struct {
+	op uint32
+
+	// width of scalars, length of vectors, columns of matrices
+	width, signed, count uint32
+
+	// elem is the component, column, element or pointee type,
+	// lengthID the constant with the length of an array
+	elem, lengthID uint32
+	storage        uint32
+	members        []uint32
+
+	// of images
+	dim, sampled uint32
+}
+
+type decorations struct {
+	set, binding, location, arrayStride, specID uint32
+	hasSet, hasBinding, hasLocation, hasSpecID  bool
+	block, bufferBlock, builtIn                 bool
+	members                                     map[uint32]*memberDecorations
+}
+
+type memberDecorations struct {
+	offset, matrixStride uint32
+	hasOffset            bool
+}
+
+type variable struct {
+	id, typeID, storage uint32
+}
+
+type specConstant struct {
+	id, typeID uint32
+}
+
+type entryPoint struct {
+	name  string
+	stage Stage
+	iface []uint32
+}
+
+// parser keeps what the instructions declared, until they're all read
+type parser struct {
+	names       map[uint32]string
+	types       map[uint32]*spvType
+	constants   map[uint32]uint32
+	decorations map[uint32]*decorations
+	variables   []variable
+	specs       []specConstant
+	entryPoints []entryPoint
+}
+
+// Parse reads the module from its code, in either byte order
+func Parse(code []byte) (*Module, error) {
+	if len(code)%4 != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of 4", len(code))
+	}
+	if len(code) < 20 {
+		return nil, errors.New("too short for a SPIR-V header")
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case binary.LittleEndian.Uint32(code) == Magic:
+	case binary.BigEndian.Uint32(code) == Magic:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("bad magic number %#08x", binary.LittleEndian.Uint32(code))
+	}
+
+	words := make([]uint32, len(code)/4)
+	for idx := range words {
+		words[idx] = order.Uint32(code[idx*4:])
+	}
+
+	p := &parser{
+		names:       make(map[uint32]string),
+		types:       make(map[uint32]*spvType),
+		constants:   make(map[uint32]uint32),
+		decorations: make(map[uint32]*decorations),
+	}
+	for offset := 5; offset < len(words); {
+		count, opcode := words[offset]>>16, words[offset]&0xFFFF
+		if count == 0 || offset+int(count) > len(words) {
+			return nil, fmt.Errorf("instruction %d at word %d runs past the end", opcode, offset)
+		}
+		if err := p.instruction(opcode, words[offset+1:offset+int(count)]); err != nil {
+			return nil, fmt.Errorf("instruction %d at word %d: %s", opcode, offset, err.Error())
+		}
+		offset += int(count)
+	}
+	return p.module()
+}
+
+// literalString reads a nul terminated string from the words, returning
+// the words after it
+func literalString(words []uint32) (string, []uint32, error) {
+	var buf []byte
+	for idx, word := range words {
+		for shift := uint(0); shift < 32; shift += 8 {
+			c := byte(word >> shift)
+			if c == 0 {
+				return string(buf), words[idx+1:], nil
+			}
+			buf = append(buf, c)
+		}
+	}
+	return "", nil, errors.New("string is not terminated")
+}
+
+func (p *parser) decoration(id uint32) *decorations {
+	d, ok := p.decorations[id]
+	if !ok {
+		d = &decorations{members: make(map[uint32]*memberDecorations)}
+		p.decorations[id] = d
+	}
+	return d
+}
+
+func (p *parser) instruction(opcode uint32, ops []uint32) error {
+	need := func(n int) error {
+		if len(ops) < n {
+			return fmt.Errorf("%d operands, expected at least %d", len(ops), n)
+		}
+		return nil
+	}
+
+	switch opcode {
+	case opName:
+		if err := need(2); err != nil {
+			return err
+		}
+		name, _, err := literalString(ops[1:])
+		if err != nil {
+			return err
+		}
+		p.names[ops[0]] = name
+
+	case opEntryPoint:
+		if err := need(3); err != nil {
+			return err
+		}
+		stage, ok := executionModels[ops[0]]
+		if !ok {
+			return fmt.Errorf("unsupported execution model %d", ops[0])
+		}
+		name, rest, err := literalString(ops[2:])
+		if err != nil {
+			return err
+		}
+		p.entryPoints = append(p.entryPoints, entryPoint{name: name, stage: stage, iface: rest})
+
+	case opTypeBool, opTypeSampler:
+		if err := need(1); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode}
+
+	case opTypeInt:
+		if err := need(3); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, width: ops[1], signed: ops[2]}
+
+	case opTypeFloat:
+		if err := need(2); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, width: ops[1]}
+
+	case opTypeVector, opTypeMatrix:
+		if err := need(3); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, elem: ops[1], count: ops[2]}
+
+	case opTypeImage:
+		if err := need(8); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, elem: ops[1], dim: ops[2], sampled: ops[6]}
+
+	case opTypeSampledImg, opTypeRuntimeArr:
+		if err := need(2); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, elem: ops[1]}
+
+	case opTypeArray:
+		if err := need(3); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, elem: ops[1], lengthID: ops[2]}
+
+	case opTypeStruct:
+		if err := need(1); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, members: ops[1:]}
+
+	case opTypePointer:
+		if err := need(3); err != nil {
+			return err
+		}
+		p.types[ops[0]] = &spvType{op: opcode, storage: ops[1], elem: ops[2]}
+
+	case opConstant, opSpecConstant:
+		// only the low word is kept, it's enough for array lengths
+		if len(ops) >= 3 {
+			p.constants[ops[1]] = ops[2]
+		}
+		if opcode == opSpecConstant {
+			p.specs = append(p.specs, specConstant{typeID: ops[0], id: ops[1]})
+		}
+
+	case opSpecTrue, opSpecFalse:
+		if err := need(2); err != nil {
+			return err
+		}
+		p.specs = append(p.specs, specConstant{typeID: ops[0], id: ops[1]})
+
+	case opVariable:
+		if err := need(3); err != nil {
+			return err
+		}
+		p.variables = append(p.variables, variable{typeID: ops[0], id: ops[1], storage: ops[2]})
+
+	case opDecorate:
+		if err := need(2); err != nil {
+			return err
+		}
+		d := p.decoration(ops[0])
+		literal := func() (uint32, error) {
+			if len(ops) < 3 {
+				return 0, fmt.Errorf("decoration %d has no value", ops[1])
+			}
+			return ops[2], nil
+		}
+		var err error
+		switch ops[1] {
+		case decorationBlock:
+			d.block = true
+		case decorationBufferBlock:
+			d.bufferBlock = true
+		case decorationBuiltIn:
+			d.builtIn = true
+		case decorationSpecID:
+			d.specID, err = literal()
+			d.hasSpecID = true
+		case decorationArrayStride:
+			d.arrayStride, err = literal()
+		case decorationLocation:
+			d.location, err = literal()
+			d.hasLocation = true
+		case decorationBinding:
+			d.binding, err = literal()
+			d.hasBinding = true
+		case decorationDescriptorSet:
+			d.set, err = literal()
+			d.hasSet = true
+		}
+		return err
+
+	case opMemberDecorate:
+		if err := need(3); err != nil {
+			return err
+		}
+		d := p.decoration(ops[0])
+		member, ok := d.members[ops[1]]
+		if !ok {
+			member = &memberDecorations{}
+			d.members[ops[1]] = member
+		}
+		switch ops[2] {
+		case decorationOffset, decorationMatrixStride:
+			if len(ops) < 4 {
+				return fmt.Errorf("member decoration %d has no value", ops[2])
+			}
+			if ops[2] == decorationOffset {
+				member.offset, member.hasOffset = ops[3], true
+			} else {
+				member.matrixStride = ops[3]
+			}
+		case decorationBuiltIn:
+			// blocks of built ins, like gl_PerVertex
+			d.builtIn = true
+		}
+	}
+	return nil
+}
+
+func (p *parser) typeOf(id uint32) (*spvType, error) {
+	t, ok := p.types[id]
+	if !ok {
+		return nil, fmt.Errorf("type %d is not declared", id)
+	}
+	return t, nil
+}
+
+// arrayLength returns the length of an array type
+func (p *parser) arrayLength(t *spvType) (uint32, error) {
+	length, ok := p.constants[t.lengthID]
+	if !ok {
+		return 0, fmt.Errorf("array length %d is not a constant", t.lengthID)
+	}
+	return length, nil
+}
+
+// size returns the size of the type in a buffer, with the matrix stride
+// of the member it's the type of, if any
+func (p *parser) size(id uint32, matrixStride uint32) (uint32, error) {
+	t, err := p.typeOf(id)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t.op {
+	case opTypeBool:
+		return 4, nil
+	case opTypeInt, opTypeFloat:
+		return t.width / 8, nil
+	case opTypeVector:
+		component, err := p.size(t.elem, 0)
+		return component * t.count, err
+	case opTypeMatrix:
+		if matrixStride > 0 {
+			return matrixStride * t.count, nil
+		}
+		column, err := p.size(t.elem, 0)
+		return column * t.count, err
+	case opTypeArray:
+		length, err := p.arrayLength(t)
+		if err != nil {
+			return 0, err
+		}
+		if stride := p.decoration(id).arrayStride; stride > 0 {
+			return stride * length, nil
+		}
+		elem, err := p.size(t.elem, matrixStride)
+		return elem * length, err
+	case opTypeRuntimeArr:
+		return 0, nil
+	case opTypeStruct:
+		var size uint32
+		d := p.decoration(id)
+		for idx, member := range t.members {
+			md, ok := d.members[uint32(idx)]
+			if !ok {
+				md = &memberDecorations{}
+			}
+			memberSize, err := p.size(member, md.matrixStride)
+			if err != nil {
+				return 0, err
+			}
+			if end := md.offset + memberSize; end > size {
+				size = end
+			}
+		}
+		return size, nil
+	}
+	return 0, fmt.Errorf("type %d has no size", id)
+}
+
+// descriptorType returns the descriptor type of a variable of the type
+// in the storage class, with the count if it's an array
+func (p *parser) descriptorType(id, storage uint32) (DescriptorType, uint32, uint32, error) {
+	t, err := p.typeOf(id)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	count := uint32(1)
+	switch t.op {
+	case opTypeArray:
+		if count, err = p.arrayLength(t); err != nil {
+			return 0, 0, 0, err
+		}
+		id = t.elem
+	case opTypeRuntimeArr:
+		count = 0
+		id = t.elem
+	}
+	if t, err = p.typeOf(id); err != nil {
+		return 0, 0, 0, err
+	}
+
+	switch {
+	case storage == storageStorageBuffer && t.op == opTypeStruct:
+		size, err := p.size(id, 0)
+		return StorageBuffer, count, size, err
+	case storage == storageUniform && t.op == opTypeStruct:
+		size, err := p.size(id, 0)
+		if p.decoration(id).bufferBlock {
+			return StorageBuffer, count, size, err
+		}
+		return UniformBuffer, count, size, err
+	case storage == storageUniformConstant && t.op == opTypeSampledImg:
+		return CombinedImageSampler, count, 0, nil
+	case storage == storageUniformConstant && t.op == opTypeSampler:
+		return Sampler, count, 0, nil
+	case storage == storageUniformConstant && t.op == opTypeImage:
+		switch {
+		case t.dim == dimSubpassData:
+			return InputAttachment, count, 0, nil
+		case t.dim == dimBuffer && t.sampled == 2:
+			return StorageTexelBuffer, count, 0, nil
+		case t.dim == dimBuffer:
+			return UniformTexelBuffer, count, 0, nil
+		case t.sampled == 2:
+			return StorageImage, count, 0, nil
+		default:
+			return SampledImage, count, 0, nil
+		}
+	}
+	return 0, 0, 0, fmt.Errorf("type %d in storage class %d is not a descriptor", id, storage)
+}
+
+// inputType returns the type of an input variable
+func (p *parser) inputType(id uint32) (Type, uint32, error) {
+	t, err := p.typeOf(id)
+	if err != nil {
+		return Type{}, 0, err
+	}
+
+	count := uint32(1)
+	if t.op == opTypeArray {
+		if count, err = p.arrayLength(t); err != nil {
+			return Type{}, 0, err
+		}
+		if t, err = p.typeOf(t.elem); err != nil {
+			return Type{}, 0, err
+		}
+	}
+
+	typ := Type{Components: 1, Columns: 1}
+	if t.op == opTypeMatrix {
+		typ.Columns = t.count
+		if t, err = p.typeOf(t.elem); err != nil {
+			return Type{}, 0, err
+		}
+	}
+	if t.op == opTypeVector {
+		typ.Components = t.count
+		if t, err = p.typeOf(t.elem); err != nil {
+			return Type{}, 0, err
+		}
+	}
+
+	switch t.op {
+	case opTypeFloat:
+		typ.Kind = Float
+	case opTypeInt:
+		typ.Kind = Uint
+		if t.signed != 0 {
+			typ.Kind = Int
+		}
+	case opTypeBool:
+		typ.Kind = Bool
+	default:
+		return Type{}, 0, fmt.Errorf("type %d is not a scalar, vector or matrix", id)
+	}
+	typ.Width = t.width
+	return typ, count, nil
+}
+
+// pointee returns the type a pointer type points to
+func (p *parser) pointee(id uint32) (uint32, error) {
+	t, err := p.typeOf(id)
+	if err != nil {
+		return 0, err
+	}
+	if t.op != opTypePointer {
+		return 0, fmt.Errorf("type %d of a variable is not a pointer", id)
+	}
+	return t.elem, nil
+}
+
+// module puts together what the instructions declared
+func (p *parser) module() (*Module, error) {
+	m := &Module{}
+	stages := Stage(0)
+	for _, ep := range p.entryPoints {
+		stages |= ep.stage
+	}
+
+	variables := make(map[uint32]variable, len(p.variables))
+	for _, v := range p.variables {
+		variables[v.id] = v
+		d := p.decoration(v.id)
+
+		switch v.storage {
+		case storageUniformConstant, storageUniform, storageStorageBuffer:
+			if !d.hasSet && !d.hasBinding {
+				continue
+			}
+			typeID, err := p.pointee(v.typeID)
+			if err != nil {
+				return nil, err
+			}
+			dt, count, size, err := p.descriptorType(typeID, v.storage)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", p.name(v.id, typeID), err.Error())
+			}
+			m.Bindings = append(m.Bindings, Binding{
+				Name:    p.name(v.id, typeID),
+				Set:     d.set,
+				Binding: d.binding,
+				Type:    dt,
+				Count:   count,
+				Size:    size,
+				Stages:  stages,
+			})
+
+		case storagePushConstant:
+			typeID, err := p.pointee(v.typeID)
+			if err != nil {
+				return nil, err
+			}
+			size, err := p.size(typeID, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", p.name(v.id, typeID), err.Error())
+			}
+			offset := size
+			for _, member := range p.decoration(typeID).members {
+				if member.hasOffset && member.offset < offset {
+					offset = member.offset
+				}
+			}
+			if offset == size {
+				offset = 0
+			}
+			m.PushConstants = append(m.PushConstants, PushConstantRange{
+				Name:   p.name(v.id, typeID),
+				Offset: offset,
+				Size:   size - offset,
+				Stages: stages,
+			})
+		}
+	}
+	sort.Slice(m.Bindings, func(i, j int) bool {
+		a, b := m.Bindings[i], m.Bindings[j]
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+		return a.Binding < b.Binding
+	})
+
+	for _, ep := range p.entryPoints {
+		entry := EntryPoint{Name: ep.name, Stage: ep.stage}
+		for _, id := range ep.iface {
+			v, ok := variables[id]
+			if !ok || v.storage != storageInput {
+				continue
+			}
+			d := p.decoration(id)
+			typeID, err := p.pointee(v.typeID)
+			if err != nil {
+				return nil, err
+			}
+			if d.builtIn || p.decoration(typeID).builtIn {
+				continue
+			}
+			if !d.hasLocation {
+				return nil, fmt.Errorf("input %s of %s has no location", p.name(id, typeID), ep.name)
+			}
+			typ, count, err := p.inputType(typeID)
+			if err != nil {
+				return nil, fmt.Errorf("input %s of %s: %s", p.name(id, typeID), ep.name, err.Error())
+			}
+			entry.Inputs = append(entry.Inputs, Variable{
+				Name:     p.name(id, typeID),
+				Location: d.location,
+				Type:     typ,
+				Count:    count,
+			})
+		}
+		sort.Slice(entry.Inputs, func(i, j int) bool {
+			return entry.Inputs[i].Location < entry.Inputs[j].Location
+		})
+		m.EntryPoints = append(m.EntryPoints, entry)
+	}
+
+	for _, c := range p.specs {
+		d := p.decoration(c.id)
+		if !d.hasSpecID {
+			// constants computed from others can't be set
+			continue
+		}
+		typ, count, err := p.inputType(c.typeID)
+		if err != nil || count != 1 || typ.Components != 1 || typ.Columns != 1 {
+			return nil, fmt.Errorf("specialization constant %s is not a scalar", p.name(c.id, c.typeID))
+		}
+		m.SpecConstants = append(m.SpecConstants, SpecConstant{
+			Name: p.name(c.id, 0),
+			ID:   d.specID,
+			Type: typ,
+		})
+	}
+	sort.Slice(m.SpecConstants, func(i, j int) bool {
+		return m.SpecConstants[i].ID < m.SpecConstants[j].ID
+	})
+	return m, nil
+}
+
+// name returns the name of the variable, or of its type if the
+// variable has none, like the instance of a block without a name
+func (p *parser) name(id, typeID uint32) string {
+	if name := p.names[id]; name != "" {
+		return name
+	}
+	if name := p.names[typeID]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("%%%d", id)
+}
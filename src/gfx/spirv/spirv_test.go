@@ -0,0 +1,484 @@
+package spirv_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/devblok/koru/src/gfx/spirv"
+	"github.com/devblok/koru/src/model"
+	vk "github.com/devblok/vulkan"
+)
+
+// assembler writes SPIR-V modules word by word, ids are handed out in order
+type assembler struct {
+	words []uint32
+	next  uint32
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		words: []uint32{spirv.Magic, 0x00010000, 0, 0, 0},
+		next:  1,
+	}
+}
+
+func (a *assembler) id() uint32 {
+	a.next++
+	return a.next - 1
+}
+
+func (a *assembler) op(opcode uint32, operands ...uint32) {
+	a.words = append(a.words, uint32(len(operands)+1)<<16|opcode)
+	a.words = append(a.words, operands...)
+}
+
+// str encodes a nul terminated literal string
+func str(s string) []uint32 {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	words := make([]uint32, len(b)/4)
+	for idx := range words {
+		words[idx] = binary.LittleEndian.Uint32(b[idx*4:])
+	}
+	return words
+}
+
+func cat(words ...interface{}) []uint32 {
+	var out []uint32
+	for _, w := range words {
+		switch w := w.(type) {
+		case uint32:
+			out = append(out, w)
+		case []uint32:
+			out = append(out, w...)
+		}
+	}
+	return out
+}
+
+func (a *assembler) bytes(order binary.ByteOrder) []byte {
+	a.words[3] = a.next
+	code := make([]byte, len(a.words)*4)
+	for idx, w := range a.words {
+		order.PutUint32(code[idx*4:], w)
+	}
+	return code
+}
+
+// Opcodes, decorations and enumerants the modules are written with
+const (
+	opName           = 5
+	opEntryPoint     = 15
+	opTypeBool       = 20
+	opTypeInt        = 21
+	opTypeFloat      = 22
+	opTypeVector     = 23
+	opTypeMatrix     = 24
+	opTypeImage      = 25
+	opTypeSampler    = 26
+	opTypeSampledImg = 27
+	opTypeArray      = 28
+	opTypeRuntimeArr = 29
+	opTypeStruct     = 30
+	opTypePointer    = 32
+	opConstant       = 43
+	opSpecTrue       = 48
+	opSpecConstant   = 50
+	opVariable       = 59
+	opDecorate       = 71
+	opMemberDecorate = 72
+
+	decorationSpecID       = 1
+	decorationBlock        = 2
+	decorationBufferBlock  = 3
+	decorationArrayStride  = 6
+	decorationMatrixStride = 7
+	decorationBuiltIn      = 11
+	decorationLocation     = 30
+	decorationBinding      = 33
+	decorationSet          = 34
+	decorationOffset       = 35
+
+	storageUniformConstant = 0
+	storageInput           = 1
+	storageUniform         = 2
+	storagePushConstant    = 9
+
+	modelVertex   = 0
+	modelFragment = 4
+)
+
+// types declares the types both modules use
+type types struct {
+	float, int, uint, vec3, vec4, mat4, ubo uint32
+}
+
+func (a *assembler) types() types {
+	var t types
+	t.float, t.int, t.uint = a.id(), a.id(), a.id()
+	a.op(opTypeFloat, t.float, 32)
+	a.op(opTypeInt, t.int, 32, 1)
+	a.op(opTypeInt, t.uint, 32, 0)
+	t.vec3, t.vec4, t.mat4 = a.id(), a.id(), a.id()
+	a.op(opTypeVector, t.vec3, t.float, 3)
+	a.op(opTypeVector, t.vec4, t.float, 4)
+	a.op(opTypeMatrix, t.mat4, t.vec4, 4)
+
+	// the uniform of main.vert, view and projection
+	t.ubo = a.id()
+	a.op(opTypeStruct, t.ubo, t.mat4, t.mat4)
+	a.op(opDecorate, t.ubo, decorationBlock)
+	for member := uint32(0); member < 2; member++ {
+		a.op(opMemberDecorate, t.ubo, member, decorationOffset, member*64)
+		a.op(opMemberDecorate, t.ubo, member, decorationMatrixStride, 16)
+	}
+	return t
+}
+
+// uniform declares a variable of the type in the storage class, at the set and binding
+func (a *assembler) uniform(name string, typ, storage, set, binding uint32) uint32 {
+	ptr, v := a.id(), a.id()
+	a.op(opTypePointer, ptr, storage, typ)
+	a.op(opVariable, ptr, v, storage)
+	a.op(opName, cat(v, str(name))...)
+	a.op(opDecorate, v, decorationSet, set)
+	a.op(opDecorate, v, decorationBinding, binding)
+	return v
+}
+
+// input declares an input variable of the type at the location
+func (a *assembler) input(name string, typ, location uint32) uint32 {
+	ptr, v := a.id(), a.id()
+	a.op(opTypePointer, ptr, storageInput, typ)
+	a.op(opVariable, ptr, v, storageInput)
+	a.op(opName, cat(v, str(name))...)
+	a.op(opDecorate, v, decorationLocation, location)
+	return v
+}
+
+// vertexModule is like main.vert, with push constants
+// and a storage buffer on top
+func vertexModule() *assembler {
+	a := newAssembler()
+	main := a.id()
+	t := a.types()
+
+	a.uniform("ubo", t.ubo, storageUniform, 0, 0)
+
+	inPos := a.input("inPos", t.vec3, 0)
+	inColor := a.input("inColor", t.vec4, 1)
+	inModel := a.input("inModel", t.mat4, 6)
+
+	ptr, vertexIndex := a.id(), a.id()
+	a.op(opTypePointer, ptr, storageInput, t.int)
+	a.op(opVariable, ptr, vertexIndex, storageInput)
+	a.op(opDecorate, vertexIndex, decorationBuiltIn, 42)
+
+	push, pushPtr, pushVar := a.id(), a.id(), a.id()
+	a.op(opTypeStruct, push, t.vec4, t.float)
+	a.op(opName, cat(push, str("Push"))...)
+	a.op(opDecorate, push, decorationBlock)
+	a.op(opMemberDecorate, push, 0, decorationOffset, 16)
+	a.op(opMemberDecorate, push, 1, decorationOffset, 32)
+	a.op(opTypePointer, pushPtr, storagePushConstant, push)
+	a.op(opVariable, pushPtr, pushVar, storagePushConstant)
+
+	particles, runtime := a.id(), a.id()
+	a.op(opTypeRuntimeArr, runtime, t.vec4)
+	a.op(opDecorate, runtime, decorationArrayStride, 16)
+	a.op(opTypeStruct, particles, t.uint, runtime)
+	a.op(opDecorate, particles, decorationBufferBlock)
+	a.op(opMemberDecorate, particles, 0, decorationOffset, 0)
+	a.op(opMemberDecorate, particles, 1, decorationOffset, 16)
+	a.uniform("particles", particles, storageUniform, 2, 0)
+
+	a.op(opEntryPoint, cat(uint32(modelVertex), main, str("main"), inPos, inColor, inModel, vertexIndex)...)
+	return a
+}
+
+// fragmentModule samples an array of two textures, and reads the uniform of
+// the vertex stage. If conflicting, the uniform is declared as a sampler.
+func fragmentModule(conflicting bool) *assembler {
+	a := newAssembler()
+	main := a.id()
+	t := a.types()
+
+	if conflicting {
+		sampler := a.id()
+		a.op(opTypeSampler, sampler)
+		a.uniform("ubo", sampler, storageUniformConstant, 0, 0)
+	} else {
+		a.uniform("ubo", t.ubo, storageUniform, 0, 0)
+	}
+
+	image, sampled, two, array := a.id(), a.id(), a.id(), a.id()
+	a.op(opTypeImage, image, t.float, 1, 0, 0, 0, 1, 0)
+	a.op(opTypeSampledImg, sampled, image)
+	a.op(opConstant, t.uint, two, 2)
+	a.op(opTypeArray, array, sampled, two)
+	a.uniform("textures", array, storageUniformConstant, 0, 1)
+
+	boolType, fog, scale := a.id(), a.id(), a.id()
+	a.op(opTypeBool, boolType)
+	a.op(opSpecTrue, boolType, fog)
+	a.op(opName, cat(fog, str("fog"))...)
+	a.op(opDecorate, fog, decorationSpecID, 3)
+	a.op(opSpecConstant, t.float, scale, 0x3F800000)
+	a.op(opName, cat(scale, str("scale"))...)
+	a.op(opDecorate, scale, decorationSpecID, 1)
+
+	fragColor := a.input("fragColor", t.vec4, 0)
+	a.op(opEntryPoint, cat(uint32(modelFragment), main, str("main"), fragColor)...)
+	return a
+}
+
+func TestParse(t *testing.T) {
+	for name, order := range map[string]binary.ByteOrder{
+		"little endian": binary.LittleEndian,
+		"big endian":    binary.BigEndian,
+	} {
+		m, err := spirv.Parse(vertexModule().bytes(order))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if len(m.EntryPoints) != 1 || m.EntryPoints[0].Name != "main" || m.Stages() != spirv.StageVertex {
+			t.Fatalf("%s: unexpected entry points %+v", name, m.EntryPoints)
+		}
+
+		expected := []spirv.Binding{
+			{Name: "ubo", Set: 0, Binding: 0, Type: spirv.UniformBuffer, Count: 1, Size: 128, Stages: spirv.StageVertex},
+			{Name: "particles", Set: 2, Binding: 0, Type: spirv.StorageBuffer, Count: 1, Size: 16, Stages: spirv.StageVertex},
+		}
+		if len(m.Bindings) != len(expected) {
+			t.Fatalf("%s: expected %d bindings, got %+v", name, len(expected), m.Bindings)
+		}
+		for idx := range expected {
+			if m.Bindings[idx] != expected[idx] {
+				t.Errorf("%s: expected %+v, got %+v", name, expected[idx], m.Bindings[idx])
+			}
+		}
+
+		push := spirv.PushConstantRange{Name: "Push", Offset: 16, Size: 20, Stages: spirv.StageVertex}
+		if len(m.PushConstants) != 1 || m.PushConstants[0] != push {
+			t.Errorf("%s: expected push constants %+v, got %+v", name, push, m.PushConstants)
+		}
+
+		inputs := m.EntryPoints[0].Inputs
+		vec := func(n uint32) spirv.Type {
+			return spirv.Type{Kind: spirv.Float, Width: 32, Components: n, Columns: 1}
+		}
+		expectedInputs := []spirv.Variable{
+			{Name: "inPos", Location: 0, Type: vec(3), Count: 1},
+			{Name: "inColor", Location: 1, Type: vec(4), Count: 1},
+			{Name: "inModel", Location: 6, Type: spirv.Type{Kind: spirv.Float, Width: 32, Components: 4, Columns: 4}, Count: 1},
+		}
+		if len(inputs) != len(expectedInputs) {
+			t.Fatalf("%s: expected %d inputs without built ins, got %+v", name, len(expectedInputs), inputs)
+		}
+		for idx := range expectedInputs {
+			if inputs[idx] != expectedInputs[idx] {
+				t.Errorf("%s: expected input %+v, got %+v", name, expectedInputs[idx], inputs[idx])
+			}
+		}
+		if inputs[2].Locations() != 4 {
+			t.Errorf("%s: a mat4 takes 4 locations, not %d", name, inputs[2].Locations())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := fragmentModule(false).bytes(binary.LittleEndian)
+
+	truncated := fragmentModule(false)
+	truncated.words = append(truncated.words, 5<<16|opName, 1)
+
+	badMagic := append([]byte{}, valid...)
+	badMagic[0] = 0
+
+	for name, code := range map[string][]byte{
+		"empty":          nil,
+		"odd size":       valid[:len(valid)-1],
+		"bad magic":      badMagic,
+		"truncated":      truncated.bytes(binary.LittleEndian),
+		"only a header":  valid[:8],
+		"bad type usage": undeclaredType(),
+	} {
+		if _, err := spirv.Parse(code); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseSpecConstants(t *testing.T) {
+	m := parse(t, fragmentModule(false))
+	scalar := func(kind spirv.ScalarKind) spirv.Type {
+		return spirv.Type{Kind: kind, Width: 32, Components: 1, Columns: 1}
+	}
+	boolean := scalar(spirv.Bool)
+	boolean.Width = 0
+
+	expected := []spirv.SpecConstant{
+		{Name: "scale", ID: 1, Type: scalar(spirv.Float)},
+		{Name: "fog", ID: 3, Type: boolean},
+	}
+	if len(m.SpecConstants) != len(expected) {
+		t.Fatalf("expected %d specialization constants, got %+v", len(expected), m.SpecConstants)
+	}
+	for idx := range expected {
+		if m.SpecConstants[idx] != expected[idx] {
+			t.Errorf("expected %+v, got %+v", expected[idx], m.SpecConstants[idx])
+		}
+	}
+	if c, ok := m.SpecConstant(3); !ok || c.Name != "fog" {
+		t.Errorf("constant 3 is not fog: %+v", c)
+	}
+	if _, ok := m.SpecConstant(2); ok {
+		t.Error("found a constant with an id that's not declared")
+	}
+}
+
+// undeclaredType is a module with a uniform of a type that isn't declared
+func undeclaredType() []byte {
+	a := newAssembler()
+	a.uniform("ubo", 100, storageUniform, 0, 0)
+	return a.bytes(binary.LittleEndian)
+}
+
+func parse(t *testing.T, a *assembler) *spirv.Module {
+	m, err := spirv.Parse(a.bytes(binary.LittleEndian))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNewLayout(t *testing.T) {
+	vert, frag := parse(t, vertexModule()), parse(t, fragmentModule(false))
+	layout, err := spirv.NewLayout(spirv.Shader{Module: vert, EntryPoint: "main"}, spirv.Shader{Module: frag, EntryPoint: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if layout.Stages != spirv.StageVertex|spirv.StageFragment {
+		t.Fatalf("unexpected stages %s", layout.Stages)
+	}
+	if len(layout.Sets) != 2 || len(layout.Sets[0]) != 2 || len(layout.Sets[2]) != 1 {
+		t.Fatalf("unexpected sets %+v", layout.Sets)
+	}
+	if ubo := layout.Sets[0][0]; ubo.Stages != spirv.StageVertex|spirv.StageFragment || ubo.Type != spirv.UniformBuffer {
+		t.Errorf("uniform of both stages: %+v", ubo)
+	}
+	if textures := layout.Sets[0][1]; textures.Stages != spirv.StageFragment || textures.Type != spirv.CombinedImageSampler || textures.Count != 2 {
+		t.Errorf("textures of the fragment stage: %+v", textures)
+	}
+	if samplers := layout.Bindings(0, spirv.CombinedImageSampler, spirv.Sampler); len(samplers) != 1 || samplers[0].Binding != 1 {
+		t.Errorf("samplers of set 0: %+v", samplers)
+	}
+	if layout.PushConstants.Size != 20 || layout.PushConstants.Stages != spirv.StageVertex {
+		t.Errorf("unexpected push constants %+v", layout.PushConstants)
+	}
+	if len(layout.Inputs) != 3 {
+		t.Errorf("inputs are not the ones of the vertex stage: %+v", layout.Inputs)
+	}
+
+	for name, shaders := range map[string][]spirv.Shader{
+		"conflicting bindings": {{Module: vert, EntryPoint: "main"}, {Module: parse(t, fragmentModule(true)), EntryPoint: "main"}},
+		"stage twice":          {{Module: vert, EntryPoint: "main"}, {Module: vert, EntryPoint: "main"}},
+		"missing entry point":  {{Module: vert, EntryPoint: "other"}},
+	} {
+		if _, err := spirv.NewLayout(shaders...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestMainProgram reflects the shaders of the main program, compiled
+// from src/shaders like buildShaders.sh does, and checks that they take
+// what the renderer binds: the camera and the texture of the mesh in
+// set 0, nothing in the material set, and the vertex and instance
+// attributes of the model. It's skipped without glslangValidator
+func TestMainProgram(t *testing.T) {
+	compiler, err := exec.LookPath("glslangValidator")
+	if err != nil {
+		t.Skip("glslangValidator is needed to compile the shaders")
+	}
+	dir, err := ioutil.TempDir("", "koru-shaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var shaders []spirv.Shader
+	for _, name := range []string{"main.vert", "main.frag"} {
+		file := filepath.Join(dir, name+".spv")
+		cmd := exec.Command(compiler, "-s", "-V", filepath.Join("..", "..", "shaders", name), "-o", file,
+			"-e", "main", "--source-entrypoint", "main")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %s\n%s", name, err, out)
+		}
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module, err := spirv.Parse(code)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		shaders = append(shaders, spirv.Shader{Module: module, EntryPoint: "main"})
+	}
+	layout, err := spirv.NewLayout(shaders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if layout.Stages != spirv.StageVertex|spirv.StageFragment {
+		t.Fatalf("unexpected stages %s", layout.Stages)
+	}
+	if len(layout.Sets) != 1 || len(layout.Sets[0]) != 2 {
+		t.Fatalf("expected the two bindings of set 0, got %+v", layout.Sets)
+	}
+	camera, texture := layout.Sets[0][0], layout.Sets[0][1]
+	if camera.Binding != 0 || camera.Type != spirv.UniformBuffer || camera.Count != 1 || camera.Stages != spirv.StageVertex ||
+		camera.Size != uint32(unsafe.Sizeof(model.Uniform{})) {
+		t.Errorf("unexpected camera uniform %+v", camera)
+	}
+	if texture.Binding != 1 || texture.Type != spirv.CombinedImageSampler || texture.Count != 1 || texture.Stages != spirv.StageFragment {
+		t.Errorf("unexpected mesh texture %+v", texture)
+	}
+	if layout.PushConstants.Size != 0 {
+		t.Errorf("unexpected push constants %+v", layout.PushConstants)
+	}
+
+	// every location of the inputs is an attribute of the same format
+	formats := map[uint32]vk.Format{
+		2: vk.FormatR32g32Sfloat,
+		3: vk.FormatR32g32b32Sfloat,
+		4: vk.FormatR32g32b32a32Sfloat,
+	}
+	locations := make(map[uint32]vk.Format)
+	for _, input := range layout.Inputs {
+		if input.Type.Kind != spirv.Float || input.Type.Width != 32 {
+			t.Fatalf("input %s is not of floats: %+v", input.Name, input.Type)
+		}
+		for location := input.Location; location < input.Location+input.Locations(); location++ {
+			locations[location] = formats[input.Type.Components]
+		}
+	}
+	attributes := model.VertexAttributeDescriptions()
+	if len(locations) != len(attributes) {
+		t.Fatalf("inputs take %d locations, there are %d attributes", len(locations), len(attributes))
+	}
+	for _, attribute := range attributes {
+		if format, ok := locations[attribute.Location]; !ok || format != attribute.Format {
+			t.Errorf("attribute at location %d is format %d, the input is %d", attribute.Location, attribute.Format, format)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package visibility finds what a camera sees and orders it for drawing.
+// Clip space follows Vulkan, depth goes from 0 to w.
+package visibility
+
+import (
+	"sort"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Plane is the set of points p where Normal.Dot(p) + Distance is 0,
+// the side it's positive on is the inside.
+type Plane struct {
+	Normal   glm.Vec3
+	Distance float32
+}
+
+func (p Plane) normalize() Plane {
+	length := p.Normal.Len()
+	if length == 0 {
+		return p
+	}
+	return Plane{Normal: p.Normal.Mul(1 / length), Distance: p.Distance / length}
+}
+
+// Frustum is the volume a camera sees, bound by the left, right,
+// top, bottom, near and far planes.
+type Frustum [6]Plane
+
+// NewFrustum extracts the frustum from a view projection matrix,
+// the planes are in the space the matrix transforms from.
+func NewFrustum(viewProjection glm.Mat4) Frustum {
+	row := func(idx int) glm.Vec4 {
+		return viewProjection.Row(idx)
+	}
+	plane := func(v glm.Vec4) Plane {
+		return Plane{Normal: v.Vec3(), Distance: v[3]}.normalize()
+	}
+	x, y, z, w := row(0), row(1), row(2), row(3)
+	return Frustum{
+		plane(w.Add(x)),
+		plane(w.Sub(x)),
+		plane(w.Add(y)),
+		plane(w.Sub(y)),
+		plane(z),
+		plane(w.Sub(z)),
+	}
+}
+
+// IntersectsSphere tells if any of the sphere may be inside. Spheres
+// near the corners of the frustum may be taken as inside when they're not.
+func (f Frustum) IntersectsSphere(s model.Sphere) bool {
+	for _, p := range f {
+		if p.Normal.Dot(s.Center)+p.Distance < -s.Radius {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsBox tells if any of the box may be inside. Large boxes near
+// the edges of the frustum may be taken as inside when they're not.
+func (f Frustum) IntersectsBox(b model.AABB) bool {
+	for _, p := range f {
+		// the corner furthest along the normal
+		var corner glm.Vec3
+		for axis := 0; axis < 3; axis++ {
+			if p.Normal[axis] >= 0 {
+				corner[axis] = b.Max[axis]
+			} else {
+				corner[axis] = b.Min[axis]
+			}
+		}
+		if p.Normal.Dot(corner)+p.Distance < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxScale returns the largest scale of the axes of the matrix
+func maxScale(m glm.Mat4) float32 {
+	var scale float32
+	for col := 0; col < 3; col++ {
+		if l := m.Col(col).Vec3().Len(); l > scale {
+			scale = l
+		}
+	}
+	return scale
+}
+
+// transformSphere returns the sphere around the sphere transformed
+// by the matrix, the radius grows with the largest scale of it
+func transformSphere(s model.Sphere, m glm.Mat4) model.Sphere {
+	return model.Sphere{
+		Center: m.Mul4x1(s.Center.Vec4(1)).Vec3(),
+		Radius: s.Radius * maxScale(m),
+	}
+}
+
+// Blended is set in the Pipeline of items that blend with what's drawn
+// before them. They're drawn after the others, back to front.
+const Blended uint64 = 1 << 63
+
+// Item is an instance of a resource that may be drawn.
+type Item struct {
+	// ID identifies the instance to the caller
+	ID uint32
+
+	// Pipeline identifies the state the resource is drawn with and
+	// Material the values bound for it, items are grouped by
+	// the pipeline first, then the material and the resource
+	Pipeline uint64
+	Material string
+	Resource string
+
+	// Model places Bounds, the ones of the resource, in the world
+	Model  glm.Mat4
+	Bounds model.Bounds
+
+	// LODs are the errors of the levels of detail of the resource,
+	// relative to the size of Bounds, most detailed first
+	LODs []float32
+
+	// Depth is the distance from the camera to the center of the bounding
+	// sphere and LOD the level of detail drawn, they're set by View.Cull
+	Depth float32
+	LOD   int
+}
+
+// View culls and sorts items for a camera.
+type View struct {
+	Frustum Frustum
+	Eye     glm.Vec3
+
+	// LODScale is how many pixels a unit at a distance of one covers
+	// on the screen. The coarsest level of detail that is off by no
+	// more than a pixel is picked, the most detailed one if it's 0
+	LODScale float32
+}
+
+// NewView creates the view of a camera with the view and projection.
+func NewView(view, projection glm.Mat4) View {
+	return View{
+		Frustum: NewFrustum(projection.Mul4(view)),
+		Eye:     view.Inv().Col(3).Vec3(),
+	}
+}
+
+// Cull returns the items inside the frustum, sorted by the pipeline,
+// the material, the resource and then front to back. Blended items come
+// after those, back to front whatever their pipeline, so they're drawn
+// over what's behind them. The items are left alone.
+func (v View) Cull(items []Item) []Item {
+	visible := make([]Item, 0, len(items))
+	for _, item := range items {
+		// the sphere is cheaper to test, the box is tighter
+		sphere := transformSphere(item.Bounds.Sphere, item.Model)
+		if !v.Frustum.IntersectsSphere(sphere) || !v.Frustum.IntersectsBox(item.Bounds.Box.Transform(item.Model)) {
+			continue
+		}
+		item.Depth = sphere.Center.Sub(v.Eye).Len()
+		item.LOD = v.lod(item, item.Depth-sphere.Radius)
+		visible = append(visible, item)
+	}
+
+	sort.Slice(visible, func(i, j int) bool {
+		a, b := &visible[i], &visible[j]
+		if blended := a.Pipeline&Blended != 0; blended != (b.Pipeline&Blended != 0) {
+			return !blended
+		} else if blended && a.Depth != b.Depth {
+			return a.Depth > b.Depth
+		}
+		if a.Pipeline != b.Pipeline {
+			return a.Pipeline < b.Pipeline
+		}
+		if a.Material != b.Material {
+			return a.Material < b.Material
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		if a.LOD != b.LOD {
+			return a.LOD < b.LOD
+		}
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		return a.ID < b.ID
+	})
+	return visible
+}
+
+// lod picks the level of detail of the item at the distance
+// from the camera to the closest point of its bounds
+func (v View) lod(item Item, distance float32) int {
+	if v.LODScale <= 0 || distance <= 0 {
+		return 0
+	}
+	size := item.Bounds.Box.Extent().Len() * maxScale(item.Model)
+	for level := len(item.LODs) - 1; level > 0; level-- {
+		if item.LODs[level]*size/distance*v.LODScale <= 1 {
+			return level
+		}
+	}
+	return 0
+}
+
+// Batch is a run of items drawn with one instanced draw.
+type Batch struct {
+	Pipeline uint64
+	Material string
+	Resource string
+	LOD      int
+
+	// First is the index of the first item of the batch, Count
+	// is how many follow, they're the instances of the draw
+	First, Count uint32
+}
+
+// Batches groups consecutive items of the same pipeline, material, resource
+// and level of detail, the items of a Cull come out in as few batches as possible.
+func Batches(items []Item) []Batch {
+	var batches []Batch
+	for idx, item := range items {
+		if last := len(batches) - 1; last >= 0 && batches[last].Pipeline == item.Pipeline &&
+			batches[last].Material == item.Material && batches[last].Resource == item.Resource &&
+			batches[last].LOD == item.LOD {
+			batches[last].Count++
+			continue
+		}
+		batches = append(batches, Batch{
+			Pipeline: item.Pipeline,
+			Material: item.Material,
+			Resource: item.Resource,
+			LOD:      item.LOD,
+			First:    uint32(idx),
+			Count:    1,
+		})
+	}
+	return batches
+}
+
+// Instances returns the per instance data of the items, in their order.
+func Instances(items []Item) []model.Instance {
+	instances := make([]model.Instance, len(items))
+	for idx, item := range items {
+		instances[idx].Model = item.Model
+	}
+	return instances
+}
@@ -0,0 +1,205 @@
+package visibility_test
+
+import (
+	"testing"
+
+	"github.com/devblok/koru/src/gfx/visibility"
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// camera looks down -Z from the origin, seeing from 1 to 10 units
+// away with 90 degrees, with depth from 0 to w like Vulkan
+func camera() (glm.Mat4, glm.Mat4) {
+	vulkanClip := glm.Mat4{
+		1, 0, 0, 0,
+		0, -1, 0, 0,
+		0, 0, 0.5, 0,
+		0, 0, 0.5, 1,
+	}
+	projection := vulkanClip.Mul4(glm.Perspective(glm.DegToRad(90), 1, 1, 10))
+	return glm.Ident4(), projection
+}
+
+var unitBox = model.NewBounds([]glm.Vec3{{-0.5, -0.5, -0.5}, {0.5, 0.5, 0.5}})
+
+func TestFrustum(t *testing.T) {
+	frustum := visibility.NewFrustum(func() glm.Mat4 {
+		view, projection := camera()
+		return projection.Mul4(view)
+	}())
+
+	for name, c := range map[string]struct {
+		center  glm.Vec3
+		visible bool
+	}{
+		"ahead":          {glm.Vec3{0, 0, -5}, true},
+		"behind":         {glm.Vec3{0, 0, 5}, false},
+		"before near":    {glm.Vec3{0, 0, 0}, false},
+		"touching near":  {glm.Vec3{0, 0, -0.7}, true},
+		"beyond far":     {glm.Vec3{0, 0, -11}, false},
+		"left":           {glm.Vec3{-7, 0, -5}, false},
+		"touching left":  {glm.Vec3{-5.4, 0, -5}, true},
+		"right":          {glm.Vec3{7, 0, -5}, false},
+		"above":          {glm.Vec3{0, 7, -5}, false},
+		"below":          {glm.Vec3{0, -7, -5}, false},
+		"touching below": {glm.Vec3{0, -5.4, -5}, true},
+	} {
+		box := unitBox.Box.Transform(glm.Translate3D(c.center[0], c.center[1], c.center[2]))
+		if visible := frustum.IntersectsBox(box); visible != c.visible {
+			t.Errorf("%s: expected visible %t, got %t", name, c.visible, visible)
+		}
+		sphere := model.Sphere{Center: c.center, Radius: 0.5}
+		if visible := frustum.IntersectsSphere(sphere); visible != c.visible {
+			t.Errorf("%s: expected the sphere visible %t, got %t", name, c.visible, visible)
+		}
+	}
+}
+
+func TestCull(t *testing.T) {
+	view := visibility.NewView(camera())
+	item := func(id uint32, pipeline uint64, resource string, z float32) visibility.Item {
+		return visibility.Item{
+			ID:       id,
+			Pipeline: pipeline,
+			Resource: resource,
+			Model:    glm.Translate3D(0, 0, z),
+			Bounds:   unitBox,
+		}
+	}
+
+	// the sphere reaches into the frustum, the box doesn't
+	loose := item(6, 0, "a", 2)
+	loose.Bounds.Sphere.Radius = 4
+
+	visible := view.Cull([]visibility.Item{
+		loose,
+		item(0, 1, "a", -3),
+		item(1, 0, "b", -3),
+		item(2, 0, "a", -8),
+		item(3, 0, "a", 4), // behind
+		item(4, 0, "a", -2),
+		item(5, 1, "a", -20), // beyond far
+	})
+
+	expected := []uint32{4, 2, 1, 0}
+	if len(visible) != len(expected) {
+		t.Fatalf("expected %d visible items, got %d", len(expected), len(visible))
+	}
+	for idx, id := range expected {
+		if visible[idx].ID != id {
+			t.Fatalf("expected %v, got item %d at %d", expected, visible[idx].ID, idx)
+		}
+	}
+	if visible[0].Depth != 2 || visible[1].Depth != 8 {
+		t.Fatalf("depth is not the distance to the camera: %v, %v", visible[0].Depth, visible[1].Depth)
+	}
+}
+
+func TestCullBlended(t *testing.T) {
+	view := visibility.NewView(camera())
+	item := func(id uint32, pipeline uint64, resource string, z float32) visibility.Item {
+		return visibility.Item{
+			ID:       id,
+			Pipeline: pipeline,
+			Resource: resource,
+			Model:    glm.Translate3D(0, 0, z),
+			Bounds:   unitBox,
+		}
+	}
+
+	// two alpha items overlap, the far one has to be drawn first to
+	// show through the near one, whatever their pipeline and resource
+	visible := view.Cull([]visibility.Item{
+		item(0, visibility.Blended|1, "a", -3),
+		item(1, visibility.Blended|2, "b", -3.5),
+		item(2, 2, "a", -5),
+		item(3, visibility.Blended|1, "a", -4),
+	})
+
+	expected := []uint32{2, 3, 1, 0}
+	for idx, id := range expected {
+		if visible[idx].ID != id {
+			t.Fatalf("expected %v, got item %d at %d", expected, visible[idx].ID, idx)
+		}
+	}
+	if batches := visibility.Batches(visible); len(batches) != 4 {
+		t.Fatalf("expected every item in a batch of its own, got %+v", batches)
+	}
+}
+
+func TestCullLOD(t *testing.T) {
+	view := visibility.NewView(camera())
+	view.LODScale = 100
+	var items []visibility.Item
+	for idx, z := range []float32{-1.5, -2, -3} {
+		items = append(items, visibility.Item{
+			ID:       uint32(idx),
+			Resource: "a",
+			Model:    glm.Translate3D(0, 0, z),
+			Bounds:   unitBox,
+			LODs:     []float32{0, 0.004, 0.01},
+		})
+	}
+
+	// a level is picked if its error covers no more than a pixel,
+	// the closer the item the more detailed the level
+	visible := view.Cull(items)
+	for idx, lod := range []int{0, 1, 2} {
+		if visible[idx].ID != uint32(idx) || visible[idx].LOD != lod {
+			t.Fatalf("expected item %d at level %d, got %+v", idx, lod, visible[idx])
+		}
+	}
+	if batches := visibility.Batches(visible); len(batches) != 3 || batches[2].LOD != 2 {
+		t.Fatalf("expected a batch for every level, got %+v", batches)
+	}
+
+	view.LODScale = 0
+	for _, item := range view.Cull(items) {
+		if item.LOD != 0 {
+			t.Fatalf("expected full detail without a scale, got %+v", item)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	view := visibility.NewView(camera())
+	var items []visibility.Item
+	for idx, resource := range []string{"b", "a", "b", "a", "c", "a", "c"} {
+		items = append(items, visibility.Item{
+			ID:       uint32(idx),
+			Resource: resource,
+			Model:    glm.Translate3D(0, 0, -2-float32(idx)),
+			Bounds:   unitBox,
+		})
+	}
+	items[5].Pipeline = 1
+	items[6].Material = "other"
+
+	visible := view.Cull(items)
+	batches := visibility.Batches(visible)
+	expected := []visibility.Batch{
+		{Pipeline: 0, Resource: "a", First: 0, Count: 2},
+		{Pipeline: 0, Resource: "b", First: 2, Count: 2},
+		{Pipeline: 0, Resource: "c", First: 4, Count: 1},
+		{Pipeline: 0, Material: "other", Resource: "c", First: 5, Count: 1},
+		{Pipeline: 1, Resource: "a", First: 6, Count: 1},
+	}
+	if len(batches) != len(expected) {
+		t.Fatalf("expected %d batches, got %+v", len(expected), batches)
+	}
+	for idx := range expected {
+		if batches[idx] != expected[idx] {
+			t.Fatalf("batch %d: expected %+v, got %+v", idx, expected[idx], batches[idx])
+		}
+	}
+
+	// instances of a batch are in order, front to back
+	instances := visibility.Instances(visible)
+	if instances[0].Model != items[1].Model || instances[1].Model != items[3].Model {
+		t.Fatal("instances of the first batch are not the a items, front to back")
+	}
+	if len(visibility.Batches(nil)) != 0 {
+		t.Fatal("batches of nothing")
+	}
+}
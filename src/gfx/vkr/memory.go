@@ -29,8 +29,11 @@ func (m *Memory) Get() vk.DeviceMemory {
 	return m.memory
 }
 
-// Release frees memory.
+// Release frees memory. Memory that was never allocated is ignored.
 func (m *Memory) Release() {
+	if m.memory == vk.NullDeviceMemory {
+		return
+	}
 	vk.FreeMemory(m.device, m.memory, nil)
 }
 
@@ -0,0 +1,148 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// AABB is an axis aligned bounding box
+type AABB struct {
+	Min glm.Vec3
+	Max glm.Vec3
+}
+
+// Center returns the middle of the box
+func (b AABB) Center() glm.Vec3 {
+	return b.Min.Add(b.Max).Mul(0.5)
+}
+
+// Extent returns the size of the box along every axis
+func (b AABB) Extent() glm.Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// Transform returns the box enclosing this one moved by m
+func (b AABB) Transform(m glm.Mat4) AABB {
+	var result AABB
+	for corner := 0; corner < 8; corner++ {
+		p := b.Min
+		for axis := 0; axis < 3; axis++ {
+			if corner&(1<<uint(axis)) != 0 {
+				p[axis] = b.Max[axis]
+			}
+		}
+		p = m.Mul4x1(p.Vec4(1)).Vec3()
+		if corner == 0 {
+			result = AABB{Min: p, Max: p}
+			continue
+		}
+		result = result.extend(p)
+	}
+	return result
+}
+
+func (b AABB) extend(p glm.Vec3) AABB {
+	for axis := 0; axis < 3; axis++ {
+		if p[axis] < b.Min[axis] {
+			b.Min[axis] = p[axis]
+		}
+		if p[axis] > b.Max[axis] {
+			b.Max[axis] = p[axis]
+		}
+	}
+	return b
+}
+
+// Sphere is a bounding sphere
+type Sphere struct {
+	Center glm.Vec3
+	Radius float32
+}
+
+// Bounds holds both bounding volumes of a mesh
+type Bounds struct {
+	Box    AABB
+	Sphere Sphere
+}
+
+// NewBounds computes the bounds of points, the sphere with Ritter's
+// algorithm, which is within a few percent of the smallest one
+func NewBounds(points []glm.Vec3) Bounds {
+	if len(points) == 0 {
+		return Bounds{}
+	}
+
+	box := AABB{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		box = box.extend(p)
+	}
+
+	// start from the points furthest apart along the widest axis
+	axis, extent := 0, box.Extent()
+	if extent[1] > extent[axis] {
+		axis = 1
+	}
+	if extent[2] > extent[axis] {
+		axis = 2
+	}
+	lo, hi := points[0], points[0]
+	for _, p := range points {
+		if p[axis] < lo[axis] {
+			lo = p
+		}
+		if p[axis] > hi[axis] {
+			hi = p
+		}
+	}
+	sphere := Sphere{Center: lo.Add(hi).Mul(0.5), Radius: hi.Sub(lo).Len() / 2}
+
+	// grow to include the points left outside
+	for _, p := range points {
+		dist := p.Sub(sphere.Center).Len()
+		if dist <= sphere.Radius {
+			continue
+		}
+		radius := (sphere.Radius + dist) / 2
+		sphere.Center = sphere.Center.Add(p.Sub(sphere.Center).Mul((radius - sphere.Radius) / dist))
+		sphere.Radius = radius
+	}
+	return Bounds{Box: box, Sphere: sphere}
+}
+
+// ComputeBounds returns the bounds of vertex positions
+func ComputeBounds(vertices []Vertex) Bounds {
+	points := make([]glm.Vec3, len(vertices))
+	for idx := range vertices {
+		points[idx] = vertices[idx].Pos
+	}
+	return NewBounds(points)
+}
+
+// ComputeIndexedBounds returns the bounds of the positions of the
+// vertices referenced by indices, a vertex may be referenced many times
+func ComputeIndexedBounds(vertices []Vertex, indices []uint32) Bounds {
+	seen := make(map[uint32]bool, len(indices))
+	points := make([]glm.Vec3, 0, len(indices))
+	for _, idx := range indices {
+		if !seen[idx] {
+			seen[idx] = true
+			points = append(points, vertices[idx].Pos)
+		}
+	}
+	return NewBounds(points)
+}
+
+// LOD is a level of detail of an object, drawn with Indices into
+// Vertices. Primitives are ranges of Indices rather than Vertices
+type LOD struct {
+	Indices    []uint32
+	Primitives []Primitive
+
+	// Error is the deviation from the full detail mesh,
+	// relative to the mesh's size
+	Error float32
+}
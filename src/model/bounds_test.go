@@ -0,0 +1,69 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestNewBounds(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	points := make([]glm.Vec3, 200)
+	for idx := range points {
+		points[idx] = glm.Vec3{random.Float32()*4 - 2, random.Float32() - 3, random.Float32() * 2}
+	}
+	points = append(points, glm.Vec3{-2, -3, 0}, glm.Vec3{2, -2, 2})
+
+	bounds := model.NewBounds(points)
+	if bounds.Box.Min != (glm.Vec3{-2, -3, 0}) || bounds.Box.Max != (glm.Vec3{2, -2, 2}) {
+		t.Fatalf("bad box: %+v", bounds.Box)
+	}
+	for _, p := range points {
+		if p.Sub(bounds.Sphere.Center).Len() > bounds.Sphere.Radius*1.0001 {
+			t.Fatalf("point %v outside of sphere %+v", p, bounds.Sphere)
+		}
+	}
+	// never larger than the sphere around the box
+	if bounds.Sphere.Radius > bounds.Box.Extent().Len()/2*1.0001 {
+		t.Fatalf("sphere is too large: %+v", bounds.Sphere)
+	}
+
+	if empty := model.NewBounds(nil); empty != (model.Bounds{}) {
+		t.Fatalf("bounds of nothing should be empty: %+v", empty)
+	}
+}
+
+func TestComputeIndexedBounds(t *testing.T) {
+	vertices := []model.Vertex{
+		{Pos: glm.Vec3{-1, 0, 0}},
+		{Pos: glm.Vec3{1, 2, 0}},
+		{Pos: glm.Vec3{10, 10, 10}}, // not referenced
+		{Pos: glm.Vec3{0, 0, 3}},
+	}
+	bounds := model.ComputeIndexedBounds(vertices, []uint32{0, 1, 3, 3, 1, 0})
+	if bounds.Box.Min != (glm.Vec3{-1, 0, 0}) || bounds.Box.Max != (glm.Vec3{1, 2, 3}) {
+		t.Fatalf("bad box: %+v", bounds.Box)
+	}
+	if all := model.ComputeBounds(vertices); all.Box.Max != (glm.Vec3{10, 10, 10}) {
+		t.Fatalf("bad box of all vertices: %+v", all.Box)
+	}
+}
+
+func TestAABBTransform(t *testing.T) {
+	box := model.AABB{Min: glm.Vec3{-1, -1, -1}, Max: glm.Vec3{1, 1, 1}}
+	moved := box.Transform(glm.Translate3D(1, 2, 3).Mul4(glm.HomogRotate3DZ(glm.DegToRad(45))))
+	s := float32(1.41421356)
+	if !moved.Min.ApproxEqual(glm.Vec3{1 - s, 2 - s, 2}) || !moved.Max.ApproxEqual(glm.Vec3{1 + s, 2 + s, 4}) {
+		t.Fatalf("bad transformed box: %+v", moved)
+	}
+	if !moved.Center().ApproxEqual(glm.Vec3{1, 2, 3}) {
+		t.Fatalf("bad center: %v", moved.Center())
+	}
+}
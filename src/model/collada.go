@@ -9,131 +9,307 @@ import (
 	"encoding/xml"
 	"fmt"
 	"image"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 
 	glm "github.com/go-gl/mathgl/mgl32"
 )
 
 // ImportColladaObject reads given file and converts Collada object to
-// engine's internal object
+// engine's internal object. Every primitive group of the mesh is
+// triangulated and becomes a Primitive with its own material.
 func ImportColladaObject(fileContents []byte, texture image.Image) (Object, error) {
+	return ImportColladaObjectWithConfiguration(fileContents, texture, ImportConfiguration{})
+}
+
+// ImportColladaObjectWithConfiguration is ImportColladaObject that
+// allows to configure the conversion
+func ImportColladaObjectWithConfiguration(fileContents []byte, texture image.Image, cfg ImportConfiguration) (Object, error) {
 	var colladaModel Collada
 	if err := xml.Unmarshal(fileContents, &colladaModel); err != nil {
 		return nil, err
 	}
-	mesh := colladaModel.Geometries[0].Mesh
+	if len(colladaModel.Geometries) == 0 {
+		return nil, fmt.Errorf("collada file contains no geometries")
+	}
+	geometry := colladaModel.Geometries[0]
+	mesh := geometry.Mesh
 
-	// make a map of inputs
-	inputs := make(map[uint]Input)
-	for _, in := range mesh.Triangles.Inputs {
-		inputs[in.Offset] = in
+	var (
+		vertices   []Vertex
+		materials  []ObjectMaterial
+		primitives []Primitive
+	)
+	var (
+		influences []vertexInfluence
+		skeleton   *Skeleton
+		clips      []AnimationClip
+		bindShape  = glm.Ident4()
+	)
+	if controller := colladaModel.findController(geometry.ID); controller != nil {
+		var err error
+		if skeleton, err = colladaModel.Skeleton(controller); err != nil {
+			return nil, err
+		}
+		if influences, err = controller.Skin.influences(len(skeleton.Joints)); err != nil {
+			return nil, err
+		}
+		if clips, err = colladaModel.Clips(skeleton); err != nil {
+			return nil, err
+		}
+		if len(controller.Skin.BindShapeMatrix.Data) >= 16 {
+			bindShape = colladaMatrix(controller.Skin.BindShapeMatrix.Data)
+		}
 	}
 
-	var vertices []Vertex
-	stride := uint(len(mesh.Triangles.Inputs))
-	for idx := uint(0); idx < uint(len(mesh.Triangles.Index))/stride; idx++ {
-		vertIdx := mesh.Triangles.Index[stride*idx : (stride*idx)+stride]
+	materialIndices := make(map[string]int)
+	for _, group := range mesh.Groups() {
+		groupVertices, err := mesh.triangleVertices(group, influences, cfg)
+		if err != nil {
+			return nil, err
+		}
 
-		var vert Vertex
-		for vIdx, v := range vertIdx {
-			switch inputs[uint(vIdx)].Semantic {
-			case "VERTEX":
-				vertSrc := mesh.Vertices.Inputs[0].Source
-				source, err := findSource(mesh.Source, vertSrc)
-				if err != nil {
-					return nil, err
-				}
-				vert.Pos = source.GetVec3(v)
-			case "NORMAL":
-				source, err := findSource(mesh.Source, inputs[uint(vIdx)].Source)
-				if err != nil {
-					return nil, err
-				}
-				vert.Normal = source.GetVec3(v)
-			case "TEXCOORD":
-				source, err := findSource(mesh.Source, inputs[uint(vIdx)].Source)
+		primitive := Primitive{
+			Material: -1,
+			Offset:   len(vertices),
+			Count:    len(groupVertices),
+		}
+		if symbol := group.Header().Material; symbol != "" {
+			if idx, ok := materialIndices[symbol]; ok {
+				primitive.Material = idx
+			} else {
+				material, err := colladaModel.ResolveMaterial(geometry.ID, symbol)
 				if err != nil {
 					return nil, err
 				}
-				vert.Tex = source.GetVec2(v)
+				materials = append(materials, material)
+				materialIndices[symbol] = len(materials) - 1
+				primitive.Material = len(materials) - 1
 			}
 		}
-		vertices = append(vertices, vert)
+
+		vertices = append(vertices, groupVertices...)
+		primitives = append(primitives, primitive)
+	}
+
+	if !HasNormals(vertices) {
+		SmoothNormals(vertices)
+	}
+
+	// skinning works on vertices in the bind shape
+	if skeleton != nil {
+		normalMatrix := bindShape.Mat3().Inv().Transpose()
+		for idx := range vertices {
+			vertices[idx].Pos = bindShape.Mul4x1(vertices[idx].Pos.Vec4(1)).Vec3()
+			if normal := normalMatrix.Mul3x1(vertices[idx].Normal); normal.Len() > 0 {
+				vertices[idx].Normal = normal.Normalize()
+			}
+		}
+	}
+
+	if !cfg.KeepRaw {
+		rotation, scale := colladaModel.Asset.Conversion()
+		for idx := range vertices {
+			vertices[idx].Pos = rotation.Mul3x1(vertices[idx].Pos).Mul(scale)
+			vertices[idx].Normal = rotation.Mul3x1(vertices[idx].Normal)
+		}
+		if skeleton != nil {
+			conjugateSkeleton(skeleton, rotation.Mat4().Mul4(glm.Scale3D(scale, scale, scale)))
+		}
 	}
+	GenerateTangents(vertices)
 
 	return &ColladaObject{
-		vertices: vertices,
-		texture:  texture,
+		meshData: newMeshData(vertices, texture, materials, primitives, skeleton, clips),
 	}, nil
 }
 
 // ColladaObject is imported from a collada (.dae) file.
 // Loaded and held in memory
 type ColladaObject struct {
-	Object
-
-	mutex    sync.RWMutex
-	position glm.Mat4
-	rotation glm.Mat4
-
-	vertices []Vertex
-	texture  image.Image
+	Transform
+	meshData
 }
 
-// SetPosition implements interface
-func (co *ColladaObject) SetPosition(pos glm.Mat4) {
-	co.mutex.Lock()
-	co.position = pos
-	co.mutex.Unlock()
+func findSource(sources []Source, id string) (Source, error) {
+	for _, s := range sources {
+		if strings.Compare(s.ID, id[1:]) == 0 {
+			return s, nil
+		}
+	}
+	return Source{}, fmt.Errorf("source type: %s not found", id[1:])
 }
 
-// Position implements interface
-func (co *ColladaObject) Position() glm.Mat4 {
-	co.mutex.RLock()
-	defer co.mutex.RUnlock()
-	return co.position
+// Collada is the top-level Collada object
+type Collada struct {
+	Asset          Asset         `xml:"asset"`
+	Images         []Image       `xml:"library_images>image"`
+	Geometries     []Geometry    `xml:"library_geometries>geometry"`
+	Materials      []Material    `xml:"library_materials>material"`
+	Effects        []Effect      `xml:"library_effects>effect"`
+	VisualScenes   []VisualScene `xml:"library_visual_scenes>visual_scene"`
+	Controllers    []Controller  `xml:"library_controllers>controller"`
+	Animations     []Animation   `xml:"library_animations>animation"`
+	AnimationClips []ColladaClip `xml:"library_animation_clips>animation_clip"`
 }
 
-// SetRotation implements interface
-func (co *ColladaObject) SetRotation(rot glm.Mat4) {
-	co.mutex.Lock()
-	co.position = rot
-	co.mutex.Unlock()
-}
+// ResolveMaterial follows the material symbol used by a primitive of a geometry
+// through the scene bindings, the material and the effect it instantiates,
+// and converts the result to engine's material. If the geometry is not
+// instanced in any scene, the symbol is treated as the material id.
+func (c *Collada) ResolveMaterial(geometryID, symbol string) (ObjectMaterial, error) {
+	target, binding := c.findMaterialBinding(geometryID, symbol)
 
-// Rotation implements interface
-func (co *ColladaObject) Rotation() glm.Mat4 {
-	co.mutex.RLock()
-	defer co.mutex.RUnlock()
-	return co.rotation
-}
+	var material *Material
+	for idx := range c.Materials {
+		if c.Materials[idx].ID == target {
+			material = &c.Materials[idx]
+			break
+		}
+	}
+	if material == nil {
+		return ObjectMaterial{}, fmt.Errorf("material: %s not found", target)
+	}
+	if len(material.Effects) == 0 {
+		return ObjectMaterial{}, fmt.Errorf("material: %s does not instance an effect", target)
+	}
 
-// Vertices implements interface
-func (co *ColladaObject) Vertices() []Vertex {
-	return co.vertices
+	effectID := strings.TrimPrefix(material.Effects[0].URL, "#")
+	var effect *Effect
+	for idx := range c.Effects {
+		if c.Effects[idx].ID == effectID {
+			effect = &c.Effects[idx]
+			break
+		}
+	}
+	if effect == nil {
+		return ObjectMaterial{}, fmt.Errorf("effect: %s not found", effectID)
+	}
+
+	name := material.Name
+	if name == "" {
+		name = material.ID
+	}
+	return ObjectMaterial{
+		Name:        name,
+		Emission:    effect.Emission.Color,
+		Ambient:     effect.Ambient.Color,
+		Diffuse:     effect.Diffuse.Color,
+		Specular:    effect.Specular.Color,
+		Shininess:   effect.Shininess,
+		DiffuseMap:  c.resolveTexture(effect, effect.Diffuse, binding),
+		SpecularMap: c.resolveTexture(effect, effect.Specular, binding),
+		NormalMap:   c.resolveTexture(effect, effect.Bump, binding),
+		EmissionMap: c.resolveTexture(effect, effect.Emission, binding),
+	}, nil
 }
 
-// Texture implements interface
-func (co *ColladaObject) Texture() image.Image {
-	return co.texture
+// findMaterialBinding looks for the instance_material that binds the symbol
+// for the given geometry, returns the target material id and the binding.
+func (c *Collada) findMaterialBinding(geometryID, symbol string) (string, *InstanceMaterial) {
+	var binding *InstanceMaterial
+	var walk func(nodes []Node)
+	walk = func(nodes []Node) {
+		bind := func(materials []InstanceMaterial) {
+			for m := range materials {
+				if materials[m].Symbol == symbol && binding == nil {
+					binding = &materials[m]
+				}
+			}
+		}
+		for n := range nodes {
+			for g := range nodes[n].InstanceGeometries {
+				instance := &nodes[n].InstanceGeometries[g]
+				if strings.TrimPrefix(instance.URL, "#") == geometryID {
+					bind(instance.Materials)
+				}
+			}
+			// skinned geometries are instanced through their controller
+			for i := range nodes[n].InstanceControllers {
+				instance := &nodes[n].InstanceControllers[i]
+				if controller := c.findController(geometryID); controller != nil && strings.TrimPrefix(instance.URL, "#") == controller.ID {
+					bind(instance.Materials)
+				}
+			}
+			walk(nodes[n].Nodes)
+		}
+	}
+	for _, scene := range c.VisualScenes {
+		walk(scene.Nodes)
+	}
+
+	if binding == nil {
+		return symbol, nil
+	}
+	return strings.TrimPrefix(binding.Target, "#"), binding
 }
 
-func findSource(sources []Source, id string) (Source, error) {
-	for _, s := range sources {
-		if strings.Compare(s.ID, id[1:]) == 0 {
-			return s, nil
+// resolveTexture follows the sampler and surface parameters of an effect
+// down to the image the texture refers to. Returns an empty TextureMap
+// when the value is a plain color or the image cannot be found.
+func (c *Collada) resolveTexture(effect *Effect, value ColorOrTexture, binding *InstanceMaterial) TextureMap {
+	if value.Texture == "" {
+		return TextureMap{}
+	}
+
+	imageID := value.Texture
+	if sampler, ok := effect.FindParam(value.Texture); ok {
+		imageID = strings.TrimPrefix(sampler.Sampler.Image.URL, "#")
+		if sampler.Sampler.Source != "" {
+			if surface, ok := effect.FindParam(sampler.Sampler.Source); ok {
+				imageID = surface.Surface.InitFrom
+			}
 		}
 	}
-	return Source{}, fmt.Errorf("source type: %s not found", id[1:])
+
+	var texMap TextureMap
+	for _, img := range c.Images {
+		if img.ID == imageID {
+			texMap.Path = img.InitFrom.Path()
+			break
+		}
+	}
+	if texMap.Path == "" {
+		return TextureMap{}
+	}
+
+	if binding != nil {
+		for _, input := range binding.VertexInputs {
+			if input.Semantic == value.TexCoord && input.InputSemantic == "TEXCOORD" {
+				texMap.Set = input.InputSet
+			}
+		}
+	}
+	return texMap
 }
 
-// Collada is the top-level Collada object
-type Collada struct {
-	Geometries []Geometry `xml:"library_geometries>geometry"`
-	Materials  []Material `xml:"library_materials>material"`
-	Effects    []Effect   `xml:"library_effects>effect"`
+// Asset holds the parts of Collada's asset information
+// that affect how the data is interpreted
+type Asset struct {
+	UpAxis string `xml:"up_axis"`
+	Unit   struct {
+		Name  string  `xml:"name,attr"`
+		Meter float32 `xml:"meter,attr"`
+	} `xml:"unit"`
+}
+
+// Conversion returns the rotation and the scale that convert
+// the asset's data into engine's space, which is Z up and in meters
+func (a Asset) Conversion() (glm.Mat3, float32) {
+	scale := a.Unit.Meter
+	if scale <= 0 {
+		scale = 1
+	}
+
+	switch strings.TrimSpace(a.UpAxis) {
+	case "X_UP":
+		return glm.Mat3{0, 0, 1, -1, 0, 0, 0, -1, 0}, scale
+	case "Y_UP":
+		return yUpToZUp, scale
+	default:
+		return glm.Ident3(), scale
+	}
 }
 
 // Geometry represents Collada's geometry
@@ -145,32 +321,255 @@ type Geometry struct {
 
 // Mesh contains all the primitive data
 type Mesh struct {
-	Source    []Source  `xml:"source"`
-	Vertices  Vertices  `xml:"vertices"`
-	Triangles Triangles `xml:"triangles"`
+	Source    []Source    `xml:"source"`
+	Vertices  Vertices    `xml:"vertices"`
+	Triangles []Triangles `xml:"triangles"`
+	Polylists []Polylist  `xml:"polylist"`
+	Polygons  []Polygons  `xml:"polygons"`
+}
+
+// Groups returns all primitive groups of the mesh
+func (m *Mesh) Groups() []PrimitiveGroup {
+	var groups []PrimitiveGroup
+	for idx := range m.Triangles {
+		groups = append(groups, &m.Triangles[idx])
+	}
+	for idx := range m.Polylists {
+		groups = append(groups, &m.Polylists[idx])
+	}
+	for idx := range m.Polygons {
+		groups = append(groups, &m.Polygons[idx])
+	}
+	return groups
+}
+
+// triangleVertices assembles the vertices of a primitive group,
+// three consecutive vertices make up a triangle. Influences of
+// skinned meshes are indexed like positions, nil otherwise.
+// Texture coordinates are flipped unless cfg keeps them raw
+func (m *Mesh) triangleVertices(group PrimitiveGroup, influences []vertexInfluence, cfg ImportConfiguration) ([]Vertex, error) {
+	header := group.Header()
+	stride := header.Stride()
+	if stride == 0 {
+		return nil, nil
+	}
+
+	// resolve sources up front, VERTEX expands to the inputs of vertices
+	type boundInput struct {
+		Input
+		source Source
+		len    int
+	}
+	var inputs []boundInput
+	for _, in := range header.Inputs {
+		if in.Semantic == "VERTEX" {
+			for _, vin := range m.Vertices.Inputs {
+				source, err := findSource(m.Source, vin.Source)
+				if err != nil {
+					return nil, err
+				}
+				vin.Offset = in.Offset
+				inputs = append(inputs, boundInput{Input: vin, source: source, len: source.Len(3)})
+			}
+			continue
+		}
+
+		source, err := findSource(m.Source, in.Source)
+		if err != nil {
+			return nil, err
+		}
+		defaultStride := 3
+		switch in.Semantic {
+		case "TEXCOORD":
+			defaultStride = 2
+		case "COLOR":
+			defaultStride = 4
+		}
+		inputs = append(inputs, boundInput{Input: in, source: source, len: source.Len(defaultStride)})
+	}
+
+	// texture coordinate sets are numbered by the exporter,
+	// the lowest one goes into Tex and the next one into Tex1
+	var texSets []uint
+	for _, in := range inputs {
+		if in.Semantic != "TEXCOORD" {
+			continue
+		}
+		seen := false
+		for _, set := range texSets {
+			seen = seen || set == in.Set
+		}
+		if !seen {
+			texSets = append(texSets, in.Set)
+		}
+	}
+	sort.Slice(texSets, func(i, j int) bool { return texSets[i] < texSets[j] })
+
+	index, err := group.Triangulate()
+	if err != nil {
+		return nil, err
+	}
+	vertices := make([]Vertex, 0, len(index)/stride)
+	for idx := 0; idx+stride <= len(index); idx += stride {
+		vertIdx := index[idx : idx+stride]
+
+		vert := Vertex{
+			Color: DefaultVertexColor,
+		}
+		for _, in := range inputs {
+			v := vertIdx[in.Offset]
+			if v < 0 || v >= in.len {
+				return nil, fmt.Errorf("index %d out of range of source: %s", v, in.source.ID)
+			}
+			switch in.Semantic {
+			case "POSITION":
+				vert.Pos = in.source.GetVec3(v)
+				if v < len(influences) {
+					vert.Joints, vert.Weights = influences[v].joints, influences[v].weights
+				}
+			case "NORMAL":
+				vert.Normal = in.source.GetVec3(v)
+			case "COLOR":
+				vert.Color = in.source.GetVec4(v, DefaultVertexColor)
+			case "TEXCOORD":
+				tex := in.source.GetVec2(v)
+				if !cfg.KeepRaw {
+					tex = flipV(tex)
+				}
+				if in.Set == texSets[0] {
+					vert.Tex = tex
+				} else if len(texSets) > 1 && in.Set == texSets[1] {
+					vert.Tex1 = tex
+				}
+			}
+		}
+		vertices = append(vertices, vert)
+	}
+	return vertices, nil
 }
 
 // Source links to other sources where data is present
 type Source struct {
-	ID     string `xml:"id,attr"`
-	Floats Floats `xml:"float_array"`
-	// technique_common define accessing rules, add if needed
+	ID       string   `xml:"id,attr"`
+	Floats   Floats   `xml:"float_array"`
+	Names    string   `xml:"Name_array"`
+	IDRefs   string   `xml:"IDREF_array"`
+	Accessor Accessor `xml:"technique_common>accessor"`
+}
+
+// Accessor defines how elements are read from the array of a source.
+// Values of params without a name are skipped
+type Accessor struct {
+	Source string  `xml:"source,attr"`
+	Count  int     `xml:"count,attr"`
+	Offset int     `xml:"offset,attr"`
+	Stride int     `xml:"stride,attr"`
+	Params []Param `xml:"param"`
+}
+
+// Param describes a single value of an accessor element
+type Param struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// width returns the number of values the param covers,
+// matrices and vectors of animation and skin sources take several
+func (p Param) width() int {
+	switch p.Type {
+	case "float2":
+		return 2
+	case "float3":
+		return 3
+	case "float4", "float2x2":
+		return 4
+	case "float3x3":
+		return 9
+	case "float4x4":
+		return 16
+	}
+	return 1
+}
+
+// stride returns the distance between elements, sources without an
+// accessor are assumed to be tightly packed sets of defaultStride elements
+func (s Source) stride(defaultStride int) int {
+	if s.Accessor.Stride > 0 {
+		return s.Accessor.Stride
+	}
+	if len(s.Accessor.Params) > 0 {
+		var stride int
+		for _, param := range s.Accessor.Params {
+			stride += param.width()
+		}
+		return stride
+	}
+	return defaultStride
 }
 
-// GetVec3 returns a set of floats from a given index
-// this function assumes array is made in sets of 3 elements
+// Len returns the number of elements in the source
+func (s Source) Len(defaultStride int) int {
+	stride := s.stride(defaultStride)
+	available := (len(s.Floats.Data) - s.Accessor.Offset) / stride
+	if s.Accessor.Count > 0 && s.Accessor.Count < available {
+		return s.Accessor.Count
+	}
+	return available
+}
+
+// get fills dst with values of the element at idx, following the accessor.
+// Missing values are left untouched
+func (s Source) get(idx int, dst []float32) {
+	start := s.Accessor.Offset + idx*s.stride(len(dst))
+	if len(s.Accessor.Params) == 0 {
+		if start+len(dst) <= len(s.Floats.Data) {
+			copy(dst, s.Floats.Data[start:])
+		}
+		return
+	}
+
+	var component, offset int
+	for _, param := range s.Accessor.Params {
+		width := param.width()
+		for w := 0; w < width; w++ {
+			if component == len(dst) {
+				return
+			}
+			if param.Name == "" {
+				break
+			}
+			if start+offset+w < len(s.Floats.Data) {
+				dst[component] = s.Floats.Data[start+offset+w]
+			}
+			component++
+		}
+		offset += width
+	}
+}
+
+// GetVec3 returns a set of floats from a given index,
+// sources without an accessor are assumed to be made in sets of 3 elements
 func (s Source) GetVec3(idx int) glm.Vec3 {
-	stride := 3
-	floats := s.Floats.Data[stride*idx : stride*idx+stride]
-	return glm.Vec3{floats[0], floats[1], floats[2]}
+	var vec glm.Vec3
+	s.get(idx, vec[:])
+	return vec
+}
+
+// GetVec4 returns a set of floats from a given index, values missing
+// from the source, like the alpha of RGB colors, are taken from def.
+// Sources without an accessor are assumed to be made in sets of 4 elements
+func (s Source) GetVec4(idx int, def glm.Vec4) glm.Vec4 {
+	vec := def
+	s.get(idx, vec[:])
+	return vec
 }
 
-// GetVec2 returns a set of floats from a given index
-// this function assumes array is made in sets of 2 elements
+// GetVec2 returns a set of floats from a given index,
+// sources without an accessor are assumed to be made in sets of 2 elements
 func (s Source) GetVec2(idx int) glm.Vec2 {
-	stride := 2
-	floats := s.Floats.Data[stride*idx : stride*idx+stride]
-	return glm.Vec2{floats[0], floats[1]}
+	var vec glm.Vec2
+	s.get(idx, vec[:])
+	return vec
 }
 
 // Floats is the array of floats
@@ -181,24 +580,97 @@ type Floats struct {
 
 // UnmarshalXML unmarshals the array of floats
 func (f *Floats) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var count int
 	for _, attr := range start.Attr {
 		switch attr.Name.Local {
 		case "id":
 			f.ID = attr.Value
+		case "count":
+			num, err := strconv.Atoi(attr.Value)
+			if err != nil {
+				return fmt.Errorf("%s %q: bad count %q", start.Name.Local, f.ID, attr.Value)
+			}
+			count = num
 		}
 	}
 	var raw string
 	if err := d.DecodeElement(&raw, &start); err != nil {
 		return err
 	}
-	for _, r := range strings.Split(raw, " ") {
-		num, err := strconv.ParseFloat(r, 32)
+
+	data, err := parseFloats(raw, count)
+	if err != nil {
+		return fmt.Errorf("%s %q: %s", start.Name.Local, f.ID, err.Error())
+	}
+	f.Data = data
+	return nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r'
+}
+
+// nextField returns the whitespace separated field
+// of raw at pos, and the position right after it
+func nextField(raw string, pos int) (string, int) {
+	for pos < len(raw) && isSpace(raw[pos]) {
+		pos++
+	}
+	start := pos
+	for pos < len(raw) && !isSpace(raw[pos]) {
+		pos++
+	}
+	return raw[start:pos], pos
+}
+
+// capacityHint bounds the number of elements announced by a count
+// attribute with what the raw text can possibly hold
+func capacityHint(raw string, count int) int {
+	if limit := len(raw)/2 + 1; count > limit {
+		return limit
+	}
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+// parseFloats parses whitespace separated floats,
+// count is the expected number of them
+func parseFloats(raw string, count int) ([]float32, error) {
+	data := make([]float32, 0, capacityHint(raw, count))
+	for pos := 0; pos < len(raw); {
+		var field string
+		field, pos = nextField(raw, pos)
+		if field == "" {
+			break
+		}
+		num, err := strconv.ParseFloat(field, 32)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("value %d %q is not a float", len(data), field)
 		}
-		f.Data = append(f.Data, float32(num))
+		data = append(data, float32(num))
 	}
-	return nil
+	return data, nil
+}
+
+// parseInts parses whitespace separated integers,
+// count is the expected number of them
+func parseInts(raw string, count int) ([]int, error) {
+	data := make([]int, 0, capacityHint(raw, count))
+	for pos := 0; pos < len(raw); {
+		var field string
+		field, pos = nextField(raw, pos)
+		if field == "" {
+			break
+		}
+		num, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("value %d %q is not an integer", len(data), field)
+		}
+		data = append(data, num)
+	}
+	return data, nil
 }
 
 // Vertices contains the list of vertices
@@ -207,16 +679,45 @@ type Vertices struct {
 	Inputs []Input `xml:"input"`
 }
 
-// Triangles contain the list of triangles
-type Triangles struct {
-	Count    int     `xml:"count,attr"`
-	Material string  `xml:"material,attr"`
-	Inputs   []Input `xml:"input"`
-	Index    []int
+// PrimitiveGroup is implemented by Collada's primitive elements
+// that can be converted into triangles
+type PrimitiveGroup interface {
+
+	// Header returns the attributes and inputs of the group
+	Header() *PrimitiveHeader
+
+	// Triangulate returns the index list rearranged into
+	// triangles, Header().Stride() indices per vertex.
+	// Fails if the lists of the group don't match
+	Triangulate() ([]int, error)
 }
 
-// UnmarshalXML parses the index list
-func (t *Triangles) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+// PrimitiveHeader holds what is common to all primitive elements
+type PrimitiveHeader struct {
+	Count    int
+	Material string
+	Inputs   []Input
+}
+
+// Header implements PrimitiveGroup
+func (h *PrimitiveHeader) Header() *PrimitiveHeader {
+	return h
+}
+
+// Stride is the number of indices that make up one vertex
+func (h *PrimitiveHeader) Stride() int {
+	var stride int
+	for _, in := range h.Inputs {
+		if int(in.Offset)+1 > stride {
+			stride = int(in.Offset) + 1
+		}
+	}
+	return stride
+}
+
+// decodePrimitive reads attributes and inputs of a primitive element,
+// any other child element is given to the child function
+func decodePrimitive(d *xml.Decoder, start xml.StartElement, h *PrimitiveHeader, child func(xml.StartElement) error) error {
 	for _, attr := range start.Attr {
 		switch attr.Name.Local {
 		case "count":
@@ -224,9 +725,9 @@ func (t *Triangles) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			if err != nil {
 				return err
 			}
-			t.Count = num
+			h.Count = num
 		case "material":
-			t.Material = attr.Value
+			h.Material = attr.Value
 		}
 	}
 
@@ -238,37 +739,183 @@ func (t *Triangles) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 		switch el := token.(type) {
 		case xml.StartElement:
-			switch el.Name.Local {
-			case "input":
+			if el.Name.Local == "input" {
 				var input Input
-				err := d.DecodeElement(&input, &el)
-				if err != nil {
+				if err := d.DecodeElement(&input, &el); err != nil {
 					return err
 				}
-				t.Inputs = append(t.Inputs, input)
-			case "p":
-				var (
-					ints []int
-					raw  string
-				)
-				if err := d.DecodeElement(&raw, &el); err != nil {
+				h.Inputs = append(h.Inputs, input)
+				continue
+			}
+			if err := child(el); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if el == start.End() {
+				return nil
+			}
+		}
+	}
+}
+
+// decodeInts reads an integer list child of a primitive element,
+// count is the expected number of integers
+func decodeInts(d *xml.Decoder, start xml.StartElement, parent xml.StartElement, h *PrimitiveHeader, count int) ([]int, error) {
+	var raw string
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return nil, err
+	}
+	ints, err := parseInts(raw, count)
+	if err != nil {
+		return nil, fmt.Errorf("%s (material %q) <%s>: %s", parent.Name.Local, h.Material, start.Name.Local, err.Error())
+	}
+	return ints, nil
+}
+
+// fanTriangulate appends the triangle fan of a polygon with n vertices,
+// each vertex being stride indices long, to dst
+func fanTriangulate(dst, polygon []int, n, stride int) []int {
+	for v := 1; v+1 < n; v++ {
+		dst = append(dst, polygon[0:stride]...)
+		dst = append(dst, polygon[v*stride:(v+1)*stride]...)
+		dst = append(dst, polygon[(v+1)*stride:(v+2)*stride]...)
+	}
+	return dst
+}
+
+// Triangles contain the list of triangles
+type Triangles struct {
+	PrimitiveHeader
+	Index []int
+}
+
+// Triangulate implements PrimitiveGroup
+func (t *Triangles) Triangulate() ([]int, error) {
+	return t.Index, nil
+}
+
+// UnmarshalXML parses the index list
+func (t *Triangles) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodePrimitive(d, start, &t.PrimitiveHeader, func(el xml.StartElement) error {
+		if el.Name.Local != "p" {
+			return d.Skip()
+		}
+		ints, err := decodeInts(d, el, start, &t.PrimitiveHeader, t.Count*3*t.Stride())
+		if err != nil {
+			return err
+		}
+		t.Index = ints
+		return nil
+	})
+}
+
+// Polylist contains polygons with a varying number of vertices,
+// the number for each polygon is listed in VCount
+type Polylist struct {
+	PrimitiveHeader
+	VCount []int
+	Index  []int
+}
+
+// Triangulate implements PrimitiveGroup
+func (p *Polylist) Triangulate() ([]int, error) {
+	stride := p.Stride()
+	var (
+		index  []int
+		offset int
+	)
+	for polygon, n := range p.VCount {
+		if n <= 0 {
+			return nil, fmt.Errorf("polylist (material %q): polygon %d has %d vertices", p.Material, polygon, n)
+		}
+		end := offset + n*stride
+		if end > len(p.Index) {
+			return nil, fmt.Errorf("polylist (material %q): polygon %d ends at index %d out of range of <p> of %d", p.Material, polygon, end, len(p.Index))
+		}
+		index = fanTriangulate(index, p.Index[offset:end], n, stride)
+		offset = end
+	}
+	return index, nil
+}
+
+// UnmarshalXML parses the vertex count and index lists
+func (p *Polylist) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodePrimitive(d, start, &p.PrimitiveHeader, func(el xml.StartElement) error {
+		var err error
+		switch el.Name.Local {
+		case "vcount":
+			p.VCount, err = decodeInts(d, el, start, &p.PrimitiveHeader, p.Count)
+		case "p":
+			var vertices int
+			for _, n := range p.VCount {
+				vertices += n
+			}
+			p.Index, err = decodeInts(d, el, start, &p.PrimitiveHeader, vertices*p.Stride())
+		default:
+			err = d.Skip()
+		}
+		return err
+	})
+}
+
+// Polygons contains polygons, each with its own index list.
+// Holes of polygons are not supported and are ignored
+type Polygons struct {
+	PrimitiveHeader
+	Index [][]int
+}
+
+// Triangulate implements PrimitiveGroup
+func (p *Polygons) Triangulate() ([]int, error) {
+	stride := p.Stride()
+	var index []int
+	for _, polygon := range p.Index {
+		index = fanTriangulate(index, polygon, len(polygon)/stride, stride)
+	}
+	return index, nil
+}
+
+// UnmarshalXML parses the index lists
+func (p *Polygons) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodePrimitive(d, start, &p.PrimitiveHeader, func(el xml.StartElement) error {
+		switch el.Name.Local {
+		case "p":
+			ints, err := decodeInts(d, el, start, &p.PrimitiveHeader, 0)
+			if err != nil {
+				return err
+			}
+			p.Index = append(p.Index, ints)
+			return nil
+		case "ph":
+			// polygon with holes, only the outline is used
+			for {
+				token, err := d.Token()
+				if err != nil {
 					return err
 				}
-				for _, r := range strings.Split(raw, " ") {
-					num, err := strconv.Atoi(r)
+				switch child := token.(type) {
+				case xml.StartElement:
+					if child.Name.Local != "p" {
+						if err := d.Skip(); err != nil {
+							return err
+						}
+						continue
+					}
+					ints, err := decodeInts(d, child, start, &p.PrimitiveHeader, 0)
 					if err != nil {
 						return err
 					}
-					ints = append(ints, num)
+					p.Index = append(p.Index, ints)
+				case xml.EndElement:
+					if child == el.End() {
+						return nil
+					}
 				}
-				t.Index = ints
-			}
-		case xml.EndElement:
-			if el == start.End() {
-				return nil
 			}
+		default:
+			return d.Skip()
 		}
-	}
+	})
 }
 
 // Input is Collada'a input type
@@ -293,10 +940,770 @@ type EffectURL struct {
 }
 
 // Effect is Collada's effect,
-// located in library_effects
+// located in library_effects. Only the profile_COMMON
+// shading models (constant, lambert, phong, blinn) are read.
 type Effect struct {
-	ID       string     `xml:"id,attr"`
-	Emission [4]float32 // The following need custom Unmarshaller
-	Diffuse  [4]float32
-	Specular float32
+	ID      string
+	Name    string
+	Shading string
+	Params  []NewParam
+
+	Emission          ColorOrTexture
+	Ambient           ColorOrTexture
+	Diffuse           ColorOrTexture
+	Specular          ColorOrTexture
+	Bump              ColorOrTexture
+	Shininess         float32
+	Transparency      float32
+	IndexOfRefraction float32
+}
+
+// FindParam looks up a newparam of the effect by its sid
+func (e *Effect) FindParam(sid string) (NewParam, bool) {
+	for _, p := range e.Params {
+		if p.SID == sid {
+			return p, true
+		}
+	}
+	return NewParam{}, false
+}
+
+// shadingModel is the common body of profile_COMMON shading techniques
+type shadingModel struct {
+	Emission          ColorOrTexture `xml:"emission"`
+	Ambient           ColorOrTexture `xml:"ambient"`
+	Diffuse           ColorOrTexture `xml:"diffuse"`
+	Specular          ColorOrTexture `xml:"specular"`
+	Shininess         float32        `xml:"shininess>float"`
+	Transparency      *float32       `xml:"transparency>float"`
+	IndexOfRefraction float32        `xml:"index_of_refraction>float"`
+}
+
+// UnmarshalXML flattens profile_COMMON of the effect
+func (e *Effect) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		ID        string     `xml:"id,attr"`
+		Name      string     `xml:"name,attr"`
+		Params    []NewParam `xml:"profile_COMMON>newparam"`
+		Technique struct {
+			Params   []NewParam     `xml:"newparam"`
+			Constant *shadingModel  `xml:"constant"`
+			Lambert  *shadingModel  `xml:"lambert"`
+			Phong    *shadingModel  `xml:"phong"`
+			Blinn    *shadingModel  `xml:"blinn"`
+			Bump     ColorOrTexture `xml:"extra>technique>bump"`
+		} `xml:"profile_COMMON>technique"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	e.ID = raw.ID
+	e.Name = raw.Name
+	e.Params = append(raw.Params, raw.Technique.Params...)
+	e.Bump = raw.Technique.Bump
+
+	var shading *shadingModel
+	switch {
+	case raw.Technique.Phong != nil:
+		e.Shading, shading = "phong", raw.Technique.Phong
+	case raw.Technique.Blinn != nil:
+		e.Shading, shading = "blinn", raw.Technique.Blinn
+	case raw.Technique.Lambert != nil:
+		e.Shading, shading = "lambert", raw.Technique.Lambert
+	case raw.Technique.Constant != nil:
+		e.Shading, shading = "constant", raw.Technique.Constant
+	default:
+		return nil
+	}
+
+	e.Emission = shading.Emission
+	e.Ambient = shading.Ambient
+	e.Diffuse = shading.Diffuse
+	e.Specular = shading.Specular
+	e.Shininess = shading.Shininess
+	e.IndexOfRefraction = shading.IndexOfRefraction
+	e.Transparency = 1
+	if shading.Transparency != nil {
+		e.Transparency = *shading.Transparency
+	}
+	return nil
+}
+
+// ColorOrTexture is a shading value that is either a color
+// or a reference to a sampler parameter
+type ColorOrTexture struct {
+	Color    glm.Vec4
+	Texture  string
+	TexCoord string
+}
+
+// UnmarshalXML reads either the color or the texture child
+func (c *ColorOrTexture) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Color   *Floats `xml:"color"`
+		Texture struct {
+			Texture  string `xml:"texture,attr"`
+			TexCoord string `xml:"texcoord,attr"`
+		} `xml:"texture"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	if raw.Color != nil {
+		copy(c.Color[:], raw.Color.Data)
+	}
+	c.Texture = raw.Texture.Texture
+	c.TexCoord = raw.Texture.TexCoord
+	return nil
+}
+
+// NewParam is an effect parameter, that is either
+// a surface pointing to an image, or a sampler of a surface
+type NewParam struct {
+	SID     string `xml:"sid,attr"`
+	Surface struct {
+		InitFrom string `xml:"init_from"`
+	} `xml:"surface"`
+	Sampler struct {
+		Source string `xml:"source"`
+		Image  struct {
+			URL string `xml:"url,attr"`
+		} `xml:"instance_image"`
+	} `xml:"sampler2D"`
+}
+
+// Image is Collada's image,
+// located in library_images
+type Image struct {
+	ID       string        `xml:"id,attr"`
+	Name     string        `xml:"name,attr"`
+	InitFrom ImageInitFrom `xml:"init_from"`
+}
+
+// ImageInitFrom holds the image location, which is the
+// text of the element in 1.4, and a ref child in 1.5
+type ImageInitFrom struct {
+	Text string `xml:",chardata"`
+	Ref  string `xml:"ref"`
+}
+
+// Path returns the image location
+func (i ImageInitFrom) Path() string {
+	if i.Ref != "" {
+		return strings.TrimSpace(i.Ref)
+	}
+	return strings.TrimSpace(i.Text)
+}
+
+// VisualScene is Collada's scene graph,
+// located in library_visual_scenes
+type VisualScene struct {
+	ID    string `xml:"id,attr"`
+	Name  string `xml:"name,attr"`
+	Nodes []Node `xml:"node"`
+}
+
+// Node is an element of the scene graph
+type Node struct {
+	ID                  string               `xml:"id,attr"`
+	Name                string               `xml:"name,attr"`
+	SID                 string               `xml:"sid,attr"`
+	Type                string               `xml:"type,attr"`
+	InstanceGeometries  []InstanceGeometry   `xml:"instance_geometry"`
+	InstanceControllers []InstanceController `xml:"instance_controller"`
+	Nodes               []Node               `xml:"node"`
+
+	// Transforms are the transformation elements of the node in
+	// document order, other unknown elements are recorded without values
+	Transforms []NodeTransform `xml:",any"`
+}
+
+// Matrix returns the transform of the node relative to its parent
+func (n *Node) Matrix() glm.Mat4 {
+	mat := glm.Ident4()
+	for _, t := range n.Transforms {
+		mat = mat.Mul4(t.Matrix())
+	}
+	return mat
+}
+
+// NodeTransform is one of the matrix, translate, rotate
+// and scale elements of a node
+type NodeTransform struct {
+	Name   string
+	SID    string
+	Values []float32
+}
+
+// UnmarshalXML unmarshals transformation elements, skipping others
+func (t *NodeTransform) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	t.Name = start.Name.Local
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "sid" {
+			t.SID = attr.Value
+		}
+	}
+	switch t.Name {
+	case "matrix", "translate", "rotate", "scale":
+	default:
+		return d.Skip()
+	}
+
+	var raw string
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	values, err := parseFloats(raw, 16)
+	if err != nil {
+		return fmt.Errorf("node %s: %s", t.Name, err.Error())
+	}
+	t.Values = values
+	return nil
+}
+
+// Matrix returns the transformation, identity for unknown
+// elements or ones with missing values
+func (t NodeTransform) Matrix() glm.Mat4 {
+	v := t.Values
+	switch {
+	case t.Name == "matrix" && len(v) >= 16:
+		return colladaMatrix(v)
+	case t.Name == "translate" && len(v) >= 3:
+		return glm.Translate3D(v[0], v[1], v[2])
+	case t.Name == "rotate" && len(v) >= 4:
+		axis := glm.Vec3{v[0], v[1], v[2]}
+		if axis.Len() == 0 {
+			break
+		}
+		return glm.HomogRotate3D(glm.DegToRad(v[3]), axis.Normalize())
+	case t.Name == "scale" && len(v) >= 3:
+		return glm.Scale3D(v[0], v[1], v[2])
+	}
+	return glm.Ident4()
+}
+
+// colladaMatrix converts Collada's row major matrix
+func colladaMatrix(v []float32) glm.Mat4 {
+	var mat glm.Mat4
+	copy(mat[:], v[:16])
+	return mat.Transpose()
+}
+
+// InstanceGeometry places a geometry in the scene and binds its materials
+type InstanceGeometry struct {
+	URL       string             `xml:"url,attr"`
+	Name      string             `xml:"name,attr"`
+	Materials []InstanceMaterial `xml:"bind_material>technique_common>instance_material"`
+}
+
+// InstanceController places a skinned geometry in the scene,
+// skeletons reference the root nodes of its joints
+type InstanceController struct {
+	URL       string             `xml:"url,attr"`
+	Name      string             `xml:"name,attr"`
+	Skeletons []string           `xml:"skeleton"`
+	Materials []InstanceMaterial `xml:"bind_material>technique_common>instance_material"`
+}
+
+// InstanceMaterial binds a material symbol used by primitives to a material
+type InstanceMaterial struct {
+	Symbol       string            `xml:"symbol,attr"`
+	Target       string            `xml:"target,attr"`
+	VertexInputs []BindVertexInput `xml:"bind_vertex_input"`
+}
+
+// BindVertexInput binds an effect texcoord name to an input set
+type BindVertexInput struct {
+	Semantic      string `xml:"semantic,attr"`
+	InputSemantic string `xml:"input_semantic,attr"`
+	InputSet      uint   `xml:"input_set,attr"`
+}
+
+// Controller is Collada's controller, located in library_controllers.
+// Only skin controllers are supported
+type Controller struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+	Skin *Skin  `xml:"skin"`
+}
+
+// Skin binds the vertices of a geometry to joints
+type Skin struct {
+	Source          string        `xml:"source,attr"`
+	BindShapeMatrix Floats        `xml:"bind_shape_matrix"`
+	Sources         []Source      `xml:"source"`
+	Joints          []Input       `xml:"joints>input"`
+	VertexWeights   VertexWeights `xml:"vertex_weights"`
+}
+
+// VertexWeights lists the joints influencing each vertex of the geometry
+// and their weights, vcount pairs of indices per vertex in v
+type VertexWeights struct {
+	Count  int     `xml:"count,attr"`
+	Inputs []Input `xml:"input"`
+	VCount string  `xml:"vcount"`
+	V      string  `xml:"v"`
+}
+
+// vertexInfluence holds the strongest joints of a vertex
+type vertexInfluence struct {
+	joints  [4]uint32
+	weights glm.Vec4
+}
+
+// names returns the names of a Name_array or IDREF_array source
+func (s Source) names() []string {
+	if s.IDRefs != "" {
+		return strings.Fields(s.IDRefs)
+	}
+	return strings.Fields(s.Names)
+}
+
+// jointNames returns the names of joints, as referenced by weights
+func (s *Skin) jointNames() ([]string, error) {
+	for _, in := range s.Joints {
+		if in.Semantic == "JOINT" {
+			source, err := findSource(s.Sources, in.Source)
+			if err != nil {
+				return nil, err
+			}
+			return source.names(), nil
+		}
+	}
+	return nil, fmt.Errorf("skin of %s has no joints", s.Source)
+}
+
+// inverseBindMatrices returns the inverse bind matrix of every joint
+func (s *Skin) inverseBindMatrices(count int) ([]glm.Mat4, error) {
+	matrices := make([]glm.Mat4, count)
+	for idx := range matrices {
+		matrices[idx] = glm.Ident4()
+	}
+	for _, in := range s.Joints {
+		if in.Semantic != "INV_BIND_MATRIX" {
+			continue
+		}
+		source, err := findSource(s.Sources, in.Source)
+		if err != nil {
+			return nil, err
+		}
+		if source.Len(16) < count {
+			return nil, fmt.Errorf("skin of %s: %d inverse bind matrices for %d joints", s.Source, source.Len(16), count)
+		}
+		var values [16]float32
+		for idx := range matrices {
+			source.get(idx, values[:])
+			matrices[idx] = colladaMatrix(values[:])
+		}
+	}
+	return matrices, nil
+}
+
+// influences returns the four strongest joints of every vertex,
+// indexed like the positions of the geometry, with normalized weights
+func (s *Skin) influences(jointCount int) ([]vertexInfluence, error) {
+	vw := s.VertexWeights
+	var (
+		jointOffset, weightOffset = -1, -1
+		weights                   Source
+		stride                    int
+	)
+	for _, in := range vw.Inputs {
+		switch in.Semantic {
+		case "JOINT":
+			jointOffset = int(in.Offset)
+		case "WEIGHT":
+			source, err := findSource(s.Sources, in.Source)
+			if err != nil {
+				return nil, err
+			}
+			weights = source
+			weightOffset = int(in.Offset)
+		}
+		if int(in.Offset)+1 > stride {
+			stride = int(in.Offset) + 1
+		}
+	}
+	if jointOffset < 0 || weightOffset < 0 {
+		return nil, fmt.Errorf("vertex weights of %s need JOINT and WEIGHT inputs", s.Source)
+	}
+
+	vcount, err := parseInts(vw.VCount, vw.Count)
+	if err != nil {
+		return nil, fmt.Errorf("vcount of %s: %s", s.Source, err.Error())
+	}
+	v, err := parseInts(vw.V, 0)
+	if err != nil {
+		return nil, fmt.Errorf("v of %s: %s", s.Source, err.Error())
+	}
+
+	weightCount := weights.Len(1)
+	influences := make([]vertexInfluence, len(vcount))
+	pos := 0
+	for vert, n := range vcount {
+		if n < 0 || pos+n*stride > len(v) {
+			return nil, fmt.Errorf("vertex weights of %s: v is too short", s.Source)
+		}
+		inf := &influences[vert]
+		for i := 0; i < n; i++ {
+			pair := v[pos+i*stride:]
+			joint, w := pair[jointOffset], pair[weightOffset]
+			// joint -1 binds to the bind shape, which does not move
+			if joint < 0 {
+				continue
+			}
+			if joint >= jointCount || w < 0 || w >= weightCount {
+				return nil, fmt.Errorf("vertex weights of %s: index out of range", s.Source)
+			}
+			var weight [1]float32
+			weights.get(w, weight[:])
+
+			// replace the weakest one if this is stronger
+			weakest := 0
+			for k := 1; k < 4; k++ {
+				if inf.weights[k] < inf.weights[weakest] {
+					weakest = k
+				}
+			}
+			if weight[0] > inf.weights[weakest] {
+				inf.joints[weakest] = uint32(joint)
+				inf.weights[weakest] = weight[0]
+			}
+		}
+		pos += n * stride
+
+		if total := inf.weights[0] + inf.weights[1] + inf.weights[2] + inf.weights[3]; total > 0 {
+			inf.weights = inf.weights.Mul(1 / total)
+		}
+	}
+	return influences, nil
+}
+
+// findController returns the skin controller of the geometry, nil if there is none
+func (c *Collada) findController(geometryID string) *Controller {
+	for idx := range c.Controllers {
+		if skin := c.Controllers[idx].Skin; skin != nil && strings.TrimPrefix(skin.Source, "#") == geometryID {
+			return &c.Controllers[idx]
+		}
+	}
+	return nil
+}
+
+// sceneNode is a node of the visual scenes with the index of its parent
+type sceneNode struct {
+	*Node
+	parent int
+}
+
+// flattenScenes lists every node of the visual scenes, parents before children
+func (c *Collada) flattenScenes() []sceneNode {
+	var nodes []sceneNode
+	var walk func(children []Node, parent int)
+	walk = func(children []Node, parent int) {
+		for idx := range children {
+			nodes = append(nodes, sceneNode{Node: &children[idx], parent: parent})
+			walk(children[idx].Nodes, len(nodes)-1)
+		}
+	}
+	for idx := range c.VisualScenes {
+		walk(c.VisualScenes[idx].Nodes, -1)
+	}
+	return nodes
+}
+
+// findJointNode looks for the node of a joint by sid, then by id and name
+func findJointNode(nodes []sceneNode, name string) int {
+	for _, match := range []func(*Node) bool{
+		func(n *Node) bool { return n.SID == name },
+		func(n *Node) bool { return n.ID == name },
+		func(n *Node) bool { return n.Name == name },
+	} {
+		for idx := range nodes {
+			if match(nodes[idx].Node) {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
+// Skeleton builds the skeleton of a skin controller from the visual scene.
+// Joints keep the order of the skin, nodes above the root joint
+// become the skeleton's Transform
+func (c *Collada) Skeleton(controller *Controller) (*Skeleton, error) {
+	skin := controller.Skin
+	names, err := skin.jointNames()
+	if err != nil {
+		return nil, err
+	}
+	inverseBind, err := skin.inverseBindMatrices(len(names))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := c.flattenScenes()
+	jointNodes := make([]int, len(names))
+	jointIndex := make(map[int]int, len(names))
+	for idx, name := range names {
+		node := findJointNode(nodes, name)
+		if node < 0 {
+			return nil, fmt.Errorf("skin %s: joint %s not found in the scene", controller.ID, name)
+		}
+		jointNodes[idx] = node
+		jointIndex[node] = idx
+	}
+
+	skeleton := &Skeleton{
+		Joints:    make([]Joint, len(names)),
+		Transform: glm.Ident4(),
+	}
+	for idx, node := range jointNodes {
+		joint := Joint{
+			Name:        names[idx],
+			Parent:      -1,
+			Rest:        DecomposeJointPose(nodes[node].Matrix()),
+			InverseBind: inverseBind[idx],
+		}
+		ancestors := glm.Ident4()
+		for p := nodes[node].parent; p >= 0; p = nodes[p].parent {
+			if j, ok := jointIndex[p]; ok {
+				joint.Parent = j
+				break
+			}
+			ancestors = nodes[p].Matrix().Mul4(ancestors)
+		}
+		if joint.Parent < 0 && idx == 0 {
+			skeleton.Transform = ancestors
+		}
+		skeleton.Joints[idx] = joint
+	}
+	return skeleton, nil
+}
+
+// Animation is Collada's animation, located in library_animations.
+// Animations may be nested to group channels
+type Animation struct {
+	ID         string             `xml:"id,attr"`
+	Name       string             `xml:"name,attr"`
+	Sources    []Source           `xml:"source"`
+	Samplers   []AnimationSampler `xml:"sampler"`
+	Channels   []Channel          `xml:"channel"`
+	Animations []Animation        `xml:"animation"`
+}
+
+// AnimationSampler pairs keyframe times (INPUT) with values (OUTPUT)
+type AnimationSampler struct {
+	ID     string  `xml:"id,attr"`
+	Inputs []Input `xml:"input"`
+}
+
+// Channel applies a sampler to a target, which is the id
+// of a node and the sid of one of its transformations
+type Channel struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+// ColladaClip is an animation clip, located in library_animation_clips
+type ColladaClip struct {
+	ID         string `xml:"id,attr"`
+	Name       string `xml:"name,attr"`
+	Animations []struct {
+		URL string `xml:"url,attr"`
+	} `xml:"instance_animation"`
+}
+
+// animationChannels converts the channels of an animation and its children.
+// Channels targeting whole matrix, translate and scale elements of joints
+// are supported, others are skipped
+func (a *Animation) animationChannels(nodes []sceneNode, skeleton *Skeleton, jointNodes map[string]int) ([]AnimationChannel, error) {
+	var channels []AnimationChannel
+	for _, ch := range a.Channels {
+		slash := strings.IndexByte(ch.Target, '/')
+		if slash < 0 || strings.ContainsAny(ch.Target[slash+1:], ".(") {
+			continue
+		}
+		joint, ok := jointNodes[ch.Target[:slash]]
+		if !ok {
+			continue
+		}
+		var transform *NodeTransform
+		for t := range nodes[joint].Transforms {
+			if nodes[joint].Transforms[t].SID == ch.Target[slash+1:] {
+				transform = &nodes[joint].Transforms[t]
+			}
+		}
+		if transform == nil {
+			continue
+		}
+
+		var sampler *AnimationSampler
+		for s := range a.Samplers {
+			if a.Samplers[s].ID == strings.TrimPrefix(ch.Source, "#") {
+				sampler = &a.Samplers[s]
+			}
+		}
+		if sampler == nil {
+			return nil, fmt.Errorf("animation %s: sampler %s not found", a.ID, ch.Source)
+		}
+		var times, values Source
+		interpolation := InterpolationLinear
+		for _, in := range sampler.Inputs {
+			source, err := findSource(a.Sources, in.Source)
+			if err != nil {
+				return nil, fmt.Errorf("animation %s: %s", a.ID, err.Error())
+			}
+			switch in.Semantic {
+			case "INPUT":
+				times = source
+			case "OUTPUT":
+				values = source
+			case "INTERPOLATION":
+				if names := source.names(); len(names) > 0 && names[0] == "STEP" {
+					interpolation = InterpolationStep
+				}
+			}
+		}
+
+		keys := make([]float32, times.Len(1))
+		for k := range keys {
+			times.get(k, keys[k:k+1])
+		}
+		jointIdx := skeleton.FindJoint(jointName(nodes[joint].Node, skeleton))
+		channel := func(path AnimationPath) AnimationChannel {
+			return AnimationChannel{
+				Joint:         jointIdx,
+				Path:          path,
+				Interpolation: interpolation,
+				Times:         keys,
+				Values:        make([]glm.Vec4, len(keys)),
+			}
+		}
+
+		switch transform.Name {
+		case "matrix":
+			if values.Len(16) < len(keys) {
+				return nil, fmt.Errorf("animation %s: fewer values than keyframes", a.ID)
+			}
+			translation, rotation, scale := channel(AnimateTranslation), channel(AnimateRotation), channel(AnimateScale)
+			var mat [16]float32
+			for k := range keys {
+				values.get(k, mat[:])
+				pose := DecomposeJointPose(colladaMatrix(mat[:]))
+				translation.Values[k] = pose.Translation.Vec4(0)
+				rotation.Values[k] = pose.Rotation.V.Vec4(pose.Rotation.W)
+				scale.Values[k] = pose.Scale.Vec4(0)
+			}
+			channels = append(channels, translation, rotation, scale)
+		case "translate", "scale":
+			if values.Len(3) < len(keys) {
+				return nil, fmt.Errorf("animation %s: fewer values than keyframes", a.ID)
+			}
+			path := AnimateTranslation
+			if transform.Name == "scale" {
+				path = AnimateScale
+			}
+			vec := channel(path)
+			for k := range keys {
+				vec.Values[k] = values.GetVec3(k).Vec4(0)
+			}
+			channels = append(channels, vec)
+		}
+	}
+
+	for idx := range a.Animations {
+		nested, err := a.Animations[idx].animationChannels(nodes, skeleton, jointNodes)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, nested...)
+	}
+	return channels, nil
+}
+
+// jointName returns the name the skeleton knows the node by
+func jointName(n *Node, skeleton *Skeleton) string {
+	for _, name := range []string{n.SID, n.ID, n.Name} {
+		if name != "" && skeleton.FindJoint(name) >= 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// Clips converts the animations of the skeleton's joints into clips.
+// Without library_animation_clips every animation makes up a single clip
+func (c *Collada) Clips(skeleton *Skeleton) ([]AnimationClip, error) {
+	nodes := c.flattenScenes()
+	jointNodes := make(map[string]int)
+	for idx := range nodes {
+		if nodes[idx].ID != "" && jointName(nodes[idx].Node, skeleton) != "" {
+			jointNodes[nodes[idx].ID] = idx
+		}
+	}
+
+	collect := func(animations []*Animation) ([]AnimationChannel, error) {
+		var channels []AnimationChannel
+		for _, anim := range animations {
+			animChannels, err := anim.animationChannels(nodes, skeleton, jointNodes)
+			if err != nil {
+				return nil, err
+			}
+			channels = append(channels, animChannels...)
+		}
+		return channels, nil
+	}
+
+	var clips []AnimationClip
+	if len(c.AnimationClips) == 0 {
+		all := make([]*Animation, len(c.Animations))
+		for idx := range c.Animations {
+			all[idx] = &c.Animations[idx]
+		}
+		channels, err := collect(all)
+		if err != nil {
+			return nil, err
+		}
+		if len(channels) > 0 {
+			clips = append(clips, AnimationClip{Name: "default", Channels: channels})
+		}
+	}
+
+	for _, clipElement := range c.AnimationClips {
+		var animations []*Animation
+		for _, instance := range clipElement.Animations {
+			if anim := findAnimation(c.Animations, strings.TrimPrefix(instance.URL, "#")); anim != nil {
+				animations = append(animations, anim)
+			}
+		}
+		channels, err := collect(animations)
+		if err != nil {
+			return nil, err
+		}
+		name := clipElement.Name
+		if name == "" {
+			name = clipElement.ID
+		}
+		clips = append(clips, AnimationClip{Name: name, Channels: channels})
+	}
+
+	for idx := range clips {
+		clips[idx].updateDuration()
+	}
+	return clips, nil
+}
+
+// findAnimation looks for an animation by id, including nested ones
+func findAnimation(animations []Animation, id string) *Animation {
+	for idx := range animations {
+		if animations[idx].ID == id {
+			return &animations[idx]
+		}
+		if nested := findAnimation(animations[idx].Animations, id); nested != nil {
+			return nested
+		}
+	}
+	return nil
 }
@@ -6,10 +6,14 @@
 package model_test
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
 )
 
 var Cube_file string = `
@@ -397,3 +401,872 @@ func TestFloatsDecode(t *testing.T) {
 		t.Fatalf("bad id, got: %s", floats.ID)
 	}
 }
+
+var Textured_file = `
+<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <library_images>
+    <image id="Bricks_COLOR_png" name="Bricks_COLOR_png">
+      <init_from>Bricks_COLOR.png</init_from>
+    </image>
+    <image id="Bricks_SPEC_png" name="Bricks_SPEC_png">
+      <init_from>textures/Bricks_SPEC.png</init_from>
+    </image>
+  </library_images>
+  <library_effects>
+    <effect id="Brick-effect">
+      <profile_COMMON>
+        <newparam sid="Bricks_COLOR_png-surface">
+          <surface type="2D">
+            <init_from>Bricks_COLOR_png</init_from>
+          </surface>
+        </newparam>
+        <newparam sid="Bricks_COLOR_png-sampler">
+          <sampler2D>
+            <source>Bricks_COLOR_png-surface</source>
+          </sampler2D>
+        </newparam>
+        <technique sid="common">
+          <blinn>
+            <emission>
+              <color sid="emission">0.1 0.2 0.3 1</color>
+            </emission>
+            <diffuse>
+              <texture texture="Bricks_COLOR_png-sampler" texcoord="UVMap"/>
+            </diffuse>
+            <specular>
+              <texture texture="Bricks_SPEC_png" texcoord="UVMap"/>
+            </specular>
+            <shininess>
+              <float sid="shininess">12.5</float>
+            </shininess>
+          </blinn>
+        </technique>
+      </profile_COMMON>
+    </effect>
+  </library_effects>
+  <library_materials>
+    <material id="Brick-material" name="Brick">
+      <instance_effect url="#Brick-effect"/>
+    </material>
+  </library_materials>
+  <library_geometries>
+    <geometry id="Tri-mesh" name="Tri">
+      <mesh>
+        <source id="Tri-mesh-positions">
+          <float_array id="Tri-mesh-positions-array" count="9">0 0 0 1 0 0 0 1 0</float_array>
+        </source>
+        <source id="Tri-mesh-map-0">
+          <float_array id="Tri-mesh-map-0-array" count="6">0 0 1 0 0 1</float_array>
+        </source>
+        <vertices id="Tri-mesh-vertices">
+          <input semantic="POSITION" source="#Tri-mesh-positions"/>
+        </vertices>
+        <triangles material="brick-symbol" count="1">
+          <input semantic="VERTEX" source="#Tri-mesh-vertices" offset="0"/>
+          <input semantic="TEXCOORD" source="#Tri-mesh-map-0" offset="1" set="0"/>
+          <p>0 0 1 1 2 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+  <library_visual_scenes>
+    <visual_scene id="Scene" name="Scene">
+      <node id="Root" name="Root" type="NODE">
+        <node id="Tri" name="Tri" type="NODE">
+          <instance_geometry url="#Tri-mesh" name="Tri">
+            <bind_material>
+              <technique_common>
+                <instance_material symbol="brick-symbol" target="#Brick-material">
+                  <bind_vertex_input semantic="UVMap" input_semantic="TEXCOORD" input_set="1"/>
+                </instance_material>
+              </technique_common>
+            </bind_material>
+          </instance_geometry>
+        </node>
+      </node>
+    </visual_scene>
+  </library_visual_scenes>
+</COLLADA>
+`
+
+func TestImportColladaObjectMaterial(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(Cube_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prims := obj.Primitives()
+	if len(prims) != 1 || prims[0].Offset != 0 || prims[0].Count != 36 {
+		t.Fatalf("bad primitives, got: %+v", prims)
+	}
+
+	mats := obj.Materials()
+	if len(mats) != 1 || prims[0].Material != 0 {
+		t.Fatalf("bad materials, got: %d, primitive material: %d", len(mats), prims[0].Material)
+	}
+	if mats[0].Name != "Material" {
+		t.Fatalf("bad material name, got: %s", mats[0].Name)
+	}
+	if mats[0].Diffuse != (glm.Vec4{0.64, 0.64, 0.64, 1}) {
+		t.Fatalf("bad diffuse, got: %v", mats[0].Diffuse)
+	}
+	if mats[0].Specular != (glm.Vec4{0.5, 0.5, 0.5, 1}) {
+		t.Fatalf("bad specular, got: %v", mats[0].Specular)
+	}
+	if mats[0].Shininess != 50 {
+		t.Fatalf("bad shininess, got: %f", mats[0].Shininess)
+	}
+	if mats[0].DiffuseMap.Path != "" {
+		t.Fatalf("unexpected diffuse map: %s", mats[0].DiffuseMap.Path)
+	}
+}
+
+func TestImportColladaObjectTexturedMaterial(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(Textured_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mats := obj.Materials()
+	if len(mats) != 1 {
+		t.Fatalf("wrong amount of materials, got: %d", len(mats))
+	}
+	mat := mats[0]
+	if mat.Name != "Brick" {
+		t.Fatalf("bad material name, got: %s", mat.Name)
+	}
+	if mat.Emission != (glm.Vec4{0.1, 0.2, 0.3, 1}) {
+		t.Fatalf("bad emission, got: %v", mat.Emission)
+	}
+	if mat.Shininess != 12.5 {
+		t.Fatalf("bad shininess, got: %f", mat.Shininess)
+	}
+	if mat.DiffuseMap.Path != "Bricks_COLOR.png" || mat.DiffuseMap.Set != 1 {
+		t.Fatalf("bad diffuse map, got: %+v", mat.DiffuseMap)
+	}
+	if mat.SpecularMap.Path != "textures/Bricks_SPEC.png" {
+		t.Fatalf("bad specular map, got: %+v", mat.SpecularMap)
+	}
+}
+
+func TestEffectDecode(t *testing.T) {
+	data := `
+	<effect id="Material-effect">
+		<profile_COMMON>
+			<technique sid="common">
+				<lambert>
+					<emission>
+						<color sid="emission">0 0 0 1</color>
+					</emission>
+					<diffuse>
+						<color sid="diffuse">0.8 0.8 0.8 1</color>
+					</diffuse>
+					<index_of_refraction>
+						<float sid="ior">1.45</float>
+					</index_of_refraction>
+				</lambert>
+			</technique>
+		</profile_COMMON>
+	</effect>
+	`
+
+	var effect model.Effect
+	if err := xml.Unmarshal([]byte(data), &effect); err != nil {
+		t.Fatal(err)
+	}
+
+	if effect.ID != "Material-effect" {
+		t.Fatalf("bad id, got: %s", effect.ID)
+	}
+	if effect.Shading != "lambert" {
+		t.Fatalf("bad shading, got: %s", effect.Shading)
+	}
+	if effect.Diffuse.Color != (glm.Vec4{0.8, 0.8, 0.8, 1}) {
+		t.Fatalf("bad diffuse, got: %v", effect.Diffuse.Color)
+	}
+	if effect.IndexOfRefraction != 1.45 {
+		t.Fatalf("bad index of refraction, got: %f", effect.IndexOfRefraction)
+	}
+}
+
+var Quad_file = `
+<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <library_effects>
+    <effect id="Red-effect">
+      <profile_COMMON>
+        <technique sid="common">
+          <lambert>
+            <diffuse>
+              <color sid="diffuse">1 0 0 1</color>
+            </diffuse>
+          </lambert>
+        </technique>
+      </profile_COMMON>
+    </effect>
+    <effect id="Blue-effect">
+      <profile_COMMON>
+        <technique sid="common">
+          <lambert>
+            <diffuse>
+              <color sid="diffuse">0 0 1 1</color>
+            </diffuse>
+          </lambert>
+        </technique>
+      </profile_COMMON>
+    </effect>
+  </library_effects>
+  <library_materials>
+    <material id="Red-material" name="Red">
+      <instance_effect url="#Red-effect"/>
+    </material>
+    <material id="Blue-material" name="Blue">
+      <instance_effect url="#Blue-effect"/>
+    </material>
+  </library_materials>
+  <library_geometries>
+    <geometry id="Quads-mesh" name="Quads">
+      <mesh>
+        <source id="Quads-mesh-positions">
+          <float_array id="Quads-mesh-positions-array" count="18">0 0 0 1 0 0 1 1 0 0 1 0 2 0 0 2 1 0</float_array>
+        </source>
+        <source id="Quads-mesh-normals">
+          <float_array id="Quads-mesh-normals-array" count="3">0 0 1</float_array>
+        </source>
+        <vertices id="Quads-mesh-vertices">
+          <input semantic="POSITION" source="#Quads-mesh-positions"/>
+        </vertices>
+        <polylist material="Red-material" count="2">
+          <input semantic="VERTEX" source="#Quads-mesh-vertices" offset="0"/>
+          <input semantic="NORMAL" source="#Quads-mesh-normals" offset="1"/>
+          <vcount>4 3</vcount>
+          <p>0 0 1 0 2 0 3 0 1 0 4 0 5 0</p>
+        </polylist>
+        <polygons material="Blue-material" count="2">
+          <input semantic="VERTEX" source="#Quads-mesh-vertices" offset="0"/>
+          <p>1 4 5 2</p>
+          <ph>
+            <p>0 1 2 3</p>
+            <h>0 1 2</h>
+          </ph>
+        </polygons>
+        <triangles material="Red-material" count="1">
+          <input semantic="VERTEX" source="#Quads-mesh-vertices" offset="0"/>
+          <p>0 1 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+</COLLADA>
+`
+
+func TestImportColladaObjectPolygons(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(Quad_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// triangles: 1, polylist: 2 + 1, polygons: 2 + 2
+	vert := obj.Vertices()
+	if len(vert) != 3*8 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+
+	prims := obj.Primitives()
+	if len(prims) != 3 {
+		t.Fatalf("wrong amount of primitives, got: %d", len(prims))
+	}
+	expected := []model.Primitive{
+		{Material: 0, Offset: 0, Count: 3},
+		{Material: 0, Offset: 3, Count: 9},
+		{Material: 1, Offset: 12, Count: 12},
+	}
+	for idx, p := range prims {
+		if p != expected[idx] {
+			t.Fatalf("bad primitive %d, expected: %+v, got: %+v", idx, expected[idx], p)
+		}
+	}
+
+	mats := obj.Materials()
+	if len(mats) != 2 || mats[0].Name != "Red" || mats[1].Name != "Blue" {
+		t.Fatalf("bad materials, got: %+v", mats)
+	}
+
+	// first triangle of the polylist quad fans out from its first vertex
+	fan := []glm.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	for idx, pos := range fan {
+		if vert[3+idx].Pos != pos {
+			t.Fatalf("bad fan vertex %d, expected: %v, got: %v", idx, pos, vert[3+idx].Pos)
+		}
+		if vert[3+idx].Normal != (glm.Vec3{0, 0, 1}) {
+			t.Fatalf("bad fan normal %d, got: %v", idx, vert[3+idx].Normal)
+		}
+	}
+}
+
+func TestPolylistDecode(t *testing.T) {
+	data := `
+		<polylist material="Material-material" count="2">
+		<input semantic="VERTEX" source="#Cube-mesh-vertices" offset="0"/>
+		<input semantic="NORMAL" source="#Cube-mesh-normals" offset="1"/>
+		<vcount>4 3</vcount>
+		<p>0 0 1 0 2 0 3 0 4 1 5 1 6 1</p>
+		</polylist>
+	`
+	var polylist model.Polylist
+	if err := xml.Unmarshal([]byte(data), &polylist); err != nil {
+		t.Fatal(err)
+	}
+
+	if polylist.Material != "Material-material" || polylist.Count != 2 {
+		t.Fatalf("bad attributes, material: %s, count: %d", polylist.Material, polylist.Count)
+	}
+	if len(polylist.VCount) != 2 || len(polylist.Index) != 14 {
+		t.Fatalf("bad lists, vcount: %d, index: %d", len(polylist.VCount), len(polylist.Index))
+	}
+
+	index, err := polylist.Triangulate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 3*3*2 {
+		t.Fatalf("bad triangulation, got %d indices", len(index))
+	}
+}
+
+func TestPolylistBadVCount(t *testing.T) {
+	for name, vcount := range map[string][]int{
+		"negative": {4, -3},
+		"zero":     {0, 4},
+		"too many": {4, 4},
+	} {
+		polylist := model.Polylist{
+			PrimitiveHeader: model.PrimitiveHeader{
+				Count:  len(vcount),
+				Inputs: []model.Input{{Semantic: "VERTEX", Offset: 0}, {Semantic: "NORMAL", Offset: 1}},
+			},
+			VCount: vcount,
+			Index:  []int{0, 0, 1, 0, 2, 0, 3, 0, 4, 1, 5, 1, 6, 1},
+		}
+		if _, err := polylist.Triangulate(); err == nil {
+			t.Errorf("%s: expected an error for vertex counts %v", name, vcount)
+		}
+	}
+}
+
+const axisFileTemplate = `
+<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <asset>
+    <unit name="centimeter" meter="%s"/>
+    <up_axis>%s</up_axis>
+  </asset>
+  <library_geometries>
+    <geometry id="Tri-mesh" name="Tri">
+      <mesh>
+        <source id="Tri-mesh-positions">
+          <float_array id="Tri-mesh-positions-array" count="9">0 100 0 100 100 0 0 100 100</float_array>
+          <technique_common>
+            <accessor source="#Tri-mesh-positions-array" count="3" stride="3">
+              <param name="X" type="float"/>
+              <param name="Y" type="float"/>
+              <param name="Z" type="float"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <source id="Tri-mesh-normals">
+          <float_array id="Tri-mesh-normals-array" count="3">0 1 0</float_array>
+        </source>
+        <source id="Tri-mesh-map">
+          <float_array id="Tri-mesh-map-array" count="13">9 0.1 0.2 7 7 0.3 0.4 7 7 0.5 0.6 7 7</float_array>
+          <technique_common>
+            <accessor source="#Tri-mesh-map-array" count="3" offset="1" stride="4">
+              <param name="S" type="float"/>
+              <param name="T" type="float"/>
+              <param type="float"/>
+              <param type="float"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <vertices id="Tri-mesh-vertices">
+          <input semantic="POSITION" source="#Tri-mesh-positions"/>
+        </vertices>
+        <triangles count="1">
+          <input semantic="VERTEX" source="#Tri-mesh-vertices" offset="0"/>
+          <input semantic="NORMAL" source="#Tri-mesh-normals" offset="1"/>
+          <input semantic="TEXCOORD" source="#Tri-mesh-map" offset="2" set="0"/>
+          <p>0 0 0 1 0 1 2 0 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+</COLLADA>
+`
+
+func TestImportColladaObjectAccessor(t *testing.T) {
+	obj, err := model.ImportColladaObjectWithConfiguration([]byte(fmt.Sprintf(axisFileTemplate, "1", "Z_UP")), nil, model.ImportConfiguration{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []glm.Vec2{{0.1, 0.2}, {0.3, 0.4}, {0.5, 0.6}}
+	for idx, vert := range obj.Vertices() {
+		if vert.Tex != expected[idx] {
+			t.Fatalf("bad texcoord %d, expected: %v, got: %v", idx, expected[idx], vert.Tex)
+		}
+	}
+}
+
+func TestImportColladaObjectAxisAndUnit(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(fmt.Sprintf(axisFileTemplate, "0.01", "Y_UP")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	expected := []glm.Vec3{{0, 0, 1}, {1, 0, 1}, {0, -1, 1}}
+	for idx, pos := range expected {
+		if !vert[idx].Pos.ApproxEqual(pos) {
+			t.Fatalf("bad position %d, expected: %v, got: %v", idx, pos, vert[idx].Pos)
+		}
+	}
+	if !vert[0].Normal.ApproxEqual(glm.Vec3{0, 0, 1}) {
+		t.Fatalf("bad normal, got: %v", vert[0].Normal)
+	}
+}
+
+func TestImportColladaObjectKeepRaw(t *testing.T) {
+	obj, err := model.ImportColladaObjectWithConfiguration(
+		[]byte(fmt.Sprintf(axisFileTemplate, "0.01", "Y_UP")), nil,
+		model.ImportConfiguration{KeepRaw: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	if vert[1].Pos != (glm.Vec3{100, 100, 0}) {
+		t.Fatalf("raw position changed, got: %v", vert[1].Pos)
+	}
+	if vert[1].Normal != (glm.Vec3{0, 1, 0}) {
+		t.Fatalf("raw normal changed, got: %v", vert[1].Normal)
+	}
+}
+
+func TestImportColladaObjectIndexOutOfRange(t *testing.T) {
+	data := strings.Replace(fmt.Sprintf(axisFileTemplate, "1", "Z_UP"), "<p>0 0 0 1 0 1 2 0 2</p>", "<p>0 0 0 1 0 1 3 0 2</p>", 1)
+	if _, err := model.ImportColladaObject([]byte(data), nil); err == nil {
+		t.Fatal("expected an error for an index out of range")
+	}
+}
+
+func TestFloatsDecodeWhitespace(t *testing.T) {
+	data := "<float_array id=\"messy\" count=\"6\">\n\t\t1  2\t3\r\n   4.5e-1\n-5\t\t6   \n</float_array>"
+
+	var floats model.Floats
+	if err := xml.Unmarshal([]byte(data), &floats); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float32{1, 2, 3, 0.45, -5, 6}
+	if len(floats.Data) != len(expected) {
+		t.Fatalf("bad number of floats, got: %d", len(floats.Data))
+	}
+	for idx := range expected {
+		if floats.Data[idx] != expected[idx] {
+			t.Fatalf("bad float %d, expected: %f, got: %f", idx, expected[idx], floats.Data[idx])
+		}
+	}
+}
+
+func TestFloatsDecodeError(t *testing.T) {
+	data := `<float_array id="broken-array" count="3">1 2,5 3</float_array>`
+
+	var floats model.Floats
+	err := xml.Unmarshal([]byte(data), &floats)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "broken-array") || !strings.Contains(err.Error(), `"2,5"`) {
+		t.Fatalf("error does not name the element and the token: %s", err.Error())
+	}
+}
+
+func TestTrianglesDecodeError(t *testing.T) {
+	data := `
+		<triangles material="Broken-material" count="1">
+		<input semantic="VERTEX" source="#Cube-mesh-vertices" offset="0"/>
+		<p>0 1 x</p>
+		</triangles>
+	`
+	var triangles model.Triangles
+	err := xml.Unmarshal([]byte(data), &triangles)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "Broken-material") || !strings.Contains(err.Error(), `"x"`) {
+		t.Fatalf("error does not name the element and the token: %s", err.Error())
+	}
+}
+
+func TestTrianglesDecodeWhitespace(t *testing.T) {
+	data := "<triangles count=\"2\">\n<input semantic=\"VERTEX\" source=\"#v\" offset=\"0\"/>\n<p>\n\t0 1 2\n\t2  3 0\n</p>\n</triangles>"
+
+	var triangles model.Triangles
+	if err := xml.Unmarshal([]byte(data), &triangles); err != nil {
+		t.Fatal(err)
+	}
+	if len(triangles.Index) != 6 {
+		t.Fatalf("number of index elements incorrect: %d", len(triangles.Index))
+	}
+}
+
+// generateGridCollada makes a Collada file of a size x size quad grid,
+// formatted with newlines and tabs like Maya or 3ds Max exports are.
+// Every vertex has its own position, normal and texture coordinate,
+// each in a source with an accessor and indexed at its own offset
+func generateGridCollada(size int) []byte {
+	var buf bytes.Buffer
+	vertices := (size + 1) * (size + 1)
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+<asset><up_axis>Y_UP</up_axis></asset>
+<library_geometries><geometry id="Grid-mesh"><mesh>
+`)
+	source := func(name string, params []string, value func(x, y int) []float32) {
+		fmt.Fprintf(&buf, "<source id=\"Grid-%s\">\n", name)
+		fmt.Fprintf(&buf, "<float_array id=\"Grid-%s-array\" count=\"%d\">\n", name, vertices*len(params))
+		for y := 0; y <= size; y++ {
+			for x := 0; x <= size; x++ {
+				for _, f := range value(x, y) {
+					fmt.Fprintf(&buf, "\t%f", f)
+				}
+				buf.WriteString("\n")
+			}
+		}
+		buf.WriteString("</float_array>\n")
+		fmt.Fprintf(&buf, "<technique_common><accessor source=\"#Grid-%s-array\" count=\"%d\" stride=\"%d\">", name, vertices, len(params))
+		for _, param := range params {
+			fmt.Fprintf(&buf, "<param name=\"%s\" type=\"float\"/>", param)
+		}
+		buf.WriteString("\n</accessor></technique_common></source>\n")
+	}
+	source("positions", []string{"X", "Y", "Z"}, func(x, y int) []float32 {
+		return []float32{float32(x) * 0.25, float32(x*y) * 0.0001, float32(y) * 0.25}
+	})
+	source("normals", []string{"X", "Y", "Z"}, func(x, y int) []float32 {
+		normal := glm.Vec3{-float32(y) * 0.0001, 1, -float32(x) * 0.0001}.Normalize()
+		return normal[:]
+	})
+	source("map", []string{"S", "T"}, func(x, y int) []float32 {
+		return []float32{float32(x) / float32(size), float32(y) / float32(size)}
+	})
+	buf.WriteString(`<vertices id="Grid-vertices"><input semantic="POSITION" source="#Grid-positions"/></vertices>`)
+	fmt.Fprintf(&buf, "\n<polylist count=\"%d\">\n", size*size)
+	buf.WriteString(`<input semantic="VERTEX" source="#Grid-vertices" offset="0"/>
+<input semantic="NORMAL" source="#Grid-normals" offset="1"/>
+<input semantic="TEXCOORD" source="#Grid-map" offset="2" set="0"/>
+<vcount>`)
+	for idx := 0; idx < size*size; idx++ {
+		buf.WriteString("4 ")
+	}
+	buf.WriteString("</vcount>\n<p>\n")
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := y*(size+1) + x
+			fmt.Fprintf(&buf, "%d %d %d  %d %d %d\t%d %d %d\t%d %d %d\n", v, v, v, v+1, v+1, v+1, v+size+2, v+size+2, v+size+2, v+size+1, v+size+1, v+size+1)
+		}
+	}
+	buf.WriteString("</p>\n</polylist>\n</mesh></geometry></library_geometries>\n</COLLADA>\n")
+	return buf.Bytes()
+}
+
+func TestImportColladaObjectGrid(t *testing.T) {
+	obj, err := model.ImportColladaObjectWithConfiguration(generateGridCollada(8), nil, model.ImportConfiguration{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vert := obj.Vertices()
+	if len(vert) != 8*8*6 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+
+	// the last quad fans out from its first corner,
+	// the middle of its last triangle is the far corner of the grid
+	last := vert[len(vert)-2]
+	if !near(last.Pos, glm.Vec3{2, 0.0064, 2}) {
+		t.Fatalf("bad position of the far corner, got: %v", last.Pos)
+	}
+	if !near(last.Normal, glm.Vec3{-0.0008, 1, -0.0008}.Normalize()) {
+		t.Fatalf("bad normal of the far corner, got: %v", last.Normal)
+	}
+	if last.Tex != (glm.Vec2{1, 1}) {
+		t.Fatalf("bad texture coordinate of the far corner, got: %v", last.Tex)
+	}
+}
+
+func BenchmarkImportColladaObjectLarge(b *testing.B) {
+	data := generateGridCollada(300)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		if _, err := model.ImportColladaObject(data, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFloatsDecodeLarge(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString(`<float_array id="large" count="1000000">`)
+	for idx := 0; idx < 1000000; idx++ {
+		fmt.Fprintf(&buf, "%f\n", float32(idx)*0.001)
+	}
+	buf.WriteString(`</float_array>`)
+	data := buf.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		var floats model.Floats
+		if err := xml.Unmarshal(data, &floats); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+var Colored_file = `
+<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <library_geometries>
+    <geometry id="Tri-mesh" name="Tri">
+      <mesh>
+        <source id="Tri-mesh-positions">
+          <float_array id="Tri-mesh-positions-array" count="9">0 0 0 1 0 0 0 1 0</float_array>
+        </source>
+        <source id="Tri-mesh-colors">
+          <float_array id="Tri-mesh-colors-array" count="9">1 0 0 0 1 0 0 0 1</float_array>
+          <technique_common>
+            <accessor source="#Tri-mesh-colors-array" count="3" stride="3">
+              <param name="R" type="float"/>
+              <param name="G" type="float"/>
+              <param name="B" type="float"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <source id="Tri-mesh-map-0">
+          <float_array id="Tri-mesh-map-0-array" count="6">0 0 1 0 0 1</float_array>
+        </source>
+        <source id="Tri-mesh-map-1">
+          <float_array id="Tri-mesh-map-1-array" count="6">0.5 0.5 0.75 0.5 0.5 0.75</float_array>
+        </source>
+        <vertices id="Tri-mesh-vertices">
+          <input semantic="POSITION" source="#Tri-mesh-positions"/>
+        </vertices>
+        <triangles count="1">
+          <input semantic="VERTEX" source="#Tri-mesh-vertices" offset="0"/>
+          <input semantic="COLOR" source="#Tri-mesh-colors" offset="0"/>
+          <input semantic="TEXCOORD" source="#Tri-mesh-map-1" offset="1" set="2"/>
+          <input semantic="TEXCOORD" source="#Tri-mesh-map-0" offset="1" set="1"/>
+          <p>0 0 1 1 2 2</p>
+        </triangles>
+        <triangles count="1">
+          <input semantic="VERTEX" source="#Tri-mesh-vertices" offset="0"/>
+          <p>0 1 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+</COLLADA>
+`
+
+func TestImportColladaObjectColorsAndTexSets(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(Colored_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	if len(vert) != 6 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+
+	colors := []glm.Vec4{{1, 0, 0, 1}, {0, 1, 0, 1}, {0, 0, 1, 1}}
+	// Texture coordinates are flipped to the top left origin
+	tex := []glm.Vec2{{0, 1}, {1, 1}, {0, 0}}
+	tex1 := []glm.Vec2{{0.5, 0.5}, {0.75, 0.5}, {0.5, 0.25}}
+	for idx := 0; idx < 3; idx++ {
+		if vert[idx].Color != colors[idx] {
+			t.Fatalf("bad color %d, expected: %v, got: %v", idx, colors[idx], vert[idx].Color)
+		}
+		if vert[idx].Tex != tex[idx] {
+			t.Fatalf("bad texcoord %d, expected: %v, got: %v", idx, tex[idx], vert[idx].Tex)
+		}
+		if vert[idx].Tex1 != tex1[idx] {
+			t.Fatalf("bad second texcoord %d, expected: %v, got: %v", idx, tex1[idx], vert[idx].Tex1)
+		}
+	}
+
+	for idx := 3; idx < 6; idx++ {
+		if vert[idx].Color != model.DefaultVertexColor {
+			t.Fatalf("vertex %d without color is not white, got: %v", idx, vert[idx].Color)
+		}
+	}
+}
+
+// Skinned_file is a triangle bound to a two joint skeleton, with the
+// upper joint animated from one to two units up. Distances are in halves
+var Skinned_file = `<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <asset>
+    <unit name="half" meter="0.5"/>
+    <up_axis>Z_UP</up_axis>
+  </asset>
+  <library_animations>
+    <animation id="Armature_Bone_pose_matrix">
+      <source id="Bone-input">
+        <float_array id="Bone-input-array" count="2">0 1</float_array>
+        <technique_common>
+          <accessor source="#Bone-input-array" count="2" stride="1">
+            <param name="TIME" type="float"/>
+          </accessor>
+        </technique_common>
+      </source>
+      <source id="Bone-output">
+        <float_array id="Bone-output-array" count="32">1 0 0 0 0 1 0 0 0 0 1 1 0 0 0 1 1 0 0 0 0 1 0 0 0 0 1 2 0 0 0 1</float_array>
+        <technique_common>
+          <accessor source="#Bone-output-array" count="2" stride="16">
+            <param name="TRANSFORM" type="float4x4"/>
+          </accessor>
+        </technique_common>
+      </source>
+      <source id="Bone-interpolation">
+        <Name_array id="Bone-interpolation-array" count="2">LINEAR LINEAR</Name_array>
+      </source>
+      <sampler id="Bone-sampler">
+        <input semantic="INPUT" source="#Bone-input"/>
+        <input semantic="OUTPUT" source="#Bone-output"/>
+        <input semantic="INTERPOLATION" source="#Bone-interpolation"/>
+      </sampler>
+      <channel source="#Bone-sampler" target="Armature_Bone/transform"/>
+    </animation>
+  </library_animations>
+  <library_controllers>
+    <controller id="Armature_Skin" name="Armature">
+      <skin source="#Triangle-mesh">
+        <bind_shape_matrix>1 0 0 0 0 1 0 0 0 0 1 0 0 0 0 1</bind_shape_matrix>
+        <source id="Skin-joints">
+          <Name_array id="Skin-joints-array" count="2">Root Bone</Name_array>
+        </source>
+        <source id="Skin-bind_poses">
+          <float_array id="Skin-bind_poses-array" count="32">1 0 0 0 0 1 0 0 0 0 1 0 0 0 0 1 1 0 0 0 0 1 0 0 0 0 1 -1 0 0 0 1</float_array>
+          <technique_common>
+            <accessor source="#Skin-bind_poses-array" count="2" stride="16">
+              <param name="TRANSFORM" type="float4x4"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <source id="Skin-weights">
+          <float_array id="Skin-weights-array" count="2">1 0.25</float_array>
+        </source>
+        <joints>
+          <input semantic="JOINT" source="#Skin-joints"/>
+          <input semantic="INV_BIND_MATRIX" source="#Skin-bind_poses"/>
+        </joints>
+        <vertex_weights count="3">
+          <input semantic="JOINT" source="#Skin-joints" offset="0"/>
+          <input semantic="WEIGHT" source="#Skin-weights" offset="1"/>
+          <vcount>1 2 1</vcount>
+          <v>0 0 0 1 1 1 1 0</v>
+        </vertex_weights>
+      </skin>
+    </controller>
+  </library_controllers>
+  <library_geometries>
+    <geometry id="Triangle-mesh" name="Triangle">
+      <mesh>
+        <source id="Triangle-positions">
+          <float_array id="Triangle-positions-array" count="9">0 0 0 1 0 0 0 0 1</float_array>
+        </source>
+        <vertices id="Triangle-vertices">
+          <input semantic="POSITION" source="#Triangle-positions"/>
+        </vertices>
+        <triangles count="1">
+          <input semantic="VERTEX" source="#Triangle-vertices" offset="0"/>
+          <p>0 1 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+  <library_visual_scenes>
+    <visual_scene id="Scene" name="Scene">
+      <node id="Armature" name="Armature" type="NODE">
+        <translate sid="location">0 0 0</translate>
+        <node id="Armature_Root" name="Root" sid="Root" type="JOINT">
+          <matrix sid="transform">1 0 0 0 0 1 0 0 0 0 1 0 0 0 0 1</matrix>
+          <node id="Armature_Bone" name="Bone" sid="Bone" type="JOINT">
+            <matrix sid="transform">1 0 0 0 0 1 0 0 0 0 1 1 0 0 0 1</matrix>
+          </node>
+        </node>
+      </node>
+      <node id="Triangle" name="Triangle" type="NODE">
+        <instance_controller url="#Armature_Skin">
+          <skeleton>#Armature_Root</skeleton>
+        </instance_controller>
+      </node>
+    </visual_scene>
+  </library_visual_scenes>
+</COLLADA>
+`
+
+func TestImportColladaObjectSkinned(t *testing.T) {
+	obj, err := model.ImportColladaObject([]byte(Skinned_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skeleton := obj.Skeleton()
+	if skeleton == nil || len(skeleton.Joints) != 2 {
+		t.Fatalf("bad skeleton: %+v", skeleton)
+	}
+	if skeleton.Joints[0].Name != "Root" || skeleton.Joints[0].Parent != -1 || skeleton.Joints[1].Name != "Bone" || skeleton.Joints[1].Parent != 0 {
+		t.Fatalf("bad joints: %+v", skeleton.Joints)
+	}
+	if skeleton.Joints[1].Rest.Translation != (glm.Vec3{0, 0, 1}) {
+		t.Fatalf("bad rest pose of the bone: %+v", skeleton.Joints[1].Rest)
+	}
+
+	vert := obj.Vertices()
+	if len(vert) != 3 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+	if vert[1].Joints[0] != 0 || vert[1].Joints[1] != 1 || vert[1].Weights != (glm.Vec4{0.5, 0.5, 0, 0}) {
+		t.Fatalf("weights are not normalized: %v, %v", vert[1].Joints, vert[1].Weights)
+	}
+	if vert[2].Joints[0] != 1 || vert[2].Weights != (glm.Vec4{1, 0, 0, 0}) {
+		t.Fatalf("bad influence of the top vertex: %v, %v", vert[2].Joints, vert[2].Weights)
+	}
+
+	clips := obj.Clips()
+	if len(clips) != 1 || clips[0].Duration != 1 || len(clips[0].Channels) != 3 {
+		t.Fatalf("bad clips: %+v", clips)
+	}
+
+	// the bind pose leaves vertices where they are, in meters
+	rest := model.SkinVertices(vert, skeleton.Evaluate(&clips[0], 0))
+	expected := []glm.Vec3{{0, 0, 0}, {0.5, 0, 0}, {0, 0, 0.5}}
+	for idx := range expected {
+		if !rest[idx].Pos.ApproxEqual(expected[idx]) {
+			t.Fatalf("vertex %d moved in bind pose, expected: %v, got: %v", idx, expected[idx], rest[idx].Pos)
+		}
+	}
+
+	halfway := model.SkinVertices(vert, skeleton.Evaluate(&clips[0], 0.5))
+	expected = []glm.Vec3{{0, 0, 0}, {0.5, 0, 0.125}, {0, 0, 0.75}}
+	for idx := range expected {
+		if !halfway[idx].Pos.ApproxEqual(expected[idx]) {
+			t.Fatalf("bad animated vertex %d, expected: %v, got: %v", idx, expected[idx], halfway[idx].Pos)
+		}
+	}
+}
@@ -0,0 +1,1197 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // embedded image decoding
+	_ "image/png"  // embedded image decoding
+	"math"
+	"net/url"
+	"strings"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// glTF constants used by the importer
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\x00"
+
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+
+	gltfModeTriangles     = 4
+	gltfModeTriangleStrip = 5
+	gltfModeTriangleFan   = 6
+)
+
+// ErrGLTFFormat is returned for files that are neither glTF JSON nor GLB
+var ErrGLTFFormat = errors.New("corrupted or not a glTF file")
+
+// ImportGLTFObject reads a glTF 2.0 file, either JSON (.gltf) or binary (.glb),
+// and converts the meshes of its default scene into engine's internal object.
+// External buffers and images are read through load, which may be nil for
+// self contained files. All skinned meshes have to share one skin.
+func ImportGLTFObject(fileContents []byte, load FileLoader, texture image.Image) (Object, error) {
+	return ImportGLTFObjectWithConfiguration(fileContents, load, texture, ImportConfiguration{})
+}
+
+// ImportGLTFObjectWithConfiguration is ImportGLTFObject that allows
+// to configure the conversion. Vertices and the skeleton are converted from
+// glTF's Y up to engine's Z up, while node, skin and animation data is kept
+// as it is in the file.
+func ImportGLTFObjectWithConfiguration(fileContents []byte, load FileLoader, texture image.Image, cfg ImportConfiguration) (Object, error) {
+	doc, err := DecodeGLTF(fileContents, load)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := make([]ObjectMaterial, len(doc.Materials))
+	for idx := range doc.Materials {
+		if materials[idx], err = doc.objectMaterial(idx); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		vertices   []Vertex
+		primitives []Primitive
+		skin       = -1
+	)
+	err = doc.walkScene(func(node int, world glm.Mat4) error {
+		n := doc.Nodes[node]
+		if n.Mesh == nil {
+			return nil
+		}
+		// an object has a single skeleton, joints of other skins would
+		// index the wrong bones
+		if n.Skin != nil {
+			if skin >= 0 && *n.Skin != skin {
+				return fmt.Errorf("gltf node %d: skin %d differs from skin %d of the object", node, *n.Skin, skin)
+			}
+			skin = *n.Skin
+		}
+		if *n.Mesh < 0 || *n.Mesh >= len(doc.Meshes) {
+			return fmt.Errorf("gltf node %d: mesh %d out of range", node, *n.Mesh)
+		}
+		// skinned meshes are placed by their joints, not by the node
+		if n.Skin != nil {
+			world = glm.Ident4()
+		}
+		normalMatrix := world.Mat3().Inv().Transpose()
+
+		for p, prim := range doc.Meshes[*n.Mesh].Primitives {
+			primVertices, err := doc.primitiveVertices(prim)
+			if err != nil {
+				return fmt.Errorf("gltf mesh %d primitive %d: %s", *n.Mesh, p, err.Error())
+			}
+			if len(primVertices) == 0 {
+				continue
+			}
+			for idx := range primVertices {
+				primVertices[idx].Pos = world.Mul4x1(primVertices[idx].Pos.Vec4(1)).Vec3()
+				if normal := normalMatrix.Mul3x1(primVertices[idx].Normal); normal.Len() > 0 {
+					primVertices[idx].Normal = normal.Normalize()
+				}
+				if tangent := world.Mat3().Mul3x1(primVertices[idx].Tangent.Vec3()); tangent.Len() > 0 {
+					primVertices[idx].Tangent = tangent.Normalize().Vec4(primVertices[idx].Tangent[3])
+				}
+			}
+			// tangents read from the file have a sign in W
+			if primVertices[0].Tangent[3] == 0 {
+				GenerateTangents(primVertices)
+			}
+
+			material := -1
+			if prim.Material != nil {
+				if *prim.Material < 0 || *prim.Material >= len(materials) {
+					return fmt.Errorf("gltf mesh %d primitive %d: material %d out of range", *n.Mesh, p, *prim.Material)
+				}
+				material = *prim.Material
+			}
+			primitives = append(primitives, Primitive{
+				Material: material,
+				Offset:   len(vertices),
+				Count:    len(primVertices),
+			})
+			vertices = append(vertices, primVertices...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		skeleton *Skeleton
+		clips    []AnimationClip
+	)
+	if skin >= 0 {
+		if skin >= len(doc.Skins) {
+			return nil, fmt.Errorf("gltf: skin %d out of range", skin)
+		}
+		if skeleton, err = doc.skeleton(skin); err != nil {
+			return nil, err
+		}
+		clips = doc.clips(doc.Skins[skin])
+	}
+
+	if !cfg.KeepRaw {
+		for idx := range vertices {
+			vertices[idx].Pos = yUpToZUp.Mul3x1(vertices[idx].Pos)
+			vertices[idx].Normal = yUpToZUp.Mul3x1(vertices[idx].Normal)
+			vertices[idx].Tangent = yUpToZUp.Mul3x1(vertices[idx].Tangent.Vec3()).Vec4(vertices[idx].Tangent[3])
+		}
+		if skeleton != nil {
+			conjugateSkeleton(skeleton, yUpToZUp.Mat4())
+		}
+	}
+
+	return &GLTFObject{
+		meshData: newMeshData(vertices, texture, materials, primitives, skeleton, clips),
+		document: doc,
+	}, nil
+}
+
+// GLTFObject is imported from a glTF (.gltf or .glb) file.
+// Loaded and held in memory
+type GLTFObject struct {
+	Transform
+	meshData
+
+	document *GLTF
+}
+
+// Nodes returns the node hierarchy of the file
+func (g *GLTFObject) Nodes() []GLTFNode {
+	return g.document.Nodes
+}
+
+// Skins returns the skins of the file, with inverse bind matrices read
+func (g *GLTFObject) Skins() []GLTFSkin {
+	return g.document.Skins
+}
+
+// Animations returns the animations of the file, with keyframes read
+func (g *GLTFObject) Animations() []GLTFAnimation {
+	return g.document.Animations
+}
+
+// GLTF is the top-level glTF document
+type GLTF struct {
+	Asset struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator"`
+	} `json:"asset"`
+	Scene              *int             `json:"scene"`
+	Scenes             []GLTFScene      `json:"scenes"`
+	Nodes              []GLTFNode       `json:"nodes"`
+	Meshes             []GLTFMesh       `json:"meshes"`
+	Accessors          []GLTFAccessor   `json:"accessors"`
+	BufferViews        []GLTFBufferView `json:"bufferViews"`
+	Buffers            []GLTFBuffer     `json:"buffers"`
+	Materials          []GLTFMaterial   `json:"materials"`
+	Textures           []GLTFTexture    `json:"textures"`
+	Images             []GLTFImage      `json:"images"`
+	Skins              []GLTFSkin       `json:"skins"`
+	Animations         []GLTFAnimation  `json:"animations"`
+	ExtensionsRequired []string         `json:"extensionsRequired"`
+}
+
+// GLTFScene lists the root nodes of a scene
+type GLTFScene struct {
+	Name  string `json:"name"`
+	Nodes []int  `json:"nodes"`
+}
+
+// GLTFNode is an element of the node hierarchy. Its local transform
+// is either a matrix or a translation, rotation and scale
+type GLTFNode struct {
+	Name        string       `json:"name"`
+	Children    []int        `json:"children"`
+	Mesh        *int         `json:"mesh"`
+	Skin        *int         `json:"skin"`
+	Matrix      *[16]float32 `json:"matrix"`
+	Translation *[3]float32  `json:"translation"`
+	Rotation    *[4]float32  `json:"rotation"`
+	Scale       *[3]float32  `json:"scale"`
+}
+
+// LocalMatrix returns the transform of the node relative to its parent
+func (n GLTFNode) LocalMatrix() glm.Mat4 {
+	if n.Matrix != nil {
+		return glm.Mat4(*n.Matrix)
+	}
+	mat := glm.Ident4()
+	if n.Translation != nil {
+		mat = glm.Translate3D(n.Translation[0], n.Translation[1], n.Translation[2])
+	}
+	if n.Rotation != nil {
+		rot := glm.Quat{W: n.Rotation[3], V: glm.Vec3{n.Rotation[0], n.Rotation[1], n.Rotation[2]}}
+		mat = mat.Mul4(rot.Normalize().Mat4())
+	}
+	if n.Scale != nil {
+		mat = mat.Mul4(glm.Scale3D(n.Scale[0], n.Scale[1], n.Scale[2]))
+	}
+	return mat
+}
+
+// GLTFMesh is a set of primitives
+type GLTFMesh struct {
+	Name       string          `json:"name"`
+	Primitives []GLTFPrimitive `json:"primitives"`
+}
+
+// GLTFPrimitive is geometry drawn with a single material
+type GLTFPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+// GLTFAccessor describes typed data in a buffer view
+type GLTFAccessor struct {
+	BufferView    *int        `json:"bufferView"`
+	ByteOffset    int         `json:"byteOffset"`
+	ComponentType int         `json:"componentType"`
+	Normalized    bool        `json:"normalized"`
+	Count         int         `json:"count"`
+	Type          string      `json:"type"`
+	Sparse        *GLTFSparse `json:"sparse"`
+}
+
+// GLTFSparse replaces some elements of an accessor
+type GLTFSparse struct {
+	Count   int `json:"count"`
+	Indices struct {
+		BufferView    int `json:"bufferView"`
+		ByteOffset    int `json:"byteOffset"`
+		ComponentType int `json:"componentType"`
+	} `json:"indices"`
+	Values struct {
+		BufferView int `json:"bufferView"`
+		ByteOffset int `json:"byteOffset"`
+	} `json:"values"`
+}
+
+// GLTFBufferView is a slice of a buffer
+type GLTFBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+// GLTFBuffer is binary data, either external, a data uri,
+// or the binary chunk of a GLB file
+type GLTFBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+
+	data []byte
+}
+
+// GLTFTextureInfo references a texture from a material
+type GLTFTextureInfo struct {
+	Index    int  `json:"index"`
+	TexCoord uint `json:"texCoord"`
+}
+
+// GLTFMaterial is a PBR metallic-roughness material
+type GLTFMaterial struct {
+	Name                 string `json:"name"`
+	PBRMetallicRoughness *struct {
+		BaseColorFactor          *[4]float32      `json:"baseColorFactor"`
+		BaseColorTexture         *GLTFTextureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float32         `json:"metallicFactor"`
+		RoughnessFactor          *float32         `json:"roughnessFactor"`
+		MetallicRoughnessTexture *GLTFTextureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture    *GLTFTextureInfo `json:"normalTexture"`
+	OcclusionTexture *GLTFTextureInfo `json:"occlusionTexture"`
+	EmissiveTexture  *GLTFTextureInfo `json:"emissiveTexture"`
+	EmissiveFactor   *[3]float32      `json:"emissiveFactor"`
+	AlphaMode        string           `json:"alphaMode"`
+	AlphaCutoff      *float32         `json:"alphaCutoff"`
+	DoubleSided      bool             `json:"doubleSided"`
+}
+
+// GLTFTexture pairs an image with a sampler
+type GLTFTexture struct {
+	Source  *int `json:"source"`
+	Sampler *int `json:"sampler"`
+}
+
+// GLTFImage is an external, data uri or buffer view image
+type GLTFImage struct {
+	Name       string `json:"name"`
+	URI        string `json:"uri"`
+	MimeType   string `json:"mimeType"`
+	BufferView *int   `json:"bufferView"`
+}
+
+// GLTFSkin binds a mesh to a set of joint nodes
+type GLTFSkin struct {
+	Name                   string `json:"name"`
+	InverseBindMatricesRef *int   `json:"inverseBindMatrices"`
+	Skeleton               *int   `json:"skeleton"`
+	Joints                 []int  `json:"joints"`
+
+	// InverseBindMatrices are read from the accessor,
+	// identity matrices if the skin does not have them
+	InverseBindMatrices []glm.Mat4 `json:"-"`
+}
+
+// GLTFAnimation is a set of channels animating node properties
+type GLTFAnimation struct {
+	Name     string                 `json:"name"`
+	Channels []GLTFAnimationChannel `json:"channels"`
+	Samplers []GLTFAnimationSampler `json:"samplers"`
+}
+
+// GLTFAnimationChannel connects a sampler to a node property,
+// the path is one of translation, rotation, scale or weights
+type GLTFAnimationChannel struct {
+	Sampler int `json:"sampler"`
+	Target  struct {
+		Node *int   `json:"node"`
+		Path string `json:"path"`
+	} `json:"target"`
+}
+
+// GLTFAnimationSampler holds keyframes, interpolation
+// is one of LINEAR, STEP or CUBICSPLINE
+type GLTFAnimationSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+
+	// Times are the keyframe times in seconds, read from Input
+	Times []float32 `json:"-"`
+
+	// Values are the keyframe values read from Output, Components
+	// floats per value, three values per keyframe for CUBICSPLINE
+	Values     []float32 `json:"-"`
+	Components int       `json:"-"`
+}
+
+// DecodeGLTF parses a glTF JSON or GLB file, loads its buffers
+// and reads the skin and animation data
+func DecodeGLTF(fileContents []byte, load FileLoader) (*GLTF, error) {
+	jsonChunk := fileContents
+	var binChunk []byte
+	if len(fileContents) >= 12 && binary.LittleEndian.Uint32(fileContents) == glbMagic {
+		var err error
+		if jsonChunk, binChunk, err = splitGLB(fileContents); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc GLTF
+	if err := json.Unmarshal(jsonChunk, &doc); err != nil {
+		return nil, fmt.Errorf("gltf: %s", err.Error())
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		return nil, fmt.Errorf("gltf: unsupported version %q", doc.Asset.Version)
+	}
+	if len(doc.ExtensionsRequired) > 0 {
+		return nil, fmt.Errorf("gltf: required extensions not supported: %s", strings.Join(doc.ExtensionsRequired, ", "))
+	}
+
+	for idx := range doc.Buffers {
+		buf := &doc.Buffers[idx]
+		var err error
+		switch {
+		case buf.URI == "" && idx == 0 && binChunk != nil:
+			buf.data = binChunk
+		case buf.URI == "":
+			err = errors.New("no data")
+		default:
+			buf.data, err = readGLTFURI(buf.URI, load)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gltf buffer %d: %s", idx, err.Error())
+		}
+		if len(buf.data) < buf.ByteLength {
+			return nil, fmt.Errorf("gltf buffer %d: %d bytes, expected %d", idx, len(buf.data), buf.ByteLength)
+		}
+	}
+
+	for idx := range doc.Skins {
+		skin := &doc.Skins[idx]
+		if skin.InverseBindMatricesRef == nil {
+			skin.InverseBindMatrices = make([]glm.Mat4, len(skin.Joints))
+			for j := range skin.InverseBindMatrices {
+				skin.InverseBindMatrices[j] = glm.Ident4()
+			}
+			continue
+		}
+		floats, components, err := doc.ReadAccessor(*skin.InverseBindMatricesRef)
+		if err != nil {
+			return nil, fmt.Errorf("gltf skin %d: %s", idx, err.Error())
+		}
+		if components != 16 {
+			return nil, fmt.Errorf("gltf skin %d: inverse bind matrices are not MAT4", idx)
+		}
+		skin.InverseBindMatrices = make([]glm.Mat4, len(floats)/16)
+		for j := range skin.InverseBindMatrices {
+			copy(skin.InverseBindMatrices[j][:], floats[j*16:])
+		}
+	}
+
+	for a := range doc.Animations {
+		for s := range doc.Animations[a].Samplers {
+			sampler := &doc.Animations[a].Samplers[s]
+			if sampler.Interpolation == "" {
+				sampler.Interpolation = "LINEAR"
+			}
+			var err error
+			if sampler.Times, _, err = doc.ReadAccessor(sampler.Input); err != nil {
+				return nil, fmt.Errorf("gltf animation %d sampler %d input: %s", a, s, err.Error())
+			}
+			if sampler.Values, sampler.Components, err = doc.ReadAccessor(sampler.Output); err != nil {
+				return nil, fmt.Errorf("gltf animation %d sampler %d output: %s", a, s, err.Error())
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// splitGLB returns the JSON and the binary chunks of a GLB file
+func splitGLB(data []byte) ([]byte, []byte, error) {
+	if binary.LittleEndian.Uint32(data[4:]) != 2 {
+		return nil, nil, fmt.Errorf("glb: unsupported version %d", binary.LittleEndian.Uint32(data[4:]))
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, ErrGLTFFormat
+	}
+
+	var jsonChunk, binChunk []byte
+	for offset := 12; offset+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if chunkLength < 0 || offset+chunkLength > length {
+			return nil, nil, ErrGLTFFormat
+		}
+		switch chunkType {
+		case glbChunkJSON:
+			jsonChunk = data[offset : offset+chunkLength]
+		case glbChunkBIN:
+			if binChunk == nil {
+				binChunk = data[offset : offset+chunkLength]
+			}
+		}
+		// chunks are aligned to 4 bytes
+		offset += (chunkLength + 3) &^ 3
+	}
+	if jsonChunk == nil {
+		return nil, nil, ErrGLTFFormat
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// readGLTFURI returns the contents of a data uri, or loads the external file
+func readGLTFURI(uri string, load FileLoader) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, errors.New("only base64 data uris are supported")
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+	if load == nil {
+		return nil, fmt.Errorf("external file %s and no loader", uri)
+	}
+	name, err := url.PathUnescape(uri)
+	if err != nil {
+		name = uri
+	}
+	return load(name)
+}
+
+// gltfComponents returns the number of components of an accessor type
+func gltfComponents(accessorType string) int {
+	switch accessorType {
+	case "SCALAR":
+		return 1
+	case "VEC2":
+		return 2
+	case "VEC3":
+		return 3
+	case "VEC4", "MAT2":
+		return 4
+	case "MAT3":
+		return 9
+	case "MAT4":
+		return 16
+	}
+	return 0
+}
+
+// gltfComponentSize returns the byte size of a component type
+func gltfComponentSize(componentType int) int {
+	switch componentType {
+	case gltfByte, gltfUnsignedByte:
+		return 1
+	case gltfShort, gltfUnsignedShort:
+		return 2
+	case gltfUnsignedInt, gltfFloat:
+		return 4
+	}
+	return 0
+}
+
+// readGLTFComponent reads a single component as a float,
+// normalized integers are mapped to [0, 1] or [-1, 1]
+func readGLTFComponent(data []byte, componentType int, normalized bool) float32 {
+	switch componentType {
+	case gltfByte:
+		v := float32(int8(data[0]))
+		if normalized {
+			return glm.Clamp(v/127, -1, 1)
+		}
+		return v
+	case gltfUnsignedByte:
+		if normalized {
+			return float32(data[0]) / 255
+		}
+		return float32(data[0])
+	case gltfShort:
+		v := float32(int16(binary.LittleEndian.Uint16(data)))
+		if normalized {
+			return glm.Clamp(v/32767, -1, 1)
+		}
+		return v
+	case gltfUnsignedShort:
+		v := float32(binary.LittleEndian.Uint16(data))
+		if normalized {
+			return v / 65535
+		}
+		return v
+	case gltfUnsignedInt:
+		return float32(binary.LittleEndian.Uint32(data))
+	default:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	}
+}
+
+// readGLTFInteger reads a single integer component, signed
+// types are kept in their two's complement
+func readGLTFInteger(data []byte, componentType int) uint32 {
+	switch componentType {
+	case gltfByte:
+		return uint32(int8(data[0]))
+	case gltfUnsignedByte:
+		return uint32(data[0])
+	case gltfShort:
+		return uint32(int16(binary.LittleEndian.Uint16(data)))
+	case gltfUnsignedShort:
+		return uint32(binary.LittleEndian.Uint16(data))
+	default:
+		return binary.LittleEndian.Uint32(data)
+	}
+}
+
+// bufferView returns the bytes of a buffer view and its stride
+func (g *GLTF) bufferView(idx int) ([]byte, int, error) {
+	if idx < 0 || idx >= len(g.BufferViews) {
+		return nil, 0, fmt.Errorf("buffer view %d out of range", idx)
+	}
+	view := g.BufferViews[idx]
+	if view.Buffer < 0 || view.Buffer >= len(g.Buffers) {
+		return nil, 0, fmt.Errorf("buffer view %d: buffer %d out of range", idx, view.Buffer)
+	}
+	data := g.Buffers[view.Buffer].data
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(data) {
+		return nil, 0, fmt.Errorf("buffer view %d out of buffer bounds", idx)
+	}
+	return data[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+}
+
+// ReadAccessor returns the elements of an accessor as floats,
+// along with the number of components of each element
+func (g *GLTF) ReadAccessor(idx int) ([]float32, int, error) {
+	acc, components, err := g.accessor(idx)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([]float32, acc.Count*components)
+	err = g.visitAccessor(idx, acc, components, func(slot int, data []byte) {
+		values[slot] = readGLTFComponent(data, acc.ComponentType, acc.Normalized)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return values, components, nil
+}
+
+// ReadIntegerAccessor returns the elements of an accessor of unnormalized
+// integers, like indices and joints, without passing them through floats
+func (g *GLTF) ReadIntegerAccessor(idx int) ([]uint32, int, error) {
+	acc, components, err := g.accessor(idx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if acc.ComponentType == gltfFloat || acc.Normalized {
+		return nil, 0, fmt.Errorf("accessor %d: not of integers", idx)
+	}
+	values := make([]uint32, acc.Count*components)
+	err = g.visitAccessor(idx, acc, components, func(slot int, data []byte) {
+		values[slot] = readGLTFInteger(data, acc.ComponentType)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return values, components, nil
+}
+
+// accessor returns an accessor of a supported type and its number of components
+func (g *GLTF) accessor(idx int) (GLTFAccessor, int, error) {
+	if idx < 0 || idx >= len(g.Accessors) {
+		return GLTFAccessor{}, 0, fmt.Errorf("accessor %d out of range", idx)
+	}
+	acc := g.Accessors[idx]
+	components := gltfComponents(acc.Type)
+	if components == 0 || gltfComponentSize(acc.ComponentType) == 0 {
+		return GLTFAccessor{}, 0, fmt.Errorf("accessor %d: unsupported type %s of %d", idx, acc.Type, acc.ComponentType)
+	}
+	return acc, components, nil
+}
+
+// visitAccessor calls read with the bytes of every component of an accessor,
+// slots replaced by sparse values are read again after the buffer view
+func (g *GLTF) visitAccessor(idx int, acc GLTFAccessor, components int, read func(slot int, data []byte)) error {
+	size := gltfComponentSize(acc.ComponentType)
+	if acc.BufferView != nil {
+		data, stride, err := g.bufferView(*acc.BufferView)
+		if err != nil {
+			return fmt.Errorf("accessor %d: %s", idx, err.Error())
+		}
+		if stride == 0 {
+			stride = components * size
+		}
+		if acc.Count > 0 && acc.ByteOffset+(acc.Count-1)*stride+components*size > len(data) {
+			return fmt.Errorf("accessor %d out of buffer view bounds", idx)
+		}
+		for e := 0; e < acc.Count; e++ {
+			element := data[acc.ByteOffset+e*stride:]
+			for c := 0; c < components; c++ {
+				read(e*components+c, element[c*size:])
+			}
+		}
+	}
+
+	if acc.Sparse != nil {
+		if err := g.visitSparse(acc, components, size, read); err != nil {
+			return fmt.Errorf("accessor %d: sparse: %s", idx, err.Error())
+		}
+	}
+	return nil
+}
+
+func (g *GLTF) visitSparse(acc GLTFAccessor, components, size int, read func(slot int, data []byte)) error {
+	sparse := acc.Sparse
+	indexData, _, err := g.bufferView(sparse.Indices.BufferView)
+	if err != nil {
+		return err
+	}
+	valueData, _, err := g.bufferView(sparse.Values.BufferView)
+	if err != nil {
+		return err
+	}
+	indexSize := gltfComponentSize(sparse.Indices.ComponentType)
+	if indexSize == 0 ||
+		sparse.Indices.ByteOffset+sparse.Count*indexSize > len(indexData) ||
+		sparse.Values.ByteOffset+sparse.Count*components*size > len(valueData) {
+		return errors.New("out of buffer view bounds")
+	}
+
+	for s := 0; s < sparse.Count; s++ {
+		target := readGLTFInteger(indexData[sparse.Indices.ByteOffset+s*indexSize:], sparse.Indices.ComponentType)
+		if target >= uint32(acc.Count) {
+			return fmt.Errorf("index %d out of range", target)
+		}
+		element := valueData[sparse.Values.ByteOffset+s*components*size:]
+		for c := 0; c < components; c++ {
+			read(int(target)*components+c, element[c*size:])
+		}
+	}
+	return nil
+}
+
+// readIndices returns the vertex indices of a primitive, or a sequence
+// of count indices if the primitive is not indexed
+func (g *GLTF) readIndices(prim GLTFPrimitive, count int) ([]int, error) {
+	if prim.Indices == nil {
+		index := make([]int, count)
+		for idx := range index {
+			index[idx] = idx
+		}
+		return index, nil
+	}
+
+	values, components, err := g.ReadIntegerAccessor(*prim.Indices)
+	if err != nil {
+		return nil, err
+	}
+	if components != 1 {
+		return nil, errors.New("indices are not scalars")
+	}
+	index := make([]int, len(values))
+	for idx, v := range values {
+		if v >= uint32(count) {
+			return nil, fmt.Errorf("index %d out of range", v)
+		}
+		index[idx] = int(v)
+	}
+	return index, nil
+}
+
+// primitiveVertices assembles the triangle list of a primitive,
+// primitives made of points or lines produce no vertices
+func (g *GLTF) primitiveVertices(prim GLTFPrimitive) ([]Vertex, error) {
+	mode := gltfModeTriangles
+	if prim.Mode != nil {
+		mode = *prim.Mode
+	}
+	if mode != gltfModeTriangles && mode != gltfModeTriangleStrip && mode != gltfModeTriangleFan {
+		return nil, nil
+	}
+
+	posAccessor, ok := prim.Attributes["POSITION"]
+	if !ok {
+		return nil, errors.New("no POSITION attribute")
+	}
+	positions, components, err := g.ReadAccessor(posAccessor)
+	if err != nil {
+		return nil, err
+	}
+	if components != 3 {
+		return nil, errors.New("POSITION is not VEC3")
+	}
+	count := len(positions) / 3
+
+	attribute := func(name string, minComponents int) ([]float32, int, error) {
+		idx, ok := prim.Attributes[name]
+		if !ok {
+			return nil, 0, nil
+		}
+		values, components, err := g.ReadAccessor(idx)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		if components < minComponents || len(values)/components < count {
+			return nil, 0, fmt.Errorf("%s does not match POSITION", name)
+		}
+		return values, components, nil
+	}
+	normals, _, err := attribute("NORMAL", 3)
+	if err != nil {
+		return nil, err
+	}
+	// tangents are only meaningful with the normals they were made for
+	var tangents []float32
+	if normals != nil {
+		if tangents, _, err = attribute("TANGENT", 4); err != nil {
+			return nil, err
+		}
+	}
+	// glTF texture coordinates already have their origin at the top
+	// left, so unlike OBJ and Collada they are never flipped
+	texCoords, _, err := attribute("TEXCOORD_0", 2)
+	if err != nil {
+		return nil, err
+	}
+	texCoords1, _, err := attribute("TEXCOORD_1", 2)
+	if err != nil {
+		return nil, err
+	}
+	colors, colorComponents, err := attribute("COLOR_0", 3)
+	if err != nil {
+		return nil, err
+	}
+	var joints []uint32
+	if idx, ok := prim.Attributes["JOINTS_0"]; ok {
+		values, components, err := g.ReadIntegerAccessor(idx)
+		if err != nil {
+			return nil, fmt.Errorf("JOINTS_0: %s", err.Error())
+		}
+		if components != 4 || len(values)/components < count {
+			return nil, errors.New("JOINTS_0 does not match POSITION")
+		}
+		joints = values
+	}
+	weights, _, err := attribute("WEIGHTS_0", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := g.readIndices(prim, count)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case gltfModeTriangleStrip:
+		var list []int
+		for idx := 0; idx+2 < len(index); idx++ {
+			if idx%2 == 0 {
+				list = append(list, index[idx], index[idx+1], index[idx+2])
+			} else {
+				list = append(list, index[idx+1], index[idx], index[idx+2])
+			}
+		}
+		index = list
+	case gltfModeTriangleFan:
+		var list []int
+		for idx := 1; idx+1 < len(index); idx++ {
+			list = append(list, index[0], index[idx], index[idx+1])
+		}
+		index = list
+	default:
+		index = index[:len(index)-len(index)%3]
+	}
+
+	vertices := make([]Vertex, len(index))
+	for idx, v := range index {
+		vert := Vertex{
+			Pos:   glm.Vec3{positions[v*3], positions[v*3+1], positions[v*3+2]},
+			Color: DefaultVertexColor,
+		}
+		if normals != nil {
+			vert.Normal = glm.Vec3{normals[v*3], normals[v*3+1], normals[v*3+2]}
+		}
+		if tangents != nil {
+			vert.Tangent = glm.Vec4{tangents[v*4], tangents[v*4+1], tangents[v*4+2], tangents[v*4+3]}
+		}
+		if texCoords != nil {
+			vert.Tex = glm.Vec2{texCoords[v*2], texCoords[v*2+1]}
+		}
+		if texCoords1 != nil {
+			vert.Tex1 = glm.Vec2{texCoords1[v*2], texCoords1[v*2+1]}
+		}
+		if colors != nil {
+			c := colors[v*colorComponents:]
+			vert.Color = glm.Vec4{c[0], c[1], c[2], 1}
+			if colorComponents == 4 {
+				vert.Color[3] = c[3]
+			}
+		}
+		if joints != nil && weights != nil {
+			for i := 0; i < 4; i++ {
+				vert.Joints[i] = joints[v*4+i]
+			}
+			vert.Weights = glm.Vec4{weights[v*4], weights[v*4+1], weights[v*4+2], weights[v*4+3]}
+		}
+		vertices[idx] = vert
+	}
+
+	if normals == nil {
+		FlatNormals(vertices)
+	}
+	return vertices, nil
+}
+
+// walkScene visits every node of the default scene with its world transform.
+// Files without scenes have all their root nodes visited
+func (g *GLTF) walkScene(visit func(node int, world glm.Mat4) error) error {
+	var roots []int
+	switch {
+	case len(g.Scenes) > 0:
+		scene := 0
+		if g.Scene != nil {
+			scene = *g.Scene
+		}
+		if scene < 0 || scene >= len(g.Scenes) {
+			return fmt.Errorf("gltf: scene %d out of range", scene)
+		}
+		roots = g.Scenes[scene].Nodes
+	default:
+		isChild := make([]bool, len(g.Nodes))
+		for _, n := range g.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for idx := range g.Nodes {
+			if !isChild[idx] {
+				roots = append(roots, idx)
+			}
+		}
+	}
+
+	visited := make([]bool, len(g.Nodes))
+	var walk func(node int, parent glm.Mat4) error
+	walk = func(node int, parent glm.Mat4) error {
+		if node < 0 || node >= len(g.Nodes) {
+			return fmt.Errorf("gltf: node %d out of range", node)
+		}
+		if visited[node] {
+			return fmt.Errorf("gltf: node %d has more than one parent", node)
+		}
+		visited[node] = true
+
+		world := parent.Mul4(g.Nodes[node].LocalMatrix())
+		if err := visit(node, world); err != nil {
+			return err
+		}
+		for _, child := range g.Nodes[node].Children {
+			if err := walk(child, world); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := walk(root, glm.Ident4()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodePose returns the local transform of a node as a joint pose
+func (n GLTFNode) nodePose() JointPose {
+	if n.Matrix != nil {
+		return DecomposeJointPose(glm.Mat4(*n.Matrix))
+	}
+	pose := IdentityJointPose
+	if n.Translation != nil {
+		pose.Translation = glm.Vec3(*n.Translation)
+	}
+	if n.Rotation != nil {
+		pose.Rotation = glm.Quat{W: n.Rotation[3], V: glm.Vec3{n.Rotation[0], n.Rotation[1], n.Rotation[2]}}.Normalize()
+	}
+	if n.Scale != nil {
+		pose.Scale = glm.Vec3(*n.Scale)
+	}
+	return pose
+}
+
+// skeleton converts a skin into a skeleton, joints keep the order of the skin
+// so that JOINTS_0 indexes them. Nodes above the root joint become its Transform
+func (g *GLTF) skeleton(skin int) (*Skeleton, error) {
+	src := g.Skins[skin]
+	parents := make([]int, len(g.Nodes))
+	for idx := range parents {
+		parents[idx] = -1
+	}
+	for idx, n := range g.Nodes {
+		for _, c := range n.Children {
+			if c >= 0 && c < len(parents) {
+				parents[c] = idx
+			}
+		}
+	}
+	jointIndex := make(map[int]int, len(src.Joints))
+	for idx, node := range src.Joints {
+		if node < 0 || node >= len(g.Nodes) {
+			return nil, fmt.Errorf("gltf skin %d: joint node %d out of range", skin, node)
+		}
+		jointIndex[node] = idx
+	}
+
+	skeleton := &Skeleton{
+		Joints:    make([]Joint, len(src.Joints)),
+		Transform: glm.Ident4(),
+	}
+	for idx, node := range src.Joints {
+		joint := Joint{
+			Name:        g.Nodes[node].Name,
+			Parent:      -1,
+			Rest:        g.Nodes[node].nodePose(),
+			InverseBind: glm.Ident4(),
+		}
+		if idx < len(src.InverseBindMatrices) {
+			joint.InverseBind = src.InverseBindMatrices[idx]
+		}
+
+		// the ancestors of the first root joint place the skeleton
+		ancestors := glm.Ident4()
+		for p, depth := parents[node], 0; p >= 0 && depth < len(g.Nodes); p, depth = parents[p], depth+1 {
+			if j, ok := jointIndex[p]; ok {
+				joint.Parent = j
+				break
+			}
+			ancestors = g.Nodes[p].LocalMatrix().Mul4(ancestors)
+		}
+		if joint.Parent < 0 && idx == 0 {
+			skeleton.Transform = ancestors
+		}
+		skeleton.Joints[idx] = joint
+	}
+	return skeleton, nil
+}
+
+// clips converts the animations of a skin's joints, CUBICSPLINE
+// keyframes are interpolated linearly between their values
+func (g *GLTF) clips(skin GLTFSkin) []AnimationClip {
+	jointIndex := make(map[int]int, len(skin.Joints))
+	for idx, node := range skin.Joints {
+		jointIndex[node] = idx
+	}
+
+	var clips []AnimationClip
+	for _, anim := range g.Animations {
+		clip := AnimationClip{Name: anim.Name}
+		for _, ch := range anim.Channels {
+			if ch.Target.Node == nil || ch.Sampler < 0 || ch.Sampler >= len(anim.Samplers) {
+				continue
+			}
+			joint, ok := jointIndex[*ch.Target.Node]
+			if !ok {
+				continue
+			}
+			channel := AnimationChannel{Joint: joint}
+			switch ch.Target.Path {
+			case "translation":
+				channel.Path = AnimateTranslation
+			case "rotation":
+				channel.Path = AnimateRotation
+			case "scale":
+				channel.Path = AnimateScale
+			default:
+				continue
+			}
+
+			sampler := anim.Samplers[ch.Sampler]
+			components, perKey := sampler.Components, 1
+			if sampler.Interpolation == "STEP" {
+				channel.Interpolation = InterpolationStep
+			}
+			if sampler.Interpolation == "CUBICSPLINE" {
+				perKey = 3
+			}
+			if components < 3 || components > 4 {
+				continue
+			}
+			channel.Times = sampler.Times
+			channel.Values = make([]glm.Vec4, len(sampler.Values)/(components*perKey))
+			for k := range channel.Values {
+				// cubic spline keyframes are in-tangent, value, out-tangent
+				value := sampler.Values[(k*perKey+perKey/2)*components:]
+				copy(channel.Values[k][:], value[:components])
+			}
+			clip.Channels = append(clip.Channels, channel)
+		}
+		if len(clip.Channels) > 0 {
+			clip.updateDuration()
+			clips = append(clips, clip)
+		}
+	}
+	return clips
+}
+
+// textureMap resolves a material's texture reference, external images
+// keep their path, embedded ones are decoded
+func (g *GLTF) textureMap(info *GLTFTextureInfo) (TextureMap, error) {
+	if info == nil {
+		return TextureMap{}, nil
+	}
+	if info.Index < 0 || info.Index >= len(g.Textures) {
+		return TextureMap{}, fmt.Errorf("texture %d out of range", info.Index)
+	}
+	texture := g.Textures[info.Index]
+	if texture.Source == nil {
+		return TextureMap{}, nil
+	}
+	if *texture.Source < 0 || *texture.Source >= len(g.Images) {
+		return TextureMap{}, fmt.Errorf("texture %d: image %d out of range", info.Index, *texture.Source)
+	}
+	img := g.Images[*texture.Source]
+
+	texMap := TextureMap{Set: info.TexCoord}
+	var data []byte
+	switch {
+	case img.BufferView != nil:
+		view, _, err := g.bufferView(*img.BufferView)
+		if err != nil {
+			return TextureMap{}, fmt.Errorf("image %d: %s", *texture.Source, err.Error())
+		}
+		data = view
+	case strings.HasPrefix(img.URI, "data:"):
+		decoded, err := readGLTFURI(img.URI, nil)
+		if err != nil {
+			return TextureMap{}, fmt.Errorf("image %d: %s", *texture.Source, err.Error())
+		}
+		data = decoded
+	default:
+		path, err := url.PathUnescape(img.URI)
+		if err != nil {
+			path = img.URI
+		}
+		texMap.Path = path
+		return texMap, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return TextureMap{}, fmt.Errorf("image %d: %s", *texture.Source, err.Error())
+	}
+	texMap.Image = decoded
+	return texMap, nil
+}
+
+// objectMaterial converts a glTF material into engine's material
+func (g *GLTF) objectMaterial(idx int) (ObjectMaterial, error) {
+	src := g.Materials[idx]
+	mat := DefaultObjectMaterial
+	mat.Name = src.Name
+	mat.Metallic = 1
+	mat.Roughness = 1
+
+	var err error
+	wrap := func(err error) error {
+		return fmt.Errorf("gltf material %d: %s", idx, err.Error())
+	}
+	if pbr := src.PBRMetallicRoughness; pbr != nil {
+		if pbr.BaseColorFactor != nil {
+			mat.Diffuse = glm.Vec4(*pbr.BaseColorFactor)
+		}
+		if pbr.MetallicFactor != nil {
+			mat.Metallic = *pbr.MetallicFactor
+		}
+		if pbr.RoughnessFactor != nil {
+			mat.Roughness = *pbr.RoughnessFactor
+		}
+		if mat.DiffuseMap, err = g.textureMap(pbr.BaseColorTexture); err != nil {
+			return mat, wrap(err)
+		}
+		if mat.MetallicRoughnessMap, err = g.textureMap(pbr.MetallicRoughnessTexture); err != nil {
+			return mat, wrap(err)
+		}
+	}
+	if src.EmissiveFactor != nil {
+		mat.Emission = glm.Vec4{src.EmissiveFactor[0], src.EmissiveFactor[1], src.EmissiveFactor[2], 1}
+	}
+	if mat.NormalMap, err = g.textureMap(src.NormalTexture); err != nil {
+		return mat, wrap(err)
+	}
+	if mat.OcclusionMap, err = g.textureMap(src.OcclusionTexture); err != nil {
+		return mat, wrap(err)
+	}
+	if mat.EmissionMap, err = g.textureMap(src.EmissiveTexture); err != nil {
+		return mat, wrap(err)
+	}
+	return mat, nil
+}
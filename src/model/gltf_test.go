@@ -0,0 +1,377 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Quad_gltf is a unit quad in the XY plane, scaled by its node and moved
+// up by its parent, with a skin of a single joint and a rotation animation.
+// Buffer and images are filled in with fmt.Sprintf
+var Quad_gltf = `{
+	"asset": {"version": "2.0"},
+	"scene": 0,
+	"scenes": [{"nodes": [0, 2]}],
+	"nodes": [
+		{"name": "Root", "translation": [0, 0, 2], "children": [1]},
+		{"name": "Quad", "mesh": 0, "scale": [2, 2, 2]},
+		{"name": "Bone", "rotation": [0, 0, 0, 1]}
+	],
+	"meshes": [{"primitives": [{
+		"attributes": {"POSITION": 0, "NORMAL": 1, "TEXCOORD_0": 2},
+		"indices": 3,
+		"material": 0
+	}]}],
+	"materials": [{
+		"name": "Painted",
+		"pbrMetallicRoughness": {
+			"baseColorFactor": [0.5, 0.5, 0.5, 1],
+			"baseColorTexture": {"index": 0},
+			"metallicFactor": 0.25,
+			"roughnessFactor": 0.75
+		},
+		"normalTexture": {"index": 1, "texCoord": 1}
+	}],
+	"textures": [{"source": 0}, {"source": 1}],
+	"images": [{"uri": "%s"}, {"uri": "normal%%20map.png"}],
+	"accessors": [
+		{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+		{"bufferView": 0, "byteOffset": 48, "componentType": 5126, "count": 4, "type": "VEC3"},
+		{"bufferView": 0, "byteOffset": 96, "componentType": 5126, "count": 4, "type": "VEC2"},
+		{"bufferView": 1, "componentType": 5123, "count": 6, "type": "SCALAR"},
+		{"bufferView": 2, "componentType": 5126, "count": 1, "type": "MAT4"},
+		{"bufferView": 2, "byteOffset": 64, "componentType": 5126, "count": 2, "type": "SCALAR"},
+		{"bufferView": 2, "byteOffset": 72, "componentType": 5126, "count": 2, "type": "VEC4"}
+	],
+	"bufferViews": [
+		{"buffer": 0, "byteOffset": 0, "byteLength": 128},
+		{"buffer": 0, "byteOffset": 128, "byteLength": 12},
+		{"buffer": 0, "byteOffset": 140, "byteLength": 104}
+	],
+	"buffers": [{%s"byteLength": 244}],
+	"skins": [{"joints": [2], "inverseBindMatrices": 4}],
+	"animations": [{
+		"name": "Spin",
+		"channels": [{"sampler": 0, "target": {"node": 2, "path": "rotation"}}],
+		"samplers": [{"input": 5, "output": 6}]
+	}]
+}`
+
+// quadBuffer returns the binary buffer referenced by Quad_gltf
+func quadBuffer() []byte {
+	var buf bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+	// positions
+	write(float32(0), float32(0), float32(0), float32(1), float32(0), float32(0),
+		float32(1), float32(1), float32(0), float32(0), float32(1), float32(0))
+	// normals
+	for idx := 0; idx < 4; idx++ {
+		write(float32(0), float32(0), float32(1))
+	}
+	// texture coordinates
+	write(float32(0), float32(1), float32(1), float32(1), float32(1), float32(0), float32(0), float32(0))
+	// indices
+	write(uint16(0), uint16(1), uint16(2), uint16(0), uint16(2), uint16(3))
+	// inverse bind matrix
+	write(glm.Translate3D(0, -1, 0))
+	// keyframe times and rotations
+	s := float32(math.Sqrt2 / 2)
+	write(float32(0), float32(1), float32(0), float32(0), float32(0), float32(1), float32(0), float32(0), s, s)
+	return buf.Bytes()
+}
+
+// pixelPNG returns a data uri of a single pixel image
+func pixelPNG(c color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, c)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// quadGLTF returns Quad_gltf with the buffer embedded as a data uri
+func quadGLTF() []byte {
+	uri := `"uri": "data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString(quadBuffer()) + `", `
+	return []byte(fmt.Sprintf(Quad_gltf, pixelPNG(color.RGBA{255, 0, 0, 255}), uri))
+}
+
+// quadGLB returns Quad_gltf packed into a binary glTF file
+func quadGLB() []byte {
+	doc := []byte(fmt.Sprintf(Quad_gltf, pixelPNG(color.RGBA{255, 0, 0, 255}), ""))
+	for len(doc)%4 != 0 {
+		doc = append(doc, ' ')
+	}
+	bin := quadBuffer()
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(doc) + 8 + len(bin))})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(doc)), 0x4E4F534A})
+	buf.Write(doc)
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004E4942})
+	buf.Write(bin)
+	return buf.Bytes()
+}
+
+func checkQuadObject(t *testing.T, obj model.Object) {
+	vert := obj.Vertices()
+	if len(vert) != 6 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+	prims := obj.Primitives()
+	if len(prims) != 1 || prims[0] != (model.Primitive{Material: 0, Offset: 0, Count: 6}) {
+		t.Fatalf("bad primitives: %+v", prims)
+	}
+
+	// scaled by 2, moved up by 2, then converted from Y up to Z up
+	expected := []glm.Vec3{{0, -2, 0}, {2, -2, 0}, {2, -2, 2}, {0, -2, 0}, {2, -2, 2}, {0, -2, 2}}
+	for idx := range expected {
+		if !vert[idx].Pos.ApproxEqual(expected[idx]) {
+			t.Fatalf("bad position of vertex %d, expected: %v, got: %v", idx, expected[idx], vert[idx].Pos)
+		}
+		if !vert[idx].Normal.ApproxEqual(glm.Vec3{0, -1, 0}) {
+			t.Fatalf("bad normal of vertex %d, got: %v", idx, vert[idx].Normal)
+		}
+		if vert[idx].Color != model.DefaultVertexColor {
+			t.Fatalf("bad color of vertex %d, got: %v", idx, vert[idx].Color)
+		}
+	}
+	if vert[2].Tex != (glm.Vec2{1, 0}) {
+		t.Fatalf("bad texture coordinates, got: %v", vert[2].Tex)
+	}
+
+	mats := obj.Materials()
+	if len(mats) != 1 {
+		t.Fatalf("wrong amount of materials, got: %d", len(mats))
+	}
+	mat := mats[0]
+	if mat.Name != "Painted" || mat.Diffuse != (glm.Vec4{0.5, 0.5, 0.5, 1}) || mat.Metallic != 0.25 || mat.Roughness != 0.75 {
+		t.Fatalf("bad material: %+v", mat)
+	}
+	if mat.DiffuseMap.Image == nil || mat.DiffuseMap.Path != "" {
+		t.Fatalf("base color image is not embedded: %+v", mat.DiffuseMap)
+	}
+	if r, g, _, _ := mat.DiffuseMap.Image.At(0, 0).RGBA(); r != 0xffff || g != 0 {
+		t.Fatalf("bad base color image pixel: %v", mat.DiffuseMap.Image.At(0, 0))
+	}
+	if mat.NormalMap.Path != "normal map.png" || mat.NormalMap.Set != 1 || mat.NormalMap.Image != nil {
+		t.Fatalf("bad normal map: %+v", mat.NormalMap)
+	}
+
+	gltf, ok := obj.(*model.GLTFObject)
+	if !ok {
+		t.Fatalf("not a glTF object: %T", obj)
+	}
+	nodes := gltf.Nodes()
+	if len(nodes) != 3 || nodes[0].Name != "Root" || len(nodes[0].Children) != 1 || nodes[0].Children[0] != 1 {
+		t.Fatalf("bad nodes: %+v", nodes)
+	}
+	if !nodes[0].LocalMatrix().ApproxEqual(glm.Translate3D(0, 0, 2)) {
+		t.Fatalf("bad root matrix: %v", nodes[0].LocalMatrix())
+	}
+
+	skins := gltf.Skins()
+	if len(skins) != 1 || len(skins[0].Joints) != 1 || skins[0].Joints[0] != 2 {
+		t.Fatalf("bad skins: %+v", skins)
+	}
+	if len(skins[0].InverseBindMatrices) != 1 || !skins[0].InverseBindMatrices[0].ApproxEqual(glm.Translate3D(0, -1, 0)) {
+		t.Fatalf("bad inverse bind matrices: %v", skins[0].InverseBindMatrices)
+	}
+
+	anims := gltf.Animations()
+	if len(anims) != 1 || anims[0].Name != "Spin" || len(anims[0].Channels) != 1 || len(anims[0].Samplers) != 1 {
+		t.Fatalf("bad animations: %+v", anims)
+	}
+	if channel := anims[0].Channels[0]; *channel.Target.Node != 2 || channel.Target.Path != "rotation" {
+		t.Fatalf("bad animation channel: %+v", channel)
+	}
+	sampler := anims[0].Samplers[0]
+	if sampler.Interpolation != "LINEAR" || len(sampler.Times) != 2 || sampler.Times[1] != 1 {
+		t.Fatalf("bad animation sampler: %+v", sampler)
+	}
+	if sampler.Components != 4 || len(sampler.Values) != 8 || sampler.Values[3] != 1 {
+		t.Fatalf("bad animation keyframes: %v", sampler.Values)
+	}
+}
+
+func TestImportGLTFObject(t *testing.T) {
+	obj, err := model.ImportGLTFObject(quadGLTF(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkQuadObject(t, obj)
+}
+
+func TestImportGLTFObjectBinary(t *testing.T) {
+	obj, err := model.ImportGLTFObject(quadGLB(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkQuadObject(t, obj)
+}
+
+func TestImportGLTFObjectExternalBuffer(t *testing.T) {
+	doc := fmt.Sprintf(Quad_gltf, pixelPNG(color.RGBA{255, 0, 0, 255}), `"uri": "quad%20data.bin", `)
+	obj, err := model.ImportGLTFObject([]byte(doc), func(name string) ([]byte, error) {
+		if name != "quad data.bin" {
+			return nil, errors.New("not found")
+		}
+		return quadBuffer(), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkQuadObject(t, obj)
+}
+
+func TestImportGLTFObjectKeepRaw(t *testing.T) {
+	obj, err := model.ImportGLTFObjectWithConfiguration(quadGLTF(), nil, nil, model.ImportConfiguration{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vert := obj.Vertices()
+	if !vert[2].Pos.ApproxEqual(glm.Vec3{2, 2, 2}) || !vert[2].Normal.ApproxEqual(glm.Vec3{0, 0, 1}) {
+		t.Fatalf("vertex was converted: %+v", vert[2])
+	}
+}
+
+func TestImportGLTFObjectStripAndColors(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0})
+	binary.Write(&buf, binary.LittleEndian, []uint8{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 0})
+	doc := `{
+		"asset": {"version": "2.0"},
+		"nodes": [{"mesh": 0}],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0, "COLOR_0": 1}, "mode": 5}]}],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+			{"bufferView": 0, "byteOffset": 48, "componentType": 5121, "normalized": true, "count": 4, "type": "VEC4"}
+		],
+		"bufferViews": [{"buffer": 0, "byteLength": 64}],
+		"buffers": [{"uri": "data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `", "byteLength": 64}]
+	}`
+	obj, err := model.ImportGLTFObjectWithConfiguration([]byte(doc), nil, nil, model.ImportConfiguration{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	if len(vert) != 6 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+	prims := obj.Primitives()
+	if len(prims) != 1 || prims[0].Material != -1 {
+		t.Fatalf("bad primitives: %+v", prims)
+	}
+	// second triangle of the strip has its winding flipped
+	if vert[3].Pos != (glm.Vec3{0, 1, 0}) || vert[4].Pos != (glm.Vec3{1, 0, 0}) || vert[5].Pos != (glm.Vec3{1, 1, 0}) {
+		t.Fatalf("bad strip triangle: %v, %v, %v", vert[3].Pos, vert[4].Pos, vert[5].Pos)
+	}
+	for idx := range vert {
+		if !vert[idx].Normal.ApproxEqual(glm.Vec3{0, 0, 1}) {
+			t.Fatalf("bad generated normal of vertex %d, got: %v", idx, vert[idx].Normal)
+		}
+	}
+	if vert[0].Color != (glm.Vec4{1, 0, 0, 1}) || vert[5].Color != (glm.Vec4{1, 1, 1, 0}) {
+		t.Fatalf("bad colors: %v, %v", vert[0].Color, vert[5].Color)
+	}
+}
+
+func TestImportGLTFObjectSeveralSkins(t *testing.T) {
+	// the quad is skinned and shown again by a node of a second skin
+	doc := string(quadGLTF())
+	for old, replacement := range map[string]string{
+		`"nodes": [0, 2]`:                            `"nodes": [0, 2, 3]`,
+		`"mesh": 0, "scale": [2, 2, 2]}`:             `"mesh": 0, "skin": 0}`,
+		`{"name": "Bone", "rotation": [0, 0, 0, 1]}`: `{"name": "Bone", "rotation": [0, 0, 0, 1]}, {"name": "Other", "mesh": 0, "skin": 1}`,
+		`"inverseBindMatrices": 4}]`:                 `"inverseBindMatrices": 4}, {"joints": [2]}]`,
+	} {
+		if !strings.Contains(doc, old) {
+			t.Fatalf("quad document has no %s", old)
+		}
+		doc = strings.Replace(doc, old, replacement, 1)
+	}
+	if _, err := model.ImportGLTFObject([]byte(doc), nil, nil); err == nil || !strings.Contains(err.Error(), "skin 1") {
+		t.Fatalf("expected an error for meshes of different skins, got: %v", err)
+	}
+}
+
+func TestGLTFReadIntegerAccessor(t *testing.T) {
+	// values above 2^24 have no exact float32, sparse replaces the second
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{1<<24 + 1, math.MaxUint32, 1, 1<<24 + 3})
+	doc := `{
+		"asset": {"version": "2.0"},
+		"accessors": [
+			{"bufferView": 0, "componentType": 5125, "count": 2, "type": "SCALAR",
+				"sparse": {"count": 1, "indices": {"bufferView": 1, "componentType": 5125}, "values": {"bufferView": 2}}},
+			{"bufferView": 0, "componentType": 5126, "count": 1, "type": "SCALAR"}
+		],
+		"bufferViews": [
+			{"buffer": 0, "byteLength": 8},
+			{"buffer": 0, "byteOffset": 8, "byteLength": 4},
+			{"buffer": 0, "byteOffset": 12, "byteLength": 4}
+		],
+		"buffers": [{"uri": "data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `", "byteLength": 16}]
+	}`
+	gltf, err := model.DecodeGLTF([]byte(doc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, components, err := gltf.ReadIntegerAccessor(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if components != 1 || len(values) != 2 || values[0] != 1<<24+1 || values[1] != 1<<24+3 {
+		t.Fatalf("bad integers: %v of %d components", values, components)
+	}
+	if _, _, err := gltf.ReadIntegerAccessor(1); err == nil {
+		t.Fatal("expected an error for a float accessor")
+	}
+}
+
+func TestImportGLTFObjectErrors(t *testing.T) {
+	buffer := `"buffers": [{"uri": "data:application/octet-stream;base64,AAAAAA==", "byteLength": 4}]`
+	cases := map[string]string{
+		"not json":          `glTF`,
+		"version":           `{"asset": {"version": "1.0"}}`,
+		"required ext":      `{"asset": {"version": "2.0"}, "extensionsRequired": ["KHR_draco_mesh_compression"]}`,
+		"external no load":  `{"asset": {"version": "2.0"}, "buffers": [{"uri": "data.bin", "byteLength": 4}]}`,
+		"short buffer":      `{"asset": {"version": "2.0"}, "buffers": [{"uri": "data:application/octet-stream;base64,AAAAAA==", "byteLength": 8}]}`,
+		"no position":       `{"asset": {"version": "2.0"}, "nodes": [{"mesh": 0}], "meshes": [{"primitives": [{"attributes": {}}]}]}`,
+		"accessor range":    `{"asset": {"version": "2.0"}, "nodes": [{"mesh": 0}], "meshes": [{"primitives": [{"attributes": {"POSITION": 3}}]}]}`,
+		"mesh range":        `{"asset": {"version": "2.0"}, "nodes": [{"mesh": 1}]}`,
+		"scene range":       `{"asset": {"version": "2.0"}, "scene": 1, "scenes": [{"nodes": []}]}`,
+		"view out of range": `{"asset": {"version": "2.0"}, "nodes": [{"mesh": 0}], "meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}], "accessors": [{"bufferView": 0, "componentType": 5126, "count": 1, "type": "VEC3"}], "bufferViews": [{"buffer": 0, "byteLength": 4}], ` + buffer + `}`,
+		"glb version":       "glTF\x01\x00\x00\x00\x0c\x00\x00\x00",
+	}
+	for name, doc := range cases {
+		if _, err := model.ImportGLTFObject([]byte(doc), nil, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package meshopt
+
+import (
+	"math"
+	"sort"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Vertex cache model of Tom Forsyth's "Linear-Speed Vertex Cache Optimisation"
+const (
+	cacheSize         = 32
+	cacheDecayPower   = 1.5
+	lastTriangleScore = 0.75
+	valenceBoostScale = 2.0
+	valenceBoostPower = 0.5
+)
+
+// vertexScore rates how much drawing a triangle with the vertex would help,
+// cachePosition is -1 for vertices that are not in the cache
+func vertexScore(cachePosition, remaining int) float32 {
+	if remaining == 0 {
+		return -1
+	}
+	var score float64
+	if cachePosition >= 0 {
+		if cachePosition < 3 {
+			score = lastTriangleScore
+		} else {
+			score = math.Pow(1-float64(cachePosition-3)/(cacheSize-3), cacheDecayPower)
+		}
+	}
+	score += valenceBoostScale * math.Pow(float64(remaining), -valenceBoostPower)
+	return float32(score)
+}
+
+// OptimizeVertexCache reorders triangles so that vertices are reused while
+// they are still in the post-transform cache. vertexCount is the number
+// of vertices indices refer to
+func OptimizeVertexCache(indices []uint32, vertexCount int) []uint32 {
+	triangleCount := len(indices) / 3
+	if triangleCount == 0 {
+		return nil
+	}
+
+	// triangles using every vertex, as offsets into adjacency
+	remaining := make([]int, vertexCount)
+	for _, v := range indices[:triangleCount*3] {
+		remaining[v]++
+	}
+	offsets := make([]int, vertexCount+1)
+	for v := 0; v < vertexCount; v++ {
+		offsets[v+1] = offsets[v] + remaining[v]
+	}
+	adjacency := make([]int, triangleCount*3)
+	fill := append([]int(nil), offsets[:vertexCount]...)
+	for t := 0; t < triangleCount; t++ {
+		for c := 0; c < 3; c++ {
+			v := indices[t*3+c]
+			adjacency[fill[v]] = t
+			fill[v]++
+		}
+	}
+
+	cachePosition := make([]int, vertexCount)
+	scores := make([]float32, vertexCount)
+	for v := range scores {
+		cachePosition[v] = -1
+		scores[v] = vertexScore(-1, remaining[v])
+	}
+	emitted := make([]bool, triangleCount)
+
+	result := make([]uint32, 0, triangleCount*3)
+	cache := make([]uint32, 0, cacheSize+3)
+	best, cursor := -1, 0
+	for len(result) < triangleCount*3 {
+		if best < 0 {
+			// nothing in the cache helps, take the next triangle in order
+			for emitted[cursor] {
+				cursor++
+			}
+			best = cursor
+		}
+
+		tri := indices[best*3 : best*3+3]
+		result = append(result, tri...)
+		emitted[best] = true
+		for _, v := range tri {
+			remaining[v]--
+			// drop the triangle from the vertex's adjacency
+			list := adjacency[offsets[v] : offsets[v]+remaining[v]+1]
+			for i, t := range list {
+				if t == best {
+					list[i] = list[len(list)-1]
+					break
+				}
+			}
+		}
+
+		// move the triangle's vertices to the front of the cache
+		next := make([]uint32, 0, cacheSize+3)
+		next = append(next, tri...)
+		for _, v := range cache {
+			if v != tri[0] && v != tri[1] && v != tri[2] {
+				next = append(next, v)
+			}
+		}
+		for _, v := range next[min(len(next), cacheSize):] {
+			cachePosition[v] = -1
+			scores[v] = vertexScore(-1, remaining[v])
+		}
+		if len(next) > cacheSize {
+			next = next[:cacheSize]
+		}
+		cache = next
+
+		// rescore triangles touching the cache and pick the best of them
+		for pos, v := range cache {
+			cachePosition[v] = pos
+			scores[v] = vertexScore(pos, remaining[v])
+		}
+		best = -1
+		var bestScore float32 = -1
+		for _, v := range cache {
+			for _, t := range adjacency[offsets[v] : offsets[v]+remaining[v]] {
+				score := scores[indices[t*3]] + scores[indices[t*3+1]] + scores[indices[t*3+2]]
+				if score > bestScore {
+					best, bestScore = t, score
+				}
+			}
+		}
+	}
+	return result
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ACMR returns the average cache miss ratio of drawing indices through a
+// FIFO cache of size vertices: transformed vertices per triangle,
+// 3 for no reuse and about 0.5 at best
+func ACMR(indices []uint32, size int) float32 {
+	triangleCount := len(indices) / 3
+	if triangleCount == 0 {
+		return 0
+	}
+	var misses int
+	fifo := make([]uint32, 0, size)
+	for _, v := range indices[:triangleCount*3] {
+		hit := false
+		for _, c := range fifo {
+			hit = hit || c == v
+		}
+		if hit {
+			continue
+		}
+		misses++
+		if len(fifo) == size {
+			fifo = fifo[1:]
+		}
+		fifo = append(fifo, v)
+	}
+	return float32(misses) / float32(triangleCount)
+}
+
+// OptimizeOverdraw reorders clusters of triangles so that the ones facing
+// away from the mesh's center, which tend to occlude the rest, are drawn
+// first. Clusters start where the vertex cache is flushed, which keeps most
+// of the ordering made by OptimizeVertexCache
+func OptimizeOverdraw(vertices []model.Vertex, indices []uint32) []uint32 {
+	triangleCount := len(indices) / 3
+	if triangleCount == 0 {
+		return nil
+	}
+
+	// a cluster starts at every triangle that misses the cache three times
+	const clusterCacheSize = 16
+	var starts []int
+	var fifo []uint32
+	for t := 0; t < triangleCount; t++ {
+		misses := 0
+		for _, v := range indices[t*3 : t*3+3] {
+			hit := false
+			for _, c := range fifo {
+				hit = hit || c == v
+			}
+			if hit {
+				continue
+			}
+			misses++
+			if len(fifo) == clusterCacheSize {
+				fifo = fifo[1:]
+			}
+			fifo = append(fifo, v)
+		}
+		if misses == 3 || t == 0 {
+			starts = append(starts, t)
+		}
+	}
+	starts = append(starts, triangleCount)
+
+	var meshCenter glm.Vec3
+	var meshArea float32
+	type cluster struct {
+		start, end int
+		center     glm.Vec3
+		normal     glm.Vec3
+		area       float32
+		sortKey    float32
+	}
+	clusters := make([]cluster, len(starts)-1)
+	for c := range clusters {
+		cl := &clusters[c]
+		cl.start, cl.end = starts[c], starts[c+1]
+		for t := cl.start; t < cl.end; t++ {
+			a, b, d := vertices[indices[t*3]].Pos, vertices[indices[t*3+1]].Pos, vertices[indices[t*3+2]].Pos
+			cross := b.Sub(a).Cross(d.Sub(a))
+			area := cross.Len() / 2
+			centroid := a.Add(b).Add(d).Mul(1.0 / 3)
+			cl.center = cl.center.Add(centroid.Mul(area))
+			cl.normal = cl.normal.Add(cross)
+			cl.area += area
+		}
+		meshCenter = meshCenter.Add(cl.center)
+		meshArea += cl.area
+		if cl.area > 0 {
+			cl.center = cl.center.Mul(1 / cl.area)
+		}
+		if cl.normal.Len() > 0 {
+			cl.normal = cl.normal.Normalize()
+		}
+	}
+	if meshArea > 0 {
+		meshCenter = meshCenter.Mul(1 / meshArea)
+	}
+	for c := range clusters {
+		clusters[c].sortKey = clusters[c].center.Sub(meshCenter).Dot(clusters[c].normal)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].sortKey > clusters[j].sortKey
+	})
+
+	result := make([]uint32, 0, triangleCount*3)
+	for _, cl := range clusters {
+		result = append(result, indices[cl.start*3:cl.end*3]...)
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package meshopt prepares imported meshes for rendering: it reorders
+// triangles for the post-transform vertex cache and for less overdraw,
+// and simplifies meshes into levels of detail.
+// Meshes are vertices and triangle lists of indices into them.
+package meshopt
+
+import (
+	"github.com/devblok/koru/src/model"
+)
+
+// Index returns indices of the triangle list made by vertices, where
+// identical vertices refer to the first of them. Vertices are not moved,
+// so the indices stay valid for the original slice
+func Index(vertices []model.Vertex) []uint32 {
+	first := make(map[model.Vertex]uint32, len(vertices))
+	indices := make([]uint32, len(vertices)-len(vertices)%3)
+	for idx := range indices {
+		v, ok := first[vertices[idx]]
+		if !ok {
+			v = uint32(idx)
+			first[vertices[idx]] = v
+		}
+		indices[idx] = v
+	}
+	return indices
+}
+
+// LODConfiguration configures GenerateLODs
+type LODConfiguration struct {
+	// Levels is the maximum number of levels, including full detail
+	Levels int
+
+	// Ratio is the fraction of triangles kept by each level
+	Ratio float32
+
+	// MaxError stops simplification beyond this deviation,
+	// relative to the mesh's size
+	MaxError float32
+}
+
+// DefaultLODConfiguration keeps halving the mesh up to four levels
+var DefaultLODConfiguration = LODConfiguration{
+	Levels:   4,
+	Ratio:    0.5,
+	MaxError: 0.05,
+}
+
+// GenerateLODs builds levels of detail for the vertices of an object, every
+// primitive simplified on its own so that materials stay apart. The first
+// level is the full mesh, every level is optimized for the vertex cache and
+// overdraw. Levels stop early when simplification can't make progress
+func GenerateLODs(vertices []model.Vertex, primitives []model.Primitive, cfg LODConfiguration) []model.LOD {
+	if cfg.Levels < 1 {
+		return nil
+	}
+
+	// indices of every primitive at the current level
+	current := make([][]uint32, len(primitives))
+	for p, prim := range primitives {
+		indices := Index(vertices[prim.Offset : prim.Offset+prim.Count])
+		for idx := range indices {
+			indices[idx] += uint32(prim.Offset)
+		}
+		current[p] = indices
+	}
+
+	var lods []model.LOD
+	var levelError float32
+	for level := 0; level < cfg.Levels; level++ {
+		if level > 0 {
+			var before, after int
+			next := make([][]uint32, len(current))
+			for p, indices := range current {
+				target := int(float32(len(indices)/3) * cfg.Ratio)
+				simplified, reached := Simplify(vertices, indices, target, cfg.MaxError)
+				next[p] = simplified
+				before += len(indices)
+				after += len(simplified)
+				if reached > levelError {
+					levelError = reached
+				}
+			}
+			if after >= before {
+				break
+			}
+			current = next
+		}
+
+		lod := model.LOD{Error: levelError}
+		for p, indices := range current {
+			optimized := OptimizeOverdraw(vertices, OptimizeVertexCache(indices, len(vertices)))
+			lod.Primitives = append(lod.Primitives, model.Primitive{
+				Material: primitives[p].Material,
+				Offset:   len(lod.Indices),
+				Count:    len(optimized),
+			})
+			lod.Indices = append(lod.Indices, optimized...)
+		}
+		lods = append(lods, lod)
+	}
+	return lods
+}
+
+// ApplyLODs generates levels of detail for an object and sets them on it
+func ApplyLODs(obj model.Object, cfg LODConfiguration) {
+	obj.SetLODs(GenerateLODs(obj.Vertices(), obj.Primitives(), cfg))
+}
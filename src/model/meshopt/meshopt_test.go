@@ -0,0 +1,236 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package meshopt_test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	"github.com/devblok/koru/src/model/meshopt"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// boxMesh returns a unit cube centered on the origin as a triangle list,
+// every side split into n by n quads with vertices of its own
+func boxMesh(n int) []model.Vertex {
+	var vertices []model.Vertex
+	axes := []struct{ normal, u, v glm.Vec3 }{
+		{glm.Vec3{1, 0, 0}, glm.Vec3{0, 1, 0}, glm.Vec3{0, 0, 1}},
+		{glm.Vec3{-1, 0, 0}, glm.Vec3{0, 0, 1}, glm.Vec3{0, 1, 0}},
+		{glm.Vec3{0, 1, 0}, glm.Vec3{0, 0, 1}, glm.Vec3{1, 0, 0}},
+		{glm.Vec3{0, -1, 0}, glm.Vec3{1, 0, 0}, glm.Vec3{0, 0, 1}},
+		{glm.Vec3{0, 0, 1}, glm.Vec3{1, 0, 0}, glm.Vec3{0, 1, 0}},
+		{glm.Vec3{0, 0, -1}, glm.Vec3{0, 1, 0}, glm.Vec3{1, 0, 0}},
+	}
+	for _, side := range axes {
+		corner := func(i, j int) model.Vertex {
+			u, v := float32(i)/float32(n), float32(j)/float32(n)
+			pos := side.normal.Mul(0.5).Add(side.u.Mul(u - 0.5)).Add(side.v.Mul(v - 0.5))
+			return model.Vertex{Pos: pos, Normal: side.normal, Tex: glm.Vec2{u, v}, Color: model.DefaultVertexColor}
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				vertices = append(vertices,
+					corner(i, j), corner(i+1, j), corner(i+1, j+1),
+					corner(i, j), corner(i+1, j+1), corner(i, j+1))
+			}
+		}
+	}
+	return vertices
+}
+
+// sortedTriangles returns the triangles of indices in a comparable form
+func sortedTriangles(indices []uint32) [][3]uint32 {
+	tris := make([][3]uint32, len(indices)/3)
+	for t := range tris {
+		tris[t] = [3]uint32{indices[t*3], indices[t*3+1], indices[t*3+2]}
+	}
+	sort.Slice(tris, func(i, j int) bool {
+		for c := 0; c < 3; c++ {
+			if tris[i][c] != tris[j][c] {
+				return tris[i][c] < tris[j][c]
+			}
+		}
+		return false
+	})
+	return tris
+}
+
+func sameTriangles(t *testing.T, expected, got []uint32) {
+	a, b := sortedTriangles(expected), sortedTriangles(got)
+	if len(a) != len(b) {
+		t.Fatalf("triangle count changed from %d to %d", len(a), len(b))
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			t.Fatalf("triangles differ: %v and %v", a[idx], b[idx])
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	vertices := boxMesh(2)
+	indices := meshopt.Index(vertices)
+	if len(indices) != len(vertices) {
+		t.Fatalf("wrong amount of indices, got: %d", len(indices))
+	}
+	unique := make(map[uint32]bool)
+	for idx, v := range indices {
+		if vertices[v] != vertices[idx] {
+			t.Fatalf("index %d refers to a different vertex", idx)
+		}
+		if v > uint32(idx) {
+			t.Fatalf("index %d does not refer to the first identical vertex", idx)
+		}
+		unique[v] = true
+	}
+	// 9 corners on each of 6 sides
+	if len(unique) != 54 {
+		t.Fatalf("wrong amount of unique vertices, got: %d", len(unique))
+	}
+}
+
+func TestOptimizeVertexCache(t *testing.T) {
+	vertices := boxMesh(8)
+	indices := meshopt.Index(vertices)
+
+	shuffled := make([]uint32, len(indices))
+	order := rand.New(rand.NewSource(1)).Perm(len(indices) / 3)
+	for t, from := range order {
+		copy(shuffled[t*3:t*3+3], indices[from*3:from*3+3])
+	}
+
+	optimized := meshopt.OptimizeVertexCache(shuffled, len(vertices))
+	sameTriangles(t, shuffled, optimized)
+
+	before, after := meshopt.ACMR(shuffled, 16), meshopt.ACMR(optimized, 16)
+	if after >= before || after > 1 {
+		t.Fatalf("cache miss ratio did not improve enough, before: %v, after: %v", before, after)
+	}
+}
+
+func TestOptimizeOverdraw(t *testing.T) {
+	vertices := boxMesh(4)
+	indices := meshopt.OptimizeVertexCache(meshopt.Index(vertices), len(vertices))
+	optimized := meshopt.OptimizeOverdraw(vertices, indices)
+	sameTriangles(t, indices, optimized)
+
+	if before, after := meshopt.ACMR(indices, 16), meshopt.ACMR(optimized, 16); after > before*1.5 {
+		t.Fatalf("overdraw ordering lost the cache ordering, before: %v, after: %v", before, after)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	vertices := boxMesh(6)
+	indices := meshopt.Index(vertices)
+
+	simplified, reached := meshopt.Simplify(vertices, indices, 24, 0.01)
+	if count := len(simplified) / 3; count >= len(indices)/3/4 {
+		t.Fatalf("box was not simplified enough, got %d triangles", count)
+	}
+	if reached > 0.01 {
+		t.Fatalf("error over the target, got: %v", reached)
+	}
+
+	// flat sides stay flat and keep facing out, the box keeps its size
+	bounds := model.ComputeIndexedBounds(vertices, simplified)
+	if !bounds.Box.Min.ApproxEqual(glm.Vec3{-0.5, -0.5, -0.5}) || !bounds.Box.Max.ApproxEqual(glm.Vec3{0.5, 0.5, 0.5}) {
+		t.Fatalf("box changed size: %+v", bounds.Box)
+	}
+	for idx := 0; idx < len(simplified); idx += 3 {
+		a, b, c := vertices[simplified[idx]], vertices[simplified[idx+1]], vertices[simplified[idx+2]]
+		normal := b.Pos.Sub(a.Pos).Cross(c.Pos.Sub(a.Pos)).Normalize()
+		if normal.Dot(a.Normal) < 0.999 || a.Normal != b.Normal || a.Normal != c.Normal {
+			t.Fatalf("triangle %d left its side: %v, %v, %v", idx/3, a, b, c)
+		}
+	}
+
+	// nothing to do below the target
+	same, reached := meshopt.Simplify(vertices, indices, len(indices), 0.01)
+	if len(same) != len(indices) || reached != 0 {
+		t.Fatalf("mesh under target was changed")
+	}
+}
+
+func TestSimplifyKeepsBorders(t *testing.T) {
+	// a single side of the box is an open mesh
+	vertices := boxMesh(4)[:4*4*6]
+	simplified, _ := meshopt.Simplify(vertices, meshopt.Index(vertices), 1, 1)
+
+	border := make(map[glm.Vec3]bool)
+	for _, idx := range simplified {
+		border[vertices[idx].Pos] = true
+	}
+	for _, v := range vertices {
+		onEdge := v.Pos[1] == -0.5 || v.Pos[1] == 0.5 || v.Pos[2] == -0.5 || v.Pos[2] == 0.5
+		if onEdge && !border[v.Pos] {
+			t.Fatalf("border vertex %v was removed", v.Pos)
+		}
+	}
+}
+
+func TestGenerateLODs(t *testing.T) {
+	vertices := boxMesh(8)
+	half := len(vertices) / 2
+	primitives := []model.Primitive{
+		{Material: 0, Offset: 0, Count: half},
+		{Material: 1, Offset: half, Count: len(vertices) - half},
+	}
+	lods := meshopt.GenerateLODs(vertices, primitives, meshopt.DefaultLODConfiguration)
+	if len(lods) < 2 || len(lods) > meshopt.DefaultLODConfiguration.Levels {
+		t.Fatalf("wrong amount of levels, got: %d", len(lods))
+	}
+	if len(lods[0].Indices) != len(vertices) || lods[0].Error != 0 {
+		t.Fatalf("first level is not the full mesh")
+	}
+
+	for level, lod := range lods {
+		if level > 0 && len(lod.Indices) >= len(lods[level-1].Indices) {
+			t.Fatalf("level %d is not simpler than the one before", level)
+		}
+		if len(lod.Primitives) != 2 {
+			t.Fatalf("level %d has %d primitives", level, len(lod.Primitives))
+		}
+		for p, prim := range lod.Primitives {
+			if prim.Material != p {
+				t.Fatalf("level %d lost material of primitive %d", level, p)
+			}
+			// indices stay in the vertex range of their primitive
+			for _, idx := range lod.Indices[prim.Offset : prim.Offset+prim.Count] {
+				if int(idx) < primitives[p].Offset || int(idx) >= primitives[p].Offset+primitives[p].Count {
+					t.Fatalf("level %d primitive %d refers to vertex %d", level, p, idx)
+				}
+			}
+		}
+	}
+}
+
+func TestApplyLODs(t *testing.T) {
+	obj, err := model.ImportOBJObject([]byte(`
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+f 1 2 3 4
+`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.LODs()) != 0 {
+		t.Fatal("objects should have no levels until they are made")
+	}
+	meshopt.ApplyLODs(obj, meshopt.DefaultLODConfiguration)
+	if lods := obj.LODs(); len(lods) != 1 || len(lods[0].Indices) != 6 {
+		t.Fatalf("bad levels of an object that can't be simplified: %+v", lods)
+	}
+
+	bounds := obj.Bounds()
+	if bounds.Box.Extent() != (glm.Vec3{1, 0, 1}) || bounds.Sphere.Radius <= 0 {
+		t.Fatalf("bad object bounds: %+v", bounds)
+	}
+}
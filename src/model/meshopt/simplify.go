@@ -0,0 +1,299 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package meshopt
+
+import (
+	"math"
+	"sort"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// quadric is the symmetric 4x4 matrix of Garland and Heckbert's error
+// metric, upper triangle only, with the area it was accumulated over
+type quadric struct {
+	a00, a01, a02, a03 float64
+	a11, a12, a13      float64
+	a22, a23           float64
+	a33                float64
+	weight             float64
+}
+
+// planeQuadric returns the quadric of the plane through p with normal n
+func planeQuadric(n glm.Vec3, p glm.Vec3, weight float64) quadric {
+	a, b, c := float64(n[0]), float64(n[1]), float64(n[2])
+	d := -(a*float64(p[0]) + b*float64(p[1]) + c*float64(p[2]))
+	return quadric{
+		a00: a * a * weight, a01: a * b * weight, a02: a * c * weight, a03: a * d * weight,
+		a11: b * b * weight, a12: b * c * weight, a13: b * d * weight,
+		a22: c * c * weight, a23: c * d * weight,
+		a33: d * d * weight,
+
+		weight: weight,
+	}
+}
+
+func (q quadric) add(o quadric) quadric {
+	return quadric{
+		q.a00 + o.a00, q.a01 + o.a01, q.a02 + o.a02, q.a03 + o.a03,
+		q.a11 + o.a11, q.a12 + o.a12, q.a13 + o.a13,
+		q.a22 + o.a22, q.a23 + o.a23,
+		q.a33 + o.a33,
+		q.weight + o.weight,
+	}
+}
+
+// error returns the mean squared distance of p to the planes of the quadric
+func (q quadric) error(p glm.Vec3) float64 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	e := x*(q.a00*x+q.a01*y+q.a02*z+q.a03) +
+		y*(q.a01*x+q.a11*y+q.a12*z+q.a13) +
+		z*(q.a02*x+q.a12*y+q.a22*z+q.a23) +
+		(q.a03*x + q.a13*y + q.a23*z + q.a33)
+	if q.weight > 0 {
+		e /= q.weight
+	}
+	return math.Abs(e)
+}
+
+// Simplify collapses edges of the triangle list until it has at most
+// targetCount triangles or no collapse stays within targetError. Vertices
+// keep their positions, a collapse moves one end of an edge onto the other,
+// so the result indexes the same vertices. Vertices sharing a position are
+// moved together, vertices on open borders never move. The error is
+// relative to the size of the mesh, the one reached is returned
+func Simplify(vertices []model.Vertex, indices []uint32, targetCount int, targetError float32) ([]uint32, float32) {
+	triangleCount := len(indices) / 3
+	if triangleCount <= targetCount || triangleCount == 0 {
+		return append([]uint32(nil), indices[:triangleCount*3]...), 0
+	}
+
+	// weld vertices by position, positions are what the topology is made of
+	canonical := make(map[glm.Vec3]int)
+	position := make(map[uint32]int, len(indices))
+	var points []glm.Vec3
+	var wedges [][]uint32
+	for _, v := range indices[:triangleCount*3] {
+		if _, ok := position[v]; ok {
+			continue
+		}
+		p, ok := canonical[vertices[v].Pos]
+		if !ok {
+			p = len(points)
+			canonical[vertices[v].Pos] = p
+			points = append(points, vertices[v].Pos)
+			wedges = append(wedges, nil)
+		}
+		position[v] = p
+		wedges[p] = append(wedges[p], v)
+	}
+
+	bounds := model.NewBounds(points)
+	scale := float64(bounds.Box.Extent().Len())
+	if scale == 0 {
+		scale = 1
+	}
+	maxError := float64(targetError) * scale
+	maxError *= maxError
+
+	tris := make([][3]uint32, triangleCount)
+	for t := range tris {
+		tris[t] = [3]uint32{indices[t*3], indices[t*3+1], indices[t*3+2]}
+	}
+
+	quadrics := make([]quadric, len(points))
+	pointTriangles := make([][]int, len(points))
+	edgeUse := make(map[[2]int]int)
+	for t, tri := range tris {
+		a, b, c := position[tri[0]], position[tri[1]], position[tri[2]]
+		cross := points[b].Sub(points[a]).Cross(points[c].Sub(points[a]))
+		if area := cross.Len() / 2; area > 0 {
+			q := planeQuadric(cross.Normalize(), points[a], float64(area))
+			for _, p := range []int{a, b, c} {
+				quadrics[p] = quadrics[p].add(q)
+			}
+		}
+		for _, p := range []int{a, b, c} {
+			pointTriangles[p] = append(pointTriangles[p], t)
+		}
+		for _, e := range [][2]int{{a, b}, {b, c}, {c, a}} {
+			if e[0] > e[1] {
+				e[0], e[1] = e[1], e[0]
+			}
+			edgeUse[e]++
+		}
+	}
+
+	// open and non-manifold edges keep their vertices in place
+	locked := make([]bool, len(points))
+	for e, uses := range edgeUse {
+		if uses != 2 {
+			locked[e[0]], locked[e[1]] = true, true
+		}
+	}
+
+	// remap follows wedges moved by collapses
+	remap := make(map[uint32]uint32)
+	resolve := func(v uint32) uint32 {
+		for {
+			next, ok := remap[v]
+			if !ok {
+				return v
+			}
+			v = next
+		}
+	}
+	pointOf := func(v uint32) int {
+		return position[resolve(v)]
+	}
+	alive := make([]bool, triangleCount)
+	aliveCount := 0
+	for t, tri := range tris {
+		a, b, c := position[tri[0]], position[tri[1]], position[tri[2]]
+		alive[t] = a != b && b != c && c != a
+		if alive[t] {
+			aliveCount++
+		}
+	}
+
+	type collapse struct {
+		from, to int
+		cost     float64
+	}
+	var reached float64
+	for aliveCount > targetCount {
+		var candidates []collapse
+		seen := make(map[[2]int]bool)
+		for t, tri := range tris {
+			if !alive[t] {
+				continue
+			}
+			p := [3]int{pointOf(tri[0]), pointOf(tri[1]), pointOf(tri[2])}
+			for c := 0; c < 3; c++ {
+				a, b := p[c], p[(c+1)%3]
+				if a > b {
+					a, b = b, a
+				}
+				if seen[[2]int{a, b}] {
+					continue
+				}
+				seen[[2]int{a, b}] = true
+
+				q := quadrics[a].add(quadrics[b])
+				best := collapse{cost: math.Inf(1)}
+				if !locked[a] {
+					best = collapse{from: a, to: b, cost: q.error(points[b])}
+				}
+				if !locked[b] {
+					if cost := q.error(points[a]); cost < best.cost {
+						best = collapse{from: b, to: a, cost: cost}
+					}
+				}
+				if !math.IsInf(best.cost, 1) && best.cost <= maxError {
+					candidates = append(candidates, best)
+				}
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].cost < candidates[j].cost })
+
+		touched := make([]bool, len(points))
+		collapsed := 0
+		for _, cand := range candidates {
+			if aliveCount <= targetCount {
+				break
+			}
+			if touched[cand.from] || touched[cand.to] {
+				continue
+			}
+			if flips(tris, alive, pointTriangles[cand.from], cand.from, cand.to, points, pointOf) {
+				continue
+			}
+
+			// move every wedge of the source onto a wedge of the target,
+			// preferring one that shared a triangle with it
+			for _, w := range wedges[cand.from] {
+				if resolve(w) != w {
+					continue
+				}
+				target := wedges[cand.to][0]
+			search:
+				for _, t := range pointTriangles[cand.from] {
+					for _, corner := range tris[t] {
+						if resolve(corner) != w {
+							continue
+						}
+						for _, other := range tris[t] {
+							if pointOf(other) == cand.to {
+								target = resolve(other)
+								break search
+							}
+						}
+					}
+				}
+				remap[w] = target
+			}
+
+			quadrics[cand.to] = quadrics[cand.to].add(quadrics[cand.from])
+			pointTriangles[cand.to] = append(pointTriangles[cand.to], pointTriangles[cand.from]...)
+			for _, t := range pointTriangles[cand.from] {
+				if !alive[t] {
+					continue
+				}
+				a, b, c := pointOf(tris[t][0]), pointOf(tris[t][1]), pointOf(tris[t][2])
+				if a == b || b == c || c == a {
+					alive[t] = false
+					aliveCount--
+				}
+			}
+			touched[cand.from], touched[cand.to] = true, true
+			if cand.cost > reached {
+				reached = cand.cost
+			}
+			collapsed++
+		}
+		if collapsed == 0 {
+			break
+		}
+	}
+
+	result := make([]uint32, 0, aliveCount*3)
+	for t, tri := range tris {
+		if alive[t] {
+			result = append(result, resolve(tri[0]), resolve(tri[1]), resolve(tri[2]))
+		}
+	}
+	return result, float32(math.Sqrt(reached) / scale)
+}
+
+// flips reports whether moving point from onto point to would turn
+// any of the triangles around it over, or collapse it to a sliver
+func flips(tris [][3]uint32, alive []bool, around []int, from, to int, points []glm.Vec3, pointOf func(uint32) int) bool {
+	for _, t := range around {
+		if !alive[t] {
+			continue
+		}
+		p := [3]int{pointOf(tris[t][0]), pointOf(tris[t][1]), pointOf(tris[t][2])}
+		if p[0] == to || p[1] == to || p[2] == to {
+			// removed by the collapse
+			continue
+		}
+		before := points[p[1]].Sub(points[p[0]]).Cross(points[p[2]].Sub(points[p[0]]))
+		for c := range p {
+			if p[c] == from {
+				p[c] = to
+			}
+		}
+		after := points[p[1]].Sub(points[p[0]]).Cross(points[p[2]].Sub(points[p[0]]))
+		if before.Len() == 0 || after.Len() == 0 {
+			continue
+		}
+		if before.Normalize().Dot(after.Normalize()) < 0.25 {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,7 @@ package model
 
 import (
 	"image"
+	"sync"
 	"unsafe"
 
 	vk "github.com/devblok/vulkan"
@@ -32,6 +33,11 @@ type Object interface {
 	// Has to be thread-safe
 	Rotation() glm.Mat4
 
+	// Matrix returns the object's transform in world space,
+	// Transform implements the methods above for embedding.
+	// Has to be thread-safe
+	Matrix() glm.Mat4
+
 	// Vertices returns the vertices for Renderer use,
 	// so it has to match the descriptors exactly
 	Vertices() []Vertex
@@ -39,6 +45,182 @@ type Object interface {
 	// Texture returns the raw data of a color texture image
 	// for use in the Renderer
 	Texture() image.Image
+
+	// Materials returns all the materials referenced by Primitives
+	Materials() []ObjectMaterial
+
+	// Primitives returns the ranges of Vertices that are
+	// drawn with a single material
+	Primitives() []Primitive
+
+	// Skeleton returns the skeleton that deforms Vertices,
+	// nil if the object is not skinned
+	Skeleton() *Skeleton
+
+	// Clips returns the animation clips of the Skeleton
+	Clips() []AnimationClip
+
+	// Bounds returns the bounding volumes of Vertices
+	Bounds() Bounds
+
+	// LODs returns the levels of detail, most detailed first.
+	// Empty until they are made with SetLODs.
+	// Has to be thread-safe
+	LODs() []LOD
+
+	// SetLODs sets the levels of detail.
+	// Has to be thread-safe
+	SetLODs([]LOD)
+}
+
+// ImportConfiguration configures how importers convert the source data
+type ImportConfiguration struct {
+	// KeepRaw disables the conversion of axes, units and texture
+	// coordinates into engine's convention, which is Z up, distances
+	// in meters and the origin of textures at the top left, the
+	// first row of the image, like Vulkan samples it
+	KeepRaw bool
+}
+
+// yUpToZUp rotates the Y up axes of OBJ, glTF and most Collada
+// files into engine's Z up, keeping the handedness
+var yUpToZUp = glm.Mat3{1, 0, 0, 0, 0, 1, 0, -1, 0}
+
+// flipV moves the origin of a texture coordinate between the bottom
+// left, where OBJ and Collada have it, and the top left
+func flipV(tex glm.Vec2) glm.Vec2 {
+	return glm.Vec2{tex[0], 1 - tex[1]}
+}
+
+// meshData holds what every importer produces and implements the
+// mesh part of Object once for all of them
+type meshData struct {
+	mutex sync.RWMutex
+
+	vertices   []Vertex
+	texture    image.Image
+	materials  []ObjectMaterial
+	primitives []Primitive
+	bounds     Bounds
+	lods       []LOD
+	skeleton   *Skeleton
+	clips      []AnimationClip
+}
+
+func newMeshData(vertices []Vertex, texture image.Image, materials []ObjectMaterial,
+	primitives []Primitive, skeleton *Skeleton, clips []AnimationClip) meshData {
+	return meshData{
+		vertices:   vertices,
+		texture:    texture,
+		materials:  materials,
+		primitives: primitives,
+		bounds:     ComputeBounds(vertices),
+		skeleton:   skeleton,
+		clips:      clips,
+	}
+}
+
+// Vertices implements interface
+func (m *meshData) Vertices() []Vertex {
+	return m.vertices
+}
+
+// Texture implements interface
+func (m *meshData) Texture() image.Image {
+	return m.texture
+}
+
+// Materials implements interface
+func (m *meshData) Materials() []ObjectMaterial {
+	return m.materials
+}
+
+// Primitives implements interface
+func (m *meshData) Primitives() []Primitive {
+	return m.primitives
+}
+
+// Bounds implements interface
+func (m *meshData) Bounds() Bounds {
+	return m.bounds
+}
+
+// LODs implements interface
+func (m *meshData) LODs() []LOD {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.lods
+}
+
+// SetLODs implements interface
+func (m *meshData) SetLODs(lods []LOD) {
+	m.mutex.Lock()
+	m.lods = lods
+	m.mutex.Unlock()
+}
+
+// Skeleton implements interface, nil for meshes that are not skinned
+func (m *meshData) Skeleton() *Skeleton {
+	return m.skeleton
+}
+
+// Clips implements interface
+func (m *meshData) Clips() []AnimationClip {
+	return m.clips
+}
+
+// ObjectMaterial is the material of an imported object,
+// resolved from whatever the source format describes
+type ObjectMaterial struct {
+	Name      string
+	Emission  glm.Vec4
+	Ambient   glm.Vec4
+	Diffuse   glm.Vec4
+	Specular  glm.Vec4
+	Shininess float32
+
+	DiffuseMap  TextureMap
+	SpecularMap TextureMap
+	NormalMap   TextureMap
+	EmissionMap TextureMap
+
+	// Metallic and Roughness are the factors of PBR materials,
+	// Diffuse holds their base color
+	Metallic  float32
+	Roughness float32
+
+	MetallicRoughnessMap TextureMap
+	OcclusionMap         TextureMap
+}
+
+// DefaultObjectMaterial is used for primitives that have no material
+var DefaultObjectMaterial = ObjectMaterial{
+	Name:     "default",
+	Ambient:  glm.Vec4{0, 0, 0, 1},
+	Diffuse:  glm.Vec4{1, 1, 1, 1},
+	Specular: glm.Vec4{0, 0, 0, 1},
+	Emission: glm.Vec4{0, 0, 0, 1},
+}
+
+// TextureMap references a texture image used by a material
+type TextureMap struct {
+	// Path to the image, relative to the imported file.
+	// Empty if the material does not use a texture in this slot
+	Path string
+
+	// Image is set instead of Path for images embedded in the imported file
+	Image image.Image
+
+	// Set is the texture coordinate set used for sampling
+	Set uint
+}
+
+// Primitive is a contiguous range of Vertices sharing a material
+type Primitive struct {
+	// Material is an index into Materials, -1 if there is none
+	Material int
+	Offset   int
+	Count    int
 }
 
 // Vertex is a model vertex
@@ -47,8 +229,23 @@ type Vertex struct {
 	Normal glm.Vec3
 	Color  glm.Vec4
 	Tex    glm.Vec2
+
+	// Tangent points along +U of Tex, W is the sign of the
+	// bitangent, which is W * cross(Normal, Tangent.Vec3())
+	Tangent glm.Vec4
+
+	// Tex1 is the second texture coordinate set, used for lightmaps
+	Tex1 glm.Vec2
+
+	// Joints index Skeleton.Joints, with the influence of each
+	// in Weights. Vertices of objects without a skeleton have no weight
+	Joints  [4]uint32
+	Weights glm.Vec4
 }
 
+// DefaultVertexColor is given to vertices that have no color
+var DefaultVertexColor = glm.Vec4{1, 1, 1, 1}
+
 // Texture is a container component for textures.
 // Because textures can either be in an image form or raw form,
 // this struct accomodates both
@@ -64,12 +261,22 @@ type Uniform struct {
 	Projection glm.Mat4
 }
 
-// VertexBindingDescriptions return Vulkan Vertex descriptors
+// Instance is the per instance data of instanced draws
+type Instance struct {
+	Model glm.Mat4
+}
+
+// VertexBindingDescriptions return Vulkan Vertex descriptors,
+// vertices are bound to 0 and instances to 1
 func VertexBindingDescriptions() []vk.VertexInputBindingDescription {
 	return []vk.VertexInputBindingDescription{{
 		Binding:   0,
 		Stride:    uint32(unsafe.Sizeof(Vertex{})),
 		InputRate: vk.VertexInputRateVertex,
+	}, {
+		Binding:   1,
+		Stride:    uint32(unsafe.Sizeof(Instance{})),
+		InputRate: vk.VertexInputRateInstance,
 	}}
 }
 
@@ -94,5 +301,48 @@ func VertexAttributeDescriptions() []vk.VertexInputAttributeDescription {
 			Format:   vk.FormatR32g32Sfloat,
 			Offset:   uint32(unsafe.Offsetof(Vertex{}.Tex)),
 		},
+		{
+			Binding:  0,
+			Location: 3,
+			Format:   vk.FormatR32g32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Vertex{}.Tex1)),
+		},
+		{
+			Binding:  0,
+			Location: 4,
+			Format:   vk.FormatR32g32b32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Vertex{}.Normal)),
+		},
+		{
+			Binding:  0,
+			Location: 5,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Vertex{}.Tangent)),
+		},
+		// the model matrix takes a location per column
+		{
+			Binding:  1,
+			Location: 6,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Instance{}.Model)),
+		},
+		{
+			Binding:  1,
+			Location: 7,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Instance{}.Model)) + 16,
+		},
+		{
+			Binding:  1,
+			Location: 8,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Instance{}.Model)) + 32,
+		},
+		{
+			Binding:  1,
+			Location: 9,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   uint32(unsafe.Offsetof(Instance{}.Model)) + 48,
+		},
 	}
 }
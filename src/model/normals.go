@@ -0,0 +1,153 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"math"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// HasNormals reports whether any vertex has a normal
+func HasNormals(vertices []Vertex) bool {
+	for idx := range vertices {
+		if vertices[idx].Normal != (glm.Vec3{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// faceNormal returns the unit normal of a counter-clockwise triangle,
+// zero for degenerate ones
+func faceNormal(a, b, c glm.Vec3) glm.Vec3 {
+	normal := b.Sub(a).Cross(c.Sub(a))
+	if normal.Len() == 0 {
+		return normal
+	}
+	return normal.Normalize()
+}
+
+// cornerAngle returns the angle of a triangle at corner a
+func cornerAngle(a, b, c glm.Vec3) float32 {
+	ab, ac := b.Sub(a), c.Sub(a)
+	if ab.Len() == 0 || ac.Len() == 0 {
+		return 0
+	}
+	cos := glm.Clamp(ab.Normalize().Dot(ac.Normalize()), -1, 1)
+	return float32(math.Acos(float64(cos)))
+}
+
+// FlatNormals gives every vertex of a triangle list the normal of its triangle
+func FlatNormals(vertices []Vertex) {
+	for idx := 0; idx+2 < len(vertices); idx += 3 {
+		normal := faceNormal(vertices[idx].Pos, vertices[idx+1].Pos, vertices[idx+2].Pos)
+		vertices[idx].Normal, vertices[idx+1].Normal, vertices[idx+2].Normal = normal, normal, normal
+	}
+}
+
+// SmoothNormals gives the vertices of a triangle list the average normal of
+// the triangles sharing their position, weighted by the angle at the vertex
+func SmoothNormals(vertices []Vertex) {
+	sums := make(map[glm.Vec3]glm.Vec3)
+	for idx := 0; idx+2 < len(vertices); idx += 3 {
+		tri := vertices[idx : idx+3]
+		normal := faceNormal(tri[0].Pos, tri[1].Pos, tri[2].Pos)
+		for c := 0; c < 3; c++ {
+			angle := cornerAngle(tri[c].Pos, tri[(c+1)%3].Pos, tri[(c+2)%3].Pos)
+			sums[tri[c].Pos] = sums[tri[c].Pos].Add(normal.Mul(angle))
+		}
+	}
+	for idx := range vertices[:len(vertices)-len(vertices)%3] {
+		normal := sums[vertices[idx].Pos]
+		if normal.Len() > 0 {
+			normal = normal.Normalize()
+		}
+		vertices[idx].Normal = normal
+	}
+}
+
+// GenerateTangents computes tangents of a triangle list from its normals and
+// first texture coordinates, following MikkTSpace's conventions: the tangent
+// points along +U, is orthogonal to the normal, and Tangent.W is the sign of
+// the bitangent, which is W * cross(Normal, Tangent.Vec3()) and points along +V.
+// Contributions are weighted by corner angle and shared between vertices with
+// the same position, normal, texture coordinates and handedness
+func GenerateTangents(vertices []Vertex) {
+	type key struct {
+		pos, normal glm.Vec3
+		tex         glm.Vec2
+		mirrored    bool
+	}
+	type sum struct {
+		tangent, bitangent glm.Vec3
+	}
+
+	count := len(vertices) - len(vertices)%3
+	keys := make([]key, count)
+	sums := make(map[key]*sum)
+	for idx := 0; idx < count; idx += 3 {
+		tri := vertices[idx : idx+3]
+		e1, e2 := tri[1].Pos.Sub(tri[0].Pos), tri[2].Pos.Sub(tri[0].Pos)
+		du1, dv1 := tri[1].Tex[0]-tri[0].Tex[0], tri[1].Tex[1]-tri[0].Tex[1]
+		du2, dv2 := tri[2].Tex[0]-tri[0].Tex[0], tri[2].Tex[1]-tri[0].Tex[1]
+
+		var tangent, bitangent glm.Vec3
+		det := du1*dv2 - du2*dv1
+		if det != 0 {
+			tangent = e1.Mul(dv2).Sub(e2.Mul(dv1)).Mul(1 / det)
+			bitangent = e2.Mul(du1).Sub(e1.Mul(du2)).Mul(1 / det)
+		}
+		for c := 0; c < 3; c++ {
+			k := key{pos: tri[c].Pos, normal: tri[c].Normal, tex: tri[c].Tex, mirrored: det < 0}
+			keys[idx+c] = k
+			s, ok := sums[k]
+			if !ok {
+				s = &sum{}
+				sums[k] = s
+			}
+			if tangent.Len() == 0 {
+				continue
+			}
+			angle := cornerAngle(tri[c].Pos, tri[(c+1)%3].Pos, tri[(c+2)%3].Pos)
+			s.tangent = s.tangent.Add(tangent.Normalize().Mul(angle))
+			if bitangent.Len() > 0 {
+				s.bitangent = s.bitangent.Add(bitangent.Normalize().Mul(angle))
+			}
+		}
+	}
+
+	for idx := 0; idx < count; idx++ {
+		s := sums[keys[idx]]
+		normal := vertices[idx].Normal
+		tangent := s.tangent.Sub(normal.Mul(normal.Dot(s.tangent)))
+		if tangent.Len() < 1e-6 {
+			tangent = anyPerpendicular(normal)
+		} else {
+			tangent = tangent.Normalize()
+		}
+
+		sign := float32(1)
+		if normal.Cross(tangent).Dot(s.bitangent) < 0 {
+			sign = -1
+		}
+		vertices[idx].Tangent = tangent.Vec4(sign)
+	}
+}
+
+// anyPerpendicular returns a unit vector perpendicular to normal,
+// used where texture coordinates do not define a tangent
+func anyPerpendicular(normal glm.Vec3) glm.Vec3 {
+	axis := glm.Vec3{1, 0, 0}
+	if math.Abs(float64(normal[0])) > 0.9 {
+		axis = glm.Vec3{0, 1, 0}
+	}
+	perpendicular := axis.Sub(normal.Mul(normal.Dot(axis)))
+	if perpendicular.Len() == 0 {
+		return axis
+	}
+	return perpendicular.Normalize()
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// roofVertices are two triangles meeting at a right angle along the Y axis
+func roofVertices() []model.Vertex {
+	return []model.Vertex{
+		{Pos: glm.Vec3{0, 0, 0}}, {Pos: glm.Vec3{1, 0, 1}}, {Pos: glm.Vec3{0, 1, 0}},
+		{Pos: glm.Vec3{0, 0, 0}}, {Pos: glm.Vec3{0, 1, 0}}, {Pos: glm.Vec3{-1, 0, 1}},
+	}
+}
+
+func TestFlatNormals(t *testing.T) {
+	vertices := roofVertices()
+	if model.HasNormals(vertices) {
+		t.Fatal("vertices should have no normals")
+	}
+	model.FlatNormals(vertices)
+
+	s := float32(math.Sqrt2 / 2)
+	for idx := 0; idx < 3; idx++ {
+		if !near(vertices[idx].Normal, glm.Vec3{-s, 0, s}) {
+			t.Fatalf("bad normal of vertex %d, got: %v", idx, vertices[idx].Normal)
+		}
+		if !near(vertices[idx+3].Normal, glm.Vec3{s, 0, s}) {
+			t.Fatalf("bad normal of vertex %d, got: %v", idx+3, vertices[idx+3].Normal)
+		}
+	}
+}
+
+func TestSmoothNormals(t *testing.T) {
+	vertices := roofVertices()
+	model.SmoothNormals(vertices)
+
+	// the ridge is shared and points straight up, the eaves keep their face's normal
+	s := float32(math.Sqrt2 / 2)
+	for _, idx := range []int{0, 2, 3, 4} {
+		if !near(vertices[idx].Normal, glm.Vec3{0, 0, 1}) {
+			t.Fatalf("bad shared normal of vertex %d, got: %v", idx, vertices[idx].Normal)
+		}
+	}
+	if !near(vertices[1].Normal, glm.Vec3{-s, 0, s}) || !near(vertices[5].Normal, glm.Vec3{s, 0, s}) {
+		t.Fatalf("bad normals of unshared vertices: %v, %v", vertices[1].Normal, vertices[5].Normal)
+	}
+}
+
+func TestGenerateTangents(t *testing.T) {
+	up := glm.Vec3{0, 0, 1}
+	quad := []model.Vertex{
+		{Pos: glm.Vec3{0, 0, 0}, Normal: up, Tex: glm.Vec2{0, 0}},
+		{Pos: glm.Vec3{1, 0, 0}, Normal: up, Tex: glm.Vec2{1, 0}},
+		{Pos: glm.Vec3{1, 1, 0}, Normal: up, Tex: glm.Vec2{1, 1}},
+		{Pos: glm.Vec3{0, 0, 0}, Normal: up, Tex: glm.Vec2{0, 0}},
+		{Pos: glm.Vec3{1, 1, 0}, Normal: up, Tex: glm.Vec2{1, 1}},
+		{Pos: glm.Vec3{0, 1, 0}, Normal: up, Tex: glm.Vec2{0, 1}},
+	}
+	model.GenerateTangents(quad)
+	for idx := range quad {
+		if !near(quad[idx].Tangent.Vec3(), glm.Vec3{1, 0, 0}) || quad[idx].Tangent[3] != 1 {
+			t.Fatalf("bad tangent of vertex %d, got: %v", idx, quad[idx].Tangent)
+		}
+	}
+
+	// mirroring U flips both the tangent and the handedness
+	for idx := range quad {
+		quad[idx].Tex[0] = 1 - quad[idx].Tex[0]
+	}
+	model.GenerateTangents(quad)
+	for idx := range quad {
+		if !near(quad[idx].Tangent.Vec3(), glm.Vec3{-1, 0, 0}) || quad[idx].Tangent[3] != -1 {
+			t.Fatalf("bad mirrored tangent of vertex %d, got: %v", idx, quad[idx].Tangent)
+		}
+	}
+
+	// texture coordinates that do not span the triangle still give a unit tangent
+	degenerate := []model.Vertex{{Pos: glm.Vec3{0, 0, 0}, Normal: up}, {Pos: glm.Vec3{1, 0, 0}, Normal: up}, {Pos: glm.Vec3{0, 1, 0}, Normal: up}}
+	model.GenerateTangents(degenerate)
+	if tangent := degenerate[0].Tangent.Vec3(); math.Abs(float64(tangent.Len()-1)) > 1e-5 || math.Abs(float64(tangent.Dot(up))) > 1e-5 {
+		t.Fatalf("bad fallback tangent, got: %v", degenerate[0].Tangent)
+	}
+}
+
+func TestImportedTangents(t *testing.T) {
+	obj, err := model.ImportGLTFObject(quadGLTF(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// U runs along X in the file and in the engine
+	for idx, vert := range obj.Vertices() {
+		if !near(vert.Tangent.Vec3(), glm.Vec3{1, 0, 0}) || vert.Tangent[3] == 0 {
+			t.Fatalf("bad tangent of vertex %d, got: %v", idx, vert.Tangent)
+		}
+	}
+
+	cube, err := model.ImportColladaObject([]byte(Cube_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, vert := range cube.Vertices() {
+		if math.Abs(float64(vert.Tangent.Vec3().Dot(vert.Normal))) > 1e-4 {
+			t.Fatalf("tangent of vertex %d is not orthogonal to its normal: %v, %v", idx, vert.Tangent, vert.Normal)
+		}
+	}
+}
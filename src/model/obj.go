@@ -0,0 +1,465 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// FileLoader reads files that are referenced by an imported file,
+// like material libraries or textures. The name is given as it appears
+// in the imported file, so it is usually relative to it.
+type FileLoader func(name string) ([]byte, error)
+
+// ImportOBJObject reads a Wavefront OBJ file and converts it to
+// engine's internal object. Material libraries are read through load,
+// if it is nil, materials only carry their names.
+func ImportOBJObject(fileContents []byte, load FileLoader, texture image.Image) (Object, error) {
+	return ImportOBJObjectWithConfiguration(fileContents, load, texture, ImportConfiguration{})
+}
+
+// ImportOBJObjectWithConfiguration is ImportOBJObject that allows
+// to configure the conversion. OBJ files carry no axis information,
+// they are assumed to be Y up, as most exporters write them.
+func ImportOBJObjectWithConfiguration(fileContents []byte, load FileLoader, texture image.Image, cfg ImportConfiguration) (Object, error) {
+	var (
+		positions []glm.Vec3
+		colors    []glm.Vec4
+		normals   []glm.Vec3
+		texCoords []glm.Vec2
+
+		libraries []ObjectMaterial
+		faces     []objFace
+		material  = -1
+		smoothing int
+	)
+
+	// materials are added in the order they are first used
+	var (
+		materials       []ObjectMaterial
+		materialIndices = make(map[string]int)
+	)
+	useMaterial := func(name string) int {
+		if idx, ok := materialIndices[name]; ok {
+			return idx
+		}
+		mat := DefaultObjectMaterial
+		mat.Name = name
+		for _, m := range libraries {
+			if m.Name == name {
+				mat = m
+				break
+			}
+		}
+		materials = append(materials, mat)
+		materialIndices[name] = len(materials) - 1
+		return len(materials) - 1
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(fileContents))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			values, err := parseOBJFloats(fields[1:], 3, 6)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: vertex: %s", line, err.Error())
+			}
+			positions = append(positions, glm.Vec3{values[0], values[1], values[2]})
+			color := DefaultVertexColor
+			if len(values) == 6 {
+				// vertex colors extension
+				color = glm.Vec4{values[3], values[4], values[5], 1}
+			}
+			colors = append(colors, color)
+		case "vn":
+			values, err := parseOBJFloats(fields[1:], 3, 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: normal: %s", line, err.Error())
+			}
+			normal := glm.Vec3{values[0], values[1], values[2]}
+			if normal.Len() > 0 {
+				normal = normal.Normalize()
+			}
+			normals = append(normals, normal)
+		case "vt":
+			values, err := parseOBJFloats(fields[1:], 1, 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: texture coordinate: %s", line, err.Error())
+			}
+			tex := glm.Vec2{values[0], 0}
+			if len(values) > 1 {
+				tex[1] = values[1]
+			}
+			texCoords = append(texCoords, tex)
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("obj line %d: face has less than 3 vertices", line)
+			}
+			face := objFace{
+				material:  material,
+				smoothing: smoothing,
+				corners:   make([]objCorner, 0, len(fields)-1),
+			}
+			for _, f := range fields[1:] {
+				corner, err := parseOBJCorner(f, len(positions), len(texCoords), len(normals))
+				if err != nil {
+					return nil, fmt.Errorf("obj line %d: face: %s", line, err.Error())
+				}
+				face.corners = append(face.corners, corner)
+			}
+			faces = append(faces, face)
+		case "s":
+			if len(fields) < 2 || fields[1] == "off" {
+				smoothing = 0
+				continue
+			}
+			num, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: bad smoothing group %q", line, fields[1])
+			}
+			smoothing = num
+		case "usemtl":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("obj line %d: usemtl without a name", line)
+			}
+			material = useMaterial(strings.Join(fields[1:], " "))
+		case "mtllib":
+			if load == nil {
+				continue
+			}
+			for _, name := range fields[1:] {
+				contents, err := load(name)
+				if err != nil {
+					return nil, fmt.Errorf("obj line %d: material library %s: %s", line, name, err.Error())
+				}
+				lib, err := ParseMTL(contents)
+				if err != nil {
+					return nil, fmt.Errorf("material library %s: %s", name, err.Error())
+				}
+				libraries = append(libraries, lib...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	faceNormals := objSmoothNormals(faces, positions)
+
+	// faces are grouped by material, in the order materials were used
+	groups := make([][]Vertex, len(materials)+1)
+	for f, face := range faces {
+		for c := 1; c+1 < len(face.corners); c++ {
+			for _, idx := range []int{0, c, c + 1} {
+				corner := face.corners[idx]
+				vert := Vertex{
+					Pos:   positions[corner.position],
+					Color: colors[corner.position],
+				}
+				if corner.normal >= 0 {
+					vert.Normal = normals[corner.normal]
+				} else {
+					vert.Normal = faceNormals[f][idx]
+				}
+				if corner.texCoord >= 0 {
+					vert.Tex = texCoords[corner.texCoord]
+					if !cfg.KeepRaw {
+						vert.Tex = flipV(vert.Tex)
+					}
+				}
+				groups[face.material+1] = append(groups[face.material+1], vert)
+			}
+		}
+	}
+
+	var (
+		vertices   []Vertex
+		primitives []Primitive
+	)
+	for g, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		primitives = append(primitives, Primitive{
+			Material: g - 1,
+			Offset:   len(vertices),
+			Count:    len(group),
+		})
+		vertices = append(vertices, group...)
+	}
+
+	if !cfg.KeepRaw {
+		for idx := range vertices {
+			vertices[idx].Pos = yUpToZUp.Mul3x1(vertices[idx].Pos)
+			vertices[idx].Normal = yUpToZUp.Mul3x1(vertices[idx].Normal)
+		}
+	}
+	GenerateTangents(vertices)
+
+	// OBJ files are never skinned
+	return &OBJObject{
+		meshData: newMeshData(vertices, texture, materials, primitives, nil, nil),
+	}, nil
+}
+
+// OBJObject is imported from a Wavefront OBJ (.obj) file.
+// Loaded and held in memory
+type OBJObject struct {
+	Transform
+	meshData
+}
+
+// objCorner holds the zero based indices of a face corner,
+// missing texture coordinates and normals are -1
+type objCorner struct {
+	position, texCoord, normal int
+}
+
+type objFace struct {
+	material  int
+	smoothing int
+	corners   []objCorner
+}
+
+func stripComment(line string) string {
+	if idx := strings.IndexByte(line, '#'); idx >= 0 {
+		return line[:idx]
+	}
+	return line
+}
+
+// parseOBJFloats parses at least minCount floats,
+// values past maxCount are ignored
+func parseOBJFloats(fields []string, minCount, maxCount int) ([]float32, error) {
+	if len(fields) < minCount {
+		return nil, fmt.Errorf("expected at least %d values, got %d", minCount, len(fields))
+	}
+	if len(fields) > maxCount {
+		fields = fields[:maxCount]
+	}
+	values := make([]float32, len(fields))
+	for idx, f := range fields {
+		num, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return nil, fmt.Errorf("value %d %q is not a float", idx, f)
+		}
+		values[idx] = float32(num)
+	}
+	return values, nil
+}
+
+// parseOBJIndex converts a one based, possibly negative (relative to the end)
+// index into a zero based one, count is the number of elements defined so far
+func parseOBJIndex(field string, count int) (int, error) {
+	num, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, fmt.Errorf("index %q is not an integer", field)
+	}
+	if num < 0 {
+		num += count
+	} else {
+		num--
+	}
+	if num < 0 || num >= count {
+		return 0, fmt.Errorf("index %s out of range", field)
+	}
+	return num, nil
+}
+
+// parseOBJCorner parses face corners in v, v/vt, v//vn and v/vt/vn forms
+func parseOBJCorner(field string, positions, texCoords, normals int) (objCorner, error) {
+	corner := objCorner{texCoord: -1, normal: -1}
+	parts := strings.Split(field, "/")
+	if len(parts) > 3 {
+		return corner, fmt.Errorf("bad vertex %q", field)
+	}
+
+	var err error
+	if corner.position, err = parseOBJIndex(parts[0], positions); err != nil {
+		return corner, err
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if corner.texCoord, err = parseOBJIndex(parts[1], texCoords); err != nil {
+			return corner, err
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if corner.normal, err = parseOBJIndex(parts[2], normals); err != nil {
+			return corner, err
+		}
+	}
+	return corner, nil
+}
+
+// objSmoothNormals computes normals for the corners of faces that do not
+// specify them. Faces outside of a smoothing group are flat shaded, inside
+// a group the area weighted normals of faces sharing a position are averaged.
+func objSmoothNormals(faces []objFace, positions []glm.Vec3) [][]glm.Vec3 {
+	type smoothKey struct {
+		position, group int
+	}
+
+	flat := make([]glm.Vec3, len(faces))
+	smooth := make(map[smoothKey]glm.Vec3)
+	for f, face := range faces {
+		// Newell's method, works for non planar polygons too
+		var normal glm.Vec3
+		for c := range face.corners {
+			cur := positions[face.corners[c].position]
+			next := positions[face.corners[(c+1)%len(face.corners)].position]
+			normal[0] += (cur[1] - next[1]) * (cur[2] + next[2])
+			normal[1] += (cur[2] - next[2]) * (cur[0] + next[0])
+			normal[2] += (cur[0] - next[0]) * (cur[1] + next[1])
+		}
+		flat[f] = normal
+		if face.smoothing == 0 {
+			continue
+		}
+		for _, corner := range face.corners {
+			key := smoothKey{corner.position, face.smoothing}
+			smooth[key] = smooth[key].Add(normal)
+		}
+	}
+
+	normals := make([][]glm.Vec3, len(faces))
+	for f, face := range faces {
+		normals[f] = make([]glm.Vec3, len(face.corners))
+		for c, corner := range face.corners {
+			normal := flat[f]
+			if face.smoothing != 0 {
+				normal = smooth[smoothKey{corner.position, face.smoothing}]
+			}
+			if normal.Len() > 0 {
+				normal = normal.Normalize()
+			}
+			normals[f][c] = normal
+		}
+	}
+	return normals
+}
+
+// mtlOptionArgs is the number of arguments texture map options take,
+// optional arguments are numbers
+var mtlOptionArgs = map[string]struct{ required, optional int }{
+	"-blendu": {1, 0}, "-blendv": {1, 0}, "-bm": {1, 0}, "-boost": {1, 0},
+	"-cc": {1, 0}, "-clamp": {1, 0}, "-imfchan": {1, 0}, "-texres": {1, 0},
+	"-type": {1, 0}, "-mm": {2, 0}, "-o": {1, 2}, "-s": {1, 2}, "-t": {1, 2},
+}
+
+// parseMTLMap returns the file name of a texture map statement,
+// skipping the options that precede it
+func parseMTLMap(fields []string) string {
+	idx := 0
+	for idx < len(fields)-1 {
+		args, ok := mtlOptionArgs[fields[idx]]
+		if !ok {
+			break
+		}
+		idx += 1 + args.required
+		for n := 0; n < args.optional && idx < len(fields)-1; n++ {
+			if _, err := strconv.ParseFloat(fields[idx], 32); err != nil {
+				break
+			}
+			idx++
+		}
+	}
+	if idx >= len(fields) {
+		return ""
+	}
+	return strings.Join(fields[idx:], " ")
+}
+
+// ParseMTL reads a Wavefront material library
+func ParseMTL(contents []byte) ([]ObjectMaterial, error) {
+	var (
+		materials []ObjectMaterial
+		current   *ObjectMaterial
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			mat := DefaultObjectMaterial
+			mat.Name = strings.Join(fields[1:], " ")
+			materials = append(materials, mat)
+			current = &materials[len(materials)-1]
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("mtl line %d: %s before newmtl", line, fields[0])
+		}
+
+		color := func(dst *glm.Vec4) error {
+			values, err := parseOBJFloats(fields[1:], 1, 3)
+			if err != nil {
+				return fmt.Errorf("mtl line %d: %s: %s", line, fields[0], err.Error())
+			}
+			if len(values) < 3 {
+				// a single value is used for all channels
+				values = []float32{values[0], values[0], values[0]}
+			}
+			*dst = glm.Vec4{values[0], values[1], values[2], dst[3]}
+			return nil
+		}
+		scalar := func() (float32, error) {
+			values, err := parseOBJFloats(fields[1:], 1, 1)
+			if err != nil {
+				return 0, fmt.Errorf("mtl line %d: %s: %s", line, fields[0], err.Error())
+			}
+			return values[0], nil
+		}
+
+		var err error
+		switch fields[0] {
+		case "Ka":
+			err = color(&current.Ambient)
+		case "Kd":
+			err = color(&current.Diffuse)
+		case "Ks":
+			err = color(&current.Specular)
+		case "Ke":
+			err = color(&current.Emission)
+		case "Ns":
+			current.Shininess, err = scalar()
+		case "d":
+			current.Diffuse[3], err = scalar()
+		case "Tr":
+			var tr float32
+			tr, err = scalar()
+			current.Diffuse[3] = 1 - tr
+		case "map_Kd":
+			current.DiffuseMap.Path = parseMTLMap(fields[1:])
+		case "map_Ks":
+			current.SpecularMap.Path = parseMTLMap(fields[1:])
+		case "map_Ke":
+			current.EmissionMap.Path = parseMTLMap(fields[1:])
+		case "map_Bump", "map_bump", "bump", "norm":
+			current.NormalMap.Path = parseMTLMap(fields[1:])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return materials, scanner.Err()
+}
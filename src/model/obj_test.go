@@ -0,0 +1,287 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+var Cube_obj = `
+# a unit cube, with a quad per side
+mtllib cube.mtl
+o Cube
+v 1 1 -1
+v 1 -1 -1
+v 1 1 1
+v 1 -1 1
+v -1 1 -1
+v -1 -1 -1
+v -1 1 1
+v -1 -1 1
+vt 0.625 0.5
+vt 0.875 0.5
+vt 0.875 0.75
+vt 0.625 0.75
+vn 0 1 0
+vn 0 0 1
+vn -1 0 0
+vn 0 -1 0
+vn 1 0 0
+vn 0 0 -1
+usemtl Brick
+s off
+f 1/1/1 5/2/1 7/3/1 3/4/1
+f 4/1/2 3/2/2 7/3/2 8/4/2
+f 8/1/3 7/2/3 5/3/3 6/4/3
+usemtl Paint
+f 6/1/4 2/2/4 4/3/4 8/4/4
+f 2/1/5 1/2/5 3/3/5 4/4/5
+usemtl Brick
+f 6/1/6 5/2/6 1/3/6 2/4/6
+`
+
+var Cube_mtl = `
+# two materials
+newmtl Brick
+Ns 250.0
+Ka 1.0 1.0 1.0
+Kd 0.8 0.7 0.6
+Ks 0.5 0.5 0.5
+Ke 0.0 0.0 0.0
+d 1.0
+map_Kd -bm 0.5 -o 0 0.5 Bricks_COLOR.png
+map_Ks Bricks_SPEC.png
+map_Bump -bm 1 Bricks_NORM.png
+
+newmtl Paint
+Kd 0.1 0.2 0.3
+Tr 0.25
+`
+
+func loadCubeMTL(name string) ([]byte, error) {
+	if name != "cube.mtl" {
+		return nil, errors.New("not found")
+	}
+	return []byte(Cube_mtl), nil
+}
+
+func TestImportOBJObject(t *testing.T) {
+	obj, err := model.ImportOBJObject([]byte(Cube_obj), loadCubeMTL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	if len(vert) != 36 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+
+	expected := []model.Primitive{
+		{Material: 0, Offset: 0, Count: 24},
+		{Material: 1, Offset: 24, Count: 12},
+	}
+	prims := obj.Primitives()
+	if len(prims) != len(expected) {
+		t.Fatalf("wrong amount of primitives, got: %d", len(prims))
+	}
+	for idx := range expected {
+		if prims[idx] != expected[idx] {
+			t.Fatalf("bad primitive %d, expected: %+v, got: %+v", idx, expected[idx], prims[idx])
+		}
+	}
+
+	mats := obj.Materials()
+	if len(mats) != 2 {
+		t.Fatalf("wrong amount of materials, got: %d", len(mats))
+	}
+	brick := mats[0]
+	if brick.Name != "Brick" || brick.Diffuse != (glm.Vec4{0.8, 0.7, 0.6, 1}) || brick.Shininess != 250 {
+		t.Fatalf("bad brick material: %+v", brick)
+	}
+	if brick.DiffuseMap.Path != "Bricks_COLOR.png" || brick.SpecularMap.Path != "Bricks_SPEC.png" || brick.NormalMap.Path != "Bricks_NORM.png" {
+		t.Fatalf("bad brick maps: %+v, %+v, %+v", brick.DiffuseMap, brick.SpecularMap, brick.NormalMap)
+	}
+	paint := mats[1]
+	if paint.Name != "Paint" || paint.Diffuse != (glm.Vec4{0.1, 0.2, 0.3, 0.75}) {
+		t.Fatalf("bad paint material: %+v", paint)
+	}
+
+	// first face is the top, Y up in the file and Z up in the engine
+	for idx := 0; idx < 6; idx++ {
+		if vert[idx].Pos[2] != 1 {
+			t.Fatalf("vertex %d is not on top, got: %v", idx, vert[idx].Pos)
+		}
+		if !vert[idx].Normal.ApproxEqual(glm.Vec3{0, 0, 1}) {
+			t.Fatalf("bad normal of vertex %d, got: %v", idx, vert[idx].Normal)
+		}
+		if vert[idx].Color != model.DefaultVertexColor {
+			t.Fatalf("bad color of vertex %d, got: %v", idx, vert[idx].Color)
+		}
+	}
+	if vert[0].Tex != (glm.Vec2{0.625, 0.5}) || vert[2].Tex != (glm.Vec2{0.875, 0.25}) {
+		t.Fatalf("bad texture coordinates: %v, %v", vert[0].Tex, vert[2].Tex)
+	}
+}
+
+func TestImportOBJObjectNgonAndSmoothing(t *testing.T) {
+	data := `
+v 0 0 0 1 0 0
+v 1 0 0 0 1 0
+v 1 0 1 0 0 1
+v 0.5 0 1.5
+v 0 0 1
+s 1
+f 1 2 3 4 5
+v 1 -1 0
+s off
+f 2 -1 3
+`
+	obj, err := model.ImportOBJObjectWithConfiguration([]byte(data), nil, nil, model.ImportConfiguration{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vert := obj.Vertices()
+	if len(vert) != 3*3+3 {
+		t.Fatalf("wrong amount of vertices, got: %d", len(vert))
+	}
+	if vert[0].Color != (glm.Vec4{1, 0, 0, 1}) || vert[1].Color != (glm.Vec4{0, 1, 0, 1}) {
+		t.Fatalf("bad vertex colors: %v, %v", vert[0].Color, vert[1].Color)
+	}
+
+	// the pentagon lies in the XZ plane and is wound towards -Y
+	for idx := 0; idx < 9; idx++ {
+		if !vert[idx].Normal.ApproxEqual(glm.Vec3{0, -1, 0}) {
+			t.Fatalf("bad smooth normal %d, got: %v", idx, vert[idx].Normal)
+		}
+	}
+
+	// the flat face is in the X = 1 plane
+	for idx := 9; idx < 12; idx++ {
+		if n := vert[idx].Normal; !n.ApproxEqual(glm.Vec3{1, 0, 0}) && !n.ApproxEqual(glm.Vec3{-1, 0, 0}) {
+			t.Fatalf("bad flat normal %d, got: %v", idx, n)
+		}
+	}
+
+	prims := obj.Primitives()
+	if len(prims) != 1 || prims[0].Material != -1 {
+		t.Fatalf("bad primitives: %+v", prims)
+	}
+}
+
+func TestImportOBJObjectErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"index out of range": "v 0 0 0\nv 1 0 0\nf 1 2 3\n",
+		"bad float":          "v 0 0 x\n",
+		"short face":         "v 0 0 0\nv 1 0 0\nf 1 2\n",
+		"missing library":    "mtllib missing.mtl\n",
+	} {
+		if _, err := model.ImportOBJObject([]byte(data), loadCubeMTL, nil); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+// Quad_obj and Quad_dae are the same textured quad, standing in the
+// XY plane with the top of the texture upwards
+const Quad_obj = `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+f 1/1 2/2 3/3 4/4
+`
+
+const Quad_dae = `
+<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <asset>
+    <unit name="meter" meter="1"/>
+    <up_axis>Y_UP</up_axis>
+  </asset>
+  <library_geometries>
+    <geometry id="Quad-mesh" name="Quad">
+      <mesh>
+        <source id="Quad-mesh-positions">
+          <float_array id="Quad-mesh-positions-array" count="12">0 0 0 1 0 0 1 1 0 0 1 0</float_array>
+          <technique_common>
+            <accessor source="#Quad-mesh-positions-array" count="4" stride="3">
+              <param name="X" type="float"/>
+              <param name="Y" type="float"/>
+              <param name="Z" type="float"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <source id="Quad-mesh-map">
+          <float_array id="Quad-mesh-map-array" count="8">0 0 1 0 1 1 0 1</float_array>
+          <technique_common>
+            <accessor source="#Quad-mesh-map-array" count="4" stride="2">
+              <param name="S" type="float"/>
+              <param name="T" type="float"/>
+            </accessor>
+          </technique_common>
+        </source>
+        <vertices id="Quad-mesh-vertices">
+          <input semantic="POSITION" source="#Quad-mesh-positions"/>
+        </vertices>
+        <triangles count="2">
+          <input semantic="VERTEX" source="#Quad-mesh-vertices" offset="0"/>
+          <input semantic="TEXCOORD" source="#Quad-mesh-map" offset="1" set="0"/>
+          <p>0 0 1 1 2 2 0 0 2 2 3 3</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+</COLLADA>
+`
+
+func TestImportOBJColladaTexCoords(t *testing.T) {
+	for _, cfg := range []model.ImportConfiguration{{}, {KeepRaw: true}} {
+		objQuad, err := model.ImportOBJObjectWithConfiguration([]byte(Quad_obj), nil, nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		daeQuad, err := model.ImportColladaObjectWithConfiguration([]byte(Quad_dae), nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tex := make(map[glm.Vec3]glm.Vec2)
+		for _, vert := range objQuad.Vertices() {
+			tex[vert.Pos] = vert.Tex
+		}
+		if len(tex) != 4 {
+			t.Fatalf("raw %v: expected 4 corners from obj, got: %v", cfg.KeepRaw, tex)
+		}
+		for _, vert := range daeQuad.Vertices() {
+			expected, ok := tex[vert.Pos]
+			if !ok {
+				t.Fatalf("raw %v: collada corner %v is not in obj", cfg.KeepRaw, vert.Pos)
+			}
+			if !vert.Tex.ApproxEqual(expected) {
+				t.Fatalf("raw %v: bad texcoord at %v, obj: %v, collada: %v", cfg.KeepRaw, vert.Pos, expected, vert.Tex)
+			}
+		}
+
+		// the top left corner is the origin of the texture once converted
+		topLeft := glm.Vec3{0, 0, 1}
+		expected := glm.Vec2{0, 0}
+		if cfg.KeepRaw {
+			topLeft, expected = glm.Vec3{0, 1, 0}, glm.Vec2{0, 1}
+		}
+		if got := tex[topLeft]; got != expected {
+			t.Fatalf("raw %v: bad texcoord at the top left, expected: %v, got: %v", cfg.KeepRaw, expected, got)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"sort"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// JointPose is the transform of a joint relative to its parent
+type JointPose struct {
+	Translation glm.Vec3
+	Rotation    glm.Quat
+	Scale       glm.Vec3
+}
+
+// IdentityJointPose leaves the joint at its parent
+var IdentityJointPose = JointPose{
+	Rotation: glm.QuatIdent(),
+	Scale:    glm.Vec3{1, 1, 1},
+}
+
+// Matrix returns the pose as translation * rotation * scale
+func (p JointPose) Matrix() glm.Mat4 {
+	return glm.Translate3D(p.Translation[0], p.Translation[1], p.Translation[2]).
+		Mul4(p.Rotation.Mat4()).
+		Mul4(glm.Scale3D(p.Scale[0], p.Scale[1], p.Scale[2]))
+}
+
+// DecomposeJointPose splits an affine matrix without shear into a pose
+func DecomposeJointPose(m glm.Mat4) JointPose {
+	pose := JointPose{
+		Translation: m.Col(3).Vec3(),
+		Scale:       glm.Vec3{m.Col(0).Vec3().Len(), m.Col(1).Vec3().Len(), m.Col(2).Vec3().Len()},
+	}
+	if m.Mat3().Det() < 0 {
+		pose.Scale[0] = -pose.Scale[0]
+	}
+
+	rot := glm.Ident4()
+	for c := 0; c < 3; c++ {
+		if pose.Scale[c] != 0 {
+			rot.SetCol(c, m.Col(c).Mul(1/pose.Scale[c]))
+		}
+	}
+	rot.SetCol(3, glm.Vec4{0, 0, 0, 1})
+	pose.Rotation = glm.Mat4ToQuat(rot).Normalize()
+	return pose
+}
+
+// Slerp interpolates rotations along the shortest arc
+func Slerp(a, b glm.Quat, t float32) glm.Quat {
+	if a.Dot(b) < 0 {
+		b = b.Scale(-1)
+	}
+	return glm.QuatSlerp(a, b, t).Normalize()
+}
+
+// Joint is a bone of a skeleton
+type Joint struct {
+	Name string
+
+	// Parent is an index into Skeleton.Joints, -1 for root joints
+	Parent int
+
+	// Rest is the pose of joints not animated by a clip
+	Rest JointPose
+
+	// InverseBind moves mesh vertices into the joint's space
+	InverseBind glm.Mat4
+}
+
+// Skeleton is a hierarchy of joints that deforms a mesh.
+// Vertex.Joints are indices into Joints
+type Skeleton struct {
+	Joints []Joint
+
+	// Transform places root joints in the object's space
+	Transform glm.Mat4
+}
+
+// FindJoint returns the index of the joint with the given name, -1 if none
+func (s *Skeleton) FindJoint(name string) int {
+	for idx := range s.Joints {
+		if s.Joints[idx].Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// RestPose returns the rest pose of every joint
+func (s *Skeleton) RestPose() []JointPose {
+	pose := make([]JointPose, len(s.Joints))
+	for idx := range s.Joints {
+		pose[idx] = s.Joints[idx].Rest
+	}
+	return pose
+}
+
+// WorldMatrices returns the transform of every joint in the
+// object's space for the given pose
+func (s *Skeleton) WorldMatrices(pose []JointPose) []glm.Mat4 {
+	world := make([]glm.Mat4, len(s.Joints))
+	done := make([]bool, len(s.Joints))
+	var resolve func(idx, depth int) glm.Mat4
+	resolve = func(idx, depth int) glm.Mat4 {
+		if done[idx] {
+			return world[idx]
+		}
+		parent := s.Transform
+		// depth guards against cycles in malformed skeletons
+		if p := s.Joints[idx].Parent; p >= 0 && p < len(s.Joints) && depth < len(s.Joints) {
+			parent = resolve(p, depth+1)
+		}
+		world[idx] = parent.Mul4(pose[idx].Matrix())
+		done[idx] = true
+		return world[idx]
+	}
+	for idx := range s.Joints {
+		resolve(idx, 0)
+	}
+	return world
+}
+
+// JointMatrices returns the skinning matrices of the given pose,
+// they move bind pose vertices to where the joints place them
+func (s *Skeleton) JointMatrices(pose []JointPose) []glm.Mat4 {
+	matrices := s.WorldMatrices(pose)
+	for idx := range matrices {
+		matrices[idx] = matrices[idx].Mul4(s.Joints[idx].InverseBind)
+	}
+	return matrices
+}
+
+// Evaluate returns the skinning matrices of the clip at time t,
+// joints the clip does not animate keep their rest pose
+func (s *Skeleton) Evaluate(clip *AnimationClip, t float32) []glm.Mat4 {
+	pose := s.RestPose()
+	if clip != nil {
+		clip.Apply(pose, t)
+	}
+	return s.JointMatrices(pose)
+}
+
+// Interpolation is the way values between keyframes are computed
+type Interpolation int
+
+// Interpolation kinds
+const (
+	InterpolationLinear Interpolation = iota
+	InterpolationStep
+)
+
+// AnimationPath is the joint property animated by a channel
+type AnimationPath int
+
+// Animated joint properties
+const (
+	AnimateTranslation AnimationPath = iota
+	AnimateRotation
+	AnimateScale
+)
+
+// AnimationChannel animates a single property of a joint. Values hold
+// a keyframe per time, vectors in XYZ and rotations as quaternions in XYZW
+type AnimationChannel struct {
+	Joint         int
+	Path          AnimationPath
+	Interpolation Interpolation
+	Times         []float32
+	Values        []glm.Vec4
+}
+
+// Sample returns the value of the channel at time t,
+// times outside of the keyframes are clamped
+func (c AnimationChannel) Sample(t float32) glm.Vec4 {
+	count := len(c.Times)
+	if len(c.Values) < count {
+		count = len(c.Values)
+	}
+	if count == 0 {
+		return glm.Vec4{}
+	}
+	if t <= c.Times[0] || count == 1 {
+		return c.Values[0]
+	}
+	if t >= c.Times[count-1] {
+		return c.Values[count-1]
+	}
+
+	next := sort.Search(count, func(i int) bool { return c.Times[i] > t })
+	prev := next - 1
+	if c.Interpolation == InterpolationStep {
+		return c.Values[prev]
+	}
+
+	span := c.Times[next] - c.Times[prev]
+	if span <= 0 {
+		return c.Values[next]
+	}
+	amount := (t - c.Times[prev]) / span
+	if c.Path == AnimateRotation {
+		a, b := c.Values[prev], c.Values[next]
+		q := Slerp(
+			glm.Quat{W: a[3], V: a.Vec3()},
+			glm.Quat{W: b[3], V: b.Vec3()},
+			amount)
+		return q.V.Vec4(q.W)
+	}
+	return c.Values[prev].Add(c.Values[next].Sub(c.Values[prev]).Mul(amount))
+}
+
+// AnimationClip is a named set of channels
+type AnimationClip struct {
+	Name     string
+	Duration float32
+	Channels []AnimationChannel
+}
+
+// Apply overwrites the animated properties of pose with the clip's values at time t
+func (c *AnimationClip) Apply(pose []JointPose, t float32) {
+	for _, channel := range c.Channels {
+		if channel.Joint < 0 || channel.Joint >= len(pose) {
+			continue
+		}
+		value := channel.Sample(t)
+		switch channel.Path {
+		case AnimateTranslation:
+			pose[channel.Joint].Translation = value.Vec3()
+		case AnimateRotation:
+			pose[channel.Joint].Rotation = glm.Quat{W: value[3], V: value.Vec3()}.Normalize()
+		case AnimateScale:
+			pose[channel.Joint].Scale = value.Vec3()
+		}
+	}
+}
+
+// updateDuration sets the duration to the time of the last keyframe
+func (c *AnimationClip) updateDuration() {
+	for _, channel := range c.Channels {
+		if n := len(channel.Times); n > 0 && channel.Times[n-1] > c.Duration {
+			c.Duration = channel.Times[n-1]
+		}
+	}
+}
+
+// SkinVertices deforms vertices by the joint matrices on the CPU, vertices
+// without weights are copied as they are. Meant for tools and testing,
+// renderers skin on the GPU
+func SkinVertices(vertices []Vertex, joints []glm.Mat4) []Vertex {
+	skinned := make([]Vertex, len(vertices))
+	for idx, vert := range vertices {
+		skinned[idx] = vert
+
+		var mat glm.Mat4
+		var total float32
+		for i, weight := range vert.Weights {
+			j := int(vert.Joints[i])
+			if weight == 0 || j >= len(joints) {
+				continue
+			}
+			for e := range mat {
+				mat[e] += joints[j][e] * weight
+			}
+			total += weight
+		}
+		if total == 0 {
+			continue
+		}
+		mat = mat.Mul(1 / total)
+
+		skinned[idx].Pos = mat.Mul4x1(vert.Pos.Vec4(1)).Vec3()
+		if normal := mat.Mat3().Inv().Transpose().Mul3x1(vert.Normal); normal.Len() > 0 {
+			skinned[idx].Normal = normal.Normalize()
+		}
+	}
+	return skinned
+}
+
+// conjugateSkeleton makes a skeleton read in file space work with
+// vertices converted by m into engine's space
+func conjugateSkeleton(s *Skeleton, m glm.Mat4) {
+	inv := m.Inv()
+	s.Transform = m.Mul4(s.Transform)
+	for idx := range s.Joints {
+		s.Joints[idx].InverseBind = s.Joints[idx].InverseBind.Mul4(inv)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// twoJointSkeleton is a root at the origin with a child one unit up
+func twoJointSkeleton() *model.Skeleton {
+	bone := model.IdentityJointPose
+	bone.Translation = glm.Vec3{0, 0, 1}
+	return &model.Skeleton{
+		Joints: []model.Joint{
+			{Name: "Root", Parent: -1, Rest: model.IdentityJointPose, InverseBind: glm.Ident4()},
+			{Name: "Bone", Parent: 0, Rest: bone, InverseBind: glm.Translate3D(0, 0, -1)},
+		},
+		Transform: glm.Ident4(),
+	}
+}
+
+// near compares vectors that went through rotations
+func near(a, b glm.Vec3) bool {
+	return a.Sub(b).Len() < 1e-5
+}
+
+func TestSlerpShortestPath(t *testing.T) {
+	a := glm.QuatIdent()
+	b := glm.QuatRotate(math.Pi/2, glm.Vec3{0, 0, 1})
+	half := model.Slerp(a, b.Scale(-1), 0.5)
+	expected := glm.QuatRotate(math.Pi/4, glm.Vec3{0, 0, 1})
+	if !half.Mat4().ApproxEqualThreshold(expected.Mat4(), 1e-5) {
+		t.Fatalf("bad slerp, expected: %v, got: %v", expected, half)
+	}
+}
+
+func TestAnimationChannelSample(t *testing.T) {
+	channel := model.AnimationChannel{
+		Path:   model.AnimateTranslation,
+		Times:  []float32{1, 2, 4},
+		Values: []glm.Vec4{{0, 0, 0, 0}, {2, 0, 0, 0}, {2, 4, 0, 0}},
+	}
+	cases := []struct {
+		time     float32
+		expected glm.Vec4
+	}{
+		{0, glm.Vec4{0, 0, 0, 0}},
+		{1.5, glm.Vec4{1, 0, 0, 0}},
+		{3, glm.Vec4{2, 2, 0, 0}},
+		{5, glm.Vec4{2, 4, 0, 0}},
+	}
+	for _, c := range cases {
+		if got := channel.Sample(c.time); !got.ApproxEqual(c.expected) {
+			t.Errorf("linear at %v, expected: %v, got: %v", c.time, c.expected, got)
+		}
+	}
+
+	channel.Interpolation = model.InterpolationStep
+	if got := channel.Sample(3.9); got != channel.Values[1] {
+		t.Errorf("step did not hold the previous keyframe, got: %v", got)
+	}
+}
+
+func TestDecomposeJointPose(t *testing.T) {
+	pose := model.JointPose{
+		Translation: glm.Vec3{1, 2, 3},
+		Rotation:    glm.QuatRotate(0.7, glm.Vec3{1, 1, 0}.Normalize()),
+		Scale:       glm.Vec3{2, 3, 4},
+	}
+	got := model.DecomposeJointPose(pose.Matrix())
+	if !got.Matrix().ApproxEqualThreshold(pose.Matrix(), 1e-5) {
+		t.Fatalf("decomposed pose does not match, expected: %+v, got: %+v", pose, got)
+	}
+}
+
+func TestSkeletonEvaluate(t *testing.T) {
+	skeleton := twoJointSkeleton()
+	clip := &model.AnimationClip{
+		Name:     "Bend",
+		Duration: 1,
+		Channels: []model.AnimationChannel{{
+			Joint:  1,
+			Path:   model.AnimateRotation,
+			Times:  []float32{0, 1},
+			Values: []glm.Vec4{{0, 0, 0, 1}, {float32(math.Sin(math.Pi / 4)), 0, 0, float32(math.Cos(math.Pi / 4))}},
+		}},
+	}
+
+	rest := skeleton.Evaluate(nil, 0)
+	for idx := range rest {
+		if !rest[idx].ApproxEqual(glm.Ident4()) {
+			t.Fatalf("rest pose matrix %d is not identity: %v", idx, rest[idx])
+		}
+	}
+
+	// the bone bends 90 degrees around X, a point above it falls forward
+	vertices := []model.Vertex{
+		{Pos: glm.Vec3{0, 0, 2}, Normal: glm.Vec3{0, 0, 1}, Joints: [4]uint32{1}, Weights: glm.Vec4{1, 0, 0, 0}},
+		{Pos: glm.Vec3{1, 0, 0}, Normal: glm.Vec3{1, 0, 0}, Joints: [4]uint32{0}, Weights: glm.Vec4{1, 0, 0, 0}},
+		{Pos: glm.Vec3{5, 5, 5}},
+	}
+	skinned := model.SkinVertices(vertices, skeleton.Evaluate(clip, 1))
+	if !near(skinned[0].Pos, glm.Vec3{0, -1, 1}) || !near(skinned[0].Normal, glm.Vec3{0, -1, 0}) {
+		t.Fatalf("bad skinned vertex: %+v", skinned[0])
+	}
+	if skinned[1].Pos != vertices[1].Pos || skinned[2].Pos != vertices[2].Pos {
+		t.Fatalf("vertices not on the bone moved: %v, %v", skinned[1].Pos, skinned[2].Pos)
+	}
+	if vertices[0].Pos != (glm.Vec3{0, 0, 2}) {
+		t.Fatal("input vertices were modified")
+	}
+
+	halfway := model.SkinVertices(vertices[:1], skeleton.Evaluate(clip, 0.5))
+	s := float32(math.Sqrt2 / 2)
+	if !near(halfway[0].Pos, glm.Vec3{0, -s, 1 + s}) {
+		t.Fatalf("bad skinned vertex halfway, got: %v", halfway[0].Pos)
+	}
+}
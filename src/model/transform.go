@@ -0,0 +1,203 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// ErrTransformCycle is returned when a transform would become its own ancestor
+var ErrTransformCycle = errors.New("transform can't be its own ancestor")
+
+// Transform places an object in space with a translation, a rotation
+// and a scale, applied in reverse order, relative to an optional parent.
+// The zero value is the identity. Matrices are cached until changed.
+// Safe for concurrent use
+type Transform struct {
+	mutex       sync.RWMutex
+	initialized bool
+
+	translation glm.Vec3
+	rotation    glm.Quat
+	scale       glm.Vec3
+	parent      *Transform
+
+	// version is taken from transformVersion on every change,
+	// world caches are keyed by the latest version up the hierarchy
+	version      uint64
+	local        glm.Mat4
+	localVersion uint64
+	world        glm.Mat4
+	worldVersion uint64
+}
+
+// transformVersion orders changes of all transforms
+var transformVersion uint64
+
+// hierarchyLock serializes parent changes of all transforms,
+// so no two of them can pass the cycle check together
+var hierarchyLock sync.Mutex
+
+// init makes the zero value an identity transform, must hold the write lock
+func (t *Transform) init() {
+	if t.initialized {
+		return
+	}
+	t.initialized = true
+	t.rotation = glm.QuatIdent()
+	t.scale = glm.Vec3{1, 1, 1}
+	t.version = atomic.AddUint64(&transformVersion, 1)
+}
+
+// change applies a local modification
+func (t *Transform) change(modify func()) {
+	t.mutex.Lock()
+	t.init()
+	modify()
+	t.version = atomic.AddUint64(&transformVersion, 1)
+	t.mutex.Unlock()
+}
+
+// read runs get under the read lock, making
+// sure the transform is initialized first
+func (t *Transform) read(get func()) {
+	t.mutex.RLock()
+	if !t.initialized {
+		t.mutex.RUnlock()
+		t.mutex.Lock()
+		t.init()
+		t.mutex.Unlock()
+		t.mutex.RLock()
+	}
+	get()
+	t.mutex.RUnlock()
+}
+
+// SetTranslation sets the translation relative to the parent
+func (t *Transform) SetTranslation(translation glm.Vec3) {
+	t.change(func() { t.translation = translation })
+}
+
+// Translation returns the translation relative to the parent
+func (t *Transform) Translation() (translation glm.Vec3) {
+	t.read(func() { translation = t.translation })
+	return
+}
+
+// SetOrientation sets the rotation relative to the parent
+func (t *Transform) SetOrientation(rotation glm.Quat) {
+	t.change(func() { t.rotation = rotation.Normalize() })
+}
+
+// Orientation returns the rotation relative to the parent
+func (t *Transform) Orientation() (rotation glm.Quat) {
+	t.read(func() { rotation = t.rotation })
+	return
+}
+
+// SetScale sets the scale along every local axis
+func (t *Transform) SetScale(scale glm.Vec3) {
+	t.change(func() { t.scale = scale })
+}
+
+// Scale returns the scale along every local axis
+func (t *Transform) Scale() (scale glm.Vec3) {
+	t.read(func() { scale = t.scale })
+	return
+}
+
+// SetPosition sets the translation from a translation matrix,
+// implements Object
+func (t *Transform) SetPosition(pos glm.Mat4) {
+	t.SetTranslation(pos.Col(3).Vec3())
+}
+
+// Position returns the translation as a matrix, implements Object
+func (t *Transform) Position() glm.Mat4 {
+	translation := t.Translation()
+	return glm.Translate3D(translation[0], translation[1], translation[2])
+}
+
+// SetRotation sets the rotation from a rotation matrix, implements Object
+func (t *Transform) SetRotation(rot glm.Mat4) {
+	t.SetOrientation(glm.Mat4ToQuat(rot))
+}
+
+// Rotation returns the rotation as a matrix, implements Object
+func (t *Transform) Rotation() glm.Mat4 {
+	return t.Orientation().Mat4()
+}
+
+// SetParent makes the transform relative to parent, nil detaches it
+func (t *Transform) SetParent(parent *Transform) error {
+	hierarchyLock.Lock()
+	defer hierarchyLock.Unlock()
+
+	for p := parent; p != nil; p = p.Parent() {
+		if p == t {
+			return ErrTransformCycle
+		}
+	}
+	t.change(func() { t.parent = parent })
+	return nil
+}
+
+// Parent returns the transform this one is relative to, nil if none
+func (t *Transform) Parent() (parent *Transform) {
+	t.read(func() { parent = t.parent })
+	return
+}
+
+// LocalMatrix returns translation * rotation * scale
+func (t *Transform) LocalMatrix() glm.Mat4 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.init()
+	return t.localMatrix()
+}
+
+// localMatrix returns the cached local matrix, must hold the write lock
+func (t *Transform) localMatrix() glm.Mat4 {
+	if t.localVersion != t.version {
+		t.local = glm.Translate3D(t.translation[0], t.translation[1], t.translation[2]).
+			Mul4(t.rotation.Mat4()).
+			Mul4(glm.Scale3D(t.scale[0], t.scale[1], t.scale[2]))
+		t.localVersion = t.version
+	}
+	return t.local
+}
+
+// Matrix returns the transform in world space, the parent's
+// matrix times the local one
+func (t *Transform) Matrix() glm.Mat4 {
+	matrix, _ := t.worldMatrix()
+	return matrix
+}
+
+// worldMatrix returns the world matrix with the version it was made at
+func (t *Transform) worldMatrix() (glm.Mat4, uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.init()
+
+	parentMatrix, parentVersion := glm.Ident4(), uint64(0)
+	if t.parent != nil {
+		parentMatrix, parentVersion = t.parent.worldMatrix()
+	}
+	version := t.version
+	if parentVersion > version {
+		version = parentVersion
+	}
+	if t.worldVersion != version {
+		t.world = parentMatrix.Mul4(t.localMatrix())
+		t.worldVersion = version
+	}
+	return t.world, version
+}
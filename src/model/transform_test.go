@@ -0,0 +1,146 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package model_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/devblok/koru/src/model"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestTransformIdentity(t *testing.T) {
+	var tr model.Transform
+	if tr.Matrix() != glm.Ident4() || tr.LocalMatrix() != glm.Ident4() {
+		t.Fatalf("zero transform is not the identity: %v", tr.Matrix())
+	}
+	if tr.Scale() != (glm.Vec3{1, 1, 1}) || tr.Orientation() != glm.QuatIdent() {
+		t.Fatalf("zero transform has bad scale or rotation")
+	}
+}
+
+func TestTransformComposition(t *testing.T) {
+	var tr model.Transform
+	tr.SetTranslation(glm.Vec3{1, 2, 3})
+	tr.SetOrientation(glm.QuatRotate(math.Pi/2, glm.Vec3{0, 0, 1}))
+	tr.SetScale(glm.Vec3{2, 2, 2})
+
+	// scaled first, then rotated, then moved
+	got := tr.Matrix().Mul4x1(glm.Vec4{1, 0, 0, 1}).Vec3()
+	if !near(got, glm.Vec3{1, 4, 3}) {
+		t.Fatalf("bad local composition, got: %v", got)
+	}
+
+	var parent model.Transform
+	parent.SetTranslation(glm.Vec3{0, 0, 10})
+	if err := tr.SetParent(&parent); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.Matrix().Mul4x1(glm.Vec4{1, 0, 0, 1}).Vec3(); !near(got, glm.Vec3{1, 4, 13}) {
+		t.Fatalf("parent was not applied, got: %v", got)
+	}
+
+	// cached world matrices follow changes up the hierarchy
+	var root model.Transform
+	if err := parent.SetParent(&root); err != nil {
+		t.Fatal(err)
+	}
+	tr.Matrix()
+	root.SetScale(glm.Vec3{1, 1, 0.5})
+	if got := tr.Matrix().Mul4x1(glm.Vec4{1, 0, 0, 1}).Vec3(); !near(got, glm.Vec3{1, 4, 6.5}) {
+		t.Fatalf("grandparent change was not seen, got: %v", got)
+	}
+	if local := tr.LocalMatrix().Mul4x1(glm.Vec4{1, 0, 0, 1}).Vec3(); !near(local, glm.Vec3{1, 4, 3}) {
+		t.Fatalf("local matrix depends on the parent, got: %v", local)
+	}
+
+	if err := tr.SetParent(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.Matrix().Mul4x1(glm.Vec4{1, 0, 0, 1}).Vec3(); !near(got, glm.Vec3{1, 4, 3}) {
+		t.Fatalf("detached transform still follows the parent, got: %v", got)
+	}
+}
+
+func TestTransformCycle(t *testing.T) {
+	var a, b, c model.Transform
+	if err := b.SetParent(&a); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetParent(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetParent(&c); err != model.ErrTransformCycle {
+		t.Fatalf("expected a cycle error, got: %v", err)
+	}
+	if err := a.SetParent(&a); err != model.ErrTransformCycle {
+		t.Fatalf("expected a cycle error, got: %v", err)
+	}
+	if a.Parent() != nil {
+		t.Fatal("failed parenting changed the transform")
+	}
+}
+
+func TestTransformConcurrentCycle(t *testing.T) {
+	for idx := 0; idx < 10000; idx++ {
+		var a, b model.Transform
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			a.SetParent(&b)
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			b.SetParent(&a)
+		}()
+		close(start)
+		wg.Wait()
+
+		if a.Parent() != nil && b.Parent() != nil {
+			t.Fatal("concurrent parenting made a cycle")
+		}
+		a.Matrix()
+		b.Matrix()
+	}
+}
+
+func TestObjectTransformRoundTrip(t *testing.T) {
+	collada, err := model.ImportColladaObject([]byte(Cube_file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := model.ImportOBJObject([]byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gltf, err := model.ImportGLTFObject(quadGLTF(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	position := glm.Translate3D(4, 5, 6)
+	rotation := glm.HomogRotate3D(math.Pi/3, glm.Vec3{1, 1, 0}.Normalize())
+	for name, object := range map[string]model.Object{"collada": collada, "obj": obj, "gltf": gltf} {
+		object.SetPosition(position)
+		object.SetRotation(rotation)
+
+		if got := object.Position(); !got.ApproxEqualThreshold(position, 1e-5) {
+			t.Fatalf("%s: position changed by setting the rotation, got: %v", name, got)
+		}
+		if got := object.Rotation(); !got.ApproxEqualThreshold(rotation, 1e-5) {
+			t.Fatalf("%s: bad rotation, expected: %v, got: %v", name, rotation, got)
+		}
+		if got := object.Matrix(); !got.ApproxEqualThreshold(position.Mul4(rotation), 1e-5) {
+			t.Fatalf("%s: bad matrix, got: %v", name, got)
+		}
+	}
+}
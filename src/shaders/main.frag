@@ -11,9 +11,12 @@ layout(set = 0, binding = 1) uniform sampler2D texSampler;
 
 layout(location = 0) in vec4 fragColor;
 layout(location = 1) in vec2 fragTexCoord;
+layout(location = 2) in vec2 fragTexCoord1;
+layout(location = 3) in vec3 fragNormal;
+layout(location = 4) in vec4 fragTangent;
 
 layout(location = 0) out vec4 outColor;
 
 void main() {
-    outColor = texture(texSampler, fragTexCoord);
+    outColor = texture(texSampler, fragTexCoord) * fragColor;
 }
\ No newline at end of file
@@ -7,10 +7,6 @@
 #extension GL_ARB_separate_shader_objects : enable
 #extension GL_ARB_shading_language_420pack : enable
 
-layout(push_constant) uniform pushConstants {
-    mat4 model;
-} push;
-
 layout(set = 0, binding = 0) uniform UniformBufferObject {
     mat4 view;
     mat4 projection;
@@ -19,12 +15,27 @@ layout(set = 0, binding = 0) uniform UniformBufferObject {
 layout(location = 0) in vec3 inPosition;
 layout(location = 1) in vec4 inColor;
 layout(location = 2) in vec2 inTexCoords;
+layout(location = 3) in vec2 inTexCoords1;
+layout(location = 4) in vec3 inNormal;
+layout(location = 5) in vec4 inTangent;
+
+// per instance, a column in every location from 6 to 9
+layout(location = 6) in mat4 inModel;
 
 layout(location = 0) out vec4 fragColor;
 layout(location = 1) out vec2 fragTexCoords;
+layout(location = 2) out vec2 fragTexCoords1;
+layout(location = 3) out vec3 fragNormal;
+layout(location = 4) out vec4 fragTangent;
 
 void main() {
-    gl_Position = ubo.projection * ubo.view * push.model * vec4(inPosition, 1.0);
+    gl_Position = ubo.projection * ubo.view * inModel * vec4(inPosition, 1.0);
     fragColor = inColor;
     fragTexCoords = inTexCoords;
+    fragTexCoords1 = inTexCoords1;
+
+    // world space tangent frame, bitangent is cross(normal, tangent) * tangent.w
+    mat3 normalMatrix = transpose(inverse(mat3(inModel)));
+    fragNormal = normalize(normalMatrix * inNormal);
+    fragTangent = vec4(normalize(mat3(inModel) * inTangent.xyz), inTangent.w);
 }
\ No newline at end of file
@@ -0,0 +1,696 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// ErrUnsupportedBlock is returned when decoding BC7 blocks
+// of modes other than the one this package writes
+var ErrUnsupportedBlock = errors.New("unsupported BC7 block mode")
+
+// block is a 4x4 tile of RGBA texels, row by row
+type block [16][4]uint8
+
+// readBlock copies a tile out of img, texels past the edges repeat the last ones
+func readBlock(img *image.NRGBA, bx, by int) (b block) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < 4; y++ {
+		sy := by*4 + y
+		if sy >= height {
+			sy = height - 1
+		}
+		for x := 0; x < 4; x++ {
+			sx := bx*4 + x
+			if sx >= width {
+				sx = width - 1
+			}
+			copy(b[y*4+x][:], img.Pix[sy*img.Stride+sx*4:])
+		}
+	}
+	return
+}
+
+// writeBlock copies the part of a tile that is inside img
+func writeBlock(img *image.NRGBA, bx, by int, b *block) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < 4 && by*4+y < height; y++ {
+		for x := 0; x < 4 && bx*4+x < width; x++ {
+			copy(img.Pix[(by*4+y)*img.Stride+(bx*4+x)*4:], b[y*4+x][:])
+		}
+	}
+}
+
+// Encode stores img in format, compressed formats are encoded on the CPU
+func Encode(format Format, img *image.NRGBA) ([]byte, error) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if !format.Compressed() {
+		out := make([]byte, format.LevelSize(width, height))
+		for y := 0; y < height; y++ {
+			copy(out[y*width*4:(y+1)*width*4], img.Pix[y*img.Stride:])
+		}
+		return out, nil
+	}
+
+	var encodeBlock func(b *block, out []byte)
+	switch format {
+	case FormatBC1:
+		encodeBlock = func(b *block, out []byte) { encodeColorBlock(b, true, out) }
+	case FormatBC3:
+		encodeBlock = func(b *block, out []byte) {
+			encodeChannelBlock(b, 3, out[:8])
+			encodeColorBlock(b, false, out[8:])
+		}
+	case FormatBC5:
+		encodeBlock = func(b *block, out []byte) {
+			encodeChannelBlock(b, 0, out[:8])
+			encodeChannelBlock(b, 1, out[8:])
+		}
+	case FormatBC7:
+		encodeBlock = encodeBC7Block
+	default:
+		return nil, fmt.Errorf("can't encode to %s", format)
+	}
+
+	blocksX, blocksY := (width+3)/4, (height+3)/4
+	size := format.BlockSize()
+	out := make([]byte, blocksX*blocksY*size)
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			b := readBlock(img, bx, by)
+			offset := (by*blocksX + bx) * size
+			encodeBlock(&b, out[offset:offset+size])
+		}
+	}
+	return out, nil
+}
+
+// Decode turns texel data of the given size into an image
+func Decode(format Format, width, height int, data []byte) (*image.NRGBA, error) {
+	if len(data) < format.LevelSize(width, height) {
+		return nil, fmt.Errorf("%s data too short for %dx%d", format, width, height)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if !format.Compressed() {
+		copy(img.Pix, data)
+		return img, nil
+	}
+
+	var decodeBlock func(data []byte, b *block) error
+	switch format {
+	case FormatBC1:
+		decodeBlock = func(data []byte, b *block) error {
+			decodeColorBlock(data, true, b)
+			return nil
+		}
+	case FormatBC3:
+		decodeBlock = func(data []byte, b *block) error {
+			decodeColorBlock(data[8:], false, b)
+			decodeChannelBlock(data[:8], 3, b)
+			return nil
+		}
+	case FormatBC5:
+		decodeBlock = func(data []byte, b *block) error {
+			decodeChannelBlock(data[:8], 0, b)
+			decodeChannelBlock(data[8:], 1, b)
+			for t := range b {
+				b[t][2], b[t][3] = 0, 255
+			}
+			return nil
+		}
+	case FormatBC7:
+		decodeBlock = decodeBC7Block
+	default:
+		return nil, fmt.Errorf("can't decode %s", format)
+	}
+
+	blocksX, blocksY := (width+3)/4, (height+3)/4
+	size := format.BlockSize()
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			var b block
+			offset := (by*blocksX + bx) * size
+			if err := decodeBlock(data[offset:offset+size], &b); err != nil {
+				return nil, err
+			}
+			writeBlock(img, bx, by, &b)
+		}
+	}
+	return img, nil
+}
+
+// principalAxis returns the direction of the largest spread of points
+// around their mean, by power iteration of the covariance matrix
+func principalAxis(points [][4]float64, channels int) (mean, axis [4]float64) {
+	if len(points) == 0 {
+		return
+	}
+	for _, p := range points {
+		for c := 0; c < channels; c++ {
+			mean[c] += p[c]
+		}
+	}
+	for c := 0; c < channels; c++ {
+		mean[c] /= float64(len(points))
+	}
+	var cov [4][4]float64
+	for _, p := range points {
+		for i := 0; i < channels; i++ {
+			for j := 0; j < channels; j++ {
+				cov[i][j] += (p[i] - mean[i]) * (p[j] - mean[j])
+			}
+		}
+	}
+	for c := 0; c < channels; c++ {
+		axis[c] = 1
+	}
+	for iteration := 0; iteration < 8; iteration++ {
+		var next [4]float64
+		var length float64
+		for i := 0; i < channels; i++ {
+			for j := 0; j < channels; j++ {
+				next[i] += cov[i][j] * axis[j]
+			}
+			length += next[i] * next[i]
+		}
+		if length == 0 {
+			break
+		}
+		length = math.Sqrt(length)
+		for i := 0; i < channels; i++ {
+			axis[i] = next[i] / length
+		}
+	}
+	return
+}
+
+// extremes returns the points with the lowest and highest projection on axis
+func extremes(points [][4]float64, mean, axis [4]float64) (low, high [4]float64) {
+	minDot, maxDot := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		var dot float64
+		for c := range p {
+			dot += (p[c] - mean[c]) * axis[c]
+		}
+		if dot < minDot {
+			minDot, low = dot, p
+		}
+		if dot > maxDot {
+			maxDot, high = dot, p
+		}
+	}
+	return
+}
+
+func clampByte(v float64) int {
+	return int(math.Max(0, math.Min(255, math.Floor(v+0.5))))
+}
+
+// pack565 quantizes a color to 5, 6 and 5 bits
+func pack565(c [4]float64) uint16 {
+	r := quantizeBits(clampByte(c[0]), 31)
+	g := quantizeBits(clampByte(c[1]), 63)
+	b := quantizeBits(clampByte(c[2]), 31)
+	return r<<11 | g<<5 | b
+}
+
+// quantizeBits returns the value of max + 1 steps that expands closest to value
+func quantizeBits(value int, max uint16) uint16 {
+	q := uint16(value * int(max) / 255)
+	if q < max && abs(expandBits(q+1, max)-value) < abs(expandBits(q, max)-value) {
+		q++
+	}
+	return q
+}
+
+func expandBits(q, max uint16) int {
+	if max == 63 {
+		return int(q<<2 | q>>4)
+	}
+	return int(q<<3 | q>>2)
+}
+
+func unpack565(c uint16) [4]int {
+	return [4]int{expandBits(c>>11, 31), expandBits(c>>5&63, 63), expandBits(c&31, 31), 255}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// colorPalette returns the colors of a BC1 block with the given endpoints
+func colorPalette(c0, c1 uint16, punchThrough bool) (palette [4][4]int) {
+	a, b := unpack565(c0), unpack565(c1)
+	palette[0], palette[1] = a, b
+	for c := 0; c < 3; c++ {
+		if c0 > c1 || !punchThrough {
+			palette[2][c] = (2*a[c] + b[c]) / 3
+			palette[3][c] = (a[c] + 2*b[c]) / 3
+		} else {
+			palette[2][c] = (a[c] + b[c]) / 2
+		}
+	}
+	palette[2][3] = 255
+	if c0 > c1 || !punchThrough {
+		palette[3][3] = 255
+	}
+	return
+}
+
+func colorDistance(a [4]uint8, b [4]int) int {
+	var d int
+	for c := 0; c < 3; c++ {
+		e := int(a[c]) - b[c]
+		d += e * e
+	}
+	return d
+}
+
+// fitColors picks the nearest palette entry for every texel
+func fitColors(b *block, palette [4][4]int, entries int, transparent []bool) (indices [16]int, err int) {
+	for t := range b {
+		if transparent != nil && transparent[t] {
+			indices[t] = 3
+			continue
+		}
+		best, bestErr := 0, math.MaxInt32
+		for p := 0; p < entries; p++ {
+			if d := colorDistance(b[t], palette[p]); d < bestErr {
+				best, bestErr = p, d
+			}
+		}
+		indices[t] = best
+		err += bestErr
+	}
+	return
+}
+
+// encodeColorBlock writes the 8 byte BC1 color block, texels with alpha
+// under half become transparent when punchThrough is allowed
+func encodeColorBlock(b *block, punchThrough bool, out []byte) {
+	var points [][4]float64
+	var transparent []bool
+	if punchThrough {
+		transparent = make([]bool, 16)
+	}
+	for t := range b {
+		if punchThrough && b[t][3] < 128 {
+			transparent[t] = true
+			continue
+		}
+		points = append(points, [4]float64{float64(b[t][0]), float64(b[t][1]), float64(b[t][2])})
+	}
+	hasTransparent := len(points) < 16
+
+	var c0, c1 uint16
+	var indices [16]int
+	if len(points) == 0 {
+		for t := range indices {
+			indices[t] = 3
+		}
+	} else {
+		mean, axis := principalAxis(points, 3)
+		low, high := extremes(points, mean, axis)
+		c0, c1 = pack565(high), pack565(low)
+
+		// three color mode needs c0 <= c1, four colors c0 > c1
+		threeColors := hasTransparent
+		order := func() {
+			if threeColors == (c0 > c1) {
+				c0, c1 = c1, c0
+			}
+		}
+		order()
+		entries := 4
+		if threeColors {
+			entries = 3
+		}
+		var err int
+		indices, err = fitColors(b, colorPalette(c0, c1, punchThrough), entries, transparent)
+
+		// refine the endpoints by least squares on the chosen indices
+		for iteration := 0; iteration < 2; iteration++ {
+			e0, e1, ok := leastSquaresColors(b, indices, threeColors, transparent)
+			if !ok {
+				break
+			}
+			n0, n1 := c0, c1
+			c0, c1 = pack565(e0), pack565(e1)
+			order()
+			next, nextErr := fitColors(b, colorPalette(c0, c1, punchThrough), entries, transparent)
+			if nextErr >= err {
+				c0, c1 = n0, n1
+				break
+			}
+			indices, err = next, nextErr
+		}
+		if c0 == c1 && !threeColors {
+			// a single color, both palette ends are the same
+			for t := range indices {
+				indices[t] = 0
+			}
+		}
+	}
+
+	binary.LittleEndian.PutUint16(out[0:], c0)
+	binary.LittleEndian.PutUint16(out[2:], c1)
+	var bits uint32
+	for t, idx := range indices {
+		bits |= uint32(idx) << uint(t*2)
+	}
+	binary.LittleEndian.PutUint32(out[4:], bits)
+}
+
+// leastSquaresColors solves for the endpoints that best
+// reproduce the texels with the given palette indices
+func leastSquaresColors(b *block, indices [16]int, threeColors bool, transparent []bool) (e0, e1 [4]float64, ok bool) {
+	weights := [4]float64{1, 0, 2.0 / 3, 1.0 / 3}
+	if threeColors {
+		weights = [4]float64{1, 0, 0.5, 0}
+	}
+	var aa, bb, ab float64
+	var ax, bx [4]float64
+	for t := range b {
+		if transparent != nil && transparent[t] {
+			continue
+		}
+		w := weights[indices[t]]
+		aa += w * w
+		bb += (1 - w) * (1 - w)
+		ab += w * (1 - w)
+		for c := 0; c < 3; c++ {
+			ax[c] += w * float64(b[t][c])
+			bx[c] += (1 - w) * float64(b[t][c])
+		}
+	}
+	det := aa*bb - ab*ab
+	if math.Abs(det) < 1e-9 {
+		return e0, e1, false
+	}
+	for c := 0; c < 3; c++ {
+		e0[c] = (ax[c]*bb - bx[c]*ab) / det
+		e1[c] = (bx[c]*aa - ax[c]*ab) / det
+	}
+	return e0, e1, true
+}
+
+func decodeColorBlock(data []byte, punchThrough bool, b *block) {
+	c0, c1 := binary.LittleEndian.Uint16(data[0:]), binary.LittleEndian.Uint16(data[2:])
+	palette := colorPalette(c0, c1, punchThrough)
+	bits := binary.LittleEndian.Uint32(data[4:])
+	for t := range b {
+		entry := palette[bits>>uint(t*2)&3]
+		for c := 0; c < 3; c++ {
+			b[t][c] = uint8(entry[c])
+		}
+		b[t][3] = uint8(entry[3])
+	}
+}
+
+// channelPalette returns the values of a BC4 block with the given endpoints
+func channelPalette(a0, a1 int) (palette [8]int) {
+	palette[0], palette[1] = a0, a1
+	if a0 > a1 {
+		for i := 1; i < 7; i++ {
+			palette[i+1] = ((7-i)*a0 + i*a1) / 7
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			palette[i+1] = ((5-i)*a0 + i*a1) / 5
+		}
+		palette[6], palette[7] = 0, 255
+	}
+	return
+}
+
+func fitChannel(b *block, channel int, palette [8]int) (indices [16]int, err int) {
+	for t := range b {
+		best, bestErr := 0, math.MaxInt32
+		for p, value := range palette {
+			d := int(b[t][channel]) - value
+			if d*d < bestErr {
+				best, bestErr = p, d*d
+			}
+		}
+		indices[t] = best
+		err += bestErr
+	}
+	return
+}
+
+// encodeChannelBlock writes the 8 byte BC4 block of a single channel,
+// trying both the eight value and the six value with 0 and 255 modes
+func encodeChannelBlock(b *block, channel int, out []byte) {
+	low, high := 255, 0
+	innerLow, innerHigh := 255, 0
+	for t := range b {
+		v := int(b[t][channel])
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+		if v != 0 && v != 255 {
+			if v < innerLow {
+				innerLow = v
+			}
+			if v > innerHigh {
+				innerHigh = v
+			}
+		}
+	}
+
+	a0, a1 := high, low
+	indices, err := fitChannel(b, channel, channelPalette(a0, a1))
+	if innerLow <= innerHigh {
+		six, sixErr := fitChannel(b, channel, channelPalette(innerLow, innerHigh))
+		if sixErr < err {
+			a0, a1, indices = innerLow, innerHigh, six
+		}
+	}
+
+	out[0], out[1] = uint8(a0), uint8(a1)
+	var bits uint64
+	for t, idx := range indices {
+		bits |= uint64(idx) << uint(t*3)
+	}
+	for i := 0; i < 6; i++ {
+		out[2+i] = uint8(bits >> uint(i*8))
+	}
+}
+
+func decodeChannelBlock(data []byte, channel int, b *block) {
+	palette := channelPalette(int(data[0]), int(data[1]))
+	var bits uint64
+	for i := 0; i < 6; i++ {
+		bits |= uint64(data[2+i]) << uint(i*8)
+	}
+	for t := range b {
+		b[t][channel] = uint8(palette[bits>>uint(t*3)&7])
+	}
+}
+
+// bc7Weights are the interpolation weights of 4-bit BC7 indices, out of 64
+var bc7Weights = [16]int{0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64}
+
+// bitWriter fills a 128-bit block from the least significant bit up
+type bitWriter struct {
+	out []byte
+	pos uint
+}
+
+func (w *bitWriter) write(value uint32, bits uint) {
+	for i := uint(0); i < bits; i++ {
+		if value>>i&1 != 0 {
+			w.out[w.pos/8] |= 1 << (w.pos % 8)
+		}
+		w.pos++
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  uint
+}
+
+func (r *bitReader) read(bits uint) uint32 {
+	var value uint32
+	for i := uint(0); i < bits; i++ {
+		value |= uint32(r.data[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return value
+}
+
+func bc7Palette(e0, e1 [4]int) (palette [16][4]int) {
+	for i, w := range bc7Weights {
+		for c := 0; c < 4; c++ {
+			palette[i][c] = ((64-w)*e0[c] + w*e1[c] + 32) >> 6
+		}
+	}
+	return
+}
+
+func fitBC7(b *block, palette [16][4]int) (indices [16]int, err int) {
+	for t := range b {
+		best, bestErr := 0, math.MaxInt32
+		for p := range palette {
+			var d int
+			for c := 0; c < 4; c++ {
+				e := int(b[t][c]) - palette[p][c]
+				d += e * e
+			}
+			if d < bestErr {
+				best, bestErr = p, d
+			}
+		}
+		indices[t] = best
+		err += bestErr
+	}
+	return
+}
+
+// bc7Endpoint quantizes a color to 7 bits per channel with a shared
+// lowest bit, returning the 7-bit values and the resulting color
+func bc7Endpoint(c [4]float64, pbit int) (q [4]int, value [4]int) {
+	for ch := 0; ch < 4; ch++ {
+		v := int(math.Floor((c[ch]-float64(pbit))/2 + 0.5))
+		if v < 0 {
+			v = 0
+		}
+		if v > 127 {
+			v = 127
+		}
+		q[ch], value[ch] = v, v<<1|pbit
+	}
+	return
+}
+
+// encodeBC7Block writes a mode 6 block: a single subset with 7-bit
+// RGBA endpoints, a p-bit each and 4-bit indices
+func encodeBC7Block(b *block, out []byte) {
+	points := make([][4]float64, 16)
+	for t := range b {
+		for c := 0; c < 4; c++ {
+			points[t][c] = float64(b[t][c])
+		}
+	}
+	mean, axis := principalAxis(points, 4)
+	low, high := extremes(points, mean, axis)
+
+	type candidate struct {
+		q0, q1  [4]int
+		p0, p1  int
+		indices [16]int
+		err     int
+	}
+	try := func(low, high [4]float64) (best candidate) {
+		best.err = math.MaxInt32
+		for pbits := 0; pbits < 4; pbits++ {
+			p0, p1 := pbits&1, pbits>>1
+			q0, e0 := bc7Endpoint(low, p0)
+			q1, e1 := bc7Endpoint(high, p1)
+			indices, err := fitBC7(b, bc7Palette(e0, e1))
+			if err < best.err {
+				best = candidate{q0, q1, p0, p1, indices, err}
+			}
+		}
+		return
+	}
+	best := try(low, high)
+
+	// refine the endpoints by least squares on the chosen indices
+	for iteration := 0; iteration < 2 && best.err > 0; iteration++ {
+		var aa, bb, ab float64
+		var ax, bx [4]float64
+		for t := range b {
+			w := float64(bc7Weights[best.indices[t]]) / 64
+			aa += (1 - w) * (1 - w)
+			bb += w * w
+			ab += w * (1 - w)
+			for c := 0; c < 4; c++ {
+				ax[c] += (1 - w) * points[t][c]
+				bx[c] += w * points[t][c]
+			}
+		}
+		det := aa*bb - ab*ab
+		if math.Abs(det) < 1e-9 {
+			break
+		}
+		var e0, e1 [4]float64
+		for c := 0; c < 4; c++ {
+			e0[c] = (ax[c]*bb - bx[c]*ab) / det
+			e1[c] = (bx[c]*aa - ax[c]*ab) / det
+		}
+		next := try(e0, e1)
+		if next.err >= best.err {
+			break
+		}
+		best = next
+	}
+
+	// the first index is stored without its highest bit, which must be 0
+	if best.indices[0] >= 8 {
+		best.q0, best.q1 = best.q1, best.q0
+		best.p0, best.p1 = best.p1, best.p0
+		for t := range best.indices {
+			best.indices[t] = 15 - best.indices[t]
+		}
+	}
+
+	for i := range out[:16] {
+		out[i] = 0
+	}
+	w := bitWriter{out: out}
+	w.write(1<<6, 7)
+	for c := 0; c < 4; c++ {
+		w.write(uint32(best.q0[c]), 7)
+		w.write(uint32(best.q1[c]), 7)
+	}
+	w.write(uint32(best.p0), 1)
+	w.write(uint32(best.p1), 1)
+	w.write(uint32(best.indices[0]), 3)
+	for _, idx := range best.indices[1:] {
+		w.write(uint32(idx), 4)
+	}
+}
+
+func decodeBC7Block(data []byte, b *block) error {
+	r := bitReader{data: data}
+	if r.read(7) != 1<<6 {
+		return ErrUnsupportedBlock
+	}
+	var e0, e1 [4]int
+	for c := 0; c < 4; c++ {
+		e0[c] = int(r.read(7)) << 1
+		e1[c] = int(r.read(7)) << 1
+	}
+	p0, p1 := int(r.read(1)), int(r.read(1))
+	for c := 0; c < 4; c++ {
+		e0[c] |= p0
+		e1[c] |= p1
+	}
+	palette := bc7Palette(e0, e1)
+	for t := range b {
+		bits := uint(4)
+		if t == 0 {
+			bits = 3
+		}
+		for c, v := range palette[r.read(bits)] {
+			b[t][c] = uint8(v)
+		}
+	}
+	return nil
+}
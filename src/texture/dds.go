@@ -0,0 +1,290 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DirectDraw Surface header values
+const (
+	ddsMagic = 0x20534444 // "DDS "
+
+	ddsdCaps        = 0x1
+	ddsdHeight      = 0x2
+	ddsdWidth       = 0x4
+	ddsdPitch       = 0x8
+	ddsdPixelFormat = 0x1000
+	ddsdMipMapCount = 0x20000
+	ddsdLinearSize  = 0x80000
+
+	ddpfAlphaPixels = 0x1
+	ddpfFourCC      = 0x4
+	ddpfRGB         = 0x40
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipMap  = 0x400000
+
+	d3d10ResourceDimensionTexture2D = 3
+)
+
+// DXGI_FORMAT values of the supported formats
+const (
+	dxgiR8G8B8A8Unorm     = 28
+	dxgiR8G8B8A8UnormSRGB = 29
+	dxgiBC1Unorm          = 71
+	dxgiBC1UnormSRGB      = 72
+	dxgiBC3Unorm          = 77
+	dxgiBC3UnormSRGB      = 78
+	dxgiBC5Unorm          = 83
+	dxgiBC7Unorm          = 98
+	dxgiBC7UnormSRGB      = 99
+)
+
+func fourCC(code string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(code))
+}
+
+type ddsPixelFormat struct {
+	Size        uint32
+	Flags       uint32
+	FourCC      uint32
+	RGBBitCount uint32
+	RBitMask    uint32
+	GBitMask    uint32
+	BBitMask    uint32
+	ABitMask    uint32
+}
+
+type ddsHeader struct {
+	Size              uint32
+	Flags             uint32
+	Height            uint32
+	Width             uint32
+	PitchOrLinearSize uint32
+	Depth             uint32
+	MipMapCount       uint32
+	Reserved1         [11]uint32
+	PixelFormat       ddsPixelFormat
+	Caps              uint32
+	Caps2             uint32
+	Caps3             uint32
+	Caps4             uint32
+	Reserved2         uint32
+}
+
+type ddsHeaderDX10 struct {
+	Format            uint32
+	ResourceDimension uint32
+	MiscFlag          uint32
+	ArraySize         uint32
+	MiscFlags2        uint32
+}
+
+// dxgiFormat maps a format to its DXGI_FORMAT
+func dxgiFormat(format Format, srgb bool) (uint32, error) {
+	type key struct {
+		format Format
+		srgb   bool
+	}
+	formats := map[key]uint32{
+		{FormatRGBA8, false}: dxgiR8G8B8A8Unorm,
+		{FormatRGBA8, true}:  dxgiR8G8B8A8UnormSRGB,
+		{FormatBC1, false}:   dxgiBC1Unorm,
+		{FormatBC1, true}:    dxgiBC1UnormSRGB,
+		{FormatBC3, false}:   dxgiBC3Unorm,
+		{FormatBC3, true}:    dxgiBC3UnormSRGB,
+		{FormatBC5, false}:   dxgiBC5Unorm,
+		{FormatBC7, false}:   dxgiBC7Unorm,
+		{FormatBC7, true}:    dxgiBC7UnormSRGB,
+	}
+	dxgi, ok := formats[key{format, srgb}]
+	if !ok {
+		if srgb {
+			return 0, ErrNoSRGB
+		}
+		return 0, fmt.Errorf("%s can't be stored in DDS", format)
+	}
+	return dxgi, nil
+}
+
+// formatOfDXGI is the reverse of dxgiFormat
+func formatOfDXGI(dxgi uint32) (Format, bool, error) {
+	switch dxgi {
+	case dxgiR8G8B8A8Unorm, dxgiR8G8B8A8UnormSRGB:
+		return FormatRGBA8, dxgi == dxgiR8G8B8A8UnormSRGB, nil
+	case dxgiBC1Unorm, dxgiBC1UnormSRGB:
+		return FormatBC1, dxgi == dxgiBC1UnormSRGB, nil
+	case dxgiBC3Unorm, dxgiBC3UnormSRGB:
+		return FormatBC3, dxgi == dxgiBC3UnormSRGB, nil
+	case dxgiBC5Unorm:
+		return FormatBC5, false, nil
+	case dxgiBC7Unorm, dxgiBC7UnormSRGB:
+		return FormatBC7, dxgi == dxgiBC7UnormSRGB, nil
+	default:
+		return 0, false, fmt.Errorf("unsupported DXGI format %d", dxgi)
+	}
+}
+
+// WriteDDS stores the texture in a DirectDraw Surface container,
+// always with the DX10 header so that the color space is kept
+func WriteDDS(w io.Writer, tex *Texture) error {
+	dxgi, err := dxgiFormat(tex.Format, tex.SRGB)
+	if err != nil {
+		return err
+	}
+	if len(tex.Levels) == 0 {
+		return errors.New("texture has no levels")
+	}
+	for level, data := range tex.Levels {
+		if width, height := tex.LevelSize(level); len(data) != tex.Format.LevelSize(width, height) {
+			return fmt.Errorf("level %d has %d bytes, expected %d", level, len(data), tex.Format.LevelSize(width, height))
+		}
+	}
+
+	header := ddsHeader{
+		Size:        124,
+		Flags:       ddsdCaps | ddsdHeight | ddsdWidth | ddsdPixelFormat,
+		Height:      uint32(tex.Height),
+		Width:       uint32(tex.Width),
+		MipMapCount: uint32(len(tex.Levels)),
+		PixelFormat: ddsPixelFormat{
+			Size:   32,
+			Flags:  ddpfFourCC,
+			FourCC: fourCC("DX10"),
+		},
+		Caps: ddsCapsTexture,
+	}
+	if tex.Format.Compressed() {
+		header.Flags |= ddsdLinearSize
+		header.PitchOrLinearSize = uint32(len(tex.Levels[0]))
+	} else {
+		header.Flags |= ddsdPitch
+		header.PitchOrLinearSize = uint32(tex.Width * tex.Format.BlockSize())
+	}
+	if len(tex.Levels) > 1 {
+		header.Flags |= ddsdMipMapCount
+		header.Caps |= ddsCapsComplex | ddsCapsMipMap
+	}
+
+	for _, data := range []interface{}{
+		uint32(ddsMagic),
+		header,
+		ddsHeaderDX10{
+			Format:            dxgi,
+			ResourceDimension: d3d10ResourceDimensionTexture2D,
+			ArraySize:         1,
+		},
+	} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	for _, data := range tex.Levels {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDDS loads a 2D texture from a DirectDraw Surface container.
+// Legacy DXT1, DXT5, ATI2 and 32-bit RGB files are accepted along
+// with DX10 headers of the formats this package supports
+func ReadDDS(r io.Reader) (*Texture, error) {
+	var magic uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != ddsMagic {
+		return nil, errors.New("not a DDS file")
+	}
+	var header ddsHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Size != 124 || header.PixelFormat.Size != 32 {
+		return nil, errors.New("malformed DDS header")
+	}
+	if header.Width == 0 || header.Height == 0 {
+		return nil, errors.New("DDS texture is empty")
+	}
+
+	tex := &Texture{
+		Width:  int(header.Width),
+		Height: int(header.Height),
+	}
+	pf := header.PixelFormat
+	swapRedBlue, opaque := false, false
+	switch {
+	case pf.Flags&ddpfFourCC != 0 && pf.FourCC == fourCC("DX10"):
+		var dx10 ddsHeaderDX10
+		if err := binary.Read(r, binary.LittleEndian, &dx10); err != nil {
+			return nil, err
+		}
+		if dx10.ResourceDimension != d3d10ResourceDimensionTexture2D || dx10.ArraySize > 1 {
+			return nil, errors.New("only single 2D DDS textures are supported")
+		}
+		format, srgb, err := formatOfDXGI(dx10.Format)
+		if err != nil {
+			return nil, err
+		}
+		tex.Format, tex.SRGB = format, srgb
+	case pf.Flags&ddpfFourCC != 0:
+		switch pf.FourCC {
+		case fourCC("DXT1"):
+			tex.Format = FormatBC1
+		case fourCC("DXT5"):
+			tex.Format = FormatBC3
+		case fourCC("ATI2"), fourCC("BC5U"):
+			tex.Format = FormatBC5
+		default:
+			return nil, fmt.Errorf("unsupported DDS FourCC %q", string([]byte{
+				byte(pf.FourCC), byte(pf.FourCC >> 8), byte(pf.FourCC >> 16), byte(pf.FourCC >> 24),
+			}))
+		}
+	case pf.Flags&ddpfRGB != 0 && pf.RGBBitCount == 32 && pf.GBitMask == 0xff00:
+		tex.Format = FormatRGBA8
+		switch {
+		case pf.RBitMask == 0xff && pf.BBitMask == 0xff0000:
+		case pf.RBitMask == 0xff0000 && pf.BBitMask == 0xff:
+			swapRedBlue = true
+		default:
+			return nil, errors.New("unsupported DDS channel layout")
+		}
+		// without an alpha channel the fourth byte is padding
+		opaque = pf.Flags&ddpfAlphaPixels == 0
+	default:
+		return nil, errors.New("unsupported DDS pixel format")
+	}
+
+	levels := 1
+	if header.Flags&ddsdMipMapCount != 0 && header.MipMapCount > 1 {
+		levels = int(header.MipMapCount)
+	}
+	if max := LevelCount(tex.Width, tex.Height); levels > max {
+		return nil, fmt.Errorf("DDS file has %d levels, at most %d fit", levels, max)
+	}
+	for level := 0; level < levels; level++ {
+		width, height := tex.LevelSize(level)
+		data := make([]byte, tex.Format.LevelSize(width, height))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("DDS level %d: %s", level, err.Error())
+		}
+		for idx := 0; swapRedBlue && idx < len(data); idx += 4 {
+			data[idx], data[idx+2] = data[idx+2], data[idx]
+		}
+		for idx := 3; opaque && idx < len(data); idx += 4 {
+			data[idx] = 255
+		}
+		tex.Levels = append(tex.Levels, data)
+	}
+	return tex, nil
+}
@@ -0,0 +1,493 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+func init() {
+	image.RegisterFormat("exr", "\x76\x2f\x31\x01", DecodeEXR, DecodeEXRConfig)
+}
+
+// EXRCompression is the compression of OpenEXR scanline blocks
+type EXRCompression uint8
+
+// Compressions that can be read and written, the lossy and
+// wavelet ones (PIZ, PXR24, B44, DWA) are not supported
+const (
+	EXRCompressionNone EXRCompression = 0
+	EXRCompressionRLE  EXRCompression = 1
+	EXRCompressionZIPS EXRCompression = 2
+	EXRCompressionZIP  EXRCompression = 3
+)
+
+// linesPerBlock returns the scanlines compressed together
+func (c EXRCompression) linesPerBlock() int {
+	if c == EXRCompressionZIP {
+		return 16
+	}
+	return 1
+}
+
+// OpenEXR pixel types
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+const (
+	exrMagic        = 20000630
+	exrTiledFlag    = 0x200
+	exrNonImageFlag = 0x800
+	exrMultiPart    = 0x1000
+)
+
+type exrChannel struct {
+	name      string
+	pixelType int32
+}
+
+func (c exrChannel) size() int {
+	if c.pixelType == exrHalf {
+		return 2
+	}
+	return 4
+}
+
+type exrHeader struct {
+	channels    []exrChannel
+	compression EXRCompression
+	dataWindow  image.Rectangle
+}
+
+func readCString(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	return s[:len(s)-1], nil
+}
+
+func readEXRHeader(r *bufio.Reader) (exrHeader, error) {
+	var h exrHeader
+	var magic, version uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return h, err
+	}
+	if magic != exrMagic {
+		return h, errors.New("not an OpenEXR file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return h, err
+	}
+	if version&0xff != 2 {
+		return h, fmt.Errorf("unsupported OpenEXR version %d", version&0xff)
+	}
+	if version&(exrTiledFlag|exrNonImageFlag|exrMultiPart) != 0 {
+		return h, errors.New("only single part scanline OpenEXR files are supported")
+	}
+
+	hasChannels, hasWindow := false, false
+	for {
+		name, err := readCString(r)
+		if err != nil {
+			return h, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := readCString(r); err != nil {
+			return h, err
+		}
+		var size int32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return h, err
+		}
+		if size < 0 {
+			return h, fmt.Errorf("bad size of attribute %s", name)
+		}
+		value := make([]byte, size)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return h, err
+		}
+
+		switch name {
+		case "channels":
+			if h.channels, err = parseEXRChannels(value); err != nil {
+				return h, err
+			}
+			hasChannels = true
+		case "compression":
+			if len(value) != 1 {
+				return h, errors.New("bad compression attribute")
+			}
+			h.compression = EXRCompression(value[0])
+			if h.compression > EXRCompressionZIP {
+				return h, fmt.Errorf("unsupported OpenEXR compression %d", value[0])
+			}
+		case "dataWindow":
+			if len(value) != 16 {
+				return h, errors.New("bad dataWindow attribute")
+			}
+			box := make([]int32, 4)
+			binary.Read(bytes.NewReader(value), binary.LittleEndian, box)
+			h.dataWindow = image.Rect(int(box[0]), int(box[1]), int(box[2])+1, int(box[3])+1)
+			hasWindow = true
+		}
+	}
+	if !hasChannels || !hasWindow {
+		return h, errors.New("OpenEXR header misses channels or dataWindow")
+	}
+	if h.dataWindow.Empty() {
+		return h, errors.New("OpenEXR image is empty")
+	}
+	return h, nil
+}
+
+func parseEXRChannels(value []byte) ([]exrChannel, error) {
+	var channels []exrChannel
+	for len(value) > 0 && value[0] != 0 {
+		end := bytes.IndexByte(value, 0)
+		if end < 0 || len(value) < end+1+16 {
+			return nil, errors.New("bad channel list")
+		}
+		c := exrChannel{name: string(value[:end])}
+		fields := value[end+1 : end+17]
+		c.pixelType = int32(binary.LittleEndian.Uint32(fields[0:]))
+		xSampling := binary.LittleEndian.Uint32(fields[8:])
+		ySampling := binary.LittleEndian.Uint32(fields[12:])
+		if c.pixelType < exrUint || c.pixelType > exrFloat {
+			return nil, fmt.Errorf("channel %s has unknown type %d", c.name, c.pixelType)
+		}
+		if xSampling != 1 || ySampling != 1 {
+			return nil, fmt.Errorf("channel %s is subsampled", c.name)
+		}
+		channels = append(channels, c)
+		value = value[end+17:]
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("image has no channels")
+	}
+	return channels, nil
+}
+
+// DecodeEXRConfig returns the size of an OpenEXR image
+func DecodeEXRConfig(r io.Reader) (image.Config, error) {
+	h, err := readEXRHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: h.dataWindow.Dx(), Height: h.dataWindow.Dy()}, nil
+}
+
+// DecodeEXR reads a single part scanline OpenEXR (.exr) image, uncompressed
+// or RLE, ZIPS and ZIP compressed, into a *FloatImage. R, G, B and A
+// channels are used, a lone Y channel is read as gray
+func DecodeEXR(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readEXRHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := h.dataWindow.Dx(), h.dataWindow.Dy()
+	lines := h.compression.linesPerBlock()
+	chunks := (height + lines - 1) / lines
+	// chunks follow each other, the offsets are not needed
+	if _, err := br.Discard(chunks * 8); err != nil {
+		return nil, err
+	}
+
+	target := make([]int, len(h.channels))
+	for idx, c := range h.channels {
+		switch c.name {
+		case "R", "Y":
+			target[idx] = 0
+		case "G":
+			target[idx] = 1
+		case "B":
+			target[idx] = 2
+		case "A":
+			target[idx] = 3
+		default:
+			target[idx] = -1
+		}
+	}
+	var lineSize int
+	for _, c := range h.channels {
+		lineSize += c.size() * width
+	}
+	gray := len(h.channels) == 1 && h.channels[0].name == "Y"
+
+	img := NewFloatImage(image.Rect(0, 0, width, height))
+	for idx := range img.Pix {
+		if idx%4 == 3 {
+			img.Pix[idx] = 1
+		}
+	}
+	for chunk := 0; chunk < chunks; chunk++ {
+		var y, size int32
+		if err := binary.Read(br, binary.LittleEndian, &y); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		first := int(y) - h.dataWindow.Min.Y
+		if first < 0 || first >= height || size < 0 {
+			return nil, fmt.Errorf("bad OpenEXR chunk at line %d", y)
+		}
+		count := lines
+		if first+count > height {
+			count = height - first
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		if data, err = decompressEXR(h.compression, data, lineSize*count); err != nil {
+			return nil, fmt.Errorf("OpenEXR chunk at line %d: %s", y, err.Error())
+		}
+
+		for line := 0; line < count; line++ {
+			row := data[line*lineSize:]
+			pix := img.Pix[(first+line)*img.Stride:]
+			for idx, c := range h.channels {
+				for x := 0; x < width; x++ {
+					var v float32
+					switch c.pixelType {
+					case exrHalf:
+						v = HalfToFloat(binary.LittleEndian.Uint16(row[x*2:]))
+					case exrFloat:
+						v = math.Float32frombits(binary.LittleEndian.Uint32(row[x*4:]))
+					default:
+						v = float32(binary.LittleEndian.Uint32(row[x*4:]))
+					}
+					if gray {
+						pix[x*4], pix[x*4+1], pix[x*4+2] = v, v, v
+					} else if target[idx] >= 0 {
+						pix[x*4+target[idx]] = v
+					}
+				}
+				row = row[c.size()*width:]
+			}
+		}
+	}
+	return img, nil
+}
+
+// decompressEXR returns the raw scanlines of a chunk, chunks
+// that would not get smaller are stored raw
+func decompressEXR(compression EXRCompression, data []byte, size int) ([]byte, error) {
+	if compression == EXRCompressionNone || len(data) == size {
+		if len(data) != size {
+			return nil, errors.New("wrong chunk size")
+		}
+		return data, nil
+	}
+
+	var packed []byte
+	switch compression {
+	case EXRCompressionRLE:
+		for len(data) > 0 {
+			count := int(int8(data[0]))
+			if count < 0 {
+				if len(data) < 1-count {
+					return nil, errors.New("truncated run")
+				}
+				packed = append(packed, data[1:1-count]...)
+				data = data[1-count:]
+			} else {
+				if len(data) < 2 {
+					return nil, errors.New("truncated run")
+				}
+				for k := 0; k <= count; k++ {
+					packed = append(packed, data[1])
+				}
+				data = data[2:]
+			}
+		}
+	default:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if packed, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	if len(packed) != size {
+		return nil, errors.New("wrong decompressed size")
+	}
+
+	// undo the predictor, then interleave the two halves
+	for idx := 1; idx < len(packed); idx++ {
+		packed[idx] = packed[idx-1] + packed[idx] - 128
+	}
+	out := make([]byte, size)
+	half := (size + 1) / 2
+	for idx := range out {
+		if idx%2 == 0 {
+			out[idx] = packed[idx/2]
+		} else {
+			out[idx] = packed[half+idx/2]
+		}
+	}
+	return out, nil
+}
+
+// compressEXR is the reverse of decompressEXR
+func compressEXR(compression EXRCompression, raw []byte) []byte {
+	if compression == EXRCompressionNone {
+		return raw
+	}
+	packed := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for idx, b := range raw {
+		if idx%2 == 0 {
+			packed[idx/2] = b
+		} else {
+			packed[half+idx/2] = b
+		}
+	}
+	for idx := len(packed) - 1; idx > 0; idx-- {
+		packed[idx] = packed[idx] - packed[idx-1] + 128
+	}
+
+	var out []byte
+	switch compression {
+	case EXRCompressionRLE:
+		for start := 0; start < len(packed); {
+			run := 1
+			for start+run < len(packed) && run < 128 && packed[start+run] == packed[start] {
+				run++
+			}
+			if run >= 3 {
+				out = append(out, byte(run-1), packed[start])
+				start += run
+				continue
+			}
+			// literal bytes until the next run of three
+			end := start
+			for end < len(packed) && end-start < 127 {
+				if end+2 < len(packed) && packed[end] == packed[end+1] && packed[end] == packed[end+2] {
+					break
+				}
+				end++
+			}
+			out = append(out, byte(int8(start-end)))
+			out = append(out, packed[start:end]...)
+			start = end
+		}
+	default:
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(packed)
+		zw.Close()
+		out = buf.Bytes()
+	}
+	if len(out) >= len(raw) {
+		return raw
+	}
+	return out
+}
+
+// EncodeEXR writes img as a scanline OpenEXR image of 32-bit float
+// R, G, B and A channels, with the given compression
+func EncodeEXR(w io.Writer, img *FloatImage, compression EXRCompression) error {
+	if compression > EXRCompressionZIP {
+		return fmt.Errorf("unsupported OpenEXR compression %d", compression)
+	}
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if width == 0 || height == 0 {
+		return errors.New("OpenEXR image is empty")
+	}
+
+	var header bytes.Buffer
+	le := func(data interface{}) {
+		binary.Write(&header, binary.LittleEndian, data)
+	}
+	attribute := func(name, kind string, value []byte) {
+		header.WriteString(name + "\x00" + kind + "\x00")
+		le(int32(len(value)))
+		header.Write(value)
+	}
+	le(uint32(exrMagic))
+	le(uint32(2))
+
+	// channels are stored in alphabetical order
+	names := []string{"A", "B", "G", "R"}
+	var channels bytes.Buffer
+	for _, name := range names {
+		channels.WriteString(name + "\x00")
+		binary.Write(&channels, binary.LittleEndian, []int32{exrFloat, 0, 1, 1})
+	}
+	channels.WriteByte(0)
+	attribute("channels", "chlist", channels.Bytes())
+	attribute("compression", "compression", []byte{byte(compression)})
+
+	box := new(bytes.Buffer)
+	binary.Write(box, binary.LittleEndian, []int32{0, 0, int32(width - 1), int32(height - 1)})
+	attribute("dataWindow", "box2i", box.Bytes())
+	attribute("displayWindow", "box2i", box.Bytes())
+	attribute("lineOrder", "lineOrder", []byte{0})
+
+	ratio := new(bytes.Buffer)
+	binary.Write(ratio, binary.LittleEndian, float32(1))
+	attribute("pixelAspectRatio", "float", ratio.Bytes())
+	attribute("screenWindowCenter", "v2f", make([]byte, 8))
+	attribute("screenWindowWidth", "float", ratio.Bytes())
+	header.WriteByte(0)
+
+	// pack every chunk first, the offsets come before them
+	lines := compression.linesPerBlock()
+	var chunks [][]byte
+	channelOf := map[string]int{"R": 0, "G": 1, "B": 2, "A": 3}
+	for first := 0; first < height; first += lines {
+		var raw []byte
+		for y := first; y < first+lines && y < height; y++ {
+			row := img.Pix[y*img.Stride:]
+			for _, name := range names {
+				for x := 0; x < width; x++ {
+					raw = append(raw, make([]byte, 4)...)
+					binary.LittleEndian.PutUint32(raw[len(raw)-4:], math.Float32bits(row[x*4+channelOf[name]]))
+				}
+			}
+		}
+		data := compressEXR(compression, raw)
+		chunk := make([]byte, 8, 8+len(data))
+		binary.LittleEndian.PutUint32(chunk[0:], uint32(first))
+		binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+		chunks = append(chunks, append(chunk, data...))
+	}
+
+	offset := uint64(header.Len() + len(chunks)*8)
+	for _, chunk := range chunks {
+		le(offset)
+		offset += uint64(len(chunk))
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
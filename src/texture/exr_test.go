@@ -0,0 +1,96 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/devblok/koru/src/texture"
+)
+
+func TestEXRRoundTrip(t *testing.T) {
+	img := hdrGradient(19, 37)
+	img.SetFloat(3, 3, [4]float32{1e5, -2, 0, 0.5})
+	for _, compression := range []texture.EXRCompression{
+		texture.EXRCompressionNone,
+		texture.EXRCompressionRLE,
+		texture.EXRCompressionZIPS,
+		texture.EXRCompressionZIP,
+	} {
+		var buf bytes.Buffer
+		if err := texture.EncodeEXR(&buf, img, compression); err != nil {
+			t.Fatal(err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil || format != "exr" || cfg.Width != 19 || cfg.Height != 37 {
+			t.Fatalf("bad config %+v %q: %v", cfg, format, err)
+		}
+		decoded, _, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatalf("compression %d: %v", compression, err)
+		}
+		sameFloats(t, img, decoded.(*texture.FloatImage), 0)
+	}
+}
+
+func TestEXRHalfLuminance(t *testing.T) {
+	// uncompressed 2x1 file with a half float Y channel
+	var file bytes.Buffer
+	le := func(data interface{}) { binary.Write(&file, binary.LittleEndian, data) }
+	attribute := func(name, kind string, value []byte) {
+		file.WriteString(name + "\x00" + kind + "\x00")
+		le(int32(len(value)))
+		file.Write(value)
+	}
+	le(uint32(20000630))
+	le(uint32(2))
+	var channels bytes.Buffer
+	channels.WriteString("Y\x00")
+	binary.Write(&channels, binary.LittleEndian, []int32{1, 0, 1, 1})
+	channels.WriteByte(0)
+	attribute("channels", "chlist", channels.Bytes())
+	attribute("compression", "compression", []byte{0})
+	var box bytes.Buffer
+	binary.Write(&box, binary.LittleEndian, []int32{10, 20, 11, 20})
+	attribute("dataWindow", "box2i", box.Bytes())
+	file.WriteByte(0)
+	le(uint64(file.Len() + 8))
+	le(int32(20))
+	le(int32(4))
+	le([]uint16{texture.FloatToHalf(0.5), texture.FloatToHalf(3)})
+
+	img, err := texture.DecodeEXR(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := img.(*texture.FloatImage)
+	if f.Rect.Dx() != 2 || f.Rect.Dy() != 1 {
+		t.Fatalf("bad size %v", f.Rect)
+	}
+	if v := f.FloatAt(0, 0); v != [4]float32{0.5, 0.5, 0.5, 1} {
+		t.Fatalf("bad gray texel: %v", v)
+	}
+	if v := f.FloatAt(1, 0); v != [4]float32{3, 3, 3, 1} {
+		t.Fatalf("bad gray texel: %v", v)
+	}
+}
+
+func TestEXRErrors(t *testing.T) {
+	var buf bytes.Buffer
+	texture.EncodeEXR(&buf, hdrGradient(4, 4), texture.EXRCompressionZIP)
+	data := buf.Bytes()
+	if _, err := texture.DecodeEXR(bytes.NewReader(data[:len(data)-5])); err == nil {
+		t.Fatal("expected an error on truncated data")
+	}
+	tiled := append([]byte(nil), data...)
+	tiled[5] |= 0x2
+	if _, err := texture.DecodeEXR(bytes.NewReader(tiled)); err == nil {
+		t.Fatal("expected an error on tiled files")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// FloatImage is an in-memory image of float32 RGBA values in linear light,
+// alpha premultiplied like image.RGBA. Values may go past 1, as
+// high dynamic range images decode into it
+type FloatImage struct {
+	// Pix holds 4 values per pixel, R, G, B and A
+	Pix []float32
+	// Stride is the number of values between vertically adjacent pixels
+	Stride int
+	Rect   image.Rectangle
+}
+
+// NewFloatImage returns a transparent black image of the given bounds
+func NewFloatImage(r image.Rectangle) *FloatImage {
+	return &FloatImage{
+		Pix:    make([]float32, r.Dx()*r.Dy()*4),
+		Stride: r.Dx() * 4,
+		Rect:   r,
+	}
+}
+
+// ColorModel implements image.Image
+func (p *FloatImage) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+// Bounds implements image.Image
+func (p *FloatImage) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// At implements image.Image, values are clamped to [0, 1]
+// without changing the transfer function
+func (p *FloatImage) At(x, y int) color.Color {
+	v := p.FloatAt(x, y)
+	channel := func(c float32) uint16 {
+		return uint16(math.Max(0, math.Min(1, float64(c)))*0xffff + 0.5)
+	}
+	c := color.RGBA64{R: channel(v[0]), G: channel(v[1]), B: channel(v[2]), A: channel(v[3])}
+	// keep the color premultiplied after clamping
+	if c.R > c.A {
+		c.R = c.A
+	}
+	if c.G > c.A {
+		c.G = c.A
+	}
+	if c.B > c.A {
+		c.B = c.A
+	}
+	return c
+}
+
+// PixOffset returns the index of the first value of the pixel at x, y
+func (p *FloatImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// FloatAt returns the values of the pixel at x, y
+func (p *FloatImage) FloatAt(x, y int) (v [4]float32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	copy(v[:], p.Pix[p.PixOffset(x, y):])
+	return
+}
+
+// SetFloat sets the values of the pixel at x, y
+func (p *FloatImage) SetFloat(x, y int, v [4]float32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	copy(p.Pix[p.PixOffset(x, y):], v[:])
+}
+
+// Set implements draw.Image
+func (p *FloatImage) Set(x, y int, c color.Color) {
+	r, g, b, a := c.RGBA()
+	p.SetFloat(x, y, [4]float32{
+		float32(r) / 0xffff,
+		float32(g) / 0xffff,
+		float32(b) / 0xffff,
+		float32(a) / 0xffff,
+	})
+}
+
+// HalfToFloat converts an IEEE 754 half precision value
+func HalfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exponent := int(h>>10) & 0x1f
+	mantissa := uint32(h) & 0x3ff
+	switch exponent {
+	case 0:
+		if mantissa == 0 {
+			return math.Float32frombits(sign)
+		}
+		// subnormal, normalize it
+		exponent = 1
+		for mantissa&0x400 == 0 {
+			mantissa <<= 1
+			exponent--
+		}
+		mantissa &= 0x3ff
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	}
+	return math.Float32frombits(sign | uint32(exponent+127-15)<<23 | mantissa<<13)
+}
+
+// FloatToHalf converts to IEEE 754 half precision, rounding to nearest even.
+// Values too large become infinity
+func FloatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+	case exponent <= 0:
+		if exponent < -10 {
+			return sign
+		}
+		// subnormal, shift in the implicit bit
+		mantissa |= 0x800000
+		shift := uint(14 - exponent)
+		half := uint16(mantissa >> shift)
+		rest := mantissa & (1<<shift - 1)
+		if rest > 1<<(shift-1) || (rest == 1<<(shift-1) && half&1 != 0) {
+			half++
+		}
+		return sign | half
+	}
+	half := uint16(exponent)<<10 | uint16(mantissa>>13)
+	rest := mantissa & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 != 0) {
+		// may carry into the exponent, up to infinity
+		half++
+	}
+	return sign | half
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/devblok/koru/src/texture"
+)
+
+func TestHalfFloat(t *testing.T) {
+	for _, c := range []struct {
+		value float32
+		half  uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{float32(math.Inf(1)), 0x7c00},
+		{6.103515625e-05, 0x0400},       // smallest normal
+		{5.960464477539063e-08, 0x0001}, // smallest subnormal
+	} {
+		if got := texture.FloatToHalf(c.value); got != c.half {
+			t.Fatalf("%v should be %#04x, got: %#04x", c.value, c.half, got)
+		}
+		if got := texture.HalfToFloat(c.half); got != c.value {
+			t.Fatalf("%#04x should be %v, got: %v", c.half, c.value, got)
+		}
+	}
+	if got := texture.FloatToHalf(1e6); got != 0x7c00 {
+		t.Fatalf("large values should be infinite, got: %#04x", got)
+	}
+	if got := texture.FloatToHalf(1 + 1.0/4096); got != 0x3c00 {
+		t.Fatalf("ties should round to even, got: %#04x", got)
+	}
+	if got := texture.HalfToFloat(texture.FloatToHalf(float32(math.NaN()))); !math.IsNaN(float64(got)) {
+		t.Fatalf("NaN was lost, got: %v", got)
+	}
+}
+
+func TestFloatImage(t *testing.T) {
+	img := texture.NewFloatImage(image.Rect(1, 1, 3, 3))
+	img.SetFloat(2, 1, [4]float32{2, 0.5, 0, 0.75})
+	if v := img.FloatAt(2, 1); v != [4]float32{2, 0.5, 0, 0.75} {
+		t.Fatalf("value not stored, got: %v", v)
+	}
+	if v := img.FloatAt(0, 0); v != [4]float32{} {
+		t.Fatalf("outside of bounds should be zero, got: %v", v)
+	}
+
+	// clamped and still premultiplied
+	c := img.At(2, 1).(color.RGBA64)
+	if c.R != c.A || c.A != 0xbfff || c.B != 0 {
+		t.Fatalf("bad clamped color: %v", c)
+	}
+
+	img.Set(1, 2, color.RGBA{255, 0, 0, 255})
+	if v := img.FloatAt(1, 2); v != [4]float32{1, 0, 0, 1} {
+		t.Fatalf("bad color conversion: %v", v)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+func init() {
+	image.RegisterFormat("hdr", "#?RADIANCE", DecodeHDR, DecodeHDRConfig)
+	image.RegisterFormat("hdr", "#?RGBE", DecodeHDR, DecodeHDRConfig)
+}
+
+// hdrHeader reads the Radiance header up to and including the
+// resolution line, returning the size and whether rows go bottom up
+func hdrHeader(r *bufio.Reader) (width, height int, bottomUp bool, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !strings.HasPrefix(line, "#?") {
+		return 0, 0, false, errors.New("not a Radiance HDR file")
+	}
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return 0, 0, false, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return 0, 0, false, fmt.Errorf("unsupported HDR %s", line)
+		}
+	}
+
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return 0, 0, false, err
+	}
+	var yAxis, xAxis string
+	if _, err := fmt.Sscanf(line, "%s %d %s %d", &yAxis, &height, &xAxis, &width); err != nil {
+		return 0, 0, false, fmt.Errorf("bad HDR resolution %q", strings.TrimSpace(line))
+	}
+	if xAxis != "+X" || (yAxis != "-Y" && yAxis != "+Y") {
+		return 0, 0, false, fmt.Errorf("unsupported HDR orientation %q", strings.TrimSpace(line))
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, false, errors.New("HDR image is empty")
+	}
+	return width, height, yAxis == "+Y", nil
+}
+
+// DecodeHDRConfig returns the size of a Radiance HDR image
+func DecodeHDRConfig(r io.Reader) (image.Config, error) {
+	width, height, _, err := hdrHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: width, Height: height}, nil
+}
+
+// DecodeHDR reads a Radiance HDR (.hdr) image of RGBE pixels,
+// flat or run length encoded, into a *FloatImage
+func DecodeHDR(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	width, height, bottomUp, err := hdrHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := NewFloatImage(image.Rect(0, 0, width, height))
+	scanline := make([]byte, width*4)
+	for row := 0; row < height; row++ {
+		if err := readHDRScanline(br, scanline); err != nil {
+			return nil, fmt.Errorf("HDR scanline %d: %s", row, err.Error())
+		}
+		y := row
+		if bottomUp {
+			y = height - 1 - row
+		}
+		for x := 0; x < width; x++ {
+			rgbe := scanline[x*4 : x*4+4]
+			var v [4]float32
+			if rgbe[3] != 0 {
+				scale := float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+				v[0], v[1], v[2] = float32(rgbe[0])*scale, float32(rgbe[1])*scale, float32(rgbe[2])*scale
+			}
+			v[3] = 1
+			img.SetFloat(x, y, v)
+		}
+	}
+	return img, nil
+}
+
+// readHDRScanline fills scanline with RGBE pixels, decoding
+// the run length encoding of one channel after another if used
+func readHDRScanline(r *bufio.Reader, scanline []byte) error {
+	width := len(scanline) / 4
+	start, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		// flat pixels
+		_, err := io.ReadFull(r, scanline)
+		return err
+	}
+	if int(start[2])<<8|int(start[3]) != width {
+		return errors.New("scanline width mismatch")
+	}
+	r.Discard(4)
+
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				run := int(count) - 128
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+run > width {
+					return errors.New("run past the end of the scanline")
+				}
+				for ; run > 0; run-- {
+					scanline[x*4+channel] = value
+					x++
+				}
+				continue
+			}
+			if count == 0 || x+int(count) > width {
+				return errors.New("bad literal run")
+			}
+			for end := x + int(count); x < end; x++ {
+				if scanline[x*4+channel], err = r.ReadByte(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// EncodeHDR writes img as a flat Radiance HDR image, premultiplied
+// colors are stored as they are and alpha is dropped
+func EncodeHDR(w io.Writer, img *FloatImage) error {
+	bw := bufio.NewWriter(w)
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+
+	rgbe := make([]byte, 4)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			v := img.FloatAt(x, y)
+			largest := math.Max(float64(v[0]), math.Max(float64(v[1]), float64(v[2])))
+			if largest < 1e-32 {
+				rgbe[0], rgbe[1], rgbe[2], rgbe[3] = 0, 0, 0, 0
+			} else {
+				mantissa, exponent := math.Frexp(largest)
+				scale := mantissa * 256 / largest
+				for c := 0; c < 3; c++ {
+					rgbe[c] = uint8(math.Max(0, float64(v[c])*scale))
+				}
+				rgbe[3] = uint8(exponent + 128)
+			}
+			bw.Write(rgbe)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture_test
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/devblok/koru/src/texture"
+)
+
+// hdrGradient returns a float image reaching past 1
+func hdrGradient(width, height int) *texture.FloatImage {
+	img := texture.NewFloatImage(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetFloat(x, y, [4]float32{float32(x) * 0.75, float32(y) / 8, 0.01 * float32(x+y), 1})
+		}
+	}
+	return img
+}
+
+func sameFloats(t *testing.T, a, b *texture.FloatImage, tolerance float64) {
+	if a.Rect.Size() != b.Rect.Size() {
+		t.Fatalf("size changed from %v to %v", a.Rect, b.Rect)
+	}
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			va, vb := a.FloatAt(a.Rect.Min.X+x, a.Rect.Min.Y+y), b.FloatAt(b.Rect.Min.X+x, b.Rect.Min.Y+y)
+			// error is relative to the largest channel of the texel
+			largest := 1.0
+			for _, v := range va {
+				largest = math.Max(largest, math.Abs(float64(v)))
+			}
+			for c := range va {
+				if diff := math.Abs(float64(va[c] - vb[c])); diff > tolerance*largest {
+					t.Fatalf("texel %d,%d differs: %v and %v", x, y, va, vb)
+				}
+			}
+		}
+	}
+}
+
+func TestHDRRoundTrip(t *testing.T) {
+	img := hdrGradient(12, 5)
+	var buf bytes.Buffer
+	if err := texture.EncodeHDR(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, format, err := image.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "hdr" {
+		t.Fatalf("wrong format %q", format)
+	}
+	// RGBE keeps 8 bits of mantissa for the largest channel
+	sameFloats(t, img, decoded.(*texture.FloatImage), 1.0/64)
+}
+
+func TestHDRRunLength(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("#?RADIANCE\n# made by hand\nFORMAT=32-bit_rle_rgbe\n\n+Y 2 +X 8\n")
+	for row := 0; row < 2; row++ {
+		file.Write([]byte{2, 2, 0, 8})
+		// red runs, green literal, blue zero, exponent 1.0
+		file.Write([]byte{128 + 4, 64, 128 + 4, 128})
+		file.Write([]byte{8, 0, 16, 32, 48, 64, 80, 96, byte(112 + row)})
+		file.Write([]byte{128 + 8, 0})
+		file.Write([]byte{128 + 8, 128})
+	}
+
+	img, err := texture.DecodeHDR(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := img.(*texture.FloatImage)
+	if v := f.FloatAt(0, 0); v != [4]float32{0.25, 0, 0, 1} {
+		t.Fatalf("bad first texel: %v", v)
+	}
+	if v := f.FloatAt(7, 1); v != [4]float32{0.5, 112.0 / 256, 0, 1} {
+		t.Fatalf("rows should go bottom up, got: %v", v)
+	}
+	if v := f.FloatAt(7, 0); v[1] != 113.0/256 {
+		t.Fatalf("bad last texel: %v", v)
+	}
+
+	if _, err := texture.DecodeHDR(bytes.NewReader(file.Bytes()[:10])); err == nil {
+		t.Fatal("expected an error on a truncated file")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Filter is the reconstruction filter used to make mip levels
+type Filter int
+
+const (
+	// FilterBox averages the texels a smaller texel covers,
+	// fast but blurry and prone to aliasing
+	FilterBox Filter = iota
+
+	// FilterKaiser is a Kaiser windowed sinc, keeps mips sharp
+	FilterKaiser
+)
+
+// Kaiser filter shape, same as the defaults of NVIDIA's texture tools
+const (
+	kaiserWidth   = 3
+	kaiserAlpha   = 4
+	kaiserStretch = 1
+)
+
+// srgbToLinear maps every 8-bit sRGB value to linear light
+var srgbToLinear = func() (table [256]float32) {
+	for c := range table {
+		table[c] = float32(decodeSRGB(float64(c) / 255))
+	}
+	return
+}()
+
+func decodeSRGB(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func encodeSRGB(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+// floatImage holds linear, premultiplied RGBA
+type floatImage struct {
+	width, height int
+	pix           []float32
+}
+
+func newFloatImage(img *image.NRGBA, srgb bool) *floatImage {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	f := &floatImage{width, height, make([]float32, width*height*4)}
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := 0; x < width; x++ {
+			src, dst := row[x*4:x*4+4], f.pix[(y*width+x)*4:(y*width+x)*4+4]
+			alpha := float32(src[3]) / 255
+			for c := 0; c < 3; c++ {
+				if srgb {
+					dst[c] = srgbToLinear[src[c]] * alpha
+				} else {
+					dst[c] = float32(src[c]) / 255 * alpha
+				}
+			}
+			dst[3] = alpha
+		}
+	}
+	return f
+}
+
+func (f *floatImage) nrgba(srgb bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, f.width, f.height))
+	quantize := func(c float64) uint8 {
+		return uint8(math.Max(0, math.Min(1, c))*255 + 0.5)
+	}
+	for idx := 0; idx < f.width*f.height; idx++ {
+		src, dst := f.pix[idx*4:idx*4+4], img.Pix[idx*4:idx*4+4]
+		alpha := math.Max(0, math.Min(1, float64(src[3])))
+		for c := 0; c < 3; c++ {
+			var value float64
+			if alpha > 0 {
+				value = math.Max(0, math.Min(1, float64(src[c])/alpha))
+			}
+			if srgb {
+				value = encodeSRGB(value)
+			}
+			dst[c] = quantize(value)
+		}
+		dst[3] = quantize(alpha)
+	}
+	return img
+}
+
+// tap is a single source texel contributing to a destination texel
+type tap struct {
+	index  int
+	weight float32
+}
+
+// bessel0 is the zeroth order modified Bessel function of the first kind
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 32; k++ {
+		term *= x / 2 / float64(k)
+		sum += term * term
+		if term*term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+func kaiser(x float64) float64 {
+	t := x / kaiserWidth
+	if t*t >= 1 {
+		return 0
+	}
+	sinc := 1.0
+	if x != 0 {
+		s := math.Pi * x * kaiserStretch
+		sinc = math.Sin(s) / s
+	}
+	return sinc * bessel0(kaiserAlpha*math.Sqrt(1-t*t)) / bessel0(kaiserAlpha)
+}
+
+// filterTaps returns the weights of the source texels for every
+// destination texel along one axis
+func filterTaps(srcSize, dstSize int, filter Filter, wrap bool) [][]tap {
+	scale := float64(srcSize) / float64(dstSize)
+	address := func(i int) int {
+		if wrap {
+			return ((i % srcSize) + srcSize) % srcSize
+		}
+		if i < 0 {
+			return 0
+		}
+		if i >= srcSize {
+			return srcSize - 1
+		}
+		return i
+	}
+
+	taps := make([][]tap, dstSize)
+	for x := range taps {
+		center := (float64(x) + 0.5) * scale
+		var radius float64
+		switch filter {
+		case FilterKaiser:
+			radius = kaiserWidth * scale
+		default:
+			radius = scale / 2
+		}
+
+		var sum float64
+		var weights []float64
+		first := int(math.Floor(center - radius))
+		for i := first; float64(i) < center+radius; i++ {
+			var w float64
+			switch filter {
+			case FilterKaiser:
+				w = kaiser((float64(i) + 0.5 - center) / scale)
+			default:
+				// coverage of the texel by the destination one
+				w = math.Min(float64(i+1), center+radius) - math.Max(float64(i), center-radius)
+			}
+			weights = append(weights, w)
+			sum += w
+		}
+		for k, w := range weights {
+			if w == 0 {
+				continue
+			}
+			taps[x] = append(taps[x], tap{address(first + k), float32(w / sum)})
+		}
+	}
+	return taps
+}
+
+// downsample resizes the image with a separable filter
+func (f *floatImage) downsample(width, height int, filter Filter, wrap bool) *floatImage {
+	horizontal := &floatImage{width, f.height, make([]float32, width*f.height*4)}
+	taps := filterTaps(f.width, width, filter, wrap)
+	for y := 0; y < f.height; y++ {
+		for x := 0; x < width; x++ {
+			dst := horizontal.pix[(y*width+x)*4 : (y*width+x)*4+4]
+			for _, t := range taps[x] {
+				src := f.pix[(y*f.width+t.index)*4 : (y*f.width+t.index)*4+4]
+				for c := range dst {
+					dst[c] += src[c] * t.weight
+				}
+			}
+		}
+	}
+
+	out := &floatImage{width, height, make([]float32, width*height*4)}
+	taps = filterTaps(f.height, height, filter, wrap)
+	for y := 0; y < height; y++ {
+		for _, t := range taps[y] {
+			src := horizontal.pix[t.index*width*4 : (t.index+1)*width*4]
+			dst := out.pix[y*width*4 : (y+1)*width*4]
+			for c := range dst {
+				dst[c] += src[c] * t.weight
+			}
+		}
+	}
+	return out
+}
+
+// GenerateMips returns img followed by its smaller levels, as configured.
+// Filtering happens on premultiplied alpha, in linear light if the
+// configuration is sRGB. The first level is img unchanged
+func GenerateMips(img image.Image, cfg Configuration) []*image.NRGBA {
+	bounds := img.Bounds()
+	first := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(first, first.Rect, img, bounds.Min, draw.Src)
+
+	count := LevelCount(first.Rect.Dx(), first.Rect.Dy())
+	if cfg.Levels > 0 && cfg.Levels < count {
+		count = cfg.Levels
+	}
+
+	mips := []*image.NRGBA{first}
+	if count == 1 {
+		return mips
+	}
+	current := newFloatImage(first, cfg.SRGB)
+	for level := 1; level < count; level++ {
+		current = current.downsample(mipSize(first.Rect.Dx(), level), mipSize(first.Rect.Dy(), level), cfg.Filter, cfg.Wrap)
+		mips = append(mips, current.nrgba(cfg.SRGB))
+	}
+	return mips
+}
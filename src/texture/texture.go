@@ -0,0 +1,217 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package texture prepares images for the GPU: it builds mip chains,
+// compresses them into block formats and stores them in DDS containers.
+package texture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Format is the layout of texel data in a Texture level
+type Format int
+
+const (
+	// FormatRGBA8 is 4 bytes per texel, red first, straight alpha
+	FormatRGBA8 Format = iota
+
+	// FormatBC1 is 8 bytes per 4x4 block, RGB with 1-bit alpha
+	FormatBC1
+
+	// FormatBC3 is 16 bytes per 4x4 block, BC1 color with BC4 alpha
+	FormatBC3
+
+	// FormatBC5 is 16 bytes per 4x4 block, two BC4 channels,
+	// red and green, meant for normal maps
+	FormatBC5
+
+	// FormatBC7 is 16 bytes per 4x4 block, high quality RGBA
+	FormatBC7
+)
+
+// String implements fmt.Stringer
+func (f Format) String() string {
+	switch f {
+	case FormatRGBA8:
+		return "RGBA8"
+	case FormatBC1:
+		return "BC1"
+	case FormatBC3:
+		return "BC3"
+	case FormatBC5:
+		return "BC5"
+	case FormatBC7:
+		return "BC7"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Compressed reports whether the format is stored in 4x4 blocks
+func (f Format) Compressed() bool {
+	return f != FormatRGBA8
+}
+
+// BlockSize returns the bytes of a single 4x4 block, or of a single texel
+// for uncompressed formats
+func (f Format) BlockSize() int {
+	switch f {
+	case FormatBC1:
+		return 8
+	case FormatBC3, FormatBC5, FormatBC7:
+		return 16
+	default:
+		return 4
+	}
+}
+
+// LevelSize returns the bytes needed by an image of the given size
+func (f Format) LevelSize(width, height int) int {
+	if !f.Compressed() {
+		return width * height * f.BlockSize()
+	}
+	return ((width + 3) / 4) * ((height + 3) / 4) * f.BlockSize()
+}
+
+// ErrNoSRGB is returned for formats that can't hold sRGB encoded colors
+var ErrNoSRGB = errors.New("format has no sRGB variant")
+
+// Texture is a chain of images ready to be uploaded,
+// every level is half the size of the one before
+type Texture struct {
+	Format Format
+
+	// SRGB is set when color channels are sRGB encoded,
+	// alpha is always linear
+	SRGB bool
+
+	// Width and Height are the size of the first level
+	Width  int
+	Height int
+
+	// Levels holds the texel data of every level, the first one
+	// is the largest. Compressed levels are rows of blocks
+	Levels [][]byte
+}
+
+// LevelSize returns the size of the level in texels
+func (t *Texture) LevelSize(level int) (width, height int) {
+	return mipSize(t.Width, level), mipSize(t.Height, level)
+}
+
+// Size returns the total bytes of all levels
+func (t *Texture) Size() int {
+	var size int
+	for _, level := range t.Levels {
+		size += len(level)
+	}
+	return size
+}
+
+// Image decodes a level into an image
+func (t *Texture) Image(level int) (*image.NRGBA, error) {
+	if level < 0 || level >= len(t.Levels) {
+		return nil, fmt.Errorf("texture has no level %d", level)
+	}
+	width, height := t.LevelSize(level)
+	return Decode(t.Format, width, height, t.Levels[level])
+}
+
+// Decompress returns a copy of the texture with every level in FormatRGBA8
+func (t *Texture) Decompress() (*Texture, error) {
+	out := &Texture{
+		Format: FormatRGBA8,
+		SRGB:   t.SRGB,
+		Width:  t.Width,
+		Height: t.Height,
+		Levels: make([][]byte, len(t.Levels)),
+	}
+	for level := range t.Levels {
+		img, err := t.Image(level)
+		if err != nil {
+			return nil, err
+		}
+		out.Levels[level] = img.Pix
+	}
+	return out, nil
+}
+
+// Configuration controls how images are turned into textures
+type Configuration struct {
+	Format Format
+
+	// SRGB marks color channels as sRGB encoded,
+	// mips are then filtered in linear light
+	SRGB bool
+
+	// Filter used to make the smaller levels
+	Filter Filter
+
+	// Wrap makes filters sample across the edges,
+	// for textures that tile
+	Wrap bool
+
+	// Levels limits the length of the chain, 0 makes all levels
+	// down to a single texel, 1 makes no mips
+	Levels int
+}
+
+// DefaultConfiguration makes uncompressed color textures
+// with full mip chains
+var DefaultConfiguration = Configuration{
+	Format: FormatRGBA8,
+	SRGB:   true,
+	Filter: FilterKaiser,
+	Wrap:   true,
+}
+
+// FromImage builds a texture with a mip chain out of img
+func FromImage(img image.Image, cfg Configuration) (*Texture, error) {
+	if cfg.SRGB && cfg.Format == FormatBC5 {
+		return nil, ErrNoSRGB
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("texture image is empty")
+	}
+
+	mips := GenerateMips(img, cfg)
+	tex := &Texture{
+		Format: cfg.Format,
+		SRGB:   cfg.SRGB,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Levels: make([][]byte, len(mips)),
+	}
+	for level, mip := range mips {
+		data, err := Encode(cfg.Format, mip)
+		if err != nil {
+			return nil, err
+		}
+		tex.Levels[level] = data
+	}
+	return tex, nil
+}
+
+// LevelCount returns the number of levels in a full chain
+func LevelCount(width, height int) int {
+	count := 1
+	for width > 1 || height > 1 {
+		width, height = width/2, height/2
+		count++
+	}
+	return count
+}
+
+func mipSize(size, level int) int {
+	size >>= uint(level)
+	if size < 1 {
+		return 1
+	}
+	return size
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package texture_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/devblok/koru/src/texture"
+)
+
+// gradient is a smooth image with a different ramp in every channel
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x * 255 / (width - 1)),
+				G: uint8(y * 255 / (height - 1)),
+				B: uint8((x + y) * 255 / (width + height - 2)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// psnr compares the first channels of two images, in decibels
+func psnr(a, b *image.NRGBA, channels int) float64 {
+	var sum float64
+	var count int
+	for idx := range a.Pix {
+		if idx%4 >= channels {
+			continue
+		}
+		d := float64(a.Pix[idx]) - float64(b.Pix[idx])
+		sum += d * d
+		count++
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/(sum/float64(count)))
+}
+
+func TestLevelCount(t *testing.T) {
+	for _, c := range []struct{ width, height, levels int }{
+		{1, 1, 1}, {2, 2, 2}, {256, 256, 9}, {5, 3, 3}, {1, 64, 7},
+	} {
+		if got := texture.LevelCount(c.width, c.height); got != c.levels {
+			t.Fatalf("%dx%d should have %d levels, got: %d", c.width, c.height, c.levels, got)
+		}
+	}
+}
+
+func TestGenerateMips(t *testing.T) {
+	img := gradient(16, 8)
+	mips := texture.GenerateMips(img, texture.Configuration{Filter: texture.FilterKaiser})
+	if len(mips) != 5 {
+		t.Fatalf("expected 5 levels, got: %d", len(mips))
+	}
+	for level, mip := range mips {
+		width, height := 16>>uint(level), 8>>uint(level)
+		if height == 0 {
+			height = 1
+		}
+		if mip.Rect.Dx() != width || mip.Rect.Dy() != height {
+			t.Fatalf("level %d has size %v", level, mip.Rect)
+		}
+	}
+	if !bytes.Equal(mips[0].Pix, img.Pix) {
+		t.Fatal("first level is not the image")
+	}
+
+	limited := texture.GenerateMips(img, texture.Configuration{Levels: 2})
+	if len(limited) != 2 {
+		t.Fatalf("level limit ignored, got %d levels", len(limited))
+	}
+}
+
+func TestGenerateMipsSRGB(t *testing.T) {
+	checker := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	checker.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+	checker.SetNRGBA(1, 1, color.NRGBA{255, 255, 255, 255})
+	checker.SetNRGBA(1, 0, color.NRGBA{0, 0, 0, 255})
+	checker.SetNRGBA(0, 1, color.NRGBA{0, 0, 0, 255})
+
+	// half the light is 188 once encoded back to sRGB
+	mips := texture.GenerateMips(checker, texture.Configuration{SRGB: true, Filter: texture.FilterBox})
+	if c := mips[1].NRGBAAt(0, 0); c.R != 188 || c.A != 255 {
+		t.Fatalf("sRGB average is wrong, got: %v", c)
+	}
+	mips = texture.GenerateMips(checker, texture.Configuration{Filter: texture.FilterBox})
+	if c := mips[1].NRGBAAt(0, 0); c.R != 128 {
+		t.Fatalf("linear average is wrong, got: %v", c)
+	}
+}
+
+func TestGenerateMipsAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 0})
+
+	// transparent texels don't bleed their color
+	for _, filter := range []texture.Filter{texture.FilterBox, texture.FilterKaiser} {
+		mips := texture.GenerateMips(img, texture.Configuration{Filter: filter})
+		if c := mips[1].NRGBAAt(0, 0); c.R != 255 || c.G != 0 || c.A < 120 || c.A > 135 {
+			t.Fatalf("filter %d blended alpha wrong, got: %v", filter, c)
+		}
+	}
+}
+
+func TestGenerateMipsConstant(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 13, 7))
+	for idx := 0; idx < len(img.Pix); idx += 4 {
+		copy(img.Pix[idx:], []uint8{200, 100, 50, 255})
+	}
+	for _, wrap := range []bool{false, true} {
+		cfg := texture.Configuration{SRGB: true, Filter: texture.FilterKaiser, Wrap: wrap}
+		for level, mip := range texture.GenerateMips(img, cfg) {
+			for idx := 0; idx < len(mip.Pix); idx += 4 {
+				if !bytes.Equal(mip.Pix[idx:idx+4], []uint8{200, 100, 50, 255}) {
+					t.Fatalf("level %d changed a constant color to %v", level, mip.Pix[idx:idx+4])
+				}
+			}
+		}
+	}
+}
+
+func TestBlockCompression(t *testing.T) {
+	img := gradient(66, 40)
+	for _, c := range []struct {
+		format   texture.Format
+		channels int
+		minPSNR  float64
+	}{
+		{texture.FormatBC1, 3, 34},
+		{texture.FormatBC3, 4, 36},
+		{texture.FormatBC5, 2, 50},
+		{texture.FormatBC7, 4, 38},
+	} {
+		data, err := texture.Encode(c.format, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != c.format.LevelSize(66, 40) {
+			t.Fatalf("%s: wrong size %d", c.format, len(data))
+		}
+		decoded, err := texture.Decode(c.format, 66, 40, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quality := psnr(img, decoded, c.channels); quality < c.minPSNR {
+			t.Fatalf("%s: quality too low, %.1fdB", c.format, quality)
+		}
+	}
+}
+
+func TestBlockCompressionAlpha(t *testing.T) {
+	img := gradient(8, 8)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Pix[y*img.Stride+x*4+3] = uint8(x * 255 / 7)
+		}
+	}
+
+	// BC1 keeps cut out texels
+	data, _ := texture.Encode(texture.FormatBC1, img)
+	decoded, _ := texture.Decode(texture.FormatBC1, 8, 8, data)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			alpha := decoded.NRGBAAt(x, y).A
+			if (img.NRGBAAt(x, y).A >= 128) != (alpha == 255) {
+				t.Fatalf("BC1 alpha at %d,%d is %d", x, y, alpha)
+			}
+		}
+	}
+
+	img = gradient(32, 32)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Pix[y*img.Stride+x*4+3] = uint8(x * 255 / 31)
+		}
+	}
+	for _, format := range []texture.Format{texture.FormatBC3, texture.FormatBC7} {
+		data, _ := texture.Encode(format, img)
+		decoded, _ := texture.Decode(format, 32, 32, data)
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				if d := int(decoded.NRGBAAt(x, y).A) - int(img.NRGBAAt(x, y).A); d < -10 || d > 10 {
+					t.Fatalf("%s alpha at %d,%d off by %d", format, x, y, d)
+				}
+			}
+		}
+	}
+}
+
+func TestBlockCompressionSolid(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for idx := 0; idx < len(img.Pix); idx += 4 {
+		copy(img.Pix[idx:], []uint8{90, 140, 230, 255})
+	}
+	for _, format := range []texture.Format{texture.FormatBC1, texture.FormatBC3, texture.FormatBC7} {
+		data, _ := texture.Encode(format, img)
+		decoded, _ := texture.Decode(format, 4, 4, data)
+		for idx, v := range decoded.Pix {
+			if d := int(v) - int(img.Pix[idx]); d < -4 || d > 4 {
+				t.Fatalf("%s solid block off by %d", format, d)
+			}
+		}
+	}
+}
+
+func TestDDSRoundTrip(t *testing.T) {
+	for _, format := range []texture.Format{texture.FormatRGBA8, texture.FormatBC1, texture.FormatBC7} {
+		tex, err := texture.FromImage(gradient(20, 12), texture.Configuration{
+			Format: format,
+			SRGB:   true,
+			Filter: texture.FilterKaiser,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tex.Levels) != 5 {
+			t.Fatalf("%s: expected a full chain, got %d levels", format, len(tex.Levels))
+		}
+
+		var buf bytes.Buffer
+		if err := texture.WriteDDS(&buf, tex); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 4+124+20+tex.Size() {
+			t.Fatalf("%s: unexpected file size %d", format, buf.Len())
+		}
+		read, err := texture.ReadDDS(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Format != format || !read.SRGB || read.Width != 20 || read.Height != 12 || len(read.Levels) != len(tex.Levels) {
+			t.Fatalf("%s: header did not survive: %+v", format, read)
+		}
+		for level := range tex.Levels {
+			if !bytes.Equal(tex.Levels[level], read.Levels[level]) {
+				t.Fatalf("%s: level %d differs", format, level)
+			}
+		}
+	}
+
+	if _, err := texture.FromImage(gradient(4, 4), texture.Configuration{Format: texture.FormatBC5, SRGB: true}); err != texture.ErrNoSRGB {
+		t.Fatalf("BC5 has no sRGB variant, got: %v", err)
+	}
+}
+
+func TestReadLegacyDDS(t *testing.T) {
+	// 2x1 BGRA without alpha and a single level
+	file := make([]byte, 128, 136)
+	put := func(offset int, value uint32) {
+		binary.LittleEndian.PutUint32(file[offset:], value)
+	}
+	copy(file, "DDS ")
+	put(4, 124)
+	put(8, 0x1|0x2|0x4|0x8|0x1000)
+	put(12, 1)
+	put(16, 2)
+	put(20, 8)
+	put(76, 32)
+	put(80, 0x40)
+	put(88, 32)
+	put(92, 0xff0000)
+	put(96, 0xff00)
+	put(100, 0xff)
+	put(108, 0x1000)
+	file = append(file, 1, 2, 3, 0, 4, 5, 6, 0)
+
+	tex, err := texture.ReadDDS(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex.Format != texture.FormatRGBA8 || tex.SRGB || len(tex.Levels) != 1 {
+		t.Fatalf("bad texture: %+v", tex)
+	}
+	if !bytes.Equal(tex.Levels[0], []byte{3, 2, 1, 255, 6, 5, 4, 255}) {
+		t.Fatalf("channels were not reordered: %v", tex.Levels[0])
+	}
+
+	if _, err := texture.ReadDDS(bytes.NewReader(file[:100])); err == nil {
+		t.Fatal("expected an error on a truncated header")
+	}
+	if _, err := texture.ReadDDS(bytes.NewReader(file[:130])); err == nil {
+		t.Fatal("expected an error on truncated texels")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	tex, err := texture.FromImage(gradient(8, 8), texture.Configuration{Format: texture.FormatBC3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba, err := tex.Decompress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rgba.Format != texture.FormatRGBA8 || len(rgba.Levels) != 4 {
+		t.Fatalf("bad decompressed texture: %v, %d levels", rgba.Format, len(rgba.Levels))
+	}
+	for level := range rgba.Levels {
+		width, height := rgba.LevelSize(level)
+		if len(rgba.Levels[level]) != width*height*4 {
+			t.Fatalf("level %d has the wrong size", level)
+		}
+	}
+}
@@ -122,13 +122,37 @@ func (b *Builder) WriteTo(w io.Writer) (int64, error) {
 		})
 	}
 
-	// Write the magic letters and the approximate size of the header
-	var offset int64
-	magicSize, err := w.Write([]byte("KAR\x00"))
+	// The space for the header is the size of it encoded with the
+	// largest offsets, gob encodes smaller numbers in fewer bytes
+	reserved, err := gobEncode(header)
 	if err != nil {
 		return 0, err
 	}
-	headerBytesSize := header.MaxExpectedSize()
+	headerBytesSize := int64(len(reserved))
+
+	// the offset at which we start writing files
+	magic := []byte("KAR\x00")
+	offset := int64(len(magic)) + HeaderSizeNumberLength + headerBytesSize
+
+	// figure out files offsets
+	for idx := range header.Index {
+		header.Index[idx].Offset = offset
+		offset += header.Index[idx].CompressedSize
+	}
+
+	// encode completed header
+	rawHeader, err := gobEncode(header)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(rawHeader)) > headerBytesSize {
+		return 0, ErrHeaderSize
+	}
+
+	// Write the magic letters and the size of the header
+	if _, err := w.Write(magic); err != nil {
+		return 0, err
+	}
 	headerSizeBytesWritten, err := w.Write(int64ToBinary(headerBytesSize))
 	if err != nil {
 		return 0, err
@@ -141,26 +165,13 @@ func (b *Builder) WriteTo(w io.Writer) (int64, error) {
 		}
 	}
 
-	// the offset at which we start writing files
-	offset += int64(magicSize)
-	offset += int64(HeaderSizeNumberLength)
-	offset += headerBytesSize
-
-	// figure out files offsets
-	for idx := range header.Index {
-		header.Index[idx].Offset = offset
-		offset += header.Index[idx].CompressedSize
+	// write the header and the padding
+	if _, err := w.Write(rawHeader); err != nil {
+		return 0, err
 	}
-
-	// encode and write completed header
-	rawHeader, err := gobEncode(header)
-	if err != nil {
+	if _, err := w.Write(make([]byte, int(headerBytesSize)-len(rawHeader))); err != nil {
 		return 0, err
 	}
-	w.Write(rawHeader)
-
-	// write the padding
-	w.Write(make([]byte, int(headerBytesSize)-len(rawHeader)))
 
 	// write out all the files
 	// order should be preserved beforehand,
@@ -27,6 +27,7 @@ var (
 	ErrFileFormat = errors.New("corrupted or not a kar archive")
 	ErrTempFail   = errors.New("temporary folder or file operation failed")
 	ErrIOMisc     = errors.New("some unknown error unhandled by the io occured")
+	ErrHeaderSize = errors.New("header does not fit the space reserved for it")
 )
 
 // Sizes relevant to the header of file
@@ -52,9 +53,8 @@ type Header struct {
 }
 
 // MaxExpectedSize calculates the amount of space a Header could take.
-// It's important to know this before writing the header into the file.
-// It only needs to be roughtly correct, offsets will be calculated
-// with consideration for this number
+// It's only roughtly correct, the Builder reserves the space of the
+// header by encoding it
 func (h *Header) MaxExpectedSize() int64 {
 	var size int64
 	size += int64(len(h.Author))
@@ -7,6 +7,7 @@ package kar_test
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -93,3 +94,65 @@ func TestCreateAndReadAll(t *testing.T) {
 		t.Error("test string does not match up")
 	}
 }
+
+func TestCreateSingleFile(t *testing.T) {
+	builder, err := kar.NewBuilder(kar.Header{
+		Author:  "devblok",
+		Version: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.Add("a/rather/long/path/to/the/only/file", bytes.NewReader([]byte(testString1)))
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := builder.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := kar.Open(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ar.ReadAll("a/rather/long/path/to/the/only/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(f) != testString1 {
+		t.Error("test string does not match up")
+	}
+}
+
+func TestCreateManyFiles(t *testing.T) {
+	builder, err := kar.NewBuilder(kar.Header{
+		Author:  strings.Repeat("devblok", 100),
+		Version: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 100)
+	for idx := range names {
+		names[idx] = strings.Repeat("dir/", idx%20) + strconv.Itoa(idx)
+		builder.Add(names[idx], strings.NewReader(names[idx]))
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := builder.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := kar.Open(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		f, err := ar.ReadAll(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(f) != name {
+			t.Fatalf("%s: got %q", name, f)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package watch finds changes to files under directories. It polls the
+// file system instead of relying on notifications of the platform, so it
+// works the same everywhere, but only for as many files as can be
+// looked at every so often. It's meant for development, where assets
+// are reloaded as they're edited.
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op is what happened to a file
+type Op int
+
+// Changes reported by the Watcher
+const (
+	Created Op = iota
+	Modified
+	Removed
+)
+
+// String implements fmt.Stringer
+func (o Op) String() string {
+	switch o {
+	case Created:
+		return "created"
+	case Modified:
+		return "modified"
+	case Removed:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change to a single file
+type Event struct {
+	// Path of the file, the watched directory joined with the
+	// path of the file in it
+	Path string
+	Op   Op
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher creates a Watcher for the files under the
+// directories, the files that are there now are not reported.
+func NewWatcher(dirs ...string) (*Watcher, error) {
+	w := &Watcher{dirs: dirs}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
+
+// Watcher finds the files that were created, modified or removed
+// under directories between polls. Modifications are found by the
+// modification time and size of files. It is safe to use concurrently.
+type Watcher struct {
+	dirs []string
+
+	mutex sync.Mutex
+	files map[string]fileState
+}
+
+// scan finds all the files under the directories
+func (w *Watcher) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	for _, dir := range w.dirs {
+		if err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				// files may be removed while walking
+				if os.IsNotExist(err) && path != dir {
+					return nil
+				}
+				return err
+			}
+			if f.Mode().IsRegular() {
+				files[path] = fileState{modTime: f.ModTime(), size: f.Size()}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Poll returns the changes since the last poll, sorted by path
+func (w *Watcher) Poll() ([]Event, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for path, state := range files {
+		previous, ok := w.files[path]
+		switch {
+		case !ok:
+			events = append(events, Event{Path: path, Op: Created})
+		case !previous.modTime.Equal(state.modTime) || previous.size != state.size:
+			events = append(events, Event{Path: path, Op: Modified})
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			events = append(events, Event{Path: path, Op: Removed})
+		}
+	}
+	w.files = files
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events, nil
+}
+
+// Run polls every interval until done is closed, sending the changes
+// on the returned channel, which is closed when it stops. Errors
+// of polling are sent to errs if it isn't nil.
+func (w *Watcher) Run(interval time.Duration, done <-chan struct{}, errs chan<- error) <-chan Event {
+	events := make(chan Event, 16)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			changes, err := w.Poll()
+			if err != nil {
+				if errs != nil {
+					errs <- err
+				}
+				continue
+			}
+			for _, e := range changes {
+				select {
+				case events <- e:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019 devblok
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devblok/koru/src/utility/watch"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "koruWatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func write(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	kept, changed, removed := filepath.Join(dir, "kept.png"), filepath.Join(dir, "models", "changed.dae"), filepath.Join(dir, "removed.spv")
+	write(t, kept, "kept")
+	write(t, changed, "before")
+	write(t, removed, "removed")
+
+	w, err := watch.NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, err := w.Poll(); err != nil || len(events) != 0 {
+		t.Fatalf("existing files reported: %v, %v", events, err)
+	}
+
+	// same size, so only the time tells it apart
+	write(t, changed, "after!")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "textures", "created.png")
+	write(t, created, "created")
+
+	events, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []watch.Event{
+		{Path: changed, Op: watch.Modified},
+		{Path: removed, Op: watch.Removed},
+		{Path: created, Op: watch.Created},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got: %v", expected, events)
+	}
+	for _, e := range expected {
+		found := false
+		for _, got := range events {
+			found = found || got == e
+		}
+		if !found {
+			t.Fatalf("%s was not %s, got: %v", e.Path, e.Op, events)
+		}
+	}
+
+	if events, _ := w.Poll(); len(events) != 0 {
+		t.Fatalf("changes reported twice: %v", events)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	w, err := watch.NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	events := w.Run(10*time.Millisecond, done, nil)
+
+	path := filepath.Join(dir, "main.frag.spv")
+	write(t, path, "spirv")
+	select {
+	case e := <-events:
+		if e.Path != path || e.Op != watch.Created {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change was never reported")
+	}
+
+	close(done)
+	for range events {
+	}
+}
+
+func TestWatcherMissing(t *testing.T) {
+	if _, err := watch.NewWatcher(filepath.Join(os.TempDir(), "koru-does-not-exist")); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}